@@ -7,4 +7,5 @@ require (
 	github.com/liangdas/mqant v1.3.4
 	github.com/pkg/errors v0.8.1
 	github.com/yireyun/go-queue v0.0.0-20180809062148-5e6897360dac
+	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4
 )
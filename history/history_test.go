@@ -0,0 +1,90 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package history
+
+import (
+	"github.com/liangdas/mqant-modules/room"
+	"github.com/liangdas/mqant/rpc/util"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	bus := room.NewEventBus()
+	store := NewMemoryStore(2)
+	recorder := NewRecorder(bus, store, 16)
+	defer recorder.Close()
+	for i := 1; i <= 3; i++ {
+		bus.Publish(&room.RoomEvent{
+			Type:    room.EventTableSettled,
+			TableId: "t" + strconv.Itoa(i),
+			Data: []*room.PlayerResult{
+				{UserId: "u1", Rank: 1, Score: int64(10 * i)},
+				{UserId: "u2", Rank: 2, Score: int64(-10 * i)},
+			},
+		})
+	}
+	//其他节点转发过来的结算不重复记录
+	bus.Publish(&room.RoomEvent{Type: room.EventTableSettled, TableId: "remote", Node: "n2"})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		records, _ := store.Recent("u2", 0)
+		if len(records) == 2 && records[0].TableId == "t3" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	records, err := store.Recent("u2", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].TableId != "t3" || records[1].Score != -20 {
+		t.Fatalf("unexpected records %+v", records)
+	}
+	records, _ = store.Recent("u1", 1)
+	if len(records) != 1 || records[0].Score != 30 {
+		t.Fatalf("unexpected records %+v", records)
+	}
+}
+
+func TestUserRecentRPCArgs(t *testing.T) {
+	store := NewMemoryStore(4)
+	store.Append("u1", &Record{TableId: "t1"})
+	store.Append("u1", &Record{TableId: "t2"})
+	history := &History{store: store}
+	//按mqant RPC的方式编码和解码参数后调用
+	in := []reflect.Value{}
+	for _, arg := range []interface{}{"u1", int64(1)} {
+		argsType, bytes, err := argsutil.ArgsTypeAnd2Bytes(nil, arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := argsutil.Bytes2Args(nil, argsType, bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in = append(in, reflect.ValueOf(value))
+	}
+	out := reflect.ValueOf(history.userRecent).Call(in)
+	if out[1].String() != "" {
+		t.Fatal(out[1].String())
+	}
+	records := out[0].Interface().(map[string]interface{})["Games"].([]*Record)
+	if len(records) != 1 || records[0].TableId != "t2" {
+		t.Fatalf("unexpected records %+v", records)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+/**
+战绩模块,客户端通过HD_Recent查询自己最近的战绩
+战绩由room进程中的Recorder从结算事件写入同一个redis
+*/
+package history
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"github.com/liangdas/mqant/conf"
+	"github.com/liangdas/mqant/gate"
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/module/base"
+	"time"
+)
+
+var Module = func() module.Module {
+	history := new(History)
+	return history
+}
+
+type History struct {
+	basemodule.BaseModule
+	RedisUrl string
+	Size     int   //每个玩家保留的局数
+	TTL      int64 //玩家不再游戏后战绩保留的时间,单位秒
+	pool     *redis.Pool
+	store    Store
+}
+
+func (self *History) GetType() string {
+	//很关键,需要与配置文件中的Module配置对应
+	return "History"
+}
+func (self *History) Version() string {
+	//可以在监控时了解代码版本
+	return "1.0.0"
+}
+func (self *History) OnInit(app module.App, settings *conf.ModuleSettings) {
+	self.BaseModule.OnInit(self, app, settings)
+	self.RedisUrl = self.GetModuleSettings().Settings["RedisUrl"].(string)
+	self.Size = 20
+	if size, ok := self.GetModuleSettings().Settings["Size"]; ok {
+		self.Size = int(size.(float64))
+	}
+	if ttl, ok := self.GetModuleSettings().Settings["TTL"]; ok {
+		self.TTL = int64(ttl.(float64))
+	}
+	self.pool = NewPool(self.RedisUrl)
+	self.store = NewRedisStore(self.pool, self.Size, self.TTL)
+	self.GetServer().RegisterGO("HD_Recent", self.recent)  //客户端查询自己的战绩
+	self.GetServer().RegisterGO("Recent", self.userRecent) //后台模块查询任意玩家的战绩
+}
+
+func (self *History) Run(closeSig chan bool) {
+}
+
+func (self *History) OnDestroy() {
+	self.pool.Close()
+	//一定别忘了关闭RPC
+	self.GetServer().OnDestroy()
+}
+
+/**
+room进程中创建Recorder时使用同样的配置
+*/
+func NewPool(url string) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     10,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(url)
+		},
+	}
+}
+
+/**
+客户端查询最近n局,n为0时返回全部
+*/
+func (self *History) recent(session gate.Session, msg map[string]interface{}) (map[string]interface{}, string) {
+	if session.IsGuest() {
+		return nil, "请先登录"
+	}
+	n := 0
+	if v, ok := msg["n"].(float64); ok {
+		n = int(v)
+	}
+	return self.userRecent(session.GetUserId(), int64(n))
+}
+
+/**
+RPC的整数参数解码为int32/int64,n必须使用int64
+*/
+func (self *History) userRecent(userId string, n int64) (map[string]interface{}, string) {
+	records, err := self.store.Recent(userId, int(n))
+	if err != nil {
+		return nil, err.Error()
+	}
+	return map[string]interface{}{
+		"Games": records,
+	}, ""
+}
@@ -0,0 +1,107 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package history
+
+import (
+	"encoding/json"
+	"github.com/liangdas/mqant-modules/room"
+	"github.com/liangdas/mqant/log"
+)
+
+/**
+订阅Room的结算事件,把每个玩家的结果写入Store
+写入在独立的协成中完成,不会阻塞table
+*/
+type Recorder struct {
+	store   Store
+	pending chan *room.RoomEvent
+	closed  chan bool
+	cancel  func()
+}
+
+/**
+capacity为待写入的结算事件数量,满了之后丢弃
+*/
+func NewRecorder(bus *room.EventBus, store Store, capacity int) *Recorder {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+	recorder := &Recorder{
+		store:   store,
+		pending: make(chan *room.RoomEvent, capacity),
+		closed:  make(chan bool),
+	}
+	recorder.cancel = bus.Subscribe(recorder.onEvent)
+	go recorder.run()
+	return recorder
+}
+
+func (self *Recorder) onEvent(event *room.RoomEvent) {
+	//其他节点的结算由其他节点的Recorder记录
+	if event.Type != room.EventTableSettled || event.Node != "" {
+		return
+	}
+	select {
+	case self.pending <- event:
+	default:
+		log.Warning("history recorder queue full, drop settlement of table %v", event.TableId)
+	}
+}
+
+func (self *Recorder) run() {
+	for {
+		select {
+		case <-self.closed:
+			return
+		case event := <-self.pending:
+			self.record(event)
+		}
+	}
+}
+
+func (self *Recorder) record(event *room.RoomEvent) {
+	results, ok := event.Data.([]*room.PlayerResult)
+	if !ok {
+		//游戏发布的自定义结构,按JSON转换
+		data, err := json.Marshal(event.Data)
+		if err != nil || json.Unmarshal(data, &results) != nil {
+			log.Warning("history unknown settlement data of table %v", event.TableId)
+			return
+		}
+	}
+	for _, result := range results {
+		if result == nil || result.UserId == "" {
+			continue
+		}
+		err := self.store.Append(result.UserId, &Record{
+			TableId:  event.TableId,
+			GameType: event.GameType,
+			Rank:     result.Rank,
+			Score:    result.Score,
+			Extra:    result.Extra,
+			Time:     event.Time,
+		})
+		if err != nil {
+			log.Error("history append %v of table %v error %v", result.UserId, event.TableId, err)
+		}
+	}
+}
+
+/**
+取消订阅,未写入的事件会被丢弃
+*/
+func (self *Recorder) Close() {
+	self.cancel()
+	close(self.closed)
+}
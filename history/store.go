@@ -0,0 +1,141 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"sync"
+)
+
+/**
+玩家一局游戏的战绩
+*/
+type Record struct {
+	TableId  string
+	GameType string
+	Rank     int
+	Score    int64
+	Extra    map[string]interface{} `json:",omitempty"`
+	Time     int64                  //单位毫秒
+}
+
+/**
+战绩存储,每个玩家只保留最近的若干局
+*/
+type Store interface {
+	Append(userId string, record *Record) error
+	//最近的n局,按时间从新到旧
+	Recent(userId string, n int) ([]*Record, error)
+}
+
+/**
+基于redis列表的Store,新战绩从左边插入,超出size的部分被裁掉
+*/
+type RedisStore struct {
+	pool *redis.Pool
+	size int
+	ttl  int64 //列表过期时间,单位秒,0表示不过期
+}
+
+func NewRedisStore(pool *redis.Pool, size int, ttl int64) *RedisStore {
+	if size <= 0 {
+		size = 20
+	}
+	return &RedisStore{
+		pool: pool,
+		size: size,
+		ttl:  ttl,
+	}
+}
+
+func (self *RedisStore) Append(userId string, record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	conn := self.pool.Get()
+	defer conn.Close()
+	key := fmt.Sprintf(UserHistoryFormat, userId)
+	conn.Send("MULTI")
+	conn.Send("LPUSH", key, data)
+	conn.Send("LTRIM", key, 0, self.size-1)
+	if self.ttl > 0 {
+		conn.Send("EXPIRE", key, self.ttl)
+	}
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+func (self *RedisStore) Recent(userId string, n int) ([]*Record, error) {
+	if n <= 0 || n > self.size {
+		n = self.size
+	}
+	conn := self.pool.Get()
+	defer conn.Close()
+	values, err := redis.ByteSlices(conn.Do("LRANGE", fmt.Sprintf(UserHistoryFormat, userId), 0, n-1))
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*Record, 0, len(values))
+	for _, value := range values {
+		record := &Record{}
+		if err := json.Unmarshal(value, record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+/**
+基于内存的Store,主要用于测试
+*/
+type MemoryStore struct {
+	lock    sync.Mutex
+	size    int
+	records map[string][]*Record
+}
+
+func NewMemoryStore(size int) *MemoryStore {
+	if size <= 0 {
+		size = 20
+	}
+	return &MemoryStore{
+		size:    size,
+		records: map[string][]*Record{},
+	}
+}
+
+func (self *MemoryStore) Append(userId string, record *Record) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	records := append([]*Record{record}, self.records[userId]...)
+	if len(records) > self.size {
+		records = records[:self.size]
+	}
+	self.records[userId] = records
+	return nil
+}
+
+func (self *MemoryStore) Recent(userId string, n int) ([]*Record, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	records := self.records[userId]
+	if n > 0 && n < len(records) {
+		records = records[:n]
+	}
+	return append([]*Record{}, records...), nil
+}
@@ -62,3 +62,32 @@ type BasePlayer interface {
 	Session() gate.Session
 	Type() string
 }
+
+/**
+BaseTable的可选接口,QTable实现了该接口
+没有实现时room内部的系统消息以PutQueue的默认优先级放入队列
+*/
+type PriorityTable interface {
+	PutQueueWithPriority(priority int, _func string, params ...interface{}) error
+}
+
+/**
+BasePlayer的可选接口,BasePlayerImp实现了该接口,返回Bind时缓存的session字段
+没有实现时每次从Session()读取,见PlayerSession
+*/
+type SessionPlayer interface {
+	UserId() string
+	SessionId() string
+	ServerId() string
+	IsGuest() bool
+	Locale() string
+	ClientVersion() string
+	Platform() string
+}
+
+/**
+BasePlayer的可选接口,Bind时客户端上报的能力,见PlayerCapabilities
+*/
+type CapablePlayer interface {
+	Capabilities() Capabilities
+}
@@ -0,0 +1,125 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/gate"
+	"strconv"
+	"sync"
+)
+
+//登录时写入session settings的玩家属性,用于准入检查
+const (
+	SessionLevel  = "level"
+	SessionRegion = "region"
+)
+
+/**
+table准入规则
+Deny优先于Allow,Allow为空表示不限制玩家
+Regions为空表示不限制地区
+*/
+type TableACL struct {
+	Allow       []string
+	Deny        []string
+	MinLevel    int
+	Regions     []string //允许的地区
+	DenyRegions []string //禁止的地区
+}
+
+func aclContains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+检查玩家是否可以加入,返回对应的错误码
+*/
+func (acl *TableACL) Check(session gate.Session) error {
+	if acl == nil {
+		return nil
+	}
+	userId := session.GetUserId()
+	if aclContains(acl.Deny, userId) {
+		return NewError(ErrCodeBanned)
+	}
+	if len(acl.Allow) > 0 && !aclContains(acl.Allow, userId) {
+		return NewError(ErrCodeNotInvited)
+	}
+	settings := session.GetSettings()
+	if acl.MinLevel > 0 {
+		level, _ := strconv.Atoi(settings[SessionLevel])
+		if level < acl.MinLevel {
+			return NewError(ErrCodeLevelTooLow, acl.MinLevel)
+		}
+	}
+	region := settings[SessionRegion]
+	if aclContains(acl.DenyRegions, region) || (len(acl.Regions) > 0 && !aclContains(acl.Regions, region)) {
+		return NewError(ErrCodeRegionRestricted)
+	}
+	return nil
+}
+
+/**
+table的准入控制,大厅可以在任意协成中修改
+*/
+type ACLTable struct {
+	aclLock sync.RWMutex
+	acl     *TableACL
+}
+
+func (this *ACLTable) ACLTableInit(acl *TableACL) {
+	this.acl = acl
+}
+
+func (this *ACLTable) SetACL(acl *TableACL) {
+	this.aclLock.Lock()
+	this.acl = acl
+	this.aclLock.Unlock()
+}
+
+func (this *ACLTable) ACL() *TableACL {
+	this.aclLock.RLock()
+	defer this.aclLock.RUnlock()
+	return this.acl
+}
+
+/**
+在加入流程中调用,没有设置规则时总是允许
+*/
+func (this *ACLTable) CheckJoin(session gate.Session) error {
+	return this.ACL().Check(session)
+}
+
+/**
+大厅动态修改table的准入规则
+*/
+func (self *Room) SetTableACL(tableId string, acl *TableACL) error {
+	value, ok := self.tables.Load(tableId)
+	if !ok {
+		return NewError(ErrCodeTableNotFound)
+	}
+	table, ok := value.(interface {
+		SetACL(acl *TableACL)
+	})
+	if !ok {
+		return NewError(ErrCodeUnknown)
+	}
+	table.SetACL(acl)
+	return nil
+}
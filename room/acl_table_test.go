@@ -0,0 +1,60 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+)
+
+func newACLSession(userId string, level string, region string) *BotSession {
+	session := NewNullSession(userId)
+	session.SetSettings(map[string]string{SessionLevel: level, SessionRegion: region})
+	return session
+}
+
+func TestTableACL(t *testing.T) {
+	var acl *TableACL
+	assertEqual(t, acl.Check(newACLSession("u1", "", "")), nil)
+
+	acl = &TableACL{Allow: []string{"u1", "u2"}, Deny: []string{"u2"}}
+	assertEqual(t, acl.Check(newACLSession("u1", "", "")), nil)
+	//Deny优先于Allow
+	assertEqual(t, ErrorCode(acl.Check(newACLSession("u2", "", ""))), ErrCodeBanned)
+	assertEqual(t, ErrorCode(acl.Check(newACLSession("u3", "", ""))), ErrCodeNotInvited)
+
+	acl = &TableACL{MinLevel: 10}
+	assertEqual(t, ErrorCode(acl.Check(newACLSession("u1", "9", ""))), ErrCodeLevelTooLow)
+	assertEqual(t, ErrorCode(acl.Check(newACLSession("u1", "", ""))), ErrCodeLevelTooLow)
+	assertEqual(t, acl.Check(newACLSession("u1", "10", "")), nil)
+
+	acl = &TableACL{Regions: []string{"cn", "sg"}, DenyRegions: []string{"sg"}}
+	assertEqual(t, acl.Check(newACLSession("u1", "", "cn")), nil)
+	assertEqual(t, ErrorCode(acl.Check(newACLSession("u1", "", "sg"))), ErrCodeRegionRestricted)
+	assertEqual(t, ErrorCode(acl.Check(newACLSession("u1", "", "us"))), ErrCodeRegionRestricted)
+	assertEqual(t, ErrorCode(acl.Check(newACLSession("u1", "", ""))), ErrCodeRegionRestricted)
+	acl = &TableACL{DenyRegions: []string{"sg"}}
+	assertEqual(t, acl.Check(newACLSession("u1", "", "us")), nil)
+}
+
+func TestSetTableACL(t *testing.T) {
+	room := NewRoom(nil)
+	table, _ := room.CreateById(nil, "t1", newBenchTable)
+	table.Run()
+	assertEqual(t, ErrorCode(room.SetTableACL("t2", &TableACL{})), ErrCodeTableNotFound)
+	assertEqual(t, room.SetTableACL("t1", &TableACL{Deny: []string{"u1"}}), nil)
+	_, err := room.JoinTable(NewNullSession("u1"), "t1", nil)
+	assertEqual(t, ErrorCode(err), ErrCodeBanned)
+	assertEqual(t, room.SetTableACL("t1", nil), nil)
+	assertEqual(t, room.checkJoin("t1", table, NewNullSession("u1")), nil)
+}
@@ -0,0 +1,157 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"sync"
+)
+
+/**
+带版本号的属性值,每次修改都会得到table内单调递增的新版本号
+删除后重新创建也不会重复使用旧版本号
+*/
+type Attribute struct {
+	Value   interface{}
+	Version int64
+	size    int64
+}
+
+/**
+table共享属性,协成安全
+外部模块(RPC)通过CompareAndSetAttr做乐观并发修改,不会与table协成产生竞争
+*/
+type AttributeTable struct {
+	attrLock  sync.RWMutex
+	attrs     map[string]*Attribute
+	attrSeq   int64
+	attrBytes int64 //所有属性的估算大小
+	quota     *Quota
+}
+
+/**
+quota 可以为nil,为nil时不限制属性大小
+*/
+func (this *AttributeTable) AttributeTableInit(quota *Quota) {
+	this.attrs = map[string]*Attribute{}
+	this.attrBytes = 0
+	this.quota = quota
+}
+
+/**
+返回属性值和版本号,不存在时ok为false
+*/
+func (this *AttributeTable) GetAttr(key string) (value interface{}, version int64, ok bool) {
+	this.attrLock.RLock()
+	defer this.attrLock.RUnlock()
+	attr, ok := this.attrs[key]
+	if !ok {
+		return nil, 0, false
+	}
+	return attr.Value, attr.Version, true
+}
+
+/**
+无条件设置属性,返回新的版本号
+超过Quota时返回ErrCodeQuotaExceeded,属性保持不变
+*/
+func (this *AttributeTable) SetAttr(key string, value interface{}) (int64, error) {
+	this.attrLock.Lock()
+	defer this.attrLock.Unlock()
+	size := approxSize(value)
+	if err := this.checkAttrQuota(key, size); err != nil {
+		return this.versionOf(key), err
+	}
+	return this.setAttr(key, value, size), nil
+}
+
+/**
+仅当当前版本号等于expect时才修改,expect为0表示属性必须不存在
+版本不一致时返回ErrCodeVersionConflict,调用方应重新读取后重试
+*/
+func (this *AttributeTable) CompareAndSetAttr(key string, expect int64, value interface{}) (int64, error) {
+	this.attrLock.Lock()
+	defer this.attrLock.Unlock()
+	if current := this.versionOf(key); current != expect {
+		return current, NewError(ErrCodeVersionConflict)
+	}
+	size := approxSize(value)
+	if err := this.checkAttrQuota(key, size); err != nil {
+		return expect, err
+	}
+	return this.setAttr(key, value, size), nil
+}
+
+/**
+仅当当前版本号等于expect时才删除
+*/
+func (this *AttributeTable) CompareAndDeleteAttr(key string, expect int64) error {
+	this.attrLock.Lock()
+	defer this.attrLock.Unlock()
+	if current := this.versionOf(key); current != expect {
+		return NewError(ErrCodeVersionConflict)
+	}
+	this.deleteAttr(key)
+	return nil
+}
+
+func (this *AttributeTable) DeleteAttr(key string) {
+	this.attrLock.Lock()
+	this.deleteAttr(key)
+	this.attrLock.Unlock()
+}
+
+/**
+所有属性的副本
+*/
+func (this *AttributeTable) Attrs() map[string]Attribute {
+	this.attrLock.RLock()
+	defer this.attrLock.RUnlock()
+	attrs := make(map[string]Attribute, len(this.attrs))
+	for k, v := range this.attrs {
+		attrs[k] = *v
+	}
+	return attrs
+}
+
+func (this *AttributeTable) versionOf(key string) int64 {
+	if attr, ok := this.attrs[key]; ok {
+		return attr.Version
+	}
+	return 0
+}
+
+func (this *AttributeTable) setAttr(key string, value interface{}, size int64) int64 {
+	if this.attrs == nil {
+		this.attrs = map[string]*Attribute{}
+	}
+	attr, ok := this.attrs[key]
+	if !ok {
+		attr = &Attribute{}
+		this.attrs[key] = attr
+		this.attrBytes += int64(len(key)) + 16
+	}
+	this.attrSeq++
+	this.attrBytes += size - attr.size
+	attr.Value = value
+	attr.Version = this.attrSeq
+	attr.size = size
+	return attr.Version
+}
+
+func (this *AttributeTable) deleteAttr(key string) {
+	if attr, ok := this.attrs[key]; ok {
+		this.attrBytes -= attr.size + int64(len(key)) + 16
+		delete(this.attrs, key)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestAttributeCompareAndSet(t *testing.T) {
+	table := &AttributeTable{}
+	table.AttributeTableInit(nil)
+	v1, err := table.CompareAndSetAttr("pot", 0, 100)
+	assertEqual(t, err, nil)
+	//属性已存在时不能按不存在创建,返回当前版本
+	current, err := table.CompareAndSetAttr("pot", 0, 200)
+	assertEqual(t, ErrorCode(err), ErrCodeVersionConflict)
+	assertEqual(t, current, v1)
+
+	v2, err := table.CompareAndSetAttr("pot", v1, 150)
+	assertEqual(t, err, nil)
+	_, err = table.CompareAndSetAttr("pot", v1, 300)
+	assertEqual(t, ErrorCode(err), ErrCodeVersionConflict)
+	value, version, _ := table.GetAttr("pot")
+	assertEqual(t, value, 150)
+	assertEqual(t, version, v2)
+
+	assertEqual(t, ErrorCode(table.CompareAndDeleteAttr("pot", v1)), ErrCodeVersionConflict)
+	assertEqual(t, table.CompareAndDeleteAttr("pot", v2), nil)
+	//删除后重新创建不会重复使用旧版本号
+	v3, err := table.CompareAndSetAttr("pot", 0, 1)
+	assertEqual(t, err, nil)
+	assertEqual(t, v3 > v2, true)
+}
+
+func TestAttributeConcurrentCompareAndSet(t *testing.T) {
+	table := &AttributeTable{}
+	table.AttributeTableInit(nil)
+	table.SetAttr("count", 0)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; {
+				value, version, _ := table.GetAttr("count")
+				if _, err := table.CompareAndSetAttr("count", version, value.(int)+1); err != nil {
+					continue
+				}
+				n++
+			}
+		}()
+	}
+	wg.Wait()
+	//冲突的修改重试后全部生效
+	value, _, _ := table.GetAttr("count")
+	assertEqual(t, value, 800)
+}
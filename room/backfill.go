@@ -0,0 +1,100 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/gate"
+)
+
+//中途加入的消息在队列中的函数名
+const BackfillQueueFunc = "Room.Backfill"
+
+//默认下发完整状态的topic
+const BackfillTopic = "Room/Backfill"
+
+/**
+中途加入(补位),用于休闲模式中替换离开的玩家
+*/
+type BackfillOptions struct {
+	//由游戏判断是否接纳,接纳时把玩家放到座位上并返回,拒绝时返回错误
+	Admit func(table BaseTable, session gate.Session) (BasePlayer, error)
+	//返回给新加入玩家的完整状态
+	State func(table BaseTable, player BasePlayer) ([]byte, error)
+	Topic string //下发完整状态的topic,默认BackfillTopic
+}
+
+func (this *QTable) backfill(session gate.Session) (BasePlayer, error) {
+	opts := this.opts.Backfill
+	if opts == nil || opts.Admit == nil {
+		return nil, NewError(ErrCodeStateInvalid)
+	}
+	if player := this.FindPlayer(session); player != nil {
+		return nil, NewError(ErrCodeStateInvalid)
+	}
+	player, err := opts.Admit(this.BaseTableImp.subtable, session)
+	if err != nil {
+		return nil, err
+	}
+	if player == nil {
+		return nil, NewError(ErrCodeTableFull)
+	}
+	if !player.IsBind() {
+		player.Bind(session)
+	}
+	this.SyncSession(session, map[string]string{SessionTableId: this.TableId()})
+	if opts.State != nil {
+		body, err := opts.State(this.BaseTableImp.subtable, player)
+		if err != nil {
+			return player, err
+		}
+		topic := opts.Topic
+		if topic == "" {
+			topic = BackfillTopic
+		}
+		if err := this.SendCallBackMsgNR([]string{PlayerSession(player).SessionId()}, topic, body); err != nil {
+			return player, err
+		}
+	}
+	return player, nil
+}
+
+func (this *QTable) onBackfill(session gate.Session, call *tableCall) {
+	if !call.start() {
+		return
+	}
+	defer call.recoverPanic()
+	player, err := this.backfill(session)
+	call.finish(player, err)
+}
+
+/**
+把玩家加入进行中的table,table没有设置Backfill时返回ErrCodeStateInvalid
+与JoinTable一样检查维护状态和准入规则,等待超时后table不会再让玩家入座
+加入成功后绑定TableLocator,断线后可以通过Rejoin回到该table
+*/
+func (self *Room) Backfill(tableId string, session gate.Session) (BasePlayer, error) {
+	table := self.GetTable(tableId)
+	if table == nil {
+		return nil, NewError(ErrCodeTableNotFound)
+	}
+	if err := self.checkJoin(tableId, table, session); err != nil {
+		return nil, err
+	}
+	result, err := self.callTable(table, PriorityAction, self.opts.RPCTimeout, BackfillQueueFunc, session)
+	player, _ := result.(BasePlayer)
+	if player != nil && !session.IsGuest() {
+		self.opts.Locator.Bind(session.GetUserId(), tableId)
+	}
+	return player, err
+}
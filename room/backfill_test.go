@@ -0,0 +1,106 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/gate"
+	"github.com/liangdas/mqant/module"
+	"testing"
+	"time"
+)
+
+func TestBackfill(t *testing.T) {
+	table := &benchTable{seats: map[string]BasePlayer{}}
+	synced := []string{}
+	err := table.OnInit(table,
+		TableId("backfill"),
+		Capaciity(16),
+		SendMsgCapaciity(16),
+		RunInterval(time.Hour),
+		Backfill(&BackfillOptions{
+			Admit: func(_ BaseTable, session gate.Session) (BasePlayer, error) {
+				if len(table.seats) >= 2 {
+					return nil, NewError(ErrCodeTableFull)
+				}
+				player := &BasePlayerImp{}
+				player.Bind(session)
+				table.seats[session.GetUserId()] = player
+				return player, nil
+			},
+			State: func(_ BaseTable, player BasePlayer) ([]byte, error) {
+				synced = append(synced, PlayerSession(player).UserId())
+				return []byte("{}"), nil
+			},
+		}),
+	)
+	assertEqual(t, err, nil)
+
+	player, err := table.backfill(NewNullSession("p1"))
+	assertEqual(t, err, nil)
+	assertEqual(t, PlayerSession(player).UserId(), "p1")
+	assertEqual(t, len(synced), 1)
+
+	//已经在座位上的玩家不能再次加入
+	_, err = table.backfill(NewNullSession("p1"))
+	assertEqual(t, ErrorCode(err), ErrCodeStateInvalid)
+
+	table.backfill(NewNullSession("p2"))
+	_, err = table.backfill(NewNullSession("p3"))
+	assertEqual(t, ErrorCode(err), ErrCodeTableFull)
+	assertEqual(t, len(synced), 2)
+}
+
+func TestRoomBackfill(t *testing.T) {
+	admitted := []string{}
+	room := NewRoom(nil, RPCTimeout(10*time.Millisecond))
+	table, err := room.CreateById(nil, "backfill", func(_ module.RPCModule, tableId string) (BaseTable, error) {
+		table := &benchTable{seats: map[string]BasePlayer{}}
+		err := table.OnInit(table,
+			TableId(tableId),
+			Capaciity(16),
+			SendMsgCapaciity(16),
+			RunInterval(time.Hour),
+			SetScheduler(benchScheduler, 0, 0),
+			Backfill(&BackfillOptions{
+				Admit: func(_ BaseTable, session gate.Session) (BasePlayer, error) {
+					admitted = append(admitted, session.GetUserId())
+					player := &BasePlayerImp{}
+					player.Bind(session)
+					table.seats[session.GetUserId()] = player
+					return player, nil
+				},
+			}),
+		)
+		return table, err
+	})
+	assertEqual(t, err, nil)
+	table.Run()
+
+	assertEqual(t, room.SetTableACL("backfill", &TableACL{Deny: []string{"banned"}}), nil)
+	_, err = room.Backfill("backfill", NewNullSession("banned"))
+	assertEqual(t, ErrorCode(err), ErrCodeBanned)
+
+	room.Pause(time.Hour, "")
+	_, err = room.Backfill("backfill", NewNullSession("p1"))
+	assertEqual(t, ErrorCode(err), ErrCodeMaintenance)
+	room.Resume("")
+
+	//等待超时后table不再让玩家入座
+	_, err = room.Backfill("backfill", NewNullSession("p1"))
+	assertEqual(t, err != nil, true)
+	table.(*benchTable).ExecuteEvent(nil)
+	assertEqual(t, len(admitted), 0)
+	_, ok := room.Locator().Locate("p1")
+	assertEqual(t, ok, false)
+}
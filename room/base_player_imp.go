@@ -18,10 +18,22 @@ import (
 	"time"
 )
 
+//客户端在登录时写入session settings的版本号
+const SessionClientVersion = "version"
+
 type BasePlayerImp struct {
 	session      gate.Session
 	lastNewsDate int64 //玩家最后一次成功通信时间	单位秒
 	body         interface{}
+	capabilities Capabilities
+	//Bind时缓存的session字段,热路径上不再调用session的getter
+	userId        string
+	sessionId     string
+	serverId      string
+	guest         bool
+	locale        string
+	clientVersion string
+	platform      string
 }
 
 func (self *BasePlayerImp) Type() string {
@@ -39,14 +51,49 @@ func (self *BasePlayerImp) IsBind() bool {
 func (self *BasePlayerImp) Bind(session gate.Session) BasePlayer {
 	self.lastNewsDate = time.Now().Unix()
 	self.session = session
+	self.RefreshSession()
 	return self
 }
 
+/**
+重新读取session缓存的字段
+session settings在Bind之后被修改时(例如切换语言)由table主动调用
+*/
+func (self *BasePlayerImp) RefreshSession() {
+	session := self.session
+	if session == nil {
+		self.userId, self.sessionId, self.serverId = "", "", ""
+		self.guest = false
+		self.locale, self.clientVersion, self.platform = "", "", ""
+		return
+	}
+	self.userId = session.GetUserId()
+	self.sessionId = session.GetSessionId()
+	self.serverId = session.GetServerId()
+	self.guest = session.IsGuest()
+	settings := session.GetSettings()
+	self.capabilities = ParseCapabilities(settings)
+	self.locale = settings[SessionLocale]
+	self.clientVersion = settings[SessionClientVersion]
+	self.platform = settings[SessionPlatform]
+}
+
+/**
+session变化时(断线重连后换了网关或session)刷新缓存
+同一个session之后绑定了userId(游客登录)时也要刷新
+*/
+func (self *BasePlayerImp) rebind(session gate.Session) {
+	self.session = session
+	if session == nil || session.GetSessionId() != self.sessionId || session.GetServerId() != self.serverId || session.GetUserId() != self.userId {
+		self.RefreshSession()
+	}
+}
+
 /**
 玩家主动发请求时间
 */
 func (self *BasePlayerImp) OnRequest(session gate.Session) {
-	self.session = session
+	self.rebind(session)
 	self.lastNewsDate = time.Now().Unix()
 }
 
@@ -54,7 +101,7 @@ func (self *BasePlayerImp) OnRequest(session gate.Session) {
 服务器主动发送消息给客户端的时间
 */
 func (self *BasePlayerImp) OnResponse(session gate.Session) {
-	self.session = session
+	self.rebind(session)
 	self.lastNewsDate = time.Now().Unix()
 }
 
@@ -72,3 +119,116 @@ func (self *BasePlayerImp) SetBody(body interface{}) {
 func (self *BasePlayerImp) Session() gate.Session {
 	return self.session
 }
+
+/**
+Bind时客户端上报的能力,与服务器协商见BaseTableImp.PlayerCapabilities
+*/
+func (self *BasePlayerImp) Capabilities() Capabilities {
+	return self.capabilities
+}
+
+func (self *BasePlayerImp) SetCapabilities(capabilities Capabilities) {
+	self.capabilities = capabilities
+}
+
+func (self *BasePlayerImp) UserId() string {
+	return self.userId
+}
+
+func (self *BasePlayerImp) SessionId() string {
+	return self.sessionId
+}
+
+func (self *BasePlayerImp) ServerId() string {
+	return self.serverId
+}
+
+func (self *BasePlayerImp) IsGuest() bool {
+	return self.guest
+}
+
+func (self *BasePlayerImp) Locale() string {
+	return self.locale
+}
+
+func (self *BasePlayerImp) ClientVersion() string {
+	return self.clientVersion
+}
+
+func (self *BasePlayerImp) Platform() string {
+	return self.platform
+}
+
+/**
+玩家的session字段,player实现了SessionPlayer时使用缓存,否则从Session()读取
+*/
+func PlayerSession(player BasePlayer) SessionPlayer {
+	if cached, ok := player.(SessionPlayer); ok {
+		return cached
+	}
+	return sessionFields{player.Session()}
+}
+
+/**
+玩家上报的客户端能力,player没有实现CapablePlayer时从Session()的settings解析
+*/
+func PlayerCapabilities(player BasePlayer) Capabilities {
+	if capable, ok := player.(CapablePlayer); ok {
+		return capable.Capabilities()
+	}
+	if session := player.Session(); session != nil {
+		return ParseCapabilities(session.GetSettings())
+	}
+	return Capabilities{}
+}
+
+/**
+直接从session读取的SessionPlayer,session为nil时返回零值
+*/
+type sessionFields struct {
+	session gate.Session
+}
+
+func (s sessionFields) UserId() string {
+	if s.session == nil {
+		return ""
+	}
+	return s.session.GetUserId()
+}
+
+func (s sessionFields) SessionId() string {
+	if s.session == nil {
+		return ""
+	}
+	return s.session.GetSessionId()
+}
+
+func (s sessionFields) ServerId() string {
+	if s.session == nil {
+		return ""
+	}
+	return s.session.GetServerId()
+}
+
+func (s sessionFields) IsGuest() bool {
+	return s.session != nil && s.session.IsGuest()
+}
+
+func (s sessionFields) Locale() string {
+	return s.setting(SessionLocale)
+}
+
+func (s sessionFields) ClientVersion() string {
+	return s.setting(SessionClientVersion)
+}
+
+func (s sessionFields) Platform() string {
+	return s.setting(SessionPlatform)
+}
+
+func (s sessionFields) setting(key string) string {
+	if s.session == nil {
+		return ""
+	}
+	return s.session.Get(key)
+}
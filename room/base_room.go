@@ -16,22 +16,57 @@ package room
 import (
 	"github.com/liangdas/mqant/module"
 	"sync"
+	"text/template"
+	"time"
 )
 
 type Room struct {
-	module module.RPCModule
-	tables sync.Map
-	roomId int
+	module           module.RPCModule
+	tables           sync.Map
+	gameTypes        sync.Map //tableId->游戏类型
+	roomId           int
+	opts             RoomOptions
+	broadcastLimiter *rateLimiter
+	spectatorLimiter *keyedRateLimiter
+	templates        map[string]*template.Template
+	templatesLock    sync.Mutex
+	maintenanceLock  sync.Mutex
+	maintenance      bool
+	maintenanceGen   int64 //每次Pause/Resume加1,用来丢弃过期的暂停定时器
+	pauseTimer       *time.Timer
+	watchdogState    *watchdogState
+	memoryGuardState *memoryGuardState
+	loadShedState    *loadShedState
+	events           *EventBus
 }
 
 type NewTableFunc func(module module.RPCModule, tableId string) (BaseTable, error)
 
-func NewRoom(module module.RPCModule) *Room {
+func NewRoom(module module.RPCModule, opts ...RoomOption) *Room {
 	room := &Room{
-		module: module,
+		module:    module,
+		opts:      newRoomOptions(opts...),
+		templates: map[string]*template.Template{},
+		events:    NewEventBus(),
+	}
+	room.events.SetClock(room.opts.Clock)
+	room.broadcastLimiter = newRateLimiter(room.opts.Clock, room.opts.BroadcastBurst, room.opts.BroadcastInterval)
+	room.spectatorLimiter = newKeyedRateLimiter(room.opts.Clock, room.opts.SpectatorBurst, room.opts.SpectatorInterval)
+	if room.opts.Watchdog != nil {
+		room.startWatchdog(room.opts.Watchdog)
+	}
+	if room.opts.MemoryGuard != nil {
+		room.startMemoryGuard(room.opts.MemoryGuard)
+	}
+	if room.opts.LoadShedding != nil {
+		room.startLoadShedding(room.opts.LoadShedding)
 	}
 	return room
 }
+
+func (self *Room) Options() RoomOptions {
+	return self.opts
+}
 func (self *Room) RoomId() int {
 	return self.roomId
 }
@@ -41,11 +76,18 @@ func (self *Room) CreateById(module module.RPCModule, tableId string, newTablefu
 		table.(BaseTable).Run()
 		return table.(BaseTable), nil
 	}
+	if self.InMaintenance() {
+		return nil, NewError(ErrCodeMaintenance)
+	}
+	if self.MemoryLevel() >= MemoryHard {
+		return nil, NewError(ErrCodeOverloaded)
+	}
 	table, err := newTablefunc(module, tableId)
 	if err != nil {
 		return nil, err
 	}
 	self.tables.Store(table.TableId(), table)
+	self.PublishEvent(EventTableCreated, table.TableId(), "", nil)
 	return table, nil
 }
 
@@ -57,7 +99,21 @@ func (self *Room) GetTable(tableId string) BaseTable {
 	return nil
 }
 
+/**
+只返回正在运行的table,不会像GetTable那样重新运行已经结束的table,用于只读的调试接口
+*/
+func (self *Room) runningTable(tableId string) BaseTable {
+	if table, ok := self.tables.Load(tableId); ok && table.(BaseTable).Runing() {
+		return table.(BaseTable)
+	}
+	return nil
+}
+
 func (self *Room) DestroyTable(tableId string) error {
+	if _, ok := self.tables.Load(tableId); ok {
+		self.PublishEvent(EventTableDestroyed, tableId, "", nil)
+	}
 	self.tables.Delete(tableId)
-	return nil
+	self.gameTypes.Delete(tableId)
+	return self.opts.Locator.UnbindTable(tableId)
 }
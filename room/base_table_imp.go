@@ -14,9 +14,11 @@
 package room
 
 import (
+	"fmt"
 	"github.com/liangdas/mqant/log"
 	"github.com/liangdas/mqant/module"
 	"github.com/liangdas/mqant/module/modules/timer"
+	"sync"
 	"time"
 )
 
@@ -30,7 +32,28 @@ type QTable struct {
 	QueueTable
 	UnifiedSendMessageTable
 	TimeOutTable
+	ProfileTable
+	StatsTable
+	VoteManager
+	PhaseTable
+	AttributeTable
+	EscrowTable
+	ObserverTable
+	PauseTable
+	TurnTable
+	SessionSyncTable
+	ACLTable
+	TickTable
+	InterestTable
+	WaitQueue
+	CountdownTable
+	DesyncTable
 	last_time_update time.Time
+	lastMemoryCheck  time.Time
+	overSoftBudget   bool
+	hibernateSince   time.Time //MemoryGuard要求休眠的时间
+	freezeSuspended  bool      //InspectFreeze时暂停了计时,解冻时恢复
+	unwatchFlags     func()
 	opts             Options
 }
 
@@ -47,24 +70,70 @@ func (this *QTable) update(arge interface{}) {
 			this.Finish()
 		}
 	}()
-	this.ExecuteEvent(arge) //执行这一帧客户端发送过来的消息
-	if this.opts.Update != nil {
-		this.opts.Update(time.Now().Sub(this.last_time_update))
-	}
-	this.ExecuteCallBackMsg(this.Trace()) //统一发送数据到客户端
-	this.CheckTimeOut()
+	this.DoProfile(func() {
+		this.ExecuteEvent(arge) //执行这一帧客户端发送过来的消息
+		now := this.Clock().Now()
+		if !this.Paused() {
+			this.CheckVotes()
+			this.CheckPhase()
+			this.CheckTurn()
+			this.RunTicks()
+			this.CheckCountdowns()
+			this.CheckStateHash()
+			if this.opts.Update != nil {
+				this.opts.Update(now.Sub(this.last_time_update))
+			}
+		}
+		this.last_time_update = now
+		this.CheckWaiting()
+		this.CheckObservers()
+		this.ExecuteCallBackMsg(this.Trace()) //统一发送数据到客户端
+		if !this.Paused() {
+			this.CheckTimeOut()
+		}
+		this.CheckMemory()
+	})
 	if this.Runing() {
-		timewheel.GetTimeWheel().AddTimer(this.opts.RunInterval, nil, this.update)
+		this.scheduleUpdate()
+	}
+}
+
+/**
+安排下一帧,使用Scheduler时长时间没有消息或被MemoryGuard要求休眠的table按IdleInterval运行
+设置了Tick时按下一个tick的时间提前运行,并且不会休眠
+*/
+func (this *QTable) scheduleUpdate() {
+	interval := this.opts.RunInterval
+	if next := this.NextTickIn(); next >= 0 && next < interval {
+		interval = next
+	}
+	scheduler := this.opts.Scheduler
+	if scheduler == nil {
+		timewheel.GetTimeWheel().AddTimer(interval, nil, this.update)
+		return
+	}
+	job := func() { this.update(nil) }
+	idle := this.forcedHibernate() || this.opts.HibernateAfter > 0 && this.Clock().Now().Sub(this.LastPut()) > this.opts.HibernateAfter
+	if !this.Ticking() && !this.CountingDown() && idle {
+		scheduler.ScheduleIdle(this.TableId(), this.opts.IdleInterval, job)
+	} else {
+		scheduler.Schedule(this.TableId(), interval, job)
 	}
 }
 
 func (this *QTable) OnCreate() {
 	this.ResetTimeOut()
-	this.last_time_update = time.Now()
-	timewheel.GetTimeWheel().AddTimer(this.opts.RunInterval, nil, this.update)
+	this.last_time_update = this.Clock().Now()
+	this.scheduleUpdate()
 }
 
 func (this *QTable) OnDestroy() {
+	this.CloseObservers()
+	this.CloseOutboxes()
+	this.CancelHandlers()
+	if this.unwatchFlags != nil {
+		this.unwatchFlags()
+	}
 	if this.opts.DestroyCallbacks != nil {
 		err := this.opts.DestroyCallbacks(this)
 		if err != nil {
@@ -77,24 +146,70 @@ func (this *QTable) OnInit(subtable SubTable, opts ...Option) error {
 	subtable.GetSeats()
 	subtable.GetModule()
 	this.opts = newOptions(opts...)
-	this.last_time_update = time.Now()
+	this.last_time_update = this.opts.Clock.Now()
 	this.BaseTableImpInit(subtable, opts...)
 	this.QueueInit(opts...)
 	this.UnifiedSendMessageTableInit(subtable, this.opts.SendMsgCapaciity)
+	if this.opts.FlowControl != nil {
+		this.SetFlowControl(this.opts.FlowControl)
+	}
+	this.UnifiedSendMessageTable.chaos = this.opts.Chaos
+	this.Register(BroadcastQueueFunc, this.onBroadcast)
+	this.Register(LocalizedBroadcastQueueFunc, this.onLocalizedBroadcast)
+	this.Register(SegmentedBroadcastQueueFunc, this.onSegmentedBroadcast)
+	this.Register(RejoinQueueFunc, this.onRejoin)
+	this.Register(PauseQueueFunc, this.onPause)
+	this.Register(ResumeQueueFunc, this.onResume)
+	this.Register(MergeOutQueueFunc, this.onMergeOut)
+	this.Register(MergeInQueueFunc, this.onMergeIn)
+	this.Register(MergeDoneQueueFunc, this.onMergeDone)
+	this.Register(InvokeQueueFunc, this.onInvoke)
+	this.Register(DiffQueueFunc, this.onDiff)
+	this.Register(SpectatorChatQueueFunc, this.onSpectatorChat)
+	this.Register(ShedMemoryQueueFunc, this.onShedMemory)
+	this.Register(ReportHashQueueFunc, this.onReportHash)
+	this.Register(PingQueueFunc, this.onPing)
+	this.Register(InspectQueueFunc, this.onInspect)
+	this.Register(BackfillQueueFunc, this.onBackfill)
+	this.Register(FlagsChangedQueueFunc, this.onFlagsChanged)
 	this.TimeOutTableInit(subtable, this.opts.TimeOut)
+	this.ProfileTableInit(this.opts.TableId, this.opts.ProfileLabels)
+	this.StatsTableInit(this.Clock)
+	this.VoteManagerInit(subtable, this.Clock)
+	this.PhaseTableInit(this.Clock)
+	this.AttributeTableInit(&this.opts.Quota)
+	this.EscrowTableInit(this.opts.TableId, this.opts.Wallet, this.opts.EscrowJournal)
+	this.ObserverTableInit(this.Clock, this.opts.ObserverDelay)
+	this.PauseTableInit(this.Clock)
+	this.TurnTableInit(this.Clock)
+	this.SessionSyncTableInit()
+	this.ACLTableInit(this.opts.ACL)
+	this.TickTableInit(this.Clock, this.opts.Tick)
+	this.InterestTableInit(this.opts.InterestFunc, this.SendCallBackMsgNR)
+	this.WaitQueueInit(this.opts.WaitQueue, this.Clock, this.SendCallBackMsgNR)
+	this.CountdownTableInit(this.Clock, this.NotifyCallBackMsgNR, this.PutQueueWithPriority)
+	this.DesyncTableInit(this.opts.Desync, this.Clock, this.NotifyCallBackMsgNR)
+	this.AddGuard(this.PauseGuard)
+	if this.opts.Moderator != nil {
+		this.AddGuard(this.opts.Moderator.MuteGuard)
+	}
+	this.AddGuard(this.PhaseGuard)
+	this.watchFlags()
 	return nil
 }
 
 type BaseTableImp struct {
-	opts     Options
-	trace    log.TraceSpan
-	state    int //当前写的队列
-	subtable BaseTable
+	opts       Options
+	trace      log.TraceSpan
+	stateLock  sync.RWMutex //state可以在其他协成中读取,例如LifecycleWatchdog
+	state      int          //当前写的队列
+	stateSince time.Time
+	subtable   BaseTable
 }
 
 func (this *BaseTableImp) BaseTableImpInit(subtable BaseTable, opts ...Option) {
 	this.opts = newOptions(opts...)
-	this.state = Uninitialized
+	this.setState(Uninitialized)
 	this.subtable = subtable
 	this.trace = log.CreateRootTrace()
 }
@@ -106,6 +221,39 @@ func (this *BaseTableImp) Options() Options {
 func (this *BaseTableImp) TableId() string {
 	return this.opts.TableId
 }
+func (this *BaseTableImp) Clock() Clock {
+	if this.opts.Clock == nil {
+		return RealClock
+	}
+	return this.opts.Clock
+}
+
+/**
+用节点密钥签名结算结果,持久化时应保存返回的SignedResult
+*/
+func (this *BaseTableImp) SignResult(result interface{}) (*SignedResult, error) {
+	signer := this.opts.ResultSigner
+	if signer == nil && this.opts.Webhook != nil {
+		signer = this.opts.Webhook.Signer()
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("table %v has no result signer", this.TableId())
+	}
+	return signer.Sign(this.TableId(), result)
+}
+
+/**
+功能开关是否对本table开启
+*/
+func (this *BaseTableImp) FlagEnabled(flag string) bool {
+	if this.opts.Flags == nil {
+		return false
+	}
+	return this.opts.Flags.IsEnabled(flag, FlagContext{
+		TableId: this.TableId(),
+		Labels:  this.opts.FlagLabels,
+	})
+}
 func (this *BaseTableImp) Trace() log.TraceSpan {
 	return this.trace
 }
@@ -113,8 +261,32 @@ func (this *BaseTableImp) SetTrace(span log.TraceSpan) {
 	this.trace = span
 }
 
+func (this *BaseTableImp) setState(state int) {
+	now := this.Clock().Now()
+	this.stateLock.Lock()
+	this.state = state
+	this.stateSince = now
+	this.stateLock.Unlock()
+}
+
+func (this *BaseTableImp) getState() int {
+	this.stateLock.RLock()
+	defer this.stateLock.RUnlock()
+	return this.state
+}
+
+/**
+当前生命周期状态以及进入该状态的时长,协成安全
+*/
+func (this *BaseTableImp) Lifecycle() (state int, elapsed time.Duration) {
+	now := this.Clock().Now()
+	this.stateLock.RLock()
+	defer this.stateLock.RUnlock()
+	return this.state, now.Sub(this.stateSince)
+}
+
 func (this *BaseTableImp) Runing() bool {
-	if this.state == Active {
+	if this.getState() == Active {
 		return true
 	}
 	return false
@@ -122,24 +294,44 @@ func (this *BaseTableImp) Runing() bool {
 
 //初始化table
 func (this *BaseTableImp) Run() {
-	if this.state != Active {
-		this.state = Initialized
+	if this.getState() != Active {
+		this.setState(Initialized)
 		this.subtable.OnCreate()
-		this.state = Active
+		this.setState(Active)
 	}
 }
 
 //停止table
 func (this *BaseTableImp) Finish() {
-	if this.state == Initialized {
-		this.subtable.OnDestroy()
-		this.state = Finished
-	} else if this.state == Active {
-		this.subtable.OnDestroy()
-		this.state = Finished
-	} else if this.state == Uninitialized {
+	state := this.getState()
+	if state == Finished {
+		return
+	}
+	if state == Initialized || state == Active || state == Uninitialized {
 		this.subtable.OnDestroy()
-		this.state = Finished
+	}
+	this.setState(Finished)
+	//没有结算的托管全部退回,已经开始结算的继续提交,失败时保留日志由RecoverEscrow处理
+	if escrow, ok := this.subtable.(interface {
+		EscrowRelease() error
+	}); ok {
+		if err := escrow.EscrowRelease(); err != nil {
+			log.Error("release escrow of table %v error %v", this.TableId(), err)
+		}
+	}
+	var stats map[string]*PlayerStats
+	if flusher, ok := this.subtable.(interface {
+		FlushStats() map[string]*PlayerStats
+	}); ok {
+		stats = flusher.FlushStats()
+		if this.opts.StatsFlush != nil {
+			this.opts.StatsFlush(this.subtable, stats)
+		}
+	}
+	if this.opts.Webhook != nil {
+		if err := this.opts.Webhook.Publish(WebhookTableFinished, this.TableId(), stats); err != nil {
+			log.Warning("publish %v error %v", WebhookTableFinished, err)
+		}
 	}
 }
 
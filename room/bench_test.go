@@ -0,0 +1,145 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/liangdas/mqant/module"
+	"math"
+	"testing"
+	"time"
+)
+
+var benchScheduler = NewScheduler(1)
+
+type benchTable struct {
+	QTable
+	seats map[string]BasePlayer
+}
+
+func (t *benchTable) GetSeats() map[string]BasePlayer {
+	return t.seats
+}
+
+func (t *benchTable) GetModule() module.RPCModule {
+	return nil
+}
+
+func newBenchTable(module module.RPCModule, tableId string) (BaseTable, error) {
+	t := &benchTable{seats: map[string]BasePlayer{}}
+	for i := 0; i < 4; i++ {
+		player := &BasePlayerImp{}
+		player.Bind(NewNullSession(fmt.Sprintf("%v-p%d", tableId, i)))
+		t.seats[fmt.Sprintf("%d", i)] = player
+	}
+	err := t.OnInit(t,
+		TableId(tableId),
+		Capaciity(1024),
+		SendMsgCapaciity(1024),
+		RunInterval(time.Hour),
+		SetScheduler(benchScheduler, 0, 0),
+	)
+	return t, err
+}
+
+type benchApplier struct {
+	State map[string]int64
+}
+
+func (a *benchApplier) Apply(event *TableEvent) error {
+	a.State[event.Type]++
+	return nil
+}
+
+func (a *benchApplier) Snapshot() ([]byte, error) {
+	return json.Marshal(a.State)
+}
+
+func (a *benchApplier) Restore(snapshot []byte) error {
+	return json.Unmarshal(snapshot, &a.State)
+}
+
+func BenchmarkQueueThroughput(b *testing.B) {
+	q := &QueueTable{}
+	q.QueueInit(Capaciity(1024))
+	q.Register("noop", func(i int) {})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := q.PutQueue("noop", i); err != nil {
+			b.Fatal(err)
+		}
+		if i%512 == 511 {
+			q.ExecuteEvent(nil)
+		}
+	}
+	q.ExecuteEvent(nil)
+}
+
+func BenchmarkBroadcastFanout(b *testing.B) {
+	room := NewRoom(nil, BroadcastRate(math.MaxInt32, 0))
+	tables := []BaseTable{}
+	for i := 0; i < 100; i++ {
+		table, err := room.CreateById(nil, fmt.Sprintf("bench-%d", i), newBenchTable)
+		if err != nil {
+			b.Fatal(err)
+		}
+		table.Run()
+		tables = append(tables, table)
+	}
+	body := []byte(`{"notice":"maintenance in 5 minutes"}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := room.Broadcast("Room/Notice", "", body); err != nil {
+			b.Fatal(err)
+		}
+		for _, table := range tables {
+			t := table.(*benchTable)
+			t.ExecuteEvent(nil)
+			t.ExecuteCallBackMsg(t.Trace())
+		}
+	}
+}
+
+func BenchmarkSnapshotSerialization(b *testing.B) {
+	applier := &benchApplier{State: map[string]int64{}}
+	for i := 0; i < 64; i++ {
+		applier.State[fmt.Sprintf("seat-%d", i)] = int64(i) * 1000
+	}
+	table := &EventSourcedTable{}
+	table.EventSourcedTableInit("bench", applier, 0, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := table.TakeSnapshot(); err != nil {
+			b.Fatal(err)
+		}
+		table.snapshots = table.snapshots[:0]
+	}
+}
+
+func BenchmarkTableCreation(b *testing.B) {
+	room := NewRoom(nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tableId := fmt.Sprintf("create-%d", i)
+		if _, err := room.CreateById(nil, tableId, newBenchTable); err != nil {
+			b.Fatal(err)
+		}
+		room.DestroyTable(tableId)
+	}
+}
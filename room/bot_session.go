@@ -0,0 +1,283 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/liangdas/mqant/gate"
+	"github.com/liangdas/mqant/log"
+	"strconv"
+	"sync"
+)
+
+var _ gate.Session = (*BotSession)(nil)
+
+/**
+不依赖网络连接的gate.Session实现
+可以绑定给服务器机器人,测试用例或者比赛观察者
+发给该session的消息会回调OnMessage,未设置时直接丢弃
+*/
+type BotSession struct {
+	lock          sync.RWMutex
+	ip            string
+	topic         string
+	network       string
+	userId        string
+	sessionId     string
+	serverId      string
+	settings      map[string]string
+	localUserData interface{}
+	judgeGuest    func(session gate.Session) bool
+	trace         log.TraceSpan
+	closed        bool
+	OnMessage     func(topic string, body []byte)
+}
+
+/**
+创建一个机器人session,sessionId随机生成
+*/
+func NewBotSession(userId string, onMessage func(topic string, body []byte)) *BotSession {
+	return &BotSession{
+		userId:    userId,
+		sessionId: "bot-" + GetRandomString(16),
+		network:   "bot",
+		settings:  map[string]string{},
+		OnMessage: onMessage,
+	}
+}
+
+/**
+创建一个丢弃所有消息的session
+*/
+func NewNullSession(userId string) *BotSession {
+	return NewBotSession(userId, nil)
+}
+
+func (self *BotSession) GetIP() string {
+	return self.ip
+}
+func (self *BotSession) GetTopic() string {
+	return self.topic
+}
+func (self *BotSession) GetNetwork() string {
+	return self.network
+}
+func (self *BotSession) GetUserId() string {
+	return self.userId
+}
+func (self *BotSession) GetUserIdInt64() int64 {
+	uid64, err := strconv.ParseInt(self.userId, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return uid64
+}
+func (self *BotSession) GetSessionId() string {
+	return self.sessionId
+}
+func (self *BotSession) GetServerId() string {
+	return self.serverId
+}
+/**
+返回settings的副本,修改副本不会影响session
+*/
+func (self *BotSession) GetSettings() map[string]string {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return copySettings(self.settings)
+}
+func (self *BotSession) LocalUserData() interface{} {
+	return self.localUserData
+}
+func (self *BotSession) SetIP(ip string) {
+	self.ip = ip
+}
+func (self *BotSession) SetTopic(topic string) {
+	self.topic = topic
+}
+func (self *BotSession) SetNetwork(network string) {
+	self.network = network
+}
+func (self *BotSession) SetUserId(userid string) {
+	self.userId = userid
+}
+func (self *BotSession) SetSessionId(sessionid string) {
+	self.sessionId = sessionid
+}
+func (self *BotSession) SetServerId(serverid string) {
+	self.serverId = serverid
+}
+func (self *BotSession) SetSettings(settings map[string]string) {
+	settings = copySettings(settings)
+	self.lock.Lock()
+	self.settings = settings
+	self.lock.Unlock()
+}
+func (self *BotSession) SetLocalKV(key, value string) error {
+	self.Set(key, value)
+	return nil
+}
+func (self *BotSession) RemoveLocalKV(key string) error {
+	self.Remove(key)
+	return nil
+}
+func (self *BotSession) SetLocalUserData(data interface{}) error {
+	self.localUserData = data
+	return nil
+}
+func (self *BotSession) Serializable() ([]byte, error) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return json.Marshal(map[string]interface{}{
+		"IP":        self.ip,
+		"Network":   self.network,
+		"UserId":    self.userId,
+		"SessionId": self.sessionId,
+		"ServerId":  self.serverId,
+		"Settings":  self.settings,
+	})
+}
+func (self *BotSession) Update() (err string) {
+	return ""
+}
+func (self *BotSession) Bind(UserId string) (err string) {
+	self.userId = UserId
+	return ""
+}
+func (self *BotSession) UnBind() (err string) {
+	self.userId = ""
+	return ""
+}
+func (self *BotSession) Push() (err string) {
+	return ""
+}
+func (self *BotSession) Set(key string, value string) (err string) {
+	self.lock.Lock()
+	if self.settings == nil {
+		self.settings = map[string]string{}
+	}
+	self.settings[key] = value
+	self.lock.Unlock()
+	return ""
+}
+func (self *BotSession) SetPush(key string, value string) (err string) {
+	return self.Set(key, value)
+}
+func (self *BotSession) SetBatch(settings map[string]string) (err string) {
+	for k, v := range settings {
+		self.Set(k, v)
+	}
+	return ""
+}
+func (self *BotSession) Get(key string) (result string) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.settings[key]
+}
+func (self *BotSession) Remove(key string) (err string) {
+	self.lock.Lock()
+	delete(self.settings, key)
+	self.lock.Unlock()
+	return ""
+}
+func (self *BotSession) Send(topic string, body []byte) (err string) {
+	if self.closed {
+		return fmt.Sprintf("session %v closed", self.sessionId)
+	}
+	if self.OnMessage != nil {
+		self.OnMessage(topic, body)
+	}
+	return ""
+}
+func (self *BotSession) SendNR(topic string, body []byte) (err string) {
+	return self.Send(topic, body)
+}
+
+/**
+机器人不在任何网关上,只能给自己发送
+*/
+func (self *BotSession) SendBatch(Sessionids string, topic string, body []byte) (int64, string) {
+	if Sessionids != self.sessionId {
+		return 0, ""
+	}
+	if err := self.Send(topic, body); err != "" {
+		return 0, err
+	}
+	return 1, ""
+}
+func (self *BotSession) IsConnect(Userid string) (result bool, err string) {
+	return !self.closed && Userid == self.userId, ""
+}
+func (self *BotSession) IsGuest() bool {
+	if self.judgeGuest != nil {
+		return self.judgeGuest(self)
+	}
+	return self.userId == ""
+}
+func (self *BotSession) JudgeGuest(judgeGuest func(session gate.Session) bool) {
+	self.judgeGuest = judgeGuest
+}
+func (self *BotSession) Close() (err string) {
+	self.closed = true
+	return ""
+}
+func (self *BotSession) Clone() gate.Session {
+	self.lock.RLock()
+	settings := copySettings(self.settings)
+	self.lock.RUnlock()
+	return &BotSession{
+		ip:            self.ip,
+		topic:         self.topic,
+		network:       self.network,
+		userId:        self.userId,
+		sessionId:     self.sessionId,
+		serverId:      self.serverId,
+		settings:      settings,
+		localUserData: self.localUserData,
+		judgeGuest:    self.judgeGuest,
+		trace:         self.trace,
+		closed:        self.closed,
+		OnMessage:     self.OnMessage,
+	}
+}
+func (self *BotSession) CreateTrace() {
+	self.trace = log.CreateRootTrace()
+}
+func (self *BotSession) TraceId() string {
+	if self.trace != nil {
+		return self.trace.TraceId()
+	}
+	return ""
+}
+func (self *BotSession) SpanId() string {
+	if self.trace != nil {
+		return self.trace.SpanId()
+	}
+	return ""
+}
+func (self *BotSession) ExtractSpan() log.TraceSpan {
+	if self.trace != nil {
+		return self.trace.ExtractSpan()
+	}
+	return nil
+}
+
+func copySettings(settings map[string]string) map[string]string {
+	copied := make(map[string]string, len(settings))
+	for k, v := range settings {
+		copied[k] = v
+	}
+	return copied
+}
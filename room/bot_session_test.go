@@ -0,0 +1,59 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBotSessionSettings(t *testing.T) {
+	session := NewNullSession("u1")
+	session.Set("k", "v1")
+
+	settings := session.GetSettings()
+	settings["k"] = "changed"
+	settings["extra"] = "x"
+	assertEqual(t, session.Get("k"), "v1")
+	assertEqual(t, len(session.GetSettings()), 1)
+
+	input := map[string]string{"k": "v2"}
+	session.SetSettings(input)
+	input["k"] = "changed"
+	assertEqual(t, session.Get("k"), "v2")
+
+	clone := session.Clone()
+	clone.Set("k", "v3")
+	assertEqual(t, session.Get("k"), "v2")
+}
+
+func TestBotSessionSettingsConcurrent(t *testing.T) {
+	session := NewNullSession("u1")
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			session.Set("k", "v")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			for range session.GetSettings() {
+			}
+		}
+	}()
+	wg.Wait()
+}
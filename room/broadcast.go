@@ -0,0 +1,170 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+)
+
+//全服广播消息在队列中的函数名
+const BroadcastQueueFunc = "Room.Broadcast"
+
+/**
+令牌桶限流,协成安全
+*/
+type rateLimiter struct {
+	lock     sync.Mutex
+	clock    Clock
+	burst    float64
+	tokens   float64
+	interval time.Duration
+	last     time.Time
+}
+
+func newRateLimiter(clock Clock, burst int, interval time.Duration) *rateLimiter {
+	return &rateLimiter{
+		clock:    clock,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		interval: interval,
+		last:     clock.Now(),
+	}
+}
+
+func (l *rateLimiter) Allow() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.clock.Now()
+	if l.interval > 0 {
+		l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+//keyedRateLimiter最多保留的key数量,超过时清理已经恢复满的限流器
+const maxLimiterKeys = 10000
+
+/**
+按key分别限流,协成安全
+*/
+type keyedRateLimiter struct {
+	lock     sync.Mutex
+	clock    Clock
+	burst    int
+	interval time.Duration
+	limiters map[string]*rateLimiter
+}
+
+func newKeyedRateLimiter(clock Clock, burst int, interval time.Duration) *keyedRateLimiter {
+	return &keyedRateLimiter{
+		clock:    clock,
+		burst:    burst,
+		interval: interval,
+		limiters: map[string]*rateLimiter{},
+	}
+}
+
+func (l *keyedRateLimiter) Allow(key string) bool {
+	l.lock.Lock()
+	limiter, ok := l.limiters[key]
+	if !ok {
+		if len(l.limiters) >= maxLimiterKeys {
+			idle := l.clock.Now().Add(-time.Duration(l.burst) * l.interval)
+			for k, v := range l.limiters {
+				v.lock.Lock()
+				if v.last.Before(idle) {
+					delete(l.limiters, k)
+				}
+				v.lock.Unlock()
+			}
+		}
+		limiter = newRateLimiter(l.clock, l.burst, l.interval)
+		l.limiters[key] = limiter
+	}
+	l.lock.Unlock()
+	return limiter.Allow()
+}
+
+/**
+全服广播(公告,维护倒计时),通过每个table的队列发送给table内所有玩家
+tmpl 为text/template模板,data为模板参数,tmpl为空时data必须是[]byte
+返回成功投递的table数量
+*/
+func (self *Room) Broadcast(topic string, tmpl string, data interface{}) (int, error) {
+	if !self.broadcastLimiter.Allow() {
+		return 0, fmt.Errorf("broadcast rate limited")
+	}
+	body, err := self.renderBroadcast(tmpl, data)
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	self.tables.Range(func(key, value interface{}) bool {
+		table := value.(BaseTable)
+		if !table.Runing() {
+			return true
+		}
+		if err := putTableQueue(table, PrioritySystem, BroadcastQueueFunc, topic, body); err == nil {
+			delivered++
+		}
+		return true
+	})
+	return delivered, nil
+}
+
+func (self *Room) renderBroadcast(tmpl string, data interface{}) ([]byte, error) {
+	if tmpl == "" {
+		body, ok := data.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("broadcast without template needs []byte data")
+		}
+		return body, nil
+	}
+	self.templatesLock.Lock()
+	t, ok := self.templates[tmpl]
+	if !ok {
+		var err error
+		t, err = template.New("broadcast").Parse(tmpl)
+		if err != nil {
+			self.templatesLock.Unlock()
+			return nil, err
+		}
+		self.templates[tmpl] = t
+	}
+	self.templatesLock.Unlock()
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/**
+table内处理全服广播,转发给所有玩家
+*/
+func (this *UnifiedSendMessageTable) onBroadcast(topic string, body []byte) error {
+	return this.NotifyCallBackMsgNR(topic, body)
+}
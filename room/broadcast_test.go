@@ -0,0 +1,58 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBroadcastTemplateCache(t *testing.T) {
+	room := NewRoom(nil, BroadcastRate(10, time.Hour))
+	body, err := room.renderBroadcast("server restarts in {{.}} minutes", 5)
+	assertEqual(t, err, nil)
+	assertEqual(t, string(body), "server restarts in 5 minutes")
+	cached := room.templates["server restarts in {{.}} minutes"]
+	body, _ = room.renderBroadcast("server restarts in {{.}} minutes", 1)
+	assertEqual(t, string(body), "server restarts in 1 minutes")
+	assertEqual(t, room.templates["server restarts in {{.}} minutes"], cached)
+	assertEqual(t, len(room.templates), 1)
+
+	//解析失败的模板不缓存
+	_, err = room.renderBroadcast("{{.", nil)
+	assertEqual(t, err != nil, true)
+	assertEqual(t, len(room.templates), 1)
+
+	body, err = room.renderBroadcast("", []byte("raw"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(body), "raw")
+	_, err = room.renderBroadcast("", "raw")
+	assertEqual(t, err != nil, true)
+}
+
+func TestBroadcast(t *testing.T) {
+	room := NewRoom(nil, BroadcastRate(2, time.Hour))
+	table, _ := room.CreateById(nil, "t1", newBenchTable)
+	table.Run()
+	finished, _ := room.CreateById(nil, "t2", newBenchTable)
+	finished.Run()
+	finished.Finish()
+	delivered, err := room.Broadcast("Room/Notice", "maintenance at {{.}}", "02:00")
+	assertEqual(t, err, nil)
+	assertEqual(t, delivered, 1)
+	_, err = room.Broadcast("Room/Notice", "", []byte("hello"))
+	assertEqual(t, err, nil)
+	_, err = room.Broadcast("Room/Notice", "", []byte("hello"))
+	assertEqual(t, err != nil, true)
+}
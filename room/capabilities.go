@@ -0,0 +1,117 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"strconv"
+	"strings"
+)
+
+//客户端在登录时写入session settings的能力字段
+const (
+	CapProtocolVersion = "cap.proto"    //协议版本号,整数
+	CapCompression     = "cap.compress" //支持的压缩算法,逗号分隔,例如 gzip,snappy
+	CapMaxMessageSize  = "cap.maxmsg"   //单条消息最大字节数
+)
+
+/**
+客户端能力,Bind时从session settings中客户端上报的能力解析,table再与Options.ServerCaps协商
+老客户端没有上报时为零值,table应按最保守的方式处理
+*/
+type Capabilities struct {
+	ProtocolVersion int
+	Compression     []string
+	MaxMessageSize  int //0表示不限制
+}
+
+func ParseCapabilities(settings map[string]string) Capabilities {
+	caps := Capabilities{}
+	if settings == nil {
+		return caps
+	}
+	if v, err := strconv.Atoi(settings[CapProtocolVersion]); err == nil {
+		caps.ProtocolVersion = v
+	}
+	if v := settings[CapCompression]; v != "" {
+		for _, c := range strings.Split(v, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				caps.Compression = append(caps.Compression, c)
+			}
+		}
+	}
+	if v, err := strconv.Atoi(settings[CapMaxMessageSize]); err == nil {
+		caps.MaxMessageSize = v
+	}
+	return caps
+}
+
+/**
+协议版本是否不低于version
+*/
+func (c Capabilities) AtLeast(version int) bool {
+	return c.ProtocolVersion >= version
+}
+
+/**
+是否支持某种压缩算法
+*/
+func (c Capabilities) Supports(compression string) bool {
+	for _, v := range c.Compression {
+		if v == compression {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+size字节的消息是否可以直接发送给客户端
+*/
+func (c Capabilities) Fits(size int) bool {
+	return c.MaxMessageSize <= 0 || size <= c.MaxMessageSize
+}
+
+/**
+与服务器能力协商,结果为双方都支持的部分
+服务器能力的零值字段表示不限制,压缩算法按服务器的优先顺序排列
+*/
+func (c Capabilities) Negotiate(server Capabilities) Capabilities {
+	result := Capabilities{
+		ProtocolVersion: c.ProtocolVersion,
+		Compression:     c.Compression,
+		MaxMessageSize:  c.MaxMessageSize,
+	}
+	if server.ProtocolVersion > 0 && server.ProtocolVersion < result.ProtocolVersion {
+		result.ProtocolVersion = server.ProtocolVersion
+	}
+	if server.Compression != nil {
+		result.Compression = nil
+		for _, compression := range server.Compression {
+			if c.Supports(compression) {
+				result.Compression = append(result.Compression, compression)
+			}
+		}
+	}
+	if server.MaxMessageSize > 0 && (result.MaxMessageSize <= 0 || server.MaxMessageSize < result.MaxMessageSize) {
+		result.MaxMessageSize = server.MaxMessageSize
+	}
+	return result
+}
+
+/**
+玩家与本table协商后的能力,服务器能力见Options.ServerCaps
+*/
+func (this *BaseTableImp) PlayerCapabilities(player BasePlayer) Capabilities {
+	return PlayerCapabilities(player).Negotiate(this.opts.ServerCaps)
+}
@@ -0,0 +1,113 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	caps := ParseCapabilities(map[string]string{
+		CapProtocolVersion: "3",
+		CapCompression:     "gzip, snappy,",
+		CapMaxMessageSize:  "4096",
+	})
+	assertEqual(t, caps.ProtocolVersion, 3)
+	assertEqual(t, strings.Join(caps.Compression, ","), "gzip,snappy")
+	assertEqual(t, caps.AtLeast(3), true)
+	assertEqual(t, caps.AtLeast(4), false)
+	assertEqual(t, caps.Supports("snappy"), true)
+	assertEqual(t, caps.Fits(4096), true)
+	assertEqual(t, caps.Fits(4097), false)
+
+	//老客户端没有上报
+	old := ParseCapabilities(map[string]string{CapProtocolVersion: "x"})
+	assertEqual(t, old.ProtocolVersion, 0)
+	assertEqual(t, old.Supports("gzip"), false)
+	assertEqual(t, old.Fits(1<<20), true)
+}
+
+func TestNegotiateCapabilities(t *testing.T) {
+	client := Capabilities{ProtocolVersion: 3, Compression: []string{"gzip", "snappy"}}
+	//服务器零值不限制
+	assertEqual(t, client.Negotiate(Capabilities{}).ProtocolVersion, 3)
+	assertEqual(t, len(client.Negotiate(Capabilities{}).Compression), 2)
+
+	caps := client.Negotiate(Capabilities{ProtocolVersion: 2, Compression: []string{"zstd", "snappy"}, MaxMessageSize: 1024})
+	assertEqual(t, caps.ProtocolVersion, 2)
+	assertEqual(t, strings.Join(caps.Compression, ","), "snappy")
+	assertEqual(t, caps.MaxMessageSize, 1024)
+	assertEqual(t, client.Negotiate(Capabilities{Compression: []string{"zstd"}}).Supports("gzip"), false)
+	small := Capabilities{MaxMessageSize: 512}
+	assertEqual(t, small.Negotiate(Capabilities{MaxMessageSize: 1024}).MaxMessageSize, 512)
+}
+
+func TestPlayerCapabilities(t *testing.T) {
+	session := NewNullSession("u1")
+	session.Set(CapProtocolVersion, "3")
+	session.Set(SessionPlatform, "ios")
+
+	player := &BasePlayerImp{}
+	player.Bind(session)
+	assertEqual(t, player.Capabilities().ProtocolVersion, 3)
+	assertEqual(t, PlayerCapabilities(player).ProtocolVersion, 3)
+	assertEqual(t, PlayerSession(player).Platform(), "ios")
+
+	//只实现BasePlayer的玩家从session读取
+	plain := struct{ BasePlayer }{player}
+	assertEqual(t, PlayerCapabilities(plain).ProtocolVersion, 3)
+	assertEqual(t, PlayerSession(plain).UserId(), "u1")
+	assertEqual(t, PlayerSession(plain).Platform(), "ios")
+	assertEqual(t, PlayerSession(plain).IsGuest(), false)
+	unbound := struct{ BasePlayer }{&BasePlayerImp{}}
+	assertEqual(t, PlayerSession(unbound).SessionId(), "")
+	assertEqual(t, PlayerCapabilities(unbound).ProtocolVersion, 0)
+}
+
+func TestPlayerRebindLogin(t *testing.T) {
+	session := NewNullSession("")
+	player := &BasePlayerImp{}
+	player.Bind(session)
+	assertEqual(t, player.IsGuest(), true)
+
+	//游客在同一个session上登录
+	session.SetUserId("u1")
+	player.OnRequest(session)
+	assertEqual(t, player.UserId(), "u1")
+	assertEqual(t, player.IsGuest(), false)
+
+	//网关下发的新session对象,sessionId不变
+	login := NewNullSession("u2")
+	login.SetSessionId(session.GetSessionId())
+	player.OnResponse(login)
+	assertEqual(t, player.UserId(), "u2")
+	assertEqual(t, player.Session().(*BotSession), login)
+}
+
+func TestTablePlayerCapabilities(t *testing.T) {
+	session := NewNullSession("u1")
+	session.Set(CapProtocolVersion, "3")
+	player := &BasePlayerImp{}
+	player.Bind(session)
+
+	//每个table按自己的服务器能力协商,互不影响
+	v2 := &BaseTableImp{}
+	v2.BaseTableImpInit(nil, ServerCaps(Capabilities{ProtocolVersion: 2}))
+	unlimited := &BaseTableImp{}
+	unlimited.BaseTableImpInit(nil)
+	assertEqual(t, v2.PlayerCapabilities(player).ProtocolVersion, 2)
+	assertEqual(t, unlimited.PlayerCapabilities(player).ProtocolVersion, 3)
+	assertEqual(t, player.Capabilities().ProtocolVersion, 3)
+}
@@ -0,0 +1,96 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/**
+故障注入,只用于测试环境,验证游戏代码在延迟,丢包和异常下的表现
+概率取值[0,1],0表示不注入
+*/
+type ChaosOptions struct {
+	DelayRate         float64       //处理函数执行前随机延迟的概率
+	MaxDelay          time.Duration //随机延迟的上限
+	PanicRate         float64       //处理函数执行前强制panic的概率,按DropPanic处理
+	DropBroadcastRate float64       //丢弃发送给客户端消息的概率
+	Funcs             []string      //只对这些队列函数注入延迟和panic,为空表示全部
+	Seed              int64         //随机数种子,0表示使用当前时间
+}
+
+/**
+协成安全
+*/
+type Chaos struct {
+	opts  ChaosOptions
+	funcs map[string]bool
+	lock  sync.Mutex
+	rand  *rand.Rand
+}
+
+func NewChaos(opts ChaosOptions) *Chaos {
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	chaos := &Chaos{
+		opts: opts,
+		rand: rand.New(rand.NewSource(seed)),
+	}
+	if len(opts.Funcs) > 0 {
+		chaos.funcs = map[string]bool{}
+		for _, f := range opts.Funcs {
+			chaos.funcs[f] = true
+		}
+	}
+	return chaos
+}
+
+func (c *Chaos) hit(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.rand.Float64() < rate
+}
+
+/**
+在处理函数执行前调用,可能延迟或panic
+*/
+func (c *Chaos) BeforeHandle(msg *QueueMsg) {
+	if c.funcs != nil && !c.funcs[msg.Func] {
+		return
+	}
+	if c.opts.MaxDelay > 0 && c.hit(c.opts.DelayRate) {
+		c.lock.Lock()
+		delay := time.Duration(c.rand.Int63n(int64(c.opts.MaxDelay)))
+		c.lock.Unlock()
+		time.Sleep(delay)
+	}
+	if c.hit(c.opts.PanicRate) {
+		panic(fmt.Sprintf("chaos: injected panic in %v", msg.Func))
+	}
+}
+
+/**
+返回true表示丢弃这条发送给客户端的消息
+*/
+func (c *Chaos) DropBroadcast() bool {
+	return c.hit(c.opts.DropBroadcastRate)
+}
@@ -0,0 +1,60 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChaosFuncs(t *testing.T) {
+	chaos := NewChaos(ChaosOptions{PanicRate: 1, Funcs: []string{"Bet"}, Seed: 1})
+	chaos.BeforeHandle(&QueueMsg{Func: "Chat"})
+	panicked := func(f string) (ok bool) {
+		defer func() { ok = recover() != nil }()
+		chaos.BeforeHandle(&QueueMsg{Func: f})
+		return false
+	}
+	assertEqual(t, panicked("Bet"), true)
+	assertEqual(t, panicked("Fold"), false)
+	assertEqual(t, chaos.DropBroadcast(), false)
+
+	//Funcs为空时对所有函数注入
+	chaos = NewChaos(ChaosOptions{DelayRate: 1, MaxDelay: time.Millisecond, DropBroadcastRate: 1, Seed: 1})
+	chaos.BeforeHandle(&QueueMsg{Func: "Chat"})
+	assertEqual(t, chaos.DropBroadcast(), true)
+}
+
+func TestChaosQueue(t *testing.T) {
+	recovered := []string{}
+	handled := []string{}
+	q := &QueueTable{}
+	q.QueueInit(
+		Capaciity(16),
+		SetChaos(NewChaos(ChaosOptions{PanicRate: 1, Funcs: []string{"Bet"}, Seed: 1})),
+		SetRecoverHandle(func(msg *QueueMsg, err error) {
+			recovered = append(recovered, msg.Func)
+		}),
+	)
+	q.Register("Bet", func() { handled = append(handled, "Bet") })
+	q.Register("Chat", func() { handled = append(handled, "Chat") })
+	q.PutQueue("Bet")
+	q.PutQueue("Chat")
+	q.ExecuteEvent(nil)
+	//只有Funcs中的函数被注入panic,其他消息正常处理
+	assertEqual(t, len(recovered), 1)
+	assertEqual(t, recovered[0], "Bet")
+	assertEqual(t, len(handled), 1)
+	assertEqual(t, handled[0], "Chat")
+}
@@ -0,0 +1,242 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+table使用的时钟,可以替换成加速或手动推进的时钟用于测试和回放
+*/
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+/**
+系统时钟,默认值
+*/
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{ticker: time.NewTicker(d)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+/**
+按倍数加速的时钟,scale=60时真实的1秒等于时钟的1分钟
+scale必须大于0
+*/
+type ScaledClock struct {
+	start time.Time
+	base  time.Time
+	scale float64
+}
+
+func NewScaledClock(scale float64) *ScaledClock {
+	if scale <= 0 {
+		panic(fmt.Sprintf("scaled clock: invalid scale %v", scale))
+	}
+	now := time.Now()
+	return &ScaledClock{
+		start: now,
+		base:  now,
+		scale: scale,
+	}
+}
+
+func (c *ScaledClock) Now() time.Time {
+	elapsed := time.Since(c.start)
+	return c.base.Add(time.Duration(float64(elapsed) * c.scale))
+}
+
+func (c *ScaledClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	time.AfterFunc(c.real(d), func() {
+		ch <- c.Now()
+	})
+	return ch
+}
+
+func (c *ScaledClock) NewTicker(d time.Duration) Ticker {
+	t := &scaledTicker{
+		ticker: time.NewTicker(c.real(d)),
+		c:      make(chan time.Time, 1),
+		stop:   make(chan bool),
+	}
+	go func() {
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-t.ticker.C:
+				select {
+				case t.c <- c.Now():
+				default:
+				}
+			}
+		}
+	}()
+	return t
+}
+
+func (c *ScaledClock) real(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / c.scale)
+}
+
+type scaledTicker struct {
+	ticker   *time.Ticker
+	c        chan time.Time
+	stop     chan bool
+	stopOnce sync.Once
+}
+
+func (t *scaledTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *scaledTicker) Stop() {
+	t.stopOnce.Do(func() {
+		t.ticker.Stop()
+		close(t.stop)
+	})
+}
+
+/**
+手动推进的时钟,只有调用Advance时间才会流逝,用于确定性的测试和回放
+*/
+type SimulatedClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*simWaiter
+}
+
+type simWaiter struct {
+	at     time.Time
+	period time.Duration //0表示只触发一次
+	c      chan time.Time
+}
+
+func NewSimulatedClock(now time.Time) *SimulatedClock {
+	return &SimulatedClock{now: now}
+}
+
+func (c *SimulatedClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *SimulatedClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	w := &simWaiter{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	return w.c
+}
+
+func (c *SimulatedClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	w := &simWaiter{at: c.now.Add(d), period: d, c: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	return &simTicker{clock: c, waiter: w}
+}
+
+/**
+推进时钟,按时间顺序触发到期的After和Ticker
+*/
+func (c *SimulatedClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	end := c.now.Add(d)
+	for {
+		sort.Slice(c.waiters, func(i, j int) bool {
+			return c.waiters[i].at.Before(c.waiters[j].at)
+		})
+		if len(c.waiters) == 0 || c.waiters[0].at.After(end) {
+			break
+		}
+		w := c.waiters[0]
+		c.now = w.at
+		select {
+		case w.c <- w.at:
+		default:
+		}
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			c.waiters = c.waiters[1:]
+		}
+	}
+	c.now = end
+}
+
+func (c *SimulatedClock) remove(w *simWaiter) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, waiter := range c.waiters {
+		if waiter == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+type simTicker struct {
+	clock  *SimulatedClock
+	waiter *simWaiter
+}
+
+func (t *simTicker) C() <-chan time.Time {
+	return t.waiter.c
+}
+
+func (t *simTicker) Stop() {
+	t.clock.remove(t.waiter)
+}
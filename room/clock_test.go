@@ -0,0 +1,116 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimulatedClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewSimulatedClock(start)
+	after := clock.After(3 * time.Second)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	clock.Advance(2 * time.Second)
+	assertEqual(t, clock.Now().Unix(), int64(1002))
+	select {
+	case <-after:
+		t.Errorf("After fired too early")
+	default:
+	}
+	assertEqual(t, (<-ticker.C()).Unix(), int64(1001))
+
+	clock.Advance(time.Second)
+	assertEqual(t, (<-after).Unix(), int64(1003))
+}
+
+func TestScaledClockInvalidScale(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected panic for non-positive scale")
+		}
+	}()
+	NewScaledClock(0)
+}
+
+func TestRoomClock(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(1000, 0))
+	room := NewRoom(nil, RoomClock(clock), RPCTimeout(time.Second))
+	table, err := room.CreateById(nil, "clock", newBenchTable)
+	assertEqual(t, err, nil)
+	table.Run()
+
+	//事件时间使用RoomClock
+	var published *RoomEvent
+	room.Events().Subscribe(func(event *RoomEvent) { published = event })
+	room.PublishEvent(EventTableCreated, "clock", "", nil)
+	assertEqual(t, published.Time, int64(1000000))
+
+	//RPC等待只有在时钟推进后才超时
+	done := make(chan error, 1)
+	go func() {
+		_, err := room.InspectTable("clock", InspectOnly)
+		done <- err
+	}()
+	for {
+		clock.lock.Lock()
+		waiting := len(clock.waiters)
+		clock.lock.Unlock()
+		if waiting > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("call returned before the clock advanced: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	clock.Advance(time.Second)
+	assertEqual(t, <-done != nil, true)
+}
+
+func TestQueueClock(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(100, 0))
+	var latency, wait time.Duration
+	q := &QueueTable{}
+	q.QueueInit(TableId("t1"), SetClock(clock), SetQueueObserver(func(event *QueueEvent) {
+		wait = event.Wait
+	}))
+	q.Register("act", func(ctx *HandlerContext) {
+		latency = ctx.Latency()
+	})
+	q.PutQueue("act")
+	assertEqual(t, q.LastPut(), time.Unix(100, 0))
+	clock.Advance(3 * time.Second)
+	q.ExecuteEvent(nil)
+	//排队时间按table时钟计算
+	assertEqual(t, latency, 3*time.Second)
+	assertEqual(t, wait > 2*time.Second && wait <= 3*time.Second, true)
+}
+
+func TestRateLimiterClock(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(100, 0))
+	room := NewRoom(nil, RoomClock(clock), BroadcastRate(1, time.Second))
+	_, err := room.Broadcast("Room/Notice", "", []byte("a"))
+	assertEqual(t, err, nil)
+	_, err = room.Broadcast("Room/Notice", "", []byte("a"))
+	assertEqual(t, err != nil, true)
+	clock.Advance(time.Second)
+	_, err = room.Broadcast("Room/Notice", "", []byte("a"))
+	assertEqual(t, err, nil)
+}
@@ -0,0 +1,193 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"github.com/liangdas/mqant/log"
+	"time"
+)
+
+/**
+倒计时推送给客户端的消息,时间单位毫秒
+客户端用ServerTime校正本地时钟后按EndsAt显示,不依赖本地计时器
+*/
+type CountdownTick struct {
+	Id         string
+	Remaining  int64 //剩余时间,最后一次推送为0
+	EndsAt     int64 //结束的服务器时间
+	ServerTime int64 //发送时的服务器时间
+	Drift      int64 //实际发送时间比计划晚了多少,受帧间隔影响
+}
+
+type countdown struct {
+	id        string
+	topic     string
+	endsAt    time.Time
+	interval  time.Duration
+	nextTick  time.Time
+	queueFunc string
+	params    []interface{}
+}
+
+/**
+服务器权威的倒计时,按interval广播剩余时间,到0时把queueFunc放入table队列
+只能在table协成中调用
+*/
+type CountdownTable struct {
+	countdownClock func() Clock
+	countdownSend  func(topic string, body []byte) error
+	countdownPut   func(priority int, _func string, params ...interface{}) error
+	countdowns     map[string]*countdown
+}
+
+func (this *CountdownTable) CountdownTableInit(clock func() Clock, send func(topic string, body []byte) error, put func(priority int, _func string, params ...interface{}) error) {
+	this.countdownClock = clock
+	this.countdownSend = send
+	this.countdownPut = put
+	this.countdowns = map[string]*countdown{}
+}
+
+/**
+开始倒计时,同一个id会替换之前的倒计时
+interval为0时只在开始和结束时推送
+queueFunc需要已经通过Register注册,为空时到0只推送不回调
+*/
+func (this *CountdownTable) StartCountdown(id string, topic string, d time.Duration, interval time.Duration, queueFunc string, params ...interface{}) {
+	now := this.countdownClock().Now()
+	c := &countdown{
+		id:        id,
+		topic:     topic,
+		endsAt:    now.Add(d),
+		interval:  interval,
+		nextTick:  now,
+		queueFunc: queueFunc,
+		params:    params,
+	}
+	this.countdowns[id] = c
+	this.sendCountdown(c, now, now)
+	this.advanceCountdown(c)
+}
+
+/**
+取消倒计时,不会触发回调
+*/
+func (this *CountdownTable) CancelCountdown(id string) bool {
+	if _, ok := this.countdowns[id]; !ok {
+		return false
+	}
+	delete(this.countdowns, id)
+	return true
+}
+
+/**
+剩余时间,倒计时不存在时ok为false
+*/
+func (this *CountdownTable) CountdownRemaining(id string) (time.Duration, bool) {
+	c, ok := this.countdowns[id]
+	if !ok {
+		return 0, false
+	}
+	remaining := c.endsAt.Sub(this.countdownClock().Now())
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+/**
+把所有倒计时推迟d,用于暂停恢复后补偿暂停的时间
+*/
+func (this *CountdownTable) ShiftCountdowns(d time.Duration) {
+	for _, c := range this.countdowns {
+		c.endsAt = c.endsAt.Add(d)
+		if !c.nextTick.IsZero() {
+			c.nextTick = c.nextTick.Add(d)
+		}
+	}
+}
+
+/**
+是否有进行中的倒计时,有时table不能进入休眠
+*/
+func (this *CountdownTable) CountingDown() bool {
+	return len(this.countdowns) > 0
+}
+
+/**
+【每帧调用】推送到期的倒计时,结束的倒计时触发回调
+*/
+func (this *CountdownTable) CheckCountdowns() {
+	if len(this.countdowns) == 0 {
+		return
+	}
+	now := this.countdownClock().Now()
+	for id, c := range this.countdowns {
+		if !now.Before(c.endsAt) {
+			delete(this.countdowns, id)
+			this.sendCountdown(c, c.endsAt, now)
+			if c.queueFunc != "" {
+				if err := this.countdownPut(PrioritySystem, c.queueFunc, c.params...); err != nil {
+					log.Error("countdown %v callback %v error %v", id, c.queueFunc, err)
+				}
+			}
+			continue
+		}
+		if !c.nextTick.IsZero() && !now.Before(c.nextTick) {
+			this.sendCountdown(c, c.nextTick, now)
+			this.advanceCountdown(c)
+		}
+	}
+}
+
+/**
+下一次推送的时间按interval对齐到结束时间,保证客户端看到的是整秒
+*/
+func (this *CountdownTable) advanceCountdown(c *countdown) {
+	if c.interval <= 0 {
+		c.nextTick = time.Time{}
+		return
+	}
+	now := this.countdownClock().Now()
+	remaining := c.endsAt.Sub(now)
+	steps := (remaining - 1) / c.interval
+	if steps <= 0 {
+		c.nextTick = time.Time{}
+		return
+	}
+	c.nextTick = c.endsAt.Add(-steps * c.interval)
+}
+
+func (this *CountdownTable) sendCountdown(c *countdown, scheduled time.Time, now time.Time) {
+	if c.topic == "" || this.countdownSend == nil {
+		return
+	}
+	remaining := c.endsAt.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	body, err := json.Marshal(&CountdownTick{
+		Id:         c.id,
+		Remaining:  int64(remaining / time.Millisecond),
+		EndsAt:     c.endsAt.UnixNano() / int64(time.Millisecond),
+		ServerTime: now.UnixNano() / int64(time.Millisecond),
+		Drift:      int64(now.Sub(scheduled) / time.Millisecond),
+	})
+	if err != nil {
+		return
+	}
+	if err := this.countdownSend(c.topic, body); err != nil {
+		log.Warning("countdown %v send error %v", c.id, err)
+	}
+}
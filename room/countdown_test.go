@@ -0,0 +1,64 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCountdown(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(100, 0))
+	ticks := []*CountdownTick{}
+	fired := []interface{}{}
+	table := &CountdownTable{}
+	table.CountdownTableInit(func() Clock { return clock }, func(topic string, body []byte) error {
+		tick := &CountdownTick{}
+		json.Unmarshal(body, tick)
+		ticks = append(ticks, tick)
+		return nil
+	}, func(priority int, _func string, params ...interface{}) error {
+		fired = append(fired, params...)
+		return nil
+	})
+	table.StartCountdown("ready", "Room/Countdown", 3*time.Second, time.Second, "OnReady", "p1")
+	assertEqual(t, len(ticks), 1)
+	assertEqual(t, ticks[0].Remaining, int64(3000))
+	assertEqual(t, ticks[0].EndsAt, int64(103000))
+
+	clock.Advance(1100 * time.Millisecond)
+	table.CheckCountdowns()
+	assertEqual(t, len(ticks), 2)
+	assertEqual(t, ticks[1].Remaining, int64(1900))
+	assertEqual(t, ticks[1].Drift, int64(100))
+
+	clock.Advance(time.Second)
+	table.CheckCountdowns()
+	assertEqual(t, len(ticks), 3)
+	assertEqual(t, len(fired), 0)
+
+	clock.Advance(time.Second)
+	table.CheckCountdowns()
+	assertEqual(t, ticks[3].Remaining, int64(0))
+	assertEqual(t, len(fired), 1)
+	assertEqual(t, fired[0], "p1")
+	assertEqual(t, table.CountingDown(), false)
+
+	table.StartCountdown("turn", "", time.Second, 0, "OnTurn")
+	assertEqual(t, table.CancelCountdown("turn"), true)
+	clock.Advance(2 * time.Second)
+	table.CheckCountdowns()
+	assertEqual(t, len(fired), 1)
+}
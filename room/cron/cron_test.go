@@ -0,0 +1,79 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cron
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	base := time.Date(2024, 2, 28, 23, 58, 30, 0, time.UTC)
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, 2, 28, 23, 59, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"30 4 * * *", time.Date(2024, 2, 29, 4, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 1-5", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", base.Add(90 * time.Second)},
+	}
+	for _, c := range cases {
+		s, err := ParseIn(c.spec, time.UTC)
+		if err != nil {
+			t.Fatalf("%v: %v", c.spec, err)
+		}
+		if next := s.Next(base); !next.Equal(c.next) {
+			t.Errorf("%v: expected %v, got %v", c.spec, c.next, next)
+		}
+	}
+	for _, spec := range []string{"* * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every -1s"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%v: expected error", spec)
+		}
+	}
+}
+
+func TestRegistryOverlap(t *testing.T) {
+	registry := NewRegistry()
+	release := make(chan bool)
+	started := make(chan bool, 1)
+	registry.Register("slow", "@every 1h", func(ctx context.Context) error {
+		started <- true
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+	registry.Start()
+	if err := registry.RunNow("slow"); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := registry.RunNow("slow"); err == nil {
+		t.Fatal("expected overlap error")
+	}
+	close(release)
+	registry.Stop()
+	stats := registry.Stats()
+	if len(stats) != 1 || stats[0].Runs != 1 || stats[0].Skipped != 1 || stats[0].Running {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
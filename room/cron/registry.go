@@ -0,0 +1,278 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cron
+
+import (
+	"context"
+	"fmt"
+	"github.com/liangdas/mqant/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+定时任务,Registry停止时ctx被取消
+*/
+type Job func(ctx context.Context) error
+
+/**
+任务的运行统计
+*/
+type JobStats struct {
+	Name         string
+	Spec         string
+	Runs         int64 //已执行次数
+	Failures     int64 //返回错误或panic的次数
+	Skipped      int64 //因为上一次还没有结束而跳过的次数
+	Running      bool
+	LastStart    time.Time
+	LastDuration time.Duration
+	LastError    string
+	Next         time.Time
+}
+
+type job struct {
+	name     string
+	spec     string
+	schedule Schedule
+	fn       Job
+	stats    JobStats
+}
+
+/**
+定时任务注册表,一个模块创建一个
+*/
+type Registry struct {
+	lock    sync.Mutex
+	jobs    map[string]*job
+	wake    chan bool
+	stop    chan bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	started bool
+}
+
+func NewRegistry() *Registry {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Registry{
+		jobs:   map[string]*job{},
+		wake:   make(chan bool, 1),
+		stop:   make(chan bool),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+/**
+注册任务,spec为cron表达式,同名任务不能重复注册
+	registry.Register("leaderboard", "0 * * * *", refreshLeaderboard)
+	registry.Register("stats", "@every 30s", flushStats)
+*/
+func (self *Registry) Register(name string, spec string, fn Job) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+	return self.RegisterSchedule(name, spec, schedule, fn)
+}
+
+func (self *Registry) RegisterSchedule(name string, spec string, schedule Schedule, fn Job) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if _, ok := self.jobs[name]; ok {
+		return fmt.Errorf("job %v already registered", name)
+	}
+	j := &job{
+		name:     name,
+		spec:     spec,
+		schedule: schedule,
+		fn:       fn,
+	}
+	j.stats.Name = name
+	j.stats.Spec = spec
+	j.stats.Next = schedule.Next(time.Now())
+	self.jobs[name] = j
+	self.notify()
+	return nil
+}
+
+/**
+移除任务,正在执行的不会被中断
+*/
+func (self *Registry) Remove(name string) {
+	self.lock.Lock()
+	delete(self.jobs, name)
+	self.lock.Unlock()
+	self.notify()
+}
+
+func (self *Registry) notify() {
+	select {
+	case self.wake <- true:
+	default:
+	}
+}
+
+/**
+启动后台调度,在模块Run中调用
+*/
+func (self *Registry) Start() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.started {
+		return
+	}
+	self.started = true
+	go self.loop()
+}
+
+/**
+停止调度,取消正在执行的任务的ctx并等待它们返回,在模块OnDestroy中调用
+停止后不能再次启动
+*/
+func (self *Registry) Stop() {
+	self.lock.Lock()
+	if !self.started {
+		self.lock.Unlock()
+		return
+	}
+	self.started = false
+	close(self.stop)
+	self.lock.Unlock()
+	self.cancel()
+	self.wg.Wait()
+}
+
+func (self *Registry) loop() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		next := self.runDue(time.Now())
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next.IsZero() {
+			timer.Reset(time.Hour)
+		} else {
+			timer.Reset(time.Until(next))
+		}
+		select {
+		case <-self.stop:
+			return
+		case <-self.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+/**
+执行所有到期的任务,返回最近的下一次执行时间
+*/
+func (self *Registry) runDue(now time.Time) time.Time {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var next time.Time
+	for _, j := range self.jobs {
+		if j.stats.Next.IsZero() {
+			continue
+		}
+		if !now.Before(j.stats.Next) {
+			self.launch(j)
+			j.stats.Next = j.schedule.Next(now)
+		}
+		if !j.stats.Next.IsZero() && (next.IsZero() || j.stats.Next.Before(next)) {
+			next = j.stats.Next
+		}
+	}
+	return next
+}
+
+/**
+调用方需持有lock
+*/
+func (self *Registry) launch(j *job) bool {
+	if j.stats.Running {
+		j.stats.Skipped++
+		log.Warning("job %v still running, skip", j.name)
+		return false
+	}
+	j.stats.Running = true
+	j.stats.Runs++
+	j.stats.LastStart = time.Now()
+	self.wg.Add(1)
+	go self.run(j)
+	return true
+}
+
+func (self *Registry) run(j *job) {
+	defer self.wg.Done()
+	start := time.Now()
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		err = j.fn(self.ctx)
+	}()
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	j.stats.Running = false
+	j.stats.LastDuration = time.Since(start)
+	if err != nil {
+		j.stats.Failures++
+		j.stats.LastError = err.Error()
+		log.Error("job %v error %v", j.name, err)
+	} else {
+		j.stats.LastError = ""
+	}
+}
+
+/**
+立即执行一次,上一次还没有结束时返回错误
+*/
+func (self *Registry) RunNow(name string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	j, ok := self.jobs[name]
+	if !ok {
+		return fmt.Errorf("job %v not found", name)
+	}
+	if !self.launch(j) {
+		return fmt.Errorf("job %v still running", name)
+	}
+	return nil
+}
+
+/**
+所有任务的统计,按名字排序
+*/
+func (self *Registry) Stats() []JobStats {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	stats := make([]JobStats, 0, len(self.jobs))
+	for _, j := range self.jobs {
+		stats = append(stats, j.stats)
+	}
+	sort.Slice(stats, func(i, k int) bool {
+		return stats[i].Name < stats[k].Name
+	})
+	return stats
+}
@@ -0,0 +1,332 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+)
+
+/**
+标准52张牌,点数23456789TJQKA,花色SHDC,例如"AS"为黑桃A
+*/
+func StandardCards() []string {
+	cards := make([]string, 0, 52)
+	for _, rank := range "23456789TJQKA" {
+		for _, suit := range "SHDC" {
+			cards = append(cards, string(rank)+string(suit))
+		}
+	}
+	return cards
+}
+
+/**
+由种子生成的确定性随机数流,块i为sha256(seed||i)
+*/
+type deckStream struct {
+	seed  []byte
+	block []byte
+	count uint64
+}
+
+func (s *deckStream) uint64() uint64 {
+	if len(s.block) == 0 {
+		var counter [8]byte
+		binary.BigEndian.PutUint64(counter[:], s.count)
+		s.count++
+		sum := sha256.Sum256(append(append([]byte{}, s.seed...), counter[:]...))
+		s.block = sum[:]
+	}
+	v := binary.BigEndian.Uint64(s.block[:8])
+	s.block = s.block[8:]
+	return v
+}
+
+/**
+[0,n)内的均匀随机数,拒绝采样避免取模偏差
+*/
+func (s *deckStream) intn(n uint64) uint64 {
+	limit := ^uint64(0) - ^uint64(0)%n
+	for {
+		if v := s.uint64(); v < limit {
+			return v % n
+		}
+	}
+}
+
+/**
+最终洗牌种子,服务器种子和所有客户端熵按顺序参与
+*/
+func deckSeed(serverSeed []byte, entropy []string) []byte {
+	h := sha256.New()
+	h.Write(serverSeed)
+	for _, e := range entropy {
+		h.Write([]byte{0})
+		h.Write([]byte(e))
+	}
+	return h.Sum(nil)
+}
+
+func shuffleCards(cards []string, seed []byte) []string {
+	order := append([]string{}, cards...)
+	stream := &deckStream{seed: seed}
+	for i := len(order) - 1; i > 0; i-- {
+		j := stream.intn(uint64(i + 1))
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
+
+/**
+服务器端牌堆,支持可验证的公平洗牌和对其他玩家隐藏的手牌
+
+公平性流程:
+1. 开局前把Commitment()发给所有玩家
+2. 玩家可以通过AddEntropy提供自己的随机串
+3. Shuffle后发牌,牌局结束后把Reveal()的结果公开,玩家用VerifyDeck验证
+
+只能在table协成中调用
+*/
+type Deck struct {
+	cards      []string //洗牌前的牌,顺序固定
+	serverSeed []byte
+	entropy    []string
+	order      []string //洗牌后的顺序
+	next       int      //下一张要发的牌在order中的下标
+	shuffled   bool
+	revealed   bool
+	hands      map[string][]string
+	shown      map[string]bool //已经亮出手牌的玩家
+	board      []string        //公共牌
+}
+
+/**
+serverSeed为nil时使用crypto/rand生成32字节
+*/
+func NewDeck(cards []string, serverSeed []byte) (*Deck, error) {
+	if serverSeed == nil {
+		serverSeed = make([]byte, 32)
+		if _, err := rand.Read(serverSeed); err != nil {
+			return nil, err
+		}
+	}
+	return &Deck{
+		cards:      append([]string{}, cards...),
+		serverSeed: serverSeed,
+		hands:      map[string][]string{},
+		shown:      map[string]bool{},
+	}, nil
+}
+
+/**
+承诺同时覆盖种子和洗牌前的牌,否则服务器可以在公开时替换Cards来配合任意的发牌顺序
+*/
+func deckCommitment(serverSeed []byte, cards []string) string {
+	h := sha256.New()
+	h.Write(serverSeed)
+	for _, card := range cards {
+		h.Write([]byte{0})
+		h.Write([]byte(card))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+/**
+服务器种子和牌的承诺sha256(serverSeed||0||card1||0||card2...),在洗牌前公开
+*/
+func (d *Deck) Commitment() string {
+	return deckCommitment(d.serverSeed, d.cards)
+}
+
+/**
+加入客户端提供的随机串,只能在Shuffle之前调用
+*/
+func (d *Deck) AddEntropy(entropy string) error {
+	if d.shuffled {
+		return NewError(ErrCodeStateInvalid)
+	}
+	d.entropy = append(d.entropy, entropy)
+	return nil
+}
+
+/**
+洗牌,每副牌只能洗一次
+*/
+func (d *Deck) Shuffle() error {
+	if d.shuffled {
+		return NewError(ErrCodeStateInvalid)
+	}
+	d.order = shuffleCards(d.cards, deckSeed(d.serverSeed, d.entropy))
+	d.shuffled = true
+	return nil
+}
+
+func (d *Deck) draw(n int) ([]string, error) {
+	if !d.shuffled || d.revealed || n <= 0 || d.next+n > len(d.order) {
+		return nil, NewError(ErrCodeStateInvalid)
+	}
+	cards := append([]string{}, d.order[d.next:d.next+n]...)
+	d.next += n
+	return cards, nil
+}
+
+/**
+给玩家发n张暗牌
+*/
+func (d *Deck) Deal(playerId string, n int) ([]string, error) {
+	cards, err := d.draw(n)
+	if err != nil {
+		return nil, err
+	}
+	d.hands[playerId] = append(d.hands[playerId], cards...)
+	return cards, nil
+}
+
+/**
+发n张公共牌
+*/
+func (d *Deck) DealBoard(n int) ([]string, error) {
+	cards, err := d.draw(n)
+	if err != nil {
+		return nil, err
+	}
+	d.board = append(d.board, cards...)
+	return cards, nil
+}
+
+/**
+弃掉n张牌(切牌),不发给任何人
+*/
+func (d *Deck) Burn(n int) error {
+	_, err := d.draw(n)
+	return err
+}
+
+func (d *Deck) Remaining() int {
+	return len(d.order) - d.next
+}
+
+func (d *Deck) Board() []string {
+	return append([]string{}, d.board...)
+}
+
+/**
+玩家打出手牌中的一张
+*/
+func (d *Deck) Play(playerId string, card string) error {
+	hand := d.hands[playerId]
+	for i, c := range hand {
+		if c == card {
+			d.hands[playerId] = append(hand[:i:i], hand[i+1:]...)
+			return nil
+		}
+	}
+	return NewError(ErrCodeStateInvalid)
+}
+
+/**
+亮出玩家的手牌,之后所有人都可以看到
+*/
+func (d *Deck) Show(playerId string) {
+	d.shown[playerId] = true
+}
+
+/**
+viewer查看owner的手牌,只有本人或已亮牌时可以查看
+*/
+func (d *Deck) Hand(viewer string, owner string) ([]string, error) {
+	if viewer != owner && !d.shown[owner] && !d.revealed {
+		return nil, NewError(ErrCodePermissionDenied)
+	}
+	return append([]string{}, d.hands[owner]...), nil
+}
+
+/**
+从某个玩家视角看到的手牌,看不到的只有张数
+*/
+type HandView struct {
+	Owner string
+	Count int
+	Cards []string `json:",omitempty"`
+}
+
+/**
+生成发给viewer的所有手牌,按玩家排序,观战者传空字符串
+*/
+func (d *Deck) View(viewer string) []HandView {
+	views := make([]HandView, 0, len(d.hands))
+	for owner, hand := range d.hands {
+		view := HandView{Owner: owner, Count: len(hand)}
+		if cards, err := d.Hand(viewer, owner); err == nil {
+			view.Cards = cards
+		}
+		views = append(views, view)
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Owner < views[j].Owner
+	})
+	return views
+}
+
+/**
+牌局结束后公开的数据,公开后所有手牌可见并且不能再发牌
+*/
+type DeckReveal struct {
+	Commitment string
+	ServerSeed string //hex
+	Entropy    []string
+	Cards      []string //洗牌前的牌
+	Order      []string //洗牌后的顺序
+}
+
+func (d *Deck) Reveal() (*DeckReveal, error) {
+	if !d.shuffled {
+		return nil, NewError(ErrCodeStateInvalid)
+	}
+	d.revealed = true
+	return &DeckReveal{
+		Commitment: d.Commitment(),
+		ServerSeed: hex.EncodeToString(d.serverSeed),
+		Entropy:    append([]string{}, d.entropy...),
+		Cards:      append([]string{}, d.cards...),
+		Order:      append([]string{}, d.order...),
+	}, nil
+}
+
+/**
+验证公开的种子和牌与开局前的承诺一致,并且洗牌结果可以复现
+客户端可以用同样的算法独立实现
+*/
+func VerifyDeck(commitment string, reveal *DeckReveal) bool {
+	seed, err := hex.DecodeString(reveal.ServerSeed)
+	if err != nil {
+		return false
+	}
+	if deckCommitment(seed, reveal.Cards) != commitment {
+		return false
+	}
+	order := shuffleCards(reveal.Cards, deckSeed(seed, reveal.Entropy))
+	if len(order) != len(reveal.Order) {
+		return false
+	}
+	for i := range order {
+		if order[i] != reveal.Order[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/hex"
+	"strconv"
+	"testing"
+)
+
+func TestDeck(t *testing.T) {
+	deck, err := NewDeck(StandardCards(), []byte("server-seed"))
+	assertEqual(t, err, nil)
+	commitment := deck.Commitment()
+	_, err = deck.Deal("p1", 2)
+	assertEqual(t, ErrorCode(err), ErrCodeStateInvalid)
+	deck.AddEntropy("p1-seed")
+	deck.AddEntropy("p2-seed")
+	assertEqual(t, deck.Shuffle(), nil)
+	assertEqual(t, ErrorCode(deck.AddEntropy("late")), ErrCodeStateInvalid)
+
+	//同样的种子和熵得到同样的顺序
+	same, _ := NewDeck(StandardCards(), []byte("server-seed"))
+	same.AddEntropy("p1-seed")
+	same.AddEntropy("p2-seed")
+	same.Shuffle()
+	p1, _ := deck.Deal("p1", 2)
+	p1same, _ := same.Deal("p1", 2)
+	assertEqual(t, p1[0], p1same[0])
+	assertEqual(t, p1[1], p1same[1])
+
+	deck.Deal("p2", 2)
+	deck.Burn(1)
+	deck.DealBoard(3)
+	assertEqual(t, deck.Remaining(), 52-8)
+
+	_, err = deck.Hand("p2", "p1")
+	assertEqual(t, ErrorCode(err), ErrCodePermissionDenied)
+	hand, _ := deck.Hand("p1", "p1")
+	assertEqual(t, len(hand), 2)
+	views := deck.View("p2")
+	assertEqual(t, views[0].Owner, "p1")
+	assertEqual(t, views[0].Count, 2)
+	assertEqual(t, len(views[0].Cards), 0)
+	assertEqual(t, len(views[1].Cards), 2)
+
+	assertEqual(t, deck.Play("p1", p1[0]), nil)
+	assertEqual(t, ErrorCode(deck.Play("p1", p1[0])), ErrCodeStateInvalid)
+	deck.Show("p1")
+	hand, _ = deck.Hand("p2", "p1")
+	assertEqual(t, len(hand), 1)
+
+	reveal, err := deck.Reveal()
+	assertEqual(t, err, nil)
+	assertEqual(t, VerifyDeck(commitment, reveal), true)
+	_, err = deck.Deal("p1", 1)
+	assertEqual(t, ErrorCode(err), ErrCodeStateInvalid)
+
+	reveal.Entropy = []string{"p1-seed"}
+	assertEqual(t, VerifyDeck(commitment, reveal), false)
+}
+
+func TestDeckTamperedCards(t *testing.T) {
+	deck, _ := NewDeck(StandardCards(), []byte("server-seed"))
+	commitment := deck.Commitment()
+	deck.Shuffle()
+	reveal, _ := deck.Reveal()
+
+	//服务器先决定发牌顺序(AS,AH最先发出),再反推出洗牌后恰好得到该顺序的Cards
+	stacked := []string{"AS", "AH"}
+	for _, card := range StandardCards() {
+		if card != "AS" && card != "AH" {
+			stacked = append(stacked, card)
+		}
+	}
+	seed, _ := hex.DecodeString(reveal.ServerSeed)
+	positions := make([]string, len(stacked))
+	for i := range positions {
+		positions[i] = strconv.Itoa(i)
+	}
+	forged := make([]string, len(stacked))
+	for i, position := range shuffleCards(positions, deckSeed(seed, reveal.Entropy)) {
+		from, _ := strconv.Atoi(position)
+		forged[from] = stacked[i]
+	}
+	reveal.Cards = forged
+	reveal.Order = shuffleCards(forged, deckSeed(seed, reveal.Entropy))
+	assertEqual(t, reveal.Order[0], "AS")
+	assertEqual(t, reveal.Order[1], "AH")
+	assertEqual(t, VerifyDeck(commitment, reveal), false)
+}
@@ -0,0 +1,186 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+/**
+返回给玩家的错误码,数值一经发布不能修改
+*/
+const (
+	ErrCodeUnknown            = 1000 //未知错误
+	ErrCodeTableFull          = 1001 //房间已满
+	ErrCodeBanned             = 1002 //被禁止加入
+	ErrCodeWrongPassword      = 1003 //房间密码错误
+	ErrCodeStateInvalid       = 1004 //当前状态不允许该操作
+	ErrCodeTableNotFound      = 1005 //房间不存在
+	ErrCodeNotSeated          = 1006 //不在该房间的座位上
+	ErrCodeUnknownGame        = 1007 //不支持的游戏类型
+	ErrCodeVersionConflict    = 1008 //属性已被修改,需要重新读取
+	ErrCodeTokenInvalid       = 1009 //重连凭证无效或已过期
+	ErrCodeUnsupportedVersion = 1010 //客户端协议版本不支持该操作
+	ErrCodeMaintenance        = 1011 //服务器维护中
+	ErrCodeNotInvited         = 1012 //不在table的允许名单中
+	ErrCodeLevelTooLow        = 1013 //等级不足
+	ErrCodeRegionRestricted   = 1014 //所在地区不允许加入
+	ErrCodeMuted              = 1015 //已被禁言
+	ErrCodeOverloaded         = 1016 //table繁忙,暂时不接受新消息
+	ErrCodePartyFull          = 1017 //队伍人数已满
+	ErrCodeNotPartyLeader     = 1018 //只有队长可以进行该操作
+	ErrCodeAlreadyInParty     = 1019 //已经在其他队伍中
+	ErrCodePartyNotFound      = 1020 //队伍不存在或玩家不在队伍中
+	ErrCodeQuotaExceeded      = 1021 //数据超过大小限制
+	ErrCodeNotYourTurn        = 1022 //还没有轮到该玩家操作
+	ErrCodePermissionDenied   = 1023 //没有执行该操作的权限
+	ErrCodeShedLoad           = 1024 //服务器过载,该游戏暂停接纳新玩家,参数为建议的重试间隔(秒)
+)
+
+var defaultMessages = map[int]string{
+	ErrCodeUnknown:            "未知错误",
+	ErrCodeTableFull:          "房间已满",
+	ErrCodeBanned:             "您已被禁止加入该房间",
+	ErrCodeWrongPassword:      "房间密码错误",
+	ErrCodeStateInvalid:       "当前状态不允许该操作",
+	ErrCodeTableNotFound:      "房间不存在",
+	ErrCodeNotSeated:          "您不在该房间中",
+	ErrCodeUnknownGame:        "不支持的游戏类型",
+	ErrCodeVersionConflict:    "数据已被修改,请重试",
+	ErrCodeTokenInvalid:       "重连凭证已失效,请重新进入房间",
+	ErrCodeUnsupportedVersion: "当前客户端版本(%v)不支持该操作,请更新客户端",
+	ErrCodeMaintenance:        "服务器维护中,请稍后再试",
+	ErrCodeNotInvited:         "该房间仅限受邀玩家加入",
+	ErrCodeLevelTooLow:        "需要达到%v级才能加入该房间",
+	ErrCodeRegionRestricted:   "您所在的地区无法加入该房间",
+	ErrCodeMuted:              "您已被禁言,解除时间%v",
+	ErrCodeOverloaded:         "房间繁忙,请稍后再试",
+	ErrCodePartyFull:          "队伍人数已满",
+	ErrCodeNotPartyLeader:     "只有队长可以进行该操作",
+	ErrCodeAlreadyInParty:     "您已经在其他队伍中",
+	ErrCodePartyNotFound:      "队伍不存在",
+	ErrCodeQuotaExceeded:      "%v超过大小限制%v",
+	ErrCodeNotYourTurn:        "还没有轮到您操作",
+	ErrCodePermissionDenied:   "您没有权限进行该操作",
+	ErrCodeShedLoad:           "服务器繁忙,请%v秒后再试",
+}
+
+/**
+房间操作的结构化错误,客户端根据Code渲染本地化的提示
+*/
+type RoomError struct {
+	Code   int
+	Params []interface{} //本地化消息模板参数
+}
+
+func NewError(code int, params ...interface{}) *RoomError {
+	return &RoomError{
+		Code:   code,
+		Params: params,
+	}
+}
+
+func (e *RoomError) Error() string {
+	return fmt.Sprintf("room error %d: %s", e.Code, e.Localize(""))
+}
+
+/**
+按locale返回本地化消息,目录中找不到时使用默认消息
+*/
+func (e *RoomError) Localize(locale string) string {
+	if catalog := GetCatalog(); catalog != nil {
+		if format, ok := catalog.Message(locale, e.Code); ok {
+			return formatMessage(format, e.Params)
+		}
+	}
+	if format, ok := defaultMessages[e.Code]; ok {
+		return formatMessage(format, e.Params)
+	}
+	return defaultMessages[ErrCodeUnknown]
+}
+
+/**
+Is 判断两个错误的错误码是否一致
+*/
+func (e *RoomError) Is(target error) bool {
+	t, ok := target.(*RoomError)
+	return ok && t.Code == e.Code
+}
+
+/**
+提取错误码,非RoomError返回ErrCodeUnknown,nil返回0
+*/
+func ErrorCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if e, ok := err.(*RoomError); ok {
+		return e.Code
+	}
+	return ErrCodeUnknown
+}
+
+/**
+注册新的错误码默认消息,游戏可以在init中扩展自己的错误码
+非协成安全,只能在init中调用
+*/
+func RegisterErrorMessage(code int, message string) {
+	defaultMessages[code] = message
+}
+
+func formatMessage(format string, params []interface{}) string {
+	if len(params) == 0 || !strings.Contains(format, "%") {
+		return format
+	}
+	return fmt.Sprintf(format, params...)
+}
+
+/**
+i18n消息目录,format可以包含fmt格式化占位符
+*/
+type Catalog interface {
+	Message(locale string, code int) (format string, ok bool)
+}
+
+var (
+	catalog     Catalog
+	catalogLock sync.RWMutex
+)
+
+func SetCatalog(c Catalog) {
+	catalogLock.Lock()
+	catalog = c
+	catalogLock.Unlock()
+}
+
+func GetCatalog() Catalog {
+	catalogLock.RLock()
+	defer catalogLock.RUnlock()
+	return catalog
+}
+
+/**
+基于map的消息目录 locale->code->format
+*/
+type MapCatalog map[string]map[int]string
+
+func (c MapCatalog) Message(locale string, code int) (string, bool) {
+	if messages, ok := c[locale]; ok {
+		format, ok := messages[code]
+		return format, ok
+	}
+	return "", false
+}
@@ -0,0 +1,32 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRoomErrorLocalize(t *testing.T) {
+	SetCatalog(MapCatalog{
+		"en": {ErrCodeTableFull: "table %v is full"},
+	})
+	defer SetCatalog(nil)
+	err := NewError(ErrCodeTableFull, "t1")
+	assertEqual(t, err.Localize("en"), "table t1 is full")
+	assertEqual(t, NewError(ErrCodeBanned).Localize("en"), "您已被禁止加入该房间")
+	assertEqual(t, ErrorCode(err), ErrCodeTableFull)
+	assertEqual(t, ErrorCode(fmt.Errorf("other")), ErrCodeUnknown)
+	assertEqual(t, ErrorCode(nil), 0)
+}
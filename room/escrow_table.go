@@ -0,0 +1,440 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"github.com/liangdas/mqant/log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/**
+玩家余额接口,所有方法都必须按holdId幂等
+Reserve冻结amount; Commit解冻并把payout加回玩家余额(冻结部分视为已支出); Rollback全额退回冻结部分
+对不存在或已经处理过的holdId,Commit/Rollback应返回nil
+对已经Commit/Rollback的holdId再次Reserve应返回错误,不能重新冻结
+参考实现见wallet包
+*/
+type Wallet interface {
+	Reserve(holdId string, userId string, amount int64) error
+	Commit(holdId string, payout int64) error
+	Rollback(holdId string) error
+}
+
+/**
+托管记录,进程崩溃后用于补偿
+Payouts不为空表示已经开始结算
+*/
+type EscrowRecord struct {
+	TableId string
+	Hand    string           //每一局的编号,与TableId,userId组成holdId
+	Holds   map[string]int64 //userId->冻结金额
+	Payouts map[string]int64 //userId->结算后返还金额
+}
+
+/**
+托管记录的持久化,必须在调用Wallet之前写入
+*/
+type EscrowJournal interface {
+	Save(record *EscrowRecord) error
+	Load(tableId string) (*EscrowRecord, error) //不存在时返回nil,nil
+	Delete(tableId string) error
+	TableIds() ([]string, error)
+}
+
+/**
+同一轮中的一个边池,只有Eligible中的玩家可以赢得
+*/
+type SidePot struct {
+	Amount   int64
+	Eligible []string
+}
+
+/**
+押注类游戏的资金托管
+入座时冻结玩家余额,每轮下注记入奖池,table结束时一次性结算
+只能在table协成中调用
+*/
+type EscrowTable struct {
+	tableId string
+	wallet  Wallet
+	journal EscrowJournal
+	hand    string //当前局的编号,第一个玩家冻结时生成
+	handSeq int64
+	holds   map[string]int64
+	stakes  map[string]int64         //冻结金额中还未下注的部分
+	pots    map[int]map[string]int64 //round->userId->下注
+	payouts map[string]int64         //不为nil表示结算结果已经写入日志,之后只能继续结算,不能再退回
+}
+
+func (this *EscrowTable) EscrowTableInit(tableId string, wallet Wallet, journal EscrowJournal) {
+	this.tableId = tableId
+	this.wallet = wallet
+	this.journal = journal
+	this.hand = ""
+	this.holds = map[string]int64{}
+	this.stakes = map[string]int64{}
+	this.pots = map[int]map[string]int64{}
+	this.payouts = nil
+}
+
+//结算中提交失败时,EscrowRelease立即重试的次数
+const escrowCommitRetries = 3
+
+/**
+Wallet按holdId幂等,同一个table的每一局必须使用不同的holdId
+hand为空时是旧版本的记录
+*/
+func escrowHoldId(tableId string, hand string, userId string) string {
+	if hand == "" {
+		return tableId + ":" + userId
+	}
+	return tableId + ":" + hand + ":" + userId
+}
+
+/**
+新一局的编号,包含时间避免进程重启后与之前的局重复
+*/
+func (this *EscrowTable) nextHand() string {
+	this.handSeq++
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "." + strconv.FormatInt(this.handSeq, 36)
+}
+
+func (this *EscrowTable) record(payouts map[string]int64) *EscrowRecord {
+	holds := make(map[string]int64, len(this.holds))
+	for userId, amount := range this.holds {
+		holds[userId] = amount
+	}
+	return &EscrowRecord{
+		TableId: this.tableId,
+		Hand:    this.hand,
+		Holds:   holds,
+		Payouts: payouts,
+	}
+}
+
+func (this *EscrowTable) save(payouts map[string]int64) error {
+	if this.journal == nil {
+		return nil
+	}
+	return this.journal.Save(this.record(payouts))
+}
+
+/**
+玩家入座时冻结amount
+*/
+func (this *EscrowTable) EscrowReserve(userId string, amount int64) error {
+	if this.wallet == nil {
+		return fmt.Errorf("table %v has no wallet", this.tableId)
+	}
+	if amount <= 0 {
+		return fmt.Errorf("invalid reserve amount %v", amount)
+	}
+	if this.payouts != nil {
+		return NewError(ErrCodeStateInvalid)
+	}
+	if _, ok := this.holds[userId]; ok {
+		return fmt.Errorf("player %v already reserved", userId)
+	}
+	if len(this.holds) == 0 {
+		this.hand = this.nextHand()
+	}
+	//先写日志再冻结,崩溃后补偿时对不存在的hold执行Rollback是安全的
+	this.holds[userId] = amount
+	if err := this.save(nil); err != nil {
+		delete(this.holds, userId)
+		return err
+	}
+	holdId := escrowHoldId(this.tableId, this.hand, userId)
+	if err := this.wallet.Reserve(holdId, userId, amount); err != nil {
+		delete(this.holds, userId)
+		//超时等情况下冻结可能已经生效,Rollback对不存在的hold是安全的
+		if rerr := this.wallet.Rollback(holdId); rerr != nil {
+			log.Warning("escrow rollback %v after reserve error %v: %v", holdId, err, rerr)
+		}
+		if len(this.holds) == 0 {
+			this.forget()
+		} else {
+			this.save(nil)
+		}
+		return err
+	}
+	this.stakes[userId] = amount
+	return nil
+}
+
+/**
+玩家在round轮下注amount
+*/
+func (this *EscrowTable) EscrowBet(round int, userId string, amount int64) error {
+	if this.payouts != nil || amount <= 0 || this.stakes[userId] < amount {
+		return NewError(ErrCodeStateInvalid)
+	}
+	pot, ok := this.pots[round]
+	if !ok {
+		pot = map[string]int64{}
+		this.pots[round] = pot
+	}
+	pot[userId] += amount
+	this.stakes[userId] -= amount
+	return nil
+}
+
+/**
+玩家剩余可下注金额
+*/
+func (this *EscrowTable) EscrowStake(userId string) int64 {
+	return this.stakes[userId]
+}
+
+/**
+round轮的总下注
+*/
+func (this *EscrowTable) EscrowPot(round int) int64 {
+	var total int64
+	for _, amount := range this.pots[round] {
+		total += amount
+	}
+	return total
+}
+
+/**
+按全下金额把round轮的下注拆分成主池和边池
+folded中的玩家下注计入奖池但不能赢取
+*/
+func (this *EscrowTable) EscrowSidePots(round int, folded map[string]bool) []SidePot {
+	return SidePots(this.pots[round], folded)
+}
+
+func SidePots(contributions map[string]int64, folded map[string]bool) []SidePot {
+	levels := []int64{}
+	seen := map[int64]bool{}
+	for userId, amount := range contributions {
+		if !folded[userId] && amount > 0 && !seen[amount] {
+			seen[amount] = true
+			levels = append(levels, amount)
+		}
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+	pots := []SidePot{}
+	var prev int64
+	for i, level := range levels {
+		pot := SidePot{}
+		for userId, amount := range contributions {
+			upper := amount
+			if i < len(levels)-1 && upper > level {
+				upper = level
+			}
+			if upper > prev {
+				pot.Amount += upper - prev
+			}
+			if !folded[userId] && amount >= level {
+				pot.Eligible = append(pot.Eligible, userId)
+			}
+		}
+		sort.Strings(pot.Eligible)
+		if pot.Amount > 0 {
+			pots = append(pots, pot)
+		}
+		prev = level
+	}
+	return pots
+}
+
+/**
+结算,payouts为每个玩家最终返还的金额(包括未下注的部分)
+返还总额不能超过冻结总额,差额为抽水
+结算结果写入日志后即进入结算状态,提交失败时返回错误并保留日志,
+之后再次调用EscrowSettle或EscrowRelease会按已记录的结果继续提交,不会退回冻结
+*/
+func (this *EscrowTable) EscrowSettle(payouts map[string]int64) error {
+	if this.payouts != nil {
+		return this.commit()
+	}
+	var reserved, paid int64
+	for _, amount := range this.holds {
+		reserved += amount
+	}
+	for userId, amount := range payouts {
+		if _, ok := this.holds[userId]; !ok {
+			return fmt.Errorf("player %v has no reserve", userId)
+		}
+		if amount < 0 {
+			return fmt.Errorf("invalid payout %v for player %v", amount, userId)
+		}
+		paid += amount
+	}
+	if paid > reserved {
+		return fmt.Errorf("payout %v exceeds reserved %v", paid, reserved)
+	}
+	//先记录结算结果,崩溃后按同样的结果继续结算
+	if err := this.save(payouts); err != nil {
+		return err
+	}
+	this.payouts = payouts
+	return this.commit()
+}
+
+/**
+按已记录的结算结果提交,全部成功后才删除日志
+*/
+func (this *EscrowTable) commit() error {
+	if err := commitEscrow(this.wallet, this.record(this.payouts)); err != nil {
+		return err
+	}
+	return this.clear()
+}
+
+/**
+是否已经开始结算
+*/
+func (this *EscrowTable) EscrowSettling() bool {
+	return this.payouts != nil
+}
+
+/**
+退回所有冻结金额,table中途解散时使用
+已经开始结算时改为重试提交,多次失败后返回错误并保留日志,由RecoverEscrow继续结算
+*/
+func (this *EscrowTable) EscrowRelease() error {
+	if len(this.holds) == 0 {
+		return nil
+	}
+	if this.payouts != nil {
+		var err error
+		for i := 0; i < escrowCommitRetries; i++ {
+			if err = this.commit(); err == nil {
+				return nil
+			}
+		}
+		return err
+	}
+	if err := rollbackEscrow(this.wallet, this.record(nil)); err != nil {
+		return err
+	}
+	return this.clear()
+}
+
+func (this *EscrowTable) forget() error {
+	this.hand = ""
+	if this.journal == nil {
+		return nil
+	}
+	return this.journal.Delete(this.tableId)
+}
+
+func (this *EscrowTable) clear() error {
+	this.holds = map[string]int64{}
+	this.stakes = map[string]int64{}
+	this.pots = map[int]map[string]int64{}
+	this.payouts = nil
+	return this.forget()
+}
+
+func commitEscrow(wallet Wallet, record *EscrowRecord) error {
+	for userId := range record.Holds {
+		if err := wallet.Commit(escrowHoldId(record.TableId, record.Hand, userId), record.Payouts[userId]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rollbackEscrow(wallet Wallet, record *EscrowRecord) error {
+	for userId := range record.Holds {
+		if err := wallet.Rollback(escrowHoldId(record.TableId, record.Hand, userId)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+进程启动时调用,处理崩溃前没有完成的托管
+已经开始结算的按记录的结果继续结算,其余全部退回
+*/
+func RecoverEscrow(wallet Wallet, journal EscrowJournal) error {
+	tableIds, err := journal.TableIds()
+	if err != nil {
+		return err
+	}
+	for _, tableId := range tableIds {
+		record, err := journal.Load(tableId)
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			continue
+		}
+		if record.Payouts != nil {
+			err = commitEscrow(wallet, record)
+		} else {
+			err = rollbackEscrow(wallet, record)
+		}
+		if err != nil {
+			return err
+		}
+		if err := journal.Delete(tableId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+基于内存的EscrowJournal,只用于测试
+*/
+type MemoryEscrowJournal struct {
+	lock    sync.Mutex
+	records map[string]*EscrowRecord
+}
+
+func NewMemoryEscrowJournal() *MemoryEscrowJournal {
+	return &MemoryEscrowJournal{
+		records: map[string]*EscrowRecord{},
+	}
+}
+
+func (self *MemoryEscrowJournal) Save(record *EscrowRecord) error {
+	self.lock.Lock()
+	self.records[record.TableId] = record
+	self.lock.Unlock()
+	return nil
+}
+
+func (self *MemoryEscrowJournal) Load(tableId string) (*EscrowRecord, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.records[tableId], nil
+}
+
+func (self *MemoryEscrowJournal) Delete(tableId string) error {
+	self.lock.Lock()
+	delete(self.records, tableId)
+	self.lock.Unlock()
+	return nil
+}
+
+func (self *MemoryEscrowJournal) TableIds() ([]string, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	tableIds := make([]string, 0, len(self.records))
+	for tableId := range self.records {
+		tableIds = append(tableIds, tableId)
+	}
+	return tableIds, nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testWallet struct {
+	reserved  map[string]int64
+	committed map[string]int64
+	rollback  map[string]bool
+}
+
+func newTestWallet() *testWallet {
+	return &testWallet{
+		reserved:  map[string]int64{},
+		committed: map[string]int64{},
+		rollback:  map[string]bool{},
+	}
+}
+
+func (w *testWallet) Reserve(holdId string, userId string, amount int64) error {
+	w.reserved[holdId] = amount
+	return nil
+}
+
+func (w *testWallet) Commit(holdId string, payout int64) error {
+	w.committed[holdId] = payout
+	return nil
+}
+
+func (w *testWallet) Rollback(holdId string) error {
+	w.rollback[holdId] = true
+	return nil
+}
+
+func TestSidePots(t *testing.T) {
+	pots := SidePots(map[string]int64{"a": 50, "b": 100, "c": 100, "d": 30}, map[string]bool{"d": true})
+	assertEqual(t, len(pots), 2)
+	assertEqual(t, pots[0].Amount, int64(180))
+	assertEqual(t, len(pots[0].Eligible), 3)
+	assertEqual(t, pots[1].Amount, int64(100))
+	assertEqual(t, pots[1].Eligible[0], "b")
+	assertEqual(t, pots[1].Eligible[1], "c")
+}
+
+func TestEscrowSettleAndRecover(t *testing.T) {
+	wallet := newTestWallet()
+	journal := NewMemoryEscrowJournal()
+	escrow := &EscrowTable{}
+	escrow.EscrowTableInit("t1", wallet, journal)
+	if err := escrow.EscrowReserve("a", 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := escrow.EscrowReserve("b", 100); err != nil {
+		t.Fatal(err)
+	}
+	hand := escrow.hand
+	if err := escrow.EscrowBet(1, "a", 60); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, escrow.EscrowStake("a"), int64(40))
+	if err := escrow.EscrowBet(1, "a", 60); err == nil {
+		t.Fatal("bet over stake should fail")
+	}
+	if err := escrow.EscrowSettle(map[string]int64{"a": 300}); err == nil {
+		t.Fatal("payout over reserved should fail")
+	}
+	if err := escrow.EscrowSettle(map[string]int64{"a": 40, "b": 155}); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, wallet.committed[escrowHoldId("t1", hand, "b")], int64(155))
+	record, _ := journal.Load("t1")
+	assertEqual(t, record == nil, true)
+
+	//崩溃前没有结算的托管全部退回
+	escrow.EscrowTableInit("t2", wallet, journal)
+	escrow.EscrowReserve("c", 100)
+	hand = escrow.hand
+	if err := RecoverEscrow(wallet, journal); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, wallet.rollback[escrowHoldId("t2", hand, "c")], true)
+	tableIds, _ := journal.TableIds()
+	assertEqual(t, len(tableIds), 0)
+}
+
+type failingWallet struct {
+	testWallet
+}
+
+func (w *failingWallet) Reserve(holdId string, userId string, amount int64) error {
+	return fmt.Errorf("insufficient balance")
+}
+
+func TestEscrowHands(t *testing.T) {
+	wallet := newTestWallet()
+	escrow := &EscrowTable{}
+	escrow.EscrowTableInit("t1", wallet, NewMemoryEscrowJournal())
+	holds := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		escrow.EscrowReserve("a", 100)
+		escrow.EscrowReserve("b", 100)
+		holds[escrowHoldId("t1", escrow.hand, "a")] = true
+		if err := escrow.EscrowSettle(map[string]int64{"a": 150, "b": 50}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//每一局使用不同的holdId,否则幂等的钱包不会再次扣款
+	assertEqual(t, len(holds), 2)
+	assertEqual(t, len(wallet.committed), 4)
+
+	journal := NewMemoryEscrowJournal()
+	failing := &failingWallet{testWallet: *newTestWallet()}
+	escrow.EscrowTableInit("t2", failing, journal)
+	if err := escrow.EscrowReserve("a", 100); err == nil {
+		t.Fatal("reserve should fail")
+	}
+	record, _ := journal.Load("t2")
+	assertEqual(t, record == nil, true)
+	assertEqual(t, len(failing.rollback), 1)
+}
+
+//对指定玩家的hold提交失败fails次
+type flakyWallet struct {
+	testWallet
+	failUser string
+	fails    int
+}
+
+func (w *flakyWallet) Commit(holdId string, payout int64) error {
+	if w.fails > 0 && strings.HasSuffix(holdId, ":"+w.failUser) {
+		w.fails--
+		return fmt.Errorf("wallet unavailable")
+	}
+	return w.testWallet.Commit(holdId, payout)
+}
+
+func TestEscrowSettleFailure(t *testing.T) {
+	wallet := &flakyWallet{testWallet: *newTestWallet(), failUser: "b", fails: 1}
+	journal := NewMemoryEscrowJournal()
+	escrow := &EscrowTable{}
+	escrow.EscrowTableInit("t1", wallet, journal)
+	escrow.EscrowReserve("a", 100)
+	escrow.EscrowReserve("b", 100)
+	hand := escrow.hand
+	assertEqual(t, escrow.EscrowSettle(map[string]int64{"a": 150, "b": 50}) != nil, true)
+	assertEqual(t, escrow.EscrowSettling(), true)
+	record, _ := journal.Load("t1")
+	assertEqual(t, record != nil && record.Payouts != nil, true)
+	//结算中不能再冻结或下注
+	assertEqual(t, ErrorCode(escrow.EscrowReserve("c", 100)), ErrCodeStateInvalid)
+
+	//table结束时继续提交而不是退回
+	assertEqual(t, escrow.EscrowRelease(), nil)
+	assertEqual(t, len(wallet.rollback), 0)
+	assertEqual(t, wallet.committed[escrowHoldId("t1", hand, "a")], int64(150))
+	assertEqual(t, wallet.committed[escrowHoldId("t1", hand, "b")], int64(50))
+	record, _ = journal.Load("t1")
+	assertEqual(t, record == nil, true)
+
+	//一直失败时保留日志,恢复后由RecoverEscrow按记录结算
+	wallet.fails = escrowCommitRetries + 1
+	escrow.EscrowReserve("a", 100)
+	escrow.EscrowReserve("b", 100)
+	hand = escrow.hand
+	assertEqual(t, escrow.EscrowSettle(map[string]int64{"a": 200}) != nil, true)
+	assertEqual(t, escrow.EscrowRelease() != nil, true)
+	assertEqual(t, len(wallet.rollback), 0)
+	record, _ = journal.Load("t1")
+	assertEqual(t, record != nil, true)
+	assertEqual(t, RecoverEscrow(wallet, journal), nil)
+	assertEqual(t, len(wallet.rollback), 0)
+	assertEqual(t, wallet.committed[escrowHoldId("t1", hand, "a")], int64(200))
+	_, ok := wallet.committed[escrowHoldId("t1", hand, "b")]
+	assertEqual(t, ok, true)
+}
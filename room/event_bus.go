@@ -0,0 +1,273 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"github.com/garyburd/redigo/redis"
+	"github.com/liangdas/mqant/log"
+	"sync"
+	"time"
+)
+
+//Room发布的事件类型,游戏可以通过Room.PublishEvent发布自定义事件
+const (
+	EventTableCreated   = "table.created"
+	EventTableDestroyed = "table.destroyed"
+	EventTableSettled   = "table.settled" //Data为[]*PlayerResult
+)
+
+/**
+table事件
+Node为空表示本节点产生的事件,从其他节点转发过来的事件Data为JSON解码后的通用结构
+*/
+type RoomEvent struct {
+	Type     string
+	TableId  string
+	GameType string
+	UserId   string
+	Data     interface{}
+	Node     string
+	Time     int64 //单位毫秒
+}
+
+type EventHandler func(event *RoomEvent)
+
+/**
+进程内的事件总线,handler在发布者的协成中同步调用,不能阻塞
+*/
+type EventBus struct {
+	lock     sync.RWMutex
+	handlers map[int]EventHandler
+	next     int
+	clock    Clock
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		handlers: map[int]EventHandler{},
+		clock:    RealClock,
+	}
+}
+
+/**
+事件时间使用的时钟,默认RealClock,Room的总线使用RoomClock,只能在使用前设置
+*/
+func (self *EventBus) SetClock(clock Clock) {
+	self.clock = clock
+}
+
+/**
+订阅所有事件,返回取消订阅的函数
+*/
+func (self *EventBus) Subscribe(handler EventHandler) func() {
+	self.lock.Lock()
+	id := self.next
+	self.next++
+	self.handlers[id] = handler
+	self.lock.Unlock()
+	return func() {
+		self.lock.Lock()
+		delete(self.handlers, id)
+		self.lock.Unlock()
+	}
+}
+
+func (self *EventBus) Publish(event *RoomEvent) {
+	if event.Time == 0 {
+		event.Time = self.clock.Now().UnixNano() / int64(time.Millisecond)
+	}
+	self.lock.RLock()
+	handlers := make([]EventHandler, 0, len(self.handlers))
+	for _, handler := range self.handlers {
+		handlers = append(handlers, handler)
+	}
+	self.lock.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+/**
+Room的事件总线
+*/
+func (self *Room) Events() *EventBus {
+	return self.events
+}
+
+/**
+发布table相关的事件
+*/
+func (self *Room) PublishEvent(eventType string, tableId string, userId string, data interface{}) {
+	self.events.Publish(&RoomEvent{
+		Type:     eventType,
+		TableId:  tableId,
+		GameType: self.GameType(tableId),
+		UserId:   userId,
+		Data:     data,
+	})
+}
+
+/**
+结算结果中单个玩家的部分
+*/
+type PlayerResult struct {
+	UserId string
+	Rank   int   //名次,从1开始,0表示不排名
+	Score  int64 //本局输赢
+	Extra  map[string]interface{}
+}
+
+/**
+发布结算结果,战绩,排位分等模块订阅EventTableSettled获取
+*/
+func (self *Room) PublishSettlement(tableId string, results []*PlayerResult) {
+	self.PublishEvent(EventTableSettled, tableId, "", results)
+}
+
+//RedisEventBridge等待发布的最大事件数,超过时丢弃新事件
+const bridgeBacklog = 1024
+
+/**
+把事件总线桥接到redis pub/sub
+本节点的事件由单独的协成按顺序发布到channel,不阻塞EventBus.Publish,其他节点发布的事件转发到本地总线,大厅等模块订阅本地总线即可看到整个集群的事件
+*/
+type RedisEventBridge struct {
+	bus         *EventBus
+	pool        *redis.Pool
+	channel     string
+	node        string
+	unsubscribe func()
+	lock        sync.Mutex
+	conn        *redis.PubSubConn
+	outbox      chan []byte
+	closed      chan bool
+}
+
+/**
+node为本节点的唯一标识,用来过滤自己发布的事件
+*/
+func NewRedisEventBridge(bus *EventBus, pool *redis.Pool, channel string, node string) *RedisEventBridge {
+	bridge := &RedisEventBridge{
+		bus:     bus,
+		pool:    pool,
+		channel: channel,
+		node:    node,
+		outbox:  make(chan []byte, bridgeBacklog),
+		closed:  make(chan bool),
+	}
+	bridge.unsubscribe = bus.Subscribe(bridge.forward)
+	go bridge.publish()
+	go bridge.run()
+	return bridge
+}
+
+func (self *RedisEventBridge) Close() {
+	self.unsubscribe()
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	select {
+	case <-self.closed:
+		return
+	default:
+	}
+	close(self.closed)
+	if self.conn != nil {
+		self.conn.Close()
+	}
+}
+
+func (self *RedisEventBridge) forward(event *RoomEvent) {
+	if event.Node != "" {
+		return
+	}
+	forward := *event
+	forward.Node = self.node
+	data, err := json.Marshal(&forward)
+	if err != nil {
+		log.Warning("marshal room event %v error %v", event.Type, err)
+		return
+	}
+	select {
+	case self.outbox <- data:
+	default:
+		log.Warning("room event bridge backlog full, drop event %v", event.Type)
+	}
+}
+
+func (self *RedisEventBridge) publish() {
+	for {
+		select {
+		case <-self.closed:
+			return
+		case data := <-self.outbox:
+			conn := self.pool.Get()
+			if _, err := conn.Do("PUBLISH", self.channel, data); err != nil {
+				log.Warning("publish room event to %v error %v", self.channel, err)
+			}
+			conn.Close()
+		}
+	}
+}
+
+func (self *RedisEventBridge) run() {
+	for {
+		if err := self.consume(); err != nil {
+			log.Warning("consume room events %v error %v", self.channel, err)
+		}
+		select {
+		case <-self.closed:
+			return
+		case <-self.bus.clock.After(time.Second):
+		}
+	}
+}
+
+func (self *RedisEventBridge) consume() error {
+	self.lock.Lock()
+	select {
+	case <-self.closed:
+		self.lock.Unlock()
+		return nil
+	default:
+	}
+	conn := &redis.PubSubConn{Conn: self.pool.Get()}
+	self.conn = conn
+	self.lock.Unlock()
+	defer conn.Close()
+	if err := conn.Subscribe(self.channel); err != nil {
+		return err
+	}
+	for {
+		switch v := conn.Receive().(type) {
+		case redis.Message:
+			event := &RoomEvent{}
+			if err := json.Unmarshal(v.Data, event); err != nil {
+				log.Warning("invalid room event %v", err)
+				continue
+			}
+			if event.Node == self.node {
+				continue
+			}
+			self.bus.Publish(event)
+		case error:
+			select {
+			case <-self.closed:
+				return nil
+			default:
+				return v
+			}
+		}
+	}
+}
@@ -0,0 +1,396 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+/**
+table状态变更事件,状态只能通过按顺序Apply事件得到
+*/
+type TableEvent struct {
+	Seq  int64 //从1开始连续递增
+	Type string
+	Time int64 //单位毫秒
+	Data []byte
+}
+
+/**
+Seq时刻的完整状态
+*/
+type TableSnapshot struct {
+	Seq  int64
+	Data []byte
+}
+
+/**
+由游戏实现,负责根据事件修改状态以及状态的序列化
+Apply必须是确定性的,相同的事件序列必须得到相同的状态
+*/
+type EventApplier interface {
+	Apply(event *TableEvent) error
+	Snapshot() ([]byte, error)
+	Restore(snapshot []byte) error
+}
+
+/**
+事件持久化,用于崩溃后恢复
+*/
+type EventStore interface {
+	Append(tableId string, event *TableEvent) error
+	SaveSnapshot(tableId string, snapshot *TableSnapshot) error
+	//返回最新的快照以及快照之后的所有事件,没有快照时snapshot为nil
+	Load(tableId string) (snapshot *TableSnapshot, events []*TableEvent, err error)
+}
+
+/**
+可选,EventStore实现后table才能在持久化的情况下Rewind
+删除Seq大于after的事件和快照
+*/
+type EventTruncater interface {
+	Truncate(tableId string, after int64) error
+}
+
+//内存中默认保留的快照数量
+const DefaultSnapshotRetention = 1
+
+/**
+事件溯源table组件,可选,与可变状态的table二选一
+内存中只保留最近retention个快照以及最早保留的快照之后的事件,Rewind和StateAt只能回到这个范围内
+*/
+type EventSourcedTable struct {
+	tableId       string
+	applier       EventApplier
+	store         EventStore
+	snapshotEvery int
+	seq           int64
+	events        []*TableEvent
+	snapshots     []*TableSnapshot
+	retention     int //保留的快照数量,0表示全部保留
+	clock         func() Clock
+}
+
+/**
+snapshotEvery 每多少个事件生成一次快照,0表示不生成
+store 可以为nil,为nil时事件只保存在内存中
+*/
+func (this *EventSourcedTable) EventSourcedTableInit(tableId string, applier EventApplier, snapshotEvery int, store EventStore) {
+	this.tableId = tableId
+	this.applier = applier
+	this.store = store
+	this.snapshotEvery = snapshotEvery
+	this.seq = 0
+	this.events = nil
+	this.snapshots = nil
+	this.retention = DefaultSnapshotRetention
+	if this.clock == nil {
+		this.clock = func() Clock { return RealClock }
+	}
+}
+
+/**
+事件时间使用的时钟,默认RealClock,与QTable一起使用时传入table的Clock
+	this.SetEventClock(this.Clock)
+*/
+func (this *EventSourcedTable) SetEventClock(clock func() Clock) {
+	this.clock = clock
+}
+
+/**
+内存中保留的快照数量,0表示全部保留,需要回退或比较更早的状态时调大
+没有设置snapshotEvery时只有初始快照,事件不会被清理
+在EventSourcedTableInit之后调用
+*/
+func (this *EventSourcedTable) SetEventRetention(snapshots int) {
+	if snapshots < 0 {
+		snapshots = 0
+	}
+	this.retention = snapshots
+}
+
+/**
+产生一个事件并立即应用到状态上
+Apply或持久化失败时状态恢复到产生事件之前,Seq不变
+只能在table协成中调用
+*/
+func (this *EventSourcedTable) Emit(eventType string, data []byte) (*TableEvent, error) {
+	if this.seq == 0 && len(this.snapshots) == 0 {
+		//保存初始状态,保证可以回退到任意位置
+		if _, err := this.TakeSnapshot(); err != nil {
+			return nil, err
+		}
+	}
+	event := &TableEvent{
+		Seq:  this.seq + 1,
+		Type: eventType,
+		Time: this.clock().Now().UnixNano() / int64(time.Millisecond),
+		Data: data,
+	}
+	//先应用再持久化,Apply失败的事件不会写入EventStore
+	if err := this.applier.Apply(event); err != nil {
+		return nil, this.discard(err)
+	}
+	if this.store != nil {
+		if err := this.store.Append(this.tableId, event); err != nil {
+			return nil, this.discard(err)
+		}
+	}
+	this.seq = event.Seq
+	this.events = append(this.events, event)
+	if this.snapshotEvery > 0 && this.seq%int64(this.snapshotEvery) == 0 {
+		if _, err := this.TakeSnapshot(); err != nil {
+			return event, err
+		}
+	}
+	return event, nil
+}
+
+/**
+丢弃没有生效的事件,Apply可能已经修改了部分状态,从快照重建当前Seq的状态
+*/
+func (this *EventSourcedTable) discard(err error) error {
+	if rerr := this.replay(this.seq); rerr != nil {
+		return fmt.Errorf("%v, rebuild state error %v", err, rerr)
+	}
+	return err
+}
+
+/**
+从seq之前最近的快照开始重放事件,得到seq时刻的状态
+*/
+func (this *EventSourcedTable) replay(seq int64) error {
+	var base *TableSnapshot
+	for _, snapshot := range this.snapshots {
+		if snapshot.Seq <= seq {
+			base = snapshot
+		}
+	}
+	if base == nil {
+		return fmt.Errorf("no snapshot before seq %v", seq)
+	}
+	if err := this.applier.Restore(base.Data); err != nil {
+		return err
+	}
+	for _, event := range this.events {
+		if event.Seq > base.Seq && event.Seq <= seq {
+			if err := this.applier.Apply(event); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/**
+只保留最近retention个快照以及之后的事件
+*/
+func (this *EventSourcedTable) prune() {
+	if this.retention <= 0 || len(this.snapshots) <= this.retention {
+		return
+	}
+	this.snapshots = append([]*TableSnapshot{}, this.snapshots[len(this.snapshots)-this.retention:]...)
+	this.events = append([]*TableEvent{}, this.events[this.indexOf(this.snapshots[0].Seq):]...)
+}
+
+/**
+立即生成当前状态的快照
+*/
+func (this *EventSourcedTable) TakeSnapshot() (*TableSnapshot, error) {
+	data, err := this.applier.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &TableSnapshot{Seq: this.seq, Data: data}
+	this.snapshots = append(this.snapshots, snapshot)
+	this.prune()
+	if this.store != nil {
+		if err := this.store.SaveSnapshot(this.tableId, snapshot); err != nil {
+			return snapshot, err
+		}
+	}
+	return snapshot, nil
+}
+
+func (this *EventSourcedTable) Seq() int64 {
+	return this.seq
+}
+
+/**
+返回Seq大于after的所有事件(审计,回放)
+*/
+func (this *EventSourcedTable) Events(after int64) []*TableEvent {
+	for i, event := range this.events {
+		if event.Seq > after {
+			return this.events[i:]
+		}
+	}
+	return nil
+}
+
+/**
+内存中保留的所有快照,按Seq从小到大排列
+*/
+func (this *EventSourcedTable) Snapshots() []*TableSnapshot {
+	return this.snapshots
+}
+
+/**
+把状态回退到seq时刻,seq之后的事件会被丢弃
+设置了EventStore时同时删除已持久化的事件,EventStore必须实现EventTruncater,
+否则之后产生的事件会与丢弃的事件Seq重复
+*/
+func (this *EventSourcedTable) Rewind(seq int64) error {
+	if seq > this.seq || seq < 0 {
+		return fmt.Errorf("rewind seq %v out of range [0,%v]", seq, this.seq)
+	}
+	var truncater EventTruncater
+	if this.store != nil {
+		var ok bool
+		if truncater, ok = this.store.(EventTruncater); !ok {
+			return fmt.Errorf("table %v EventStore does not support rewind", this.tableId)
+		}
+	}
+	if err := this.replay(seq); err != nil {
+		return err
+	}
+	this.seq = seq
+	this.events = this.events[:this.indexOf(seq)]
+	snapshots := this.snapshots[:0]
+	for _, snapshot := range this.snapshots {
+		if snapshot.Seq <= seq {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	this.snapshots = snapshots
+	if truncater != nil {
+		if err := truncater.Truncate(this.tableId, seq); err != nil {
+			return err
+		}
+		//EventStore可能只保留最新的快照,重新保存回退后的状态
+		data, err := this.applier.Snapshot()
+		if err != nil {
+			return err
+		}
+		return this.store.SaveSnapshot(this.tableId, &TableSnapshot{Seq: seq, Data: data})
+	}
+	return nil
+}
+
+/**
+从EventStore恢复状态,应在table启动时调用
+*/
+func (this *EventSourcedTable) Recover() error {
+	if this.store == nil {
+		return fmt.Errorf("table %v has no EventStore", this.tableId)
+	}
+	snapshot, events, err := this.store.Load(this.tableId)
+	if err != nil {
+		return err
+	}
+	this.seq = 0
+	this.events = nil
+	this.snapshots = nil
+	if snapshot != nil {
+		if err := this.applier.Restore(snapshot.Data); err != nil {
+			return err
+		}
+		this.seq = snapshot.Seq
+		this.snapshots = append(this.snapshots, snapshot)
+	}
+	for _, event := range events {
+		if event.Seq != this.seq+1 {
+			return fmt.Errorf("table %v event seq %v not continuous after %v", this.tableId, event.Seq, this.seq)
+		}
+		if err := this.applier.Apply(event); err != nil {
+			return err
+		}
+		this.seq = event.Seq
+		this.events = append(this.events, event)
+	}
+	return nil
+}
+
+/**
+events中第一个Seq大于seq的下标
+*/
+func (this *EventSourcedTable) indexOf(seq int64) int {
+	for i, event := range this.events {
+		if event.Seq > seq {
+			return i
+		}
+	}
+	return len(this.events)
+}
+
+/**
+基于内存的EventStore,主要用于测试
+*/
+type MemoryEventStore struct {
+	lock      sync.Mutex
+	events    map[string][]*TableEvent
+	snapshots map[string]*TableSnapshot
+}
+
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{
+		events:    map[string][]*TableEvent{},
+		snapshots: map[string]*TableSnapshot{},
+	}
+}
+
+func (self *MemoryEventStore) Append(tableId string, event *TableEvent) error {
+	self.lock.Lock()
+	self.events[tableId] = append(self.events[tableId], event)
+	self.lock.Unlock()
+	return nil
+}
+
+func (self *MemoryEventStore) SaveSnapshot(tableId string, snapshot *TableSnapshot) error {
+	self.lock.Lock()
+	self.snapshots[tableId] = snapshot
+	self.lock.Unlock()
+	return nil
+}
+
+func (self *MemoryEventStore) Truncate(tableId string, after int64) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	events := self.events[tableId]
+	for i, event := range events {
+		if event.Seq > after {
+			self.events[tableId] = events[:i]
+			break
+		}
+	}
+	if snapshot := self.snapshots[tableId]; snapshot != nil && snapshot.Seq > after {
+		delete(self.snapshots, tableId)
+	}
+	return nil
+}
+
+func (self *MemoryEventStore) Load(tableId string) (*TableSnapshot, []*TableEvent, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	snapshot := self.snapshots[tableId]
+	events := []*TableEvent{}
+	for _, event := range self.events[tableId] {
+		if snapshot == nil || event.Seq > snapshot.Seq {
+			events = append(events, event)
+		}
+	}
+	return snapshot, events, nil
+}
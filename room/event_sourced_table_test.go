@@ -0,0 +1,202 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type counterApplier struct {
+	total int
+}
+
+func (c *counterApplier) Apply(event *TableEvent) error {
+	n, err := strconv.Atoi(string(event.Data))
+	if err != nil {
+		return err
+	}
+	c.total += n
+	return nil
+}
+
+func (c *counterApplier) Snapshot() ([]byte, error) {
+	return []byte(strconv.Itoa(c.total)), nil
+}
+
+func (c *counterApplier) Restore(snapshot []byte) (err error) {
+	c.total, err = strconv.Atoi(string(snapshot))
+	return err
+}
+
+func TestEventSourcedTable(t *testing.T) {
+	store := NewMemoryEventStore()
+	state := &counterApplier{}
+	table := &EventSourcedTable{}
+	table.EventSourcedTableInit("t1", state, 2, store)
+	table.SetEventRetention(0)
+	for i := 1; i <= 5; i++ {
+		if _, err := table.Emit("add", []byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertEqual(t, state.total, 15)
+	assertEqual(t, len(table.Events(3)), 2)
+
+	assertEqual(t, table.Rewind(3), nil)
+	assertEqual(t, state.total, 6)
+	assertEqual(t, table.Seq(), int64(3))
+
+	//回退后的新事件沿用被丢弃的Seq,恢复时不能混入旧的事件
+	event, err := table.Emit("add", []byte("10"))
+	assertEqual(t, err, nil)
+	assertEqual(t, event.Seq, int64(4))
+	assertEqual(t, state.total, 16)
+
+	recovered := &counterApplier{}
+	other := &EventSourcedTable{}
+	other.EventSourcedTableInit("t1", recovered, 2, store)
+	assertEqual(t, other.Recover(), nil)
+	assertEqual(t, recovered.total, 16)
+	assertEqual(t, other.Seq(), int64(4))
+}
+
+type appendOnlyStore struct {
+	failing bool
+}
+
+func (s *appendOnlyStore) Append(tableId string, event *TableEvent) error {
+	if s.failing {
+		return fmt.Errorf("store unavailable")
+	}
+	return nil
+}
+
+func (s *appendOnlyStore) SaveSnapshot(tableId string, snapshot *TableSnapshot) error {
+	return nil
+}
+
+func (s *appendOnlyStore) Load(tableId string) (*TableSnapshot, []*TableEvent, error) {
+	return nil, nil, nil
+}
+
+func TestEventSourcedTableStore(t *testing.T) {
+	store := &appendOnlyStore{}
+	state := &counterApplier{}
+	table := &EventSourcedTable{}
+	table.EventSourcedTableInit("t1", state, 0, store)
+	table.Emit("add", []byte("1"))
+	table.Emit("add", []byte("2"))
+
+	//持久化失败的事件不应用到状态上
+	store.failing = true
+	_, err := table.Emit("add", []byte("3"))
+	assertEqual(t, err != nil, true)
+	assertEqual(t, state.total, 3)
+	assertEqual(t, table.Seq(), int64(2))
+
+	//不支持删除事件的EventStore不能回退
+	assertEqual(t, table.Rewind(1) != nil, true)
+	assertEqual(t, state.total, 3)
+}
+
+func TestEventSourcedTableApplyFailure(t *testing.T) {
+	store := NewMemoryEventStore()
+	state := &counterApplier{}
+	table := &EventSourcedTable{}
+	table.EventSourcedTableInit("t1", state, 0, store)
+	table.Emit("add", []byte("1"))
+	//Apply失败的事件不写入EventStore,下一个事件的Seq不会与它重复
+	_, err := table.Emit("add", []byte("x"))
+	assertEqual(t, err != nil, true)
+	assertEqual(t, table.Seq(), int64(1))
+	event, err := table.Emit("add", []byte("2"))
+	assertEqual(t, err, nil)
+	assertEqual(t, event.Seq, int64(2))
+
+	recovered := &counterApplier{}
+	other := &EventSourcedTable{}
+	other.EventSourcedTableInit("t1", recovered, 0, store)
+	assertEqual(t, other.Recover(), nil)
+	assertEqual(t, recovered.total, state.total)
+	assertEqual(t, other.Seq(), int64(2))
+}
+
+func TestEventSourcedTablePrune(t *testing.T) {
+	state := &counterApplier{}
+	table := &EventSourcedTable{}
+	table.EventSourcedTableInit("t1", state, 2, nil)
+	for i := 1; i <= 5; i++ {
+		table.Emit("add", []byte(strconv.Itoa(i)))
+	}
+	//只保留最新的快照以及之后的事件
+	assertEqual(t, len(table.Snapshots()), 1)
+	assertEqual(t, table.Snapshots()[0].Seq, int64(4))
+	assertEqual(t, len(table.Events(0)), 1)
+	assertEqual(t, table.Rewind(3) != nil, true)
+	assertEqual(t, state.total, 15)
+	assertEqual(t, table.Rewind(4), nil)
+	assertEqual(t, state.total, 10)
+
+	table.SetEventRetention(2)
+	for i := 1; i <= 4; i++ {
+		table.Emit("add", []byte("1"))
+	}
+	assertEqual(t, len(table.Snapshots()), 2)
+	assertEqual(t, table.Snapshots()[0].Seq, int64(6))
+	assertEqual(t, len(table.Events(0)), 2)
+}
+
+func TestEventSourcedTableDiff(t *testing.T) {
+	state := &counterApplier{}
+	table := &EventSourcedTable{}
+	table.EventSourcedTableInit("t1", state, 2, nil)
+	table.SetEventRetention(0)
+	for i := 1; i <= 5; i++ {
+		if _, err := table.Emit("add", []byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	diff, err := table.DiffState(1, 4)
+	assertEqual(t, err, nil)
+	assertEqual(t, string(diff.Before), "1")
+	assertEqual(t, string(diff.After), "10")
+	assertEqual(t, len(diff.Events), 3)
+	assertEqual(t, len(diff.Changes), 1)
+	//计算历史状态后当前状态不变
+	assertEqual(t, state.total, 15)
+
+	changes, err := DiffJSON([]byte(`{"a":1,"b":[1,2],"c":"x"}`), []byte(`{"a":1,"b":[1,3,4],"d":true}`))
+	assertEqual(t, err, nil)
+	paths := []string{}
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+	}
+	assertEqual(t, strings.Join(paths, ","), "b.1,b.2,c,d")
+}
+
+func TestDiffFinishedTable(t *testing.T) {
+	room := NewRoom(nil)
+	table, _ := room.CreateById(nil, "t1", newBenchTable)
+	_, err := room.DiffTable("t1", 0, -1)
+	assertEqual(t, ErrorCode(err), ErrCodeTableNotFound)
+	table.Run()
+	table.Finish()
+	//调试接口不能重新运行已经结束的table
+	_, err = room.DiffTable("t1", 0, -1)
+	assertEqual(t, ErrorCode(err), ErrCodeTableNotFound)
+	assertEqual(t, table.Runing(), false)
+}
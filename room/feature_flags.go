@@ -0,0 +1,298 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"github.com/garyburd/redigo/redis"
+	"github.com/liangdas/mqant/log"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+//开关变化后通知table的消息在队列中的函数名
+const FlagsChangedQueueFunc = "Room.FlagsChanged"
+
+//File/Redis开关的默认重新加载间隔
+const DefaultFlagReloadInterval = 10 * time.Second
+
+/**
+判断开关时table提供的上下文
+*/
+type FlagContext struct {
+	TableId string
+	Labels  map[string]string
+}
+
+/**
+一个开关的规则
+Percent按TableId哈希灰度,同一个table的结果是稳定的
+Labels不为空时上下文中的标签必须全部匹配
+*/
+type FlagRule struct {
+	Enabled bool
+	Percent int //0-100,0表示不按比例灰度(全部开启)
+	Labels  map[string]string
+}
+
+func (r FlagRule) Match(ctx FlagContext) bool {
+	if !r.Enabled {
+		return false
+	}
+	for k, v := range r.Labels {
+		if ctx.Labels[k] != v {
+			return false
+		}
+	}
+	if r.Percent <= 0 || r.Percent >= 100 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(ctx.TableId))
+	return int(h.Sum32()%100) < r.Percent
+}
+
+/**
+开关发生变化时调用,参数为变化后的完整规则,只读
+在开关提供者的协成中调用,不能阻塞,table通过FlagsChanged选项在table协成中处理
+*/
+type FlagListener func(rules map[string]FlagRule)
+
+/**
+开关变化后在table协成中调用
+*/
+type FlagCallback func(table BaseTable, rules map[string]FlagRule)
+
+type FlagProvider interface {
+	IsEnabled(flag string, ctx FlagContext) bool
+	//监听变化,返回取消监听的函数
+	Watch(listener FlagListener) func()
+}
+
+/**
+内存中的开关集合,File/Redis实现都基于它
+*/
+type StaticFlags struct {
+	lock      sync.RWMutex
+	rules     map[string]FlagRule
+	listeners map[int]FlagListener
+	next      int
+}
+
+func NewStaticFlags(rules map[string]FlagRule) *StaticFlags {
+	if rules == nil {
+		rules = map[string]FlagRule{}
+	}
+	return &StaticFlags{
+		rules:     rules,
+		listeners: map[int]FlagListener{},
+	}
+}
+
+func (self *StaticFlags) IsEnabled(flag string, ctx FlagContext) bool {
+	self.lock.RLock()
+	rule, ok := self.rules[flag]
+	self.lock.RUnlock()
+	return ok && rule.Match(ctx)
+}
+
+func (self *StaticFlags) Watch(listener FlagListener) func() {
+	self.lock.Lock()
+	id := self.next
+	self.next++
+	self.listeners[id] = listener
+	self.lock.Unlock()
+	return func() {
+		self.lock.Lock()
+		delete(self.listeners, id)
+		self.lock.Unlock()
+	}
+}
+
+/**
+替换全部规则,有变化时通知监听者
+*/
+func (self *StaticFlags) Update(rules map[string]FlagRule) {
+	self.lock.Lock()
+	if reflect.DeepEqual(self.rules, rules) {
+		self.lock.Unlock()
+		return
+	}
+	self.rules = rules
+	listeners := make([]FlagListener, 0, len(self.listeners))
+	for _, listener := range self.listeners {
+		listeners = append(listeners, listener)
+	}
+	self.lock.Unlock()
+	for _, listener := range listeners {
+		listener(rules)
+	}
+}
+
+/**
+从JSON文件加载开关,文件修改后自动重新加载
+文件格式: {"flag":{"Enabled":true,"Percent":10}}
+interval<=0时使用DefaultFlagReloadInterval
+*/
+type FileFlagProvider struct {
+	*StaticFlags
+	path    string
+	modTime time.Time
+	closed  chan bool
+}
+
+func NewFileFlagProvider(path string, interval time.Duration) (*FileFlagProvider, error) {
+	if interval <= 0 {
+		interval = DefaultFlagReloadInterval
+	}
+	provider := &FileFlagProvider{
+		StaticFlags: NewStaticFlags(nil),
+		path:        path,
+		closed:      make(chan bool),
+	}
+	if err := provider.reload(); err != nil {
+		return nil, err
+	}
+	go provider.run(interval)
+	return provider, nil
+}
+
+func (self *FileFlagProvider) Close() {
+	close(self.closed)
+}
+
+func (self *FileFlagProvider) reload() error {
+	info, err := os.Stat(self.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(self.modTime) {
+		return nil
+	}
+	data, err := ioutil.ReadFile(self.path)
+	if err != nil {
+		return err
+	}
+	rules := map[string]FlagRule{}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return err
+	}
+	self.modTime = info.ModTime()
+	self.Update(rules)
+	return nil
+}
+
+func (self *FileFlagProvider) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.closed:
+			return
+		case <-ticker.C:
+			if err := self.reload(); err != nil {
+				log.Warning("reload feature flags %v error %v", self.path, err)
+			}
+		}
+	}
+}
+
+/**
+从redis hash加载开关,field为开关名,value为FlagRule的JSON
+interval<=0时使用DefaultFlagReloadInterval
+*/
+type RedisFlagProvider struct {
+	*StaticFlags
+	pool   *redis.Pool
+	key    string
+	closed chan bool
+}
+
+func NewRedisFlagProvider(pool *redis.Pool, key string, interval time.Duration) (*RedisFlagProvider, error) {
+	if interval <= 0 {
+		interval = DefaultFlagReloadInterval
+	}
+	provider := &RedisFlagProvider{
+		StaticFlags: NewStaticFlags(nil),
+		pool:        pool,
+		key:         key,
+		closed:      make(chan bool),
+	}
+	if err := provider.reload(); err != nil {
+		return nil, err
+	}
+	go provider.run(interval)
+	return provider, nil
+}
+
+func (self *RedisFlagProvider) Close() {
+	close(self.closed)
+}
+
+func (self *RedisFlagProvider) reload() error {
+	conn := self.pool.Get()
+	defer conn.Close()
+	values, err := redis.StringMap(conn.Do("HGETALL", self.key))
+	if err != nil {
+		return err
+	}
+	rules := map[string]FlagRule{}
+	for flag, value := range values {
+		rule := FlagRule{}
+		if err := json.Unmarshal([]byte(value), &rule); err != nil {
+			log.Warning("feature flag %v invalid: %v", flag, err)
+			continue
+		}
+		rules[flag] = rule
+	}
+	self.Update(rules)
+	return nil
+}
+
+func (self *RedisFlagProvider) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.closed:
+			return
+		case <-ticker.C:
+			if err := self.reload(); err != nil {
+				log.Warning("reload feature flags %v error %v", self.key, err)
+			}
+		}
+	}
+}
+
+/**
+设置了Flags和FlagsChanged时监听开关变化,变化以系统优先级放入队列,在table协成中回调
+*/
+func (this *QTable) watchFlags() {
+	if this.opts.Flags == nil || this.opts.FlagsChanged == nil {
+		return
+	}
+	this.unwatchFlags = this.opts.Flags.Watch(func(rules map[string]FlagRule) {
+		if err := this.PutQueueWithPriority(PrioritySystem, FlagsChangedQueueFunc, rules); err != nil {
+			log.Warning("table %v flags changed: %v", this.TableId(), err)
+		}
+	})
+}
+
+func (this *QTable) onFlagsChanged(rules map[string]FlagRule) {
+	this.opts.FlagsChanged(this.BaseTableImp.subtable, rules)
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileFlagProviderDefaultInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flags")
+	assertEqual(t, err, nil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "flags.json")
+	assertEqual(t, ioutil.WriteFile(path, []byte(`{"new_rule":{"Enabled":true}}`), 0644), nil)
+
+	//interval为0时不能panic
+	provider, err := NewFileFlagProvider(path, 0)
+	assertEqual(t, err, nil)
+	defer provider.Close()
+	assertEqual(t, provider.IsEnabled("new_rule", FlagContext{TableId: "t1"}), true)
+}
+
+func TestFlagsChanged(t *testing.T) {
+	flags := NewStaticFlags(nil)
+	changed := []map[string]FlagRule{}
+	table := &benchTable{seats: map[string]BasePlayer{}}
+	err := table.OnInit(table,
+		TableId("flags"),
+		Capaciity(16),
+		SendMsgCapaciity(16),
+		RunInterval(time.Hour),
+		SetScheduler(benchScheduler, 0, 0),
+		Flags(flags, nil),
+		OnFlagsChanged(func(_ BaseTable, rules map[string]FlagRule) {
+			changed = append(changed, rules)
+		}),
+	)
+	assertEqual(t, err, nil)
+	table.Run()
+
+	flags.Update(map[string]FlagRule{"new_rule": {Enabled: true}})
+	//在提供者的协成中只放入队列
+	assertEqual(t, len(changed), 0)
+	assertEqual(t, table.FlagEnabled("new_rule"), true)
+	table.ExecuteEvent(nil)
+	assertEqual(t, len(changed), 1)
+	assertEqual(t, changed[0]["new_rule"].Enabled, true)
+
+	//销毁后不再监听
+	table.Finish()
+	flags.Update(map[string]FlagRule{})
+	assertEqual(t, len(flags.listeners), 0)
+	table.ExecuteEvent(nil)
+	assertEqual(t, len(changed), 1)
+}
@@ -0,0 +1,257 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/gate"
+	"sync"
+	"sync/atomic"
+)
+
+//客户端积压时的处理策略
+const (
+	FlowCoalesce   = iota //同一topic只保留最新的一条,适合状态同步;没有同topic的消息时丢弃最早的一条
+	FlowDropLow           //丢弃一条积压的低优先级消息,没有可丢弃的消息时丢弃新消息
+	FlowDisconnect        //断开客户端,由客户端重连后拉取完整状态
+)
+
+//FlowControl.Backlog未设置时每个玩家最多积压的消息数
+const DefaultFlowBacklog = 64
+
+/**
+按玩家的发送流控
+开启后每个玩家有独立的发送队列和发送协成,慢客户端不会阻塞table
+*/
+type FlowControl struct {
+	Backlog     int //每个玩家最多积压的消息数,小于等于0时使用DefaultFlowBacklog
+	Policy      int
+	LowPriority func(topic string) bool //FlowDropLow时判断消息是否可以丢弃,为空时都不可丢弃
+	OnOverflow  func(player BasePlayer, topic string)
+}
+
+type outboxMsg struct {
+	topic     string
+	body      []byte
+	needReply bool
+}
+
+/**
+单个玩家的发送队列
+*/
+type playerOutbox struct {
+	session   gate.Session
+	lock      sync.Mutex
+	pending   []*outboxMsg
+	signal    chan bool
+	closed    chan bool
+	closeOnce sync.Once
+	delivered int32 //上一帧之后是否有需要回复的消息发送成功
+}
+
+func newPlayerOutbox(session gate.Session) *playerOutbox {
+	o := &playerOutbox{
+		session: session,
+		signal:  make(chan bool, 1),
+		closed:  make(chan bool),
+	}
+	go o.run()
+	return o
+}
+
+func (o *playerOutbox) run() {
+	for {
+		select {
+		case <-o.closed:
+			return
+		case <-o.signal:
+		}
+		for msg := o.pop(); msg != nil; msg = o.pop() {
+			if msg.needReply {
+				if e := o.session.Send(msg.topic, msg.body); e == "" {
+					atomic.StoreInt32(&o.delivered, 1)
+				}
+			} else {
+				_ = o.session.SendNR(msg.topic, msg.body)
+			}
+		}
+	}
+}
+
+func (o *playerOutbox) pop() *outboxMsg {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	select {
+	case <-o.closed:
+		return nil
+	default:
+	}
+	if len(o.pending) == 0 {
+		return nil
+	}
+	msg := o.pending[0]
+	o.pending = o.pending[1:]
+	return msg
+}
+
+/**
+放入发送队列,返回false表示发生了积压
+*/
+func (o *playerOutbox) push(msg *outboxMsg, fc *FlowControl) bool {
+	o.lock.Lock()
+	ok := true
+	if len(o.pending) < fc.Backlog {
+		o.pending = append(o.pending, msg)
+	} else {
+		ok = false
+		switch fc.Policy {
+		case FlowCoalesce:
+			o.remove(o.find(func(m *outboxMsg) bool { return m.topic == msg.topic }))
+			o.pending = append(o.pending, msg)
+		case FlowDropLow:
+			if fc.LowPriority != nil {
+				if i := o.find(func(m *outboxMsg) bool { return fc.LowPriority(m.topic) }); i >= 0 {
+					o.remove(i)
+					o.pending = append(o.pending, msg)
+				}
+			}
+		}
+	}
+	o.lock.Unlock()
+	select {
+	case o.signal <- true:
+	default:
+	}
+	return ok
+}
+
+func (o *playerOutbox) find(match func(m *outboxMsg) bool) int {
+	for i, m := range o.pending {
+		if match(m) {
+			return i
+		}
+	}
+	return -1
+}
+
+/**
+i为-1时丢弃最早的一条
+*/
+func (o *playerOutbox) remove(i int) {
+	if len(o.pending) == 0 {
+		return
+	}
+	if i < 0 {
+		i = 0
+	}
+	o.pending = append(o.pending[:i], o.pending[i+1:]...)
+}
+
+func (o *playerOutbox) close() {
+	o.closeOnce.Do(func() {
+		close(o.closed)
+	})
+}
+
+/**
+开启按玩家的发送流控,只能在table初始化时调用
+*/
+func (this *UnifiedSendMessageTable) SetFlowControl(fc *FlowControl) {
+	flow := *fc
+	if flow.Backlog <= 0 {
+		flow.Backlog = DefaultFlowBacklog
+	}
+	this.flow = &flow
+	this.outboxes = map[string]*playerOutbox{}
+}
+
+func (this *UnifiedSendMessageTable) flowDispatch(msg *CallBackMsg) {
+	for _, role := range this.tableimp.GetSeats() {
+		if role == nil || role.Session() == nil {
+			continue
+		}
+		if !msg.notify && !containsString(msg.players, role.Session().GetSessionId()) {
+			continue
+		}
+		if bot, ok := role.Session().(*BotSession); ok {
+			bot.Send(*msg.topic, *msg.body)
+			continue
+		}
+		this.flowSend(role, msg)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *UnifiedSendMessageTable) flowSend(role BasePlayer, msg *CallBackMsg) {
+	session := role.Session()
+	o, ok := this.outboxes[session.GetSessionId()]
+	if !ok || o.session != session {
+		if ok {
+			o.close()
+		}
+		o = newPlayerOutbox(session)
+		this.outboxes[session.GetSessionId()] = o
+	}
+	if o.push(&outboxMsg{topic: *msg.topic, body: *msg.body, needReply: msg.needReply}, this.flow) {
+		return
+	}
+	if this.flow.OnOverflow != nil {
+		this.flow.OnOverflow(role, *msg.topic)
+	}
+	if this.flow.Policy == FlowDisconnect {
+		o.close()
+		delete(this.outboxes, session.GetSessionId())
+		go session.Close()
+	}
+}
+
+/**
+每帧结束时调用,更新玩家最后通信时间并回收已离开玩家的发送队列
+*/
+func (this *UnifiedSendMessageTable) flushOutboxes() {
+	seated := map[string]bool{}
+	for _, role := range this.tableimp.GetSeats() {
+		if role == nil || role.Session() == nil {
+			continue
+		}
+		sessionId := role.Session().GetSessionId()
+		seated[sessionId] = true
+		if o, ok := this.outboxes[sessionId]; ok && atomic.SwapInt32(&o.delivered, 0) == 1 {
+			role.OnResponse(role.Session())
+		}
+	}
+	for sessionId, o := range this.outboxes {
+		if !seated[sessionId] {
+			o.close()
+			delete(this.outboxes, sessionId)
+		}
+	}
+}
+
+/**
+关闭所有发送协成,table销毁时调用
+*/
+func (this *UnifiedSendMessageTable) CloseOutboxes() {
+	for sessionId, o := range this.outboxes {
+		o.close()
+		delete(this.outboxes, sessionId)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestOutbox() *playerOutbox {
+	//不启动发送协成,积压的消息保留在pending中
+	return &playerOutbox{
+		signal: make(chan bool, 1),
+		closed: make(chan bool),
+	}
+}
+
+func TestFlowControlBacklog(t *testing.T) {
+	table := &UnifiedSendMessageTable{}
+	table.SetFlowControl(&FlowControl{Policy: FlowCoalesce})
+	assertEqual(t, table.flow.Backlog, DefaultFlowBacklog)
+
+	//Backlog为0时也不能因为没有积压消息而panic
+	o := newTestOutbox()
+	assertEqual(t, o.push(&outboxMsg{topic: "state"}, &FlowControl{Policy: FlowCoalesce}), false)
+	assertEqual(t, len(o.pending), 1)
+}
+
+func TestFlowControlPolicy(t *testing.T) {
+	o := newTestOutbox()
+	fc := &FlowControl{Backlog: 2, Policy: FlowCoalesce}
+	o.push(&outboxMsg{topic: "state", body: []byte("1")}, fc)
+	o.push(&outboxMsg{topic: "chat"}, fc)
+	assertEqual(t, o.push(&outboxMsg{topic: "state", body: []byte("2")}, fc), false)
+	assertEqual(t, len(o.pending), 2)
+	assertEqual(t, o.pending[0].topic, "chat")
+	assertEqual(t, string(o.pending[1].body), "2")
+
+	o = newTestOutbox()
+	fc = &FlowControl{Backlog: 1, Policy: FlowDropLow, LowPriority: func(topic string) bool {
+		return strings.HasPrefix(topic, "low/")
+	}}
+	o.push(&outboxMsg{topic: "low/emote"}, fc)
+	o.push(&outboxMsg{topic: "state"}, fc)
+	assertEqual(t, o.pending[0].topic, "state")
+	//没有可丢弃的消息时丢弃新消息
+	o.push(&outboxMsg{topic: "result"}, fc)
+	assertEqual(t, len(o.pending), 1)
+	assertEqual(t, o.pending[0].topic, "state")
+}
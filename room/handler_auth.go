@@ -0,0 +1,123 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/gate"
+)
+
+//客户端不能修改的session settings,由登录模块写入玩家的角色
+const SessionRole = "role"
+
+//内置的角色
+const (
+	RoleAdmin = "admin"
+)
+
+/**
+处理函数的执行条件,返回错误则不执行该消息并回调ErrorHandle
+session为消息的第一个参数,消息没有session时为nil
+*/
+type Requirement func(session gate.Session, msg *QueueMsg) error
+
+/**
+给已注册的处理函数添加执行条件,多个条件按顺序检查
+只能在table初始化时调用
+*/
+func (self *QueueTable) Require(id string, requirements ...Requirement) {
+	if self.requirements == nil {
+		self.requirements = map[string][]Requirement{}
+	}
+	self.requirements[id] = append(self.requirements[id], requirements...)
+}
+
+/**
+注册处理函数并同时声明执行条件
+	table.RegisterWith("Play", table.Play, table.RequireSeated(), table.RequireTurn(nil))
+*/
+func (self *QueueTable) RegisterWith(id string, f interface{}, requirements ...Requirement) {
+	self.Register(id, f)
+	self.Require(id, requirements...)
+}
+
+func (self *QueueTable) checkRequirements(msg *QueueMsg) error {
+	requirements := self.requirements[msg.Func]
+	if len(requirements) == 0 {
+		return nil
+	}
+	var session gate.Session
+	if len(msg.Params) > 0 {
+		session, _ = msg.Params[0].(gate.Session)
+	}
+	for _, requirement := range requirements {
+		if err := requirement(session, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+只有坐在座位上的玩家可以执行
+*/
+func (this *QTable) RequireSeated() Requirement {
+	return func(session gate.Session, msg *QueueMsg) error {
+		if session == nil || this.FindPlayer(session) == nil {
+			return NewError(ErrCodeNotSeated)
+		}
+		return nil
+	}
+}
+
+/**
+只有当前回合的玩家可以执行
+playerId把session转换为StartTurns中使用的玩家id,为nil时使用userId
+*/
+func (this *QTable) RequireTurn(playerId func(session gate.Session) string) Requirement {
+	if playerId == nil {
+		playerId = func(session gate.Session) string {
+			return session.GetUserId()
+		}
+	}
+	return func(session gate.Session, msg *QueueMsg) error {
+		if session == nil || this.CurrentTurn() == "" || this.CurrentTurn() != playerId(session) {
+			return NewError(ErrCodeNotYourTurn)
+		}
+		return nil
+	}
+}
+
+/**
+只有指定角色的玩家可以执行,角色从session的SessionRole中读取
+*/
+func RequireRole(roles ...string) Requirement {
+	return func(session gate.Session, msg *QueueMsg) error {
+		if session != nil {
+			role := session.Get(SessionRole)
+			for _, r := range roles {
+				if role == r {
+					return nil
+				}
+			}
+		}
+		return NewError(ErrCodePermissionDenied)
+	}
+}
+
+/**
+管理员操作,例如踢人,解散
+*/
+func RequireAdmin() Requirement {
+	return RequireRole(RoleAdmin)
+}
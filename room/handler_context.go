@@ -0,0 +1,131 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"context"
+	"github.com/liangdas/mqant/gate"
+	"github.com/liangdas/mqant/log"
+	"reflect"
+	"time"
+)
+
+var handlerContextType = reflect.TypeOf((*HandlerContext)(nil))
+
+/**
+队列消息的执行上下文
+处理函数的第一个参数声明为*HandlerContext时使用,例如
+	func (this *MyTable) doAction(ctx *room.HandlerContext, action string) error
+消息第一个参数为gate.Session时放入Session,其余参数按顺序传入
+table销毁时Done()会被关闭,设置HandlerTimeout后带有截止时间
+*/
+type HandlerContext struct {
+	context.Context
+	Func        string
+	Priority    int
+	EnqueueTime time.Time     //table收到消息的时间
+	Session     gate.Session  //发起消息的玩家,系统消息为nil
+	Span        log.TraceSpan //玩家请求的trace,可以传给RPC调用
+	RTT         time.Duration //发起玩家的RTT估算,没有采样时为0
+	clock       Clock
+}
+
+/**
+从收到消息到现在的耗时,包括排队等待
+*/
+func (c *HandlerContext) Latency() time.Duration {
+	if c.clock == nil {
+		return time.Since(c.EnqueueTime)
+	}
+	return c.clock.Now().Sub(c.EnqueueTime)
+}
+
+/**
+估算的玩家实际操作时间,即收到时间减去单程延迟,用于对时间敏感的操作做补偿
+没有RTT采样时等于EnqueueTime
+*/
+func (c *HandlerContext) ActionTime() time.Time {
+	return c.EnqueueTime.Add(-c.RTT / 2)
+}
+
+func (c *HandlerContext) Debug(format string, a ...interface{}) {
+	log.TDebug(c.Span, format, a...)
+}
+
+func (c *HandlerContext) Info(format string, a ...interface{}) {
+	log.TInfo(c.Span, format, a...)
+}
+
+func (c *HandlerContext) Warning(format string, a ...interface{}) {
+	log.TWarning(c.Span, format, a...)
+}
+
+func (c *HandlerContext) Error(format string, a ...interface{}) {
+	log.TError(c.Span, format, a...)
+}
+
+/**
+table销毁时取消所有执行中的上下文
+*/
+func (self *QueueTable) CancelHandlers() {
+	if self.cancel != nil {
+		self.cancel()
+	}
+}
+
+/**
+生成处理函数的参数,第一个参数为*HandlerContext时返回的cancel需要在执行后调用
+*/
+func (self *QueueTable) handlerArgs(f reflect.Value, msg *QueueMsg) ([]reflect.Value, context.CancelFunc) {
+	params := msg.Params
+	var (
+		in     []reflect.Value
+		cancel context.CancelFunc
+	)
+	t := f.Type()
+	if t.NumIn() > 0 && t.In(0) == handlerContextType {
+		ctx := &HandlerContext{
+			Func:        msg.Func,
+			Priority:    msg.Priority,
+			EnqueueTime: msg.EnqueueTime,
+			clock:       self.opts.Clock,
+		}
+		if len(params) > 0 {
+			if session, ok := params[0].(gate.Session); ok {
+				ctx.Session = session
+				if session != nil {
+					ctx.Span = session.ExtractSpan()
+					ctx.RTT = self.sessionRTT(session)
+				}
+				params = params[1:]
+			}
+		}
+		if self.opts.HandlerTimeout > 0 {
+			ctx.Context, cancel = context.WithTimeout(self.ctx, self.opts.HandlerTimeout)
+		} else {
+			ctx.Context, cancel = context.WithCancel(self.ctx)
+		}
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	offset := len(in)
+	for k, param := range params {
+		switch v := param.(type) {
+		case nil:
+			in = append(in, reflect.Zero(t.In(k+offset)))
+		default:
+			in = append(in, reflect.ValueOf(v))
+		}
+	}
+	return in, cancel
+}
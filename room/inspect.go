@@ -0,0 +1,239 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+//查看table状态的消息在队列中的函数名,以系统优先级执行
+const InspectQueueFunc = "Room.Inspect"
+
+//InspectTable的操作
+const (
+	InspectOnly   = ""       //只查看
+	InspectFreeze = "freeze" //冻结后查看
+	InspectThaw   = "thaw"   //查看后解冻
+)
+
+/**
+冻结队列,之后只执行系统优先级消息,其余消息暂存到解冻
+只冻结队列,Update和计时照常进行,InspectTable冻结时会同时Suspend
+协成安全
+*/
+func (self *QueueTable) Freeze() {
+	atomic.StoreInt32(&self.frozen, 1)
+}
+
+/**
+解冻队列,暂存的消息在下一帧按原顺序执行
+协成安全
+*/
+func (self *QueueTable) Thaw() {
+	atomic.StoreInt32(&self.frozen, 0)
+}
+
+func (self *QueueTable) Frozen() bool {
+	return atomic.LoadInt32(&self.frozen) == 1
+}
+
+/**
+由游戏table实现,返回需要包含在TableDump中的游戏状态
+*/
+type Inspector interface {
+	Inspect() interface{}
+}
+
+type PlayerDump struct {
+	Seat      string
+	UserId    string
+	SessionId string
+	ServerId  string
+	Body      interface{}
+}
+
+type PendingDump struct {
+	Func        string
+	Priority    int
+	EnqueueTime time.Time
+	Params      int //参数个数,参数本身可能包含session等不能序列化的对象
+}
+
+type TimerDump struct {
+	Name      string
+	Remaining time.Duration
+}
+
+/**
+table的完整状态,用于线上排查
+*/
+type TableDump struct {
+	TableId    string
+	State      int
+	Elapsed    time.Duration //进入当前生命周期状态的时长
+	Frozen     bool
+	Paused     bool
+	Players    []PlayerDump
+	Held       []PendingDump //冻结期间暂存的消息
+	Queued     []uint32      //各优先级队列中尚未取出的消息数,下标即优先级
+	Timers     []TimerDump
+	Attributes map[string]Attribute
+	Game       interface{} `json:",omitempty"` //Inspector返回的游戏状态
+}
+
+func (self *QueueTable) queued() []uint32 {
+	queued := make([]uint32, len(self.lanes))
+	for i, lane := range self.lanes {
+		queued[i] = lane.queue0.Quantity() + lane.queue1.Quantity()
+	}
+	return queued
+}
+
+/**
+只能在table协成中调用
+*/
+func (this *QTable) Dump() *TableDump {
+	state, elapsed := this.Lifecycle()
+	dump := &TableDump{
+		TableId:    this.TableId(),
+		State:      state,
+		Elapsed:    elapsed,
+		Frozen:     this.Frozen(),
+		Paused:     this.Paused(),
+		Players:    []PlayerDump{},
+		Held:       []PendingDump{},
+		Queued:     this.queued(),
+		Timers:     []TimerDump{},
+		Attributes: this.Attrs(),
+	}
+	for seat, player := range this.tableimp.GetSeats() {
+		if player == nil || !player.IsBind() {
+			continue
+		}
+		info := PlayerSession(player)
+		dump.Players = append(dump.Players, PlayerDump{
+			Seat:      seat,
+			UserId:    info.UserId(),
+			SessionId: info.SessionId(),
+			ServerId:  info.ServerId(),
+			Body:      player.Body(),
+		})
+	}
+	sort.Slice(dump.Players, func(i, j int) bool {
+		return dump.Players[i].Seat < dump.Players[j].Seat
+	})
+	for _, msg := range this.held {
+		dump.Held = append(dump.Held, PendingDump{
+			Func:        msg.Func,
+			Priority:    msg.Priority,
+			EnqueueTime: msg.EnqueueTime,
+			Params:      len(msg.Params),
+		})
+	}
+	if phase := this.CurrentPhase(); phase != nil {
+		dump.Timers = append(dump.Timers, TimerDump{Name: "phase:" + phase.Name, Remaining: this.PhaseRemaining()})
+	}
+	if turn := this.CurrentTurn(); turn != "" {
+		dump.Timers = append(dump.Timers, TimerDump{Name: "turn:" + turn, Remaining: this.TurnRemaining()})
+	}
+	for id := range this.countdowns {
+		remaining, _ := this.CountdownRemaining(id)
+		dump.Timers = append(dump.Timers, TimerDump{Name: "countdown:" + id, Remaining: remaining})
+	}
+	sort.Slice(dump.Timers, func(i, j int) bool {
+		return dump.Timers[i].Name < dump.Timers[j].Name
+	})
+	if inspector, ok := this.BaseTableImp.subtable.(Inspector); ok {
+		dump.Game = inspector.Inspect()
+	}
+	return dump
+}
+
+func (this *QTable) onInspect(action string, call *tableCall) {
+	if !call.start() {
+		return
+	}
+	defer call.recoverPanic()
+	switch action {
+	case InspectFreeze:
+		//暂停计时,否则冻结期间回合超时等会替玩家自动操作
+		this.Freeze()
+		if !this.Paused() {
+			this.Suspend()
+			this.freezeSuspended = true
+		}
+	case InspectThaw:
+		defer this.thaw()
+	}
+	//在table协成中序列化,避免与之后的消息竞争
+	dump, err := json.Marshal(this.Dump())
+	call.finish(dump, err)
+}
+
+/**
+解冻,只恢复由InspectFreeze暂停的计时,维护暂停保持不变
+*/
+func (this *QTable) thaw() {
+	this.Thaw()
+	if this.freezeSuspended {
+		this.freezeSuspended = false
+		this.Resume()
+	}
+}
+
+/**
+查看table状态,返回JSON
+action为InspectFreeze时先冻结队列并暂停计时,为InspectThaw时查看后解冻
+冻结不影响系统优先级消息,所以冻结期间可以多次查看
+没有运行的table返回ErrCodeTableNotFound,不会重新运行已经结束的table
+*/
+func (self *Room) InspectTable(tableId string, action string) ([]byte, error) {
+	table := self.runningTable(tableId)
+	if table == nil {
+		return nil, NewError(ErrCodeTableNotFound)
+	}
+	result, err := self.callTable(table, PrioritySystem, self.opts.RPCTimeout, InspectQueueFunc, action)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]byte), nil
+}
+
+/**
+/debug/room/inspect?table=xxx&action=freeze	action可以为空,freeze或thaw
+freeze和thaw会修改table状态,必须使用POST
+*/
+func (self *Room) serveTableInspect(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	action := query.Get("action")
+	if action != InspectOnly && action != InspectFreeze && action != InspectThaw {
+		http.Error(w, "invalid action", http.StatusBadRequest)
+		return
+	}
+	if action != InspectOnly && r.Method != http.MethodPost {
+		http.Error(w, "freeze and thaw require POST", http.StatusMethodNotAllowed)
+		return
+	}
+	dump, err := self.InspectTable(query.Get("table"), action)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(dump)
+}
@@ -0,0 +1,74 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newInspectCall() *tableCall {
+	return &tableCall{done: make(chan struct{})}
+}
+
+func TestInspectFreeze(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(0, 0))
+	table := &benchTable{seats: map[string]BasePlayer{}}
+	err := table.OnInit(table,
+		TableId("inspect"),
+		Capaciity(16),
+		SendMsgCapaciity(16),
+		RunInterval(time.Hour),
+		SetClock(clock),
+	)
+	assertEqual(t, err, nil)
+	table.StartCountdown("deal", "", 10*time.Second, 0, "")
+
+	//冻结期间计时暂停,解冻后剩余时间不变
+	table.onInspect(InspectFreeze, newInspectCall())
+	assertEqual(t, table.Frozen(), true)
+	assertEqual(t, table.Paused(), true)
+	clock.Advance(time.Minute)
+	table.onInspect(InspectThaw, newInspectCall())
+	assertEqual(t, table.Frozen(), false)
+	assertEqual(t, table.Paused(), false)
+	remaining, _ := table.CountdownRemaining("deal")
+	assertEqual(t, remaining, 10*time.Second)
+
+	//解冻不能恢复维护暂停
+	table.Suspend()
+	table.onInspect(InspectFreeze, newInspectCall())
+	table.onInspect(InspectThaw, newInspectCall())
+	assertEqual(t, table.Paused(), true)
+}
+
+func TestInspectMethod(t *testing.T) {
+	room := NewRoom(nil)
+	w := httptest.NewRecorder()
+	room.serveTableInspect(w, httptest.NewRequest(http.MethodGet, "/debug/room/inspect?table=t1&action=freeze", nil))
+	assertEqual(t, w.Code, http.StatusMethodNotAllowed)
+}
+
+func TestInspectFinishedTable(t *testing.T) {
+	room := NewRoom(nil)
+	table, _ := room.CreateById(nil, "t1", newBenchTable)
+	table.Run()
+	table.Finish()
+	//只读的查看不能重新运行已经结束的table
+	_, err := room.InspectTable("t1", InspectOnly)
+	assertEqual(t, ErrorCode(err), ErrCodeTableNotFound)
+	assertEqual(t, table.Runing(), false)
+}
@@ -0,0 +1,139 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+/**
+由游戏实现的空间函数,返回事件影响到的区域或实体
+例如按格子划分地图时返回事件所在格子及相邻格子
+*/
+type InterestFunc func(event interface{}) []string
+
+/**
+兴趣管理,广播只发送给订阅了相关区域或实体的玩家
+只能在table协成中调用
+*/
+type InterestTable struct {
+	interestFunc InterestFunc
+	interestSend func(players []string, topic string, body []byte) error
+	subscribers  map[string]map[string]bool //区域->sessionId
+	interests    map[string]map[string]bool //sessionId->区域
+}
+
+func (this *InterestTable) InterestTableInit(f InterestFunc, send func(players []string, topic string, body []byte) error) {
+	this.interestFunc = f
+	this.interestSend = send
+	this.subscribers = map[string]map[string]bool{}
+	this.interests = map[string]map[string]bool{}
+}
+
+/**
+玩家订阅区域或实体
+*/
+func (this *InterestTable) SubscribeInterest(sessionId string, keys ...string) {
+	interests, ok := this.interests[sessionId]
+	if !ok {
+		interests = map[string]bool{}
+		this.interests[sessionId] = interests
+	}
+	for _, key := range keys {
+		subscribers, ok := this.subscribers[key]
+		if !ok {
+			subscribers = map[string]bool{}
+			this.subscribers[key] = subscribers
+		}
+		subscribers[sessionId] = true
+		interests[key] = true
+	}
+}
+
+func (this *InterestTable) UnsubscribeInterest(sessionId string, keys ...string) {
+	interests := this.interests[sessionId]
+	for _, key := range keys {
+		if subscribers, ok := this.subscribers[key]; ok {
+			delete(subscribers, sessionId)
+			if len(subscribers) == 0 {
+				delete(this.subscribers, key)
+			}
+		}
+		delete(interests, key)
+	}
+	if len(interests) == 0 {
+		delete(this.interests, sessionId)
+	}
+}
+
+/**
+把玩家的订阅替换为keys,玩家移动时使用
+*/
+func (this *InterestTable) SetInterest(sessionId string, keys ...string) {
+	this.ClearInterest(sessionId)
+	this.SubscribeInterest(sessionId, keys...)
+}
+
+/**
+玩家离开时清除所有订阅
+*/
+func (this *InterestTable) ClearInterest(sessionId string) {
+	keys := make([]string, 0, len(this.interests[sessionId]))
+	for key := range this.interests[sessionId] {
+		keys = append(keys, key)
+	}
+	this.UnsubscribeInterest(sessionId, keys...)
+}
+
+func (this *InterestTable) Interests(sessionId string) []string {
+	keys := make([]string, 0, len(this.interests[sessionId]))
+	for key := range this.interests[sessionId] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+/**
+订阅了任意一个key的玩家sessionId
+*/
+func (this *InterestTable) InterestSet(keys ...string) []string {
+	seen := map[string]bool{}
+	players := []string{}
+	for _, key := range keys {
+		for sessionId := range this.subscribers[key] {
+			if !seen[sessionId] {
+				seen[sessionId] = true
+				players = append(players, sessionId)
+			}
+		}
+	}
+	return players
+}
+
+/**
+发送给订阅了keys的玩家,没有玩家订阅时不发送
+*/
+func (this *InterestTable) NotifyInterest(keys []string, topic string, body []byte) error {
+	players := this.InterestSet(keys...)
+	if len(players) == 0 {
+		return nil
+	}
+	return this.interestSend(players, topic, body)
+}
+
+/**
+通过InterestFunc计算事件影响的区域并发送,没有设置InterestFunc时返回错误
+*/
+func (this *InterestTable) NotifyArea(event interface{}, topic string, body []byte) error {
+	if this.interestFunc == nil {
+		return NewError(ErrCodeStateInvalid)
+	}
+	return this.NotifyInterest(this.interestFunc(event), topic, body)
+}
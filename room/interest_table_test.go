@@ -0,0 +1,76 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestInterestUnsubscribe(t *testing.T) {
+	sent := [][]string{}
+	table := &InterestTable{}
+	table.InterestTableInit(nil, func(players []string, topic string, body []byte) error {
+		sort.Strings(players)
+		sent = append(sent, players)
+		return nil
+	})
+	table.SubscribeInterest("s1", "a", "b")
+	table.SubscribeInterest("s2", "b")
+	assertEqual(t, len(table.InterestSet("a", "b")), 2)
+
+	table.UnsubscribeInterest("s1", "a")
+	//没有订阅者的区域被清除
+	_, ok := table.subscribers["a"]
+	assertEqual(t, ok, false)
+	assertEqual(t, len(table.Interests("s1")), 1)
+	assertEqual(t, table.Interests("s1")[0], "b")
+
+	table.SetInterest("s2", "c")
+	assertEqual(t, len(table.InterestSet("b")), 1)
+	assertEqual(t, table.InterestSet("b")[0], "s1")
+	assertEqual(t, table.InterestSet("c")[0], "s2")
+
+	table.ClearInterest("s1")
+	table.ClearInterest("s2")
+	assertEqual(t, len(table.subscribers), 0)
+	assertEqual(t, len(table.interests), 0)
+	//取消不存在的订阅不会留下空记录
+	table.UnsubscribeInterest("s3", "a")
+	assertEqual(t, len(table.subscribers), 0)
+	assertEqual(t, len(table.interests), 0)
+
+	assertEqual(t, table.NotifyInterest([]string{"b"}, "Room/Move", nil), nil)
+	assertEqual(t, len(sent), 0)
+	assertEqual(t, ErrorCode(table.NotifyArea("x", "Room/Move", nil)), ErrCodeStateInvalid)
+}
+
+func TestNotifyArea(t *testing.T) {
+	sent := [][]string{}
+	table := &InterestTable{}
+	table.InterestTableInit(func(event interface{}) []string {
+		return []string{event.(string), "center"}
+	}, func(players []string, topic string, body []byte) error {
+		sort.Strings(players)
+		sent = append(sent, players)
+		return nil
+	})
+	table.SubscribeInterest("s1", "west", "center")
+	table.SubscribeInterest("s2", "center")
+	table.SubscribeInterest("s3", "east")
+	assertEqual(t, table.NotifyArea("west", "Room/Move", nil), nil)
+	assertEqual(t, len(sent), 1)
+	assertEqual(t, strings.Join(sent[0], ","), "s1,s2")
+}
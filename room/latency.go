@@ -0,0 +1,146 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"github.com/liangdas/mqant/gate"
+	"sync"
+	"time"
+)
+
+//客户端测量延迟的消息在队列中的函数名
+const PingQueueFunc = "Room.Ping"
+
+//回复客户端测量延迟的topic
+const PongTopic = "Room/Pong"
+
+//超过这个时间没有新采样的玩家会被清理
+const rttStaleAfter = 5 * time.Minute
+
+/**
+回复给客户端的Ping
+客户端收到后用当前时间减去ClientTime得到一次RTT,在下一次Ping中上报
+*/
+type Pong struct {
+	ClientTime int64 //客户端发送Ping时的时间,原样返回
+	ServerTime int64 //服务器收到Ping的时间,单位毫秒
+	RTT        int64 //当前服务器估算的RTT,单位毫秒
+}
+
+type rttSample struct {
+	srtt    time.Duration
+	rttvar  time.Duration
+	samples int64
+	updated time.Time
+}
+
+/**
+按session估算客户端RTT,算法与TCP的SRTT相同
+协成安全
+*/
+type RTTEstimator struct {
+	lock     sync.Mutex
+	sessions map[string]*rttSample
+}
+
+func NewRTTEstimator() *RTTEstimator {
+	return &RTTEstimator{
+		sessions: map[string]*rttSample{},
+	}
+}
+
+/**
+记录一次RTT采样,小于等于0的采样被忽略
+*/
+func (self *RTTEstimator) Sample(sessionId string, rtt time.Duration, now time.Time) {
+	if rtt <= 0 {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for id, s := range self.sessions {
+		if now.Sub(s.updated) > rttStaleAfter {
+			delete(self.sessions, id)
+		}
+	}
+	s, ok := self.sessions[sessionId]
+	if !ok {
+		self.sessions[sessionId] = &rttSample{srtt: rtt, rttvar: rtt / 2, samples: 1, updated: now}
+		return
+	}
+	diff := s.srtt - rtt
+	if diff < 0 {
+		diff = -diff
+	}
+	s.rttvar = (3*s.rttvar + diff) / 4
+	s.srtt = (7*s.srtt + rtt) / 8
+	s.samples++
+	s.updated = now
+}
+
+/**
+返回估算的RTT和抖动,没有采样时ok为false
+*/
+func (self *RTTEstimator) RTT(sessionId string) (rtt time.Duration, jitter time.Duration, ok bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	s, ok := self.sessions[sessionId]
+	if !ok {
+		return 0, 0, false
+	}
+	return s.srtt, s.rttvar, true
+}
+
+func (self *RTTEstimator) Forget(sessionId string) {
+	self.lock.Lock()
+	delete(self.sessions, sessionId)
+	self.lock.Unlock()
+}
+
+/**
+table的RTT估算,游戏可以用来对时间敏感的操作做补偿
+*/
+func (self *QueueTable) RTTEstimator() *RTTEstimator {
+	return self.rtt
+}
+
+func (self *QueueTable) sessionRTT(session gate.Session) time.Duration {
+	if session == nil {
+		return 0
+	}
+	rtt, _, _ := self.rtt.RTT(session.GetSessionId())
+	return rtt
+}
+
+/**
+客户端定期发送Ping,lastRtt为客户端上一次测得的RTT(毫秒),第一次为0
+只有已入座的玩家会收到Pong
+*/
+func (this *QTable) onPing(ctx *HandlerContext, clientTime int64, lastRtt int64) error {
+	if ctx.Session == nil {
+		return nil
+	}
+	now := this.Clock().Now()
+	this.rtt.Sample(ctx.Session.GetSessionId(), time.Duration(lastRtt)*time.Millisecond, now)
+	body, err := json.Marshal(&Pong{
+		ClientTime: clientTime,
+		ServerTime: ctx.EnqueueTime.UnixNano() / int64(time.Millisecond),
+		RTT:        int64(this.sessionRTT(ctx.Session) / time.Millisecond),
+	})
+	if err != nil {
+		return err
+	}
+	return this.SendCallBackMsgNR([]string{ctx.Session.GetSessionId()}, PongTopic, body)
+}
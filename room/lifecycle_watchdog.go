@@ -0,0 +1,166 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/log"
+	"sync"
+	"time"
+)
+
+//超时后的处理方式
+const (
+	WatchdogLog   = iota //只打印日志
+	WatchdogForce        //从Room中移除table
+	WatchdogAlert        //调用OnAlert通知外部
+)
+
+//被检查的生命周期阶段
+const (
+	LifecycleUninitialized = "uninitialized" //创建后一直没有Run
+	LifecycleCreate        = "create"        //OnCreate没有返回
+	LifecycleFinished      = "finished"      //已结束但没有从Room中移除
+)
+
+/**
+Timeout为0表示不检查该阶段
+*/
+type WatchdogRule struct {
+	Timeout time.Duration
+	Action  int
+}
+
+/**
+table生命周期检查
+每个table的每个阶段只处理一次
+*/
+type LifecycleWatchdog struct {
+	Uninitialized WatchdogRule
+	Create        WatchdogRule
+	Finished      WatchdogRule
+	Interval      time.Duration //检查间隔,默认1秒
+	OnAlert       func(tableId string, phase string, elapsed time.Duration)
+}
+
+func (w *LifecycleWatchdog) rule(state int) (string, WatchdogRule) {
+	switch state {
+	case Uninitialized:
+		return LifecycleUninitialized, w.Uninitialized
+	case Initialized:
+		return LifecycleCreate, w.Create
+	case Finished:
+		return LifecycleFinished, w.Finished
+	}
+	return "", WatchdogRule{}
+}
+
+type watchdogState struct {
+	lock  sync.Mutex
+	fired map[string]string //tableId->已处理的阶段
+	stop  chan struct{}
+}
+
+func (self *Room) startWatchdog(w *LifecycleWatchdog) {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	self.watchdogState = &watchdogState{
+		fired: map[string]string{},
+		stop:  make(chan struct{}),
+	}
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				self.CheckLifecycle()
+			case <-stop:
+				return
+			}
+		}
+	}(self.watchdogState.stop)
+}
+
+/**
+停止后台检查
+*/
+func (self *Room) StopWatchdog() {
+	if self.watchdogState == nil {
+		return
+	}
+	self.watchdogState.lock.Lock()
+	defer self.watchdogState.lock.Unlock()
+	if self.watchdogState.stop != nil {
+		close(self.watchdogState.stop)
+		self.watchdogState.stop = nil
+	}
+}
+
+/**
+检查一遍所有table,没有设置Watchdog时不做任何事
+*/
+func (self *Room) CheckLifecycle() {
+	w := self.opts.Watchdog
+	if w == nil || self.watchdogState == nil {
+		return
+	}
+	state := self.watchdogState
+	alive := map[string]bool{}
+	self.tables.Range(func(key, value interface{}) bool {
+		tableId := key.(string)
+		alive[tableId] = true
+		table, ok := value.(interface {
+			Lifecycle() (int, time.Duration)
+		})
+		if !ok {
+			return true
+		}
+		current, elapsed := table.Lifecycle()
+		phase, rule := w.rule(current)
+		if rule.Timeout <= 0 || elapsed < rule.Timeout {
+			return true
+		}
+		state.lock.Lock()
+		fired := state.fired[tableId] == phase
+		state.fired[tableId] = phase
+		state.lock.Unlock()
+		if !fired {
+			self.watchdogFire(w, rule, tableId, phase, elapsed)
+		}
+		return true
+	})
+	state.lock.Lock()
+	for tableId := range state.fired {
+		if !alive[tableId] {
+			delete(state.fired, tableId)
+		}
+	}
+	state.lock.Unlock()
+}
+
+func (self *Room) watchdogFire(w *LifecycleWatchdog, rule WatchdogRule, tableId string, phase string, elapsed time.Duration) {
+	log.Warning("table %v stuck in %v for %v", tableId, phase, elapsed)
+	switch rule.Action {
+	case WatchdogForce:
+		if err := self.DestroyTable(tableId); err != nil {
+			log.Error("watchdog destroy table %v error %v", tableId, err)
+		}
+	case WatchdogAlert:
+		if w.OnAlert != nil {
+			w.OnAlert(tableId, phase, elapsed)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+过载时按游戏类型的优先级削减负载,优先保证高优先级游戏的新table和新玩家
+每次检查过载时把准入的最低优先级提高一级,负载下降到Recover以下时降低一级
+最高优先级的游戏类型始终准入
+*/
+type LoadShedding struct {
+	Interval time.Duration //检查间隔,默认1秒
+	//返回0~1的CPU使用率,为nil时不检查CPU,容器中可以读取cgroup
+	CPU          func() float64
+	CPUHigh      float64       //CPU使用率超过该值视为过载
+	QueueLatency time.Duration //队列平均等待超过该值视为过载,需要把LoadObserver设置为table的QueueObserver
+	//负载低于阈值的该比例时降低一级,默认0.8
+	Recover    float64
+	Priorities map[string]int //游戏类型->优先级,越大越重要,未配置的为0
+	RetryAfter time.Duration  //返回给客户端的重试间隔,默认5秒
+	//准入的最低优先级变化时调用,用于告警
+	OnChange func(minPriority int, load float64)
+}
+
+type loadShedState struct {
+	lock      sync.Mutex
+	levels    []int //所有优先级,从低到高
+	level     int32 //当前准入的最低优先级在levels中的下标
+	queueWait int64 //队列等待的指数移动平均,单位纳秒
+	observed  int32 //上次检查之后是否有新的队列等待数据
+	stop      chan struct{}
+}
+
+func (self *Room) startLoadShedding(s *LoadShedding) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	seen := map[int]bool{0: true}
+	levels := []int{0}
+	for _, priority := range s.Priorities {
+		if !seen[priority] {
+			seen[priority] = true
+			levels = append(levels, priority)
+		}
+	}
+	sort.Ints(levels)
+	self.loadShedState = &loadShedState{
+		levels: levels,
+		stop:   make(chan struct{}),
+	}
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				self.CheckLoad()
+			case <-stop:
+				return
+			}
+		}
+	}(self.loadShedState.stop)
+}
+
+/**
+停止后台检查
+*/
+func (self *Room) StopLoadShedding() {
+	if self.loadShedState == nil {
+		return
+	}
+	self.loadShedState.lock.Lock()
+	defer self.loadShedState.lock.Unlock()
+	if self.loadShedState.stop != nil {
+		close(self.loadShedState.stop)
+		self.loadShedState.stop = nil
+	}
+}
+
+/**
+统计队列等待时间的QueueObserver,可以与其他QueueObserver组合使用
+*/
+func (self *Room) LoadObserver() QueueObserver {
+	return func(event *QueueEvent) {
+		if self.loadShedState == nil || event.Dropped != "" {
+			return
+		}
+		atomic.StoreInt32(&self.loadShedState.observed, 1)
+		self.loadShedState.observeWait(int64(event.Wait))
+	}
+}
+
+func (state *loadShedState) observeWait(wait int64) {
+	for {
+		old := atomic.LoadInt64(&state.queueWait)
+		if atomic.CompareAndSwapInt64(&state.queueWait, old, (old*7+wait)/8) {
+			return
+		}
+	}
+}
+
+/**
+当前准入的最低优先级,没有设置LoadShedding时为0
+*/
+func (self *Room) ShedPriority() int {
+	if self.loadShedState == nil {
+		return 0
+	}
+	return self.loadShedState.levels[atomic.LoadInt32(&self.loadShedState.level)]
+}
+
+/**
+计算一次负载并调整准入的最低优先级
+负载为各项指标与阈值之比的最大值,大于等于1表示过载
+*/
+func (self *Room) CheckLoad() {
+	s := self.opts.LoadShedding
+	state := self.loadShedState
+	if s == nil || state == nil {
+		return
+	}
+	load := 0.0
+	if s.CPU != nil && s.CPUHigh > 0 {
+		load = s.CPU() / s.CPUHigh
+	}
+	if atomic.SwapInt32(&state.observed, 0) == 0 {
+		//没有消息时队列等待为0,否则空闲后平均值会一直停留在最后一次的值
+		state.observeWait(0)
+	}
+	if s.QueueLatency > 0 {
+		wait := float64(atomic.LoadInt64(&state.queueWait)) / float64(s.QueueLatency)
+		if wait > load {
+			load = wait
+		}
+	}
+	low := s.Recover
+	if low <= 0 {
+		low = 0.8
+	}
+	state.lock.Lock()
+	old := int(atomic.LoadInt32(&state.level))
+	level := old
+	if load >= 1 && level < len(state.levels)-1 {
+		level++
+	} else if load < low && level > 0 {
+		level--
+	}
+	atomic.StoreInt32(&state.level, int32(level))
+	state.lock.Unlock()
+	if level != old {
+		if level > old {
+			log.Error("room load %.2f, shedding game priority below %v", load, state.levels[level])
+		} else {
+			log.Warning("room load %.2f, shedding game priority below %v", load, state.levels[level])
+		}
+		if s.OnChange != nil {
+			s.OnChange(state.levels[level], load)
+		}
+	}
+}
+
+/**
+是否准入该游戏类型的新table或新玩家,拒绝时返回带重试间隔(秒)的ErrCodeShedLoad
+CreateByType,JoinTable和Backfill会自动调用
+*/
+func (self *Room) Admit(gameType string) error {
+	s := self.opts.LoadShedding
+	if s == nil || self.loadShedState == nil {
+		return nil
+	}
+	if s.Priorities[gameType] >= self.ShedPriority() {
+		return nil
+	}
+	retry := s.RetryAfter
+	if retry <= 0 {
+		retry = 5 * time.Second
+	}
+	return NewError(ErrCodeShedLoad, int64(retry/time.Second))
+}
@@ -0,0 +1,110 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/module"
+	"testing"
+	"time"
+)
+
+func TestLoadShedding(t *testing.T) {
+	cpu := 0.5
+	changes := []int{}
+	registry := NewTableRegistry()
+	registry.Register("casual", func(module module.RPCModule, tableId string) (BaseTable, error) {
+		t.Fatal("table created while shedding")
+		return nil, nil
+	})
+	room := NewRoom(nil, Registry(registry), SetLoadShedding(&LoadShedding{
+		Interval:     time.Hour,
+		CPU:          func() float64 { return cpu },
+		CPUHigh:      0.8,
+		QueueLatency: 100 * time.Millisecond,
+		Priorities:   map[string]int{"ranked": 10, "tournament": 20},
+		RetryAfter:   3 * time.Second,
+		OnChange:     func(minPriority int, load float64) { changes = append(changes, minPriority) },
+	}))
+	defer room.StopLoadShedding()
+	room.CheckLoad()
+	assertEqual(t, room.Admit("casual"), nil)
+
+	cpu = 0.9
+	room.CheckLoad()
+	assertEqual(t, room.ShedPriority(), 10)
+	err := room.Admit("casual")
+	assertEqual(t, ErrorCode(err), ErrCodeShedLoad)
+	assertEqual(t, err.(*RoomError).Params[0], int64(3))
+	assertEqual(t, room.Admit("ranked"), nil)
+	_, err = room.CreateByType("casual", "t1")
+	assertEqual(t, ErrorCode(err), ErrCodeShedLoad)
+
+	//最高优先级始终准入
+	room.CheckLoad()
+	room.CheckLoad()
+	assertEqual(t, room.ShedPriority(), 20)
+	assertEqual(t, room.Admit("tournament"), nil)
+
+	//队列等待也计入负载
+	cpu = 0.1
+	observe := room.LoadObserver()
+	for i := 0; i < 50; i++ {
+		observe(&QueueEvent{Wait: 200 * time.Millisecond})
+	}
+	room.CheckLoad()
+	assertEqual(t, room.ShedPriority(), 20)
+	for i := 0; i < 50; i++ {
+		observe(&QueueEvent{Wait: 0})
+	}
+	room.CheckLoad()
+	room.CheckLoad()
+	assertEqual(t, room.ShedPriority(), 0)
+	assertEqual(t, len(changes), 4)
+	assertEqual(t, changes[2], 10)
+	assertEqual(t, changes[3], 0)
+}
+
+func TestLoadSheddingJoin(t *testing.T) {
+	cpu := 0.1
+	registry := NewTableRegistry()
+	registry.Register("casual", newBenchTable)
+	room := NewRoom(nil, Registry(registry), SetLoadShedding(&LoadShedding{
+		Interval:     time.Hour,
+		CPU:          func() float64 { return cpu },
+		CPUHigh:      0.8,
+		QueueLatency: 100 * time.Millisecond,
+		Priorities:   map[string]int{"ranked": 10},
+	}))
+	defer room.StopLoadShedding()
+	_, err := room.CreateByType("casual", "t1")
+	assertEqual(t, err, nil)
+
+	cpu = 0.9
+	room.CheckLoad()
+	_, err = room.JoinTable(NewNullSession("p1"), "t1", nil)
+	assertEqual(t, ErrorCode(err), ErrCodeShedLoad)
+
+	//没有新消息时队列等待逐渐回落
+	cpu = 0.1
+	observe := room.LoadObserver()
+	for i := 0; i < 50; i++ {
+		observe(&QueueEvent{Wait: time.Second})
+	}
+	room.CheckLoad()
+	assertEqual(t, room.ShedPriority(), 10)
+	for i := 0; i < 50 && room.ShedPriority() > 0; i++ {
+		room.CheckLoad()
+	}
+	assertEqual(t, room.ShedPriority(), 0)
+}
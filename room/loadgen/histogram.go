@@ -0,0 +1,184 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package loadgen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var buckets = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+}
+
+/**
+固定桶的延迟直方图,协成安全
+*/
+type Histogram struct {
+	lock   sync.Mutex
+	counts []int64 //最后一个桶是+Inf
+	total  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{
+		counts: make([]int64, len(buckets)+1),
+	}
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	i := 0
+	for i < len(buckets) && d > buckets[i] {
+		i++
+	}
+	h.counts[i]++
+	h.total++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+func (h *Histogram) Count() int64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.total
+}
+
+/**
+按桶估算分位数,返回所在桶的上界
+*/
+func (h *Histogram) Percentile(p float64) time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	target := int64(float64(h.total) * p)
+	var n int64
+	for i, c := range h.counts {
+		n += c
+		if n > target || n == h.total {
+			if i < len(buckets) {
+				return buckets[i]
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+func (h *Histogram) String() string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	buf := &bytes.Buffer{}
+	if h.total == 0 {
+		return "no samples"
+	}
+	fmt.Fprintf(buf, "count=%d avg=%v max=%v\n", h.total, h.sum/time.Duration(h.total), h.max)
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		if i < len(buckets) {
+			fmt.Fprintf(buf, "  <=%-8v %d\n", buckets[i], c)
+		} else {
+			fmt.Fprintf(buf, "  >%-9v %d\n", buckets[len(buckets)-1], c)
+		}
+	}
+	return buf.String()
+}
+
+/**
+按错误分类计数,协成安全
+*/
+type ErrorHistogram struct {
+	lock   sync.Mutex
+	counts map[string]int64
+	total  int64
+}
+
+func NewErrorHistogram() *ErrorHistogram {
+	return &ErrorHistogram{
+		counts: map[string]int64{},
+	}
+}
+
+func (h *ErrorHistogram) Observe(kind string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.counts[kind]++
+	h.total++
+}
+
+func (h *ErrorHistogram) Count() int64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.total
+}
+
+/**
+各分类的次数副本
+*/
+func (h *ErrorHistogram) Counts() map[string]int64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	counts := make(map[string]int64, len(h.counts))
+	for kind, c := range h.counts {
+		counts[kind] = c
+	}
+	return counts
+}
+
+/**
+按次数从多到少排列
+*/
+func (h *ErrorHistogram) String() string {
+	counts := h.Counts()
+	if len(counts) == 0 {
+		return "no errors"
+	}
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if counts[kinds[i]] != counts[kinds[j]] {
+			return counts[kinds[i]] > counts[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+	buf := &bytes.Buffer{}
+	for _, kind := range kinds {
+		fmt.Fprintf(buf, "  %-24v %d\n", kind, counts[kind])
+	}
+	return buf.String()
+}
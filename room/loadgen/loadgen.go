@@ -0,0 +1,292 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/**
+room压力测试工具
+
+在进程内创建大量table和机器人玩家,按配置的频率发送脚本化的操作,统计延迟和错误,用于评估单个room节点的容量
+运行前需要先启动timewheel(mqant应用启动时会自动启动)
+*/
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/liangdas/mqant-modules/room"
+	"github.com/liangdas/mqant/module"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+模拟玩家发送的操作
+*/
+type Action struct {
+	Func   string
+	Weight int //按权重随机选择操作
+	//生成操作参数,requestId需要由游戏在回复中原样带回,为nil时传session和requestId
+	Params func(session *room.BotSession, requestId string) []interface{}
+	//等待回复的topic,设置后统计从放入队列到机器人收到带有相同requestId回复的延迟
+	Reply string
+}
+
+/**
+回复中的请求标识和错误,由ReplyParser从回复消息中解析
+*/
+type Reply struct {
+	RequestId string
+	Error     string //为空表示成功
+}
+
+type ReplyParser func(topic string, body []byte) (*Reply, error)
+
+/**
+默认的ReplyParser,回复为JSON {"RequestId":"xxx","Code":0,"Message":""},Code不为0时按错误统计
+*/
+func ParseJSONReply(topic string, body []byte) (*Reply, error) {
+	msg := struct {
+		RequestId string
+		Code      int
+		Message   string
+	}{}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	reply := &Reply{RequestId: msg.RequestId}
+	if msg.Code != 0 {
+		reply.Error = fmt.Sprintf("code %d", msg.Code)
+	}
+	return reply, nil
+}
+
+type Config struct {
+	Module          module.RPCModule
+	NewTable        room.NewTableFunc
+	Tables          int
+	PlayersPerTable int
+	Rate            float64       //每个玩家每秒发送的操作数
+	Duration        time.Duration //压测持续时间
+	Actions         []Action
+	//让机器人加入table,由游戏实现,例如放入join消息
+	Join func(table room.BaseTable, session *room.BotSession) error
+	//解析回复,默认ParseJSONReply
+	ParseReply ReplyParser
+}
+
+type Report struct {
+	Tables   int
+	Players  int
+	Sent     int64
+	Timeouts int64 //压测结束时仍未收到回复的操作数
+	Duration time.Duration
+	Latency  *Histogram
+	Errors   *ErrorHistogram //放入队列失败和回复中的错误,按错误分类
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("tables=%d players=%d sent=%d (%.1f/s) errors=%d timeouts=%d p50=%v p99=%v\nlatency %v\nerrors %v",
+		r.Tables, r.Players, r.Sent, float64(r.Sent)/r.Duration.Seconds(), r.Errors.Count(), r.Timeouts,
+		r.Latency.Percentile(0.5), r.Latency.Percentile(0.99), r.Latency, r.Errors)
+}
+
+type Generator struct {
+	cfg     Config
+	room    *room.Room
+	latency *Histogram
+	errors  *ErrorHistogram
+	sent    int64
+	weight  int
+}
+
+func New(cfg Config) *Generator {
+	weight := 0
+	for _, action := range cfg.Actions {
+		weight += action.Weight
+	}
+	if cfg.ParseReply == nil {
+		cfg.ParseReply = ParseJSONReply
+	}
+	return &Generator{
+		cfg:     cfg,
+		room:    room.NewRoom(cfg.Module),
+		latency: NewHistogram(),
+		errors:  NewErrorHistogram(),
+		weight:  weight,
+	}
+}
+
+type request struct {
+	topic string
+	sent  time.Time
+}
+
+/**
+模拟玩家,按requestId记录还未收到回复的请求
+*/
+type player struct {
+	session *room.BotSession
+	lock    sync.Mutex
+	seq     int64
+	pending map[string]*request
+}
+
+func newPlayer(userId string, g *Generator) *player {
+	p := &player{pending: map[string]*request{}}
+	p.session = room.NewBotSession(userId, p.onMessage(g))
+	return p
+}
+
+/**
+记录等待topic回复的请求,返回requestId
+*/
+func (p *player) track(topic string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.seq++
+	requestId := fmt.Sprintf("%s-%d", p.session.GetUserId(), p.seq)
+	p.pending[requestId] = &request{topic: topic, sent: time.Now()}
+	return requestId
+}
+
+func (p *player) untrack(requestId string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.pending, requestId)
+}
+
+func (p *player) outstanding() int64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return int64(len(p.pending))
+}
+
+/**
+只统计topic和requestId都匹配的回复,广播等其他消息忽略
+*/
+func (p *player) onMessage(g *Generator) func(topic string, body []byte) {
+	return func(topic string, body []byte) {
+		reply, err := g.cfg.ParseReply(topic, body)
+		if err != nil || reply == nil || reply.RequestId == "" {
+			return
+		}
+		p.lock.Lock()
+		req, ok := p.pending[reply.RequestId]
+		if ok && req.topic == topic {
+			delete(p.pending, reply.RequestId)
+		}
+		p.lock.Unlock()
+		if !ok || req.topic != topic {
+			return
+		}
+		g.latency.Observe(time.Since(req.sent))
+		if reply.Error != "" {
+			g.errors.Observe(reply.Error)
+		}
+	}
+}
+
+/**
+阻塞执行压测直到Duration结束
+*/
+func (g *Generator) Run() (*Report, error) {
+	if g.cfg.NewTable == nil || g.cfg.Join == nil {
+		return nil, fmt.Errorf("loadgen: NewTable and Join are required")
+	}
+	if g.weight <= 0 || g.cfg.Rate <= 0 {
+		return nil, fmt.Errorf("loadgen: Actions with positive Weight and a positive Rate are required")
+	}
+	players := []*player{}
+	tableIds := []string{}
+	for i := 0; i < g.cfg.Tables; i++ {
+		tableId := fmt.Sprintf("loadgen-%d-%s", i, room.GetRandomString(6))
+		table, err := g.room.CreateById(g.cfg.Module, tableId, g.cfg.NewTable)
+		if err != nil {
+			return nil, err
+		}
+		table.Run()
+		tableIds = append(tableIds, table.TableId())
+		for j := 0; j < g.cfg.PlayersPerTable; j++ {
+			p := newPlayer(fmt.Sprintf("%d", i*g.cfg.PlayersPerTable+j+1), g)
+			if err := g.cfg.Join(table, p.session); err != nil {
+				return nil, err
+			}
+			players = append(players, p)
+			go g.drive(table, p, time.Now().Add(g.cfg.Duration))
+		}
+	}
+	start := time.Now()
+	time.Sleep(g.cfg.Duration)
+	//等待最后一批回复
+	time.Sleep(time.Second)
+	report := &Report{
+		Tables:   g.cfg.Tables,
+		Players:  len(players),
+		Sent:     atomic.LoadInt64(&g.sent),
+		Duration: time.Since(start),
+		Latency:  g.latency,
+		Errors:   g.errors,
+	}
+	for _, p := range players {
+		report.Timeouts += p.outstanding()
+	}
+	for _, tableId := range tableIds {
+		if table := g.room.GetTable(tableId); table != nil {
+			table.Finish()
+		}
+		g.room.DestroyTable(tableId)
+	}
+	return report, nil
+}
+
+func (g *Generator) drive(table room.BaseTable, p *player, deadline time.Time) {
+	interval := time.Duration(float64(time.Second) / g.cfg.Rate)
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	//随机错开第一次发送,避免所有机器人同时发送
+	time.Sleep(time.Duration(r.Int63n(int64(interval) + 1)))
+	for time.Now().Before(deadline) {
+		g.send(table, p, g.pick(r))
+		time.Sleep(interval)
+	}
+}
+
+func (g *Generator) send(table room.BaseTable, p *player, action Action) {
+	requestId := ""
+	if action.Reply != "" {
+		requestId = p.track(action.Reply)
+	}
+	params := []interface{}{p.session, requestId}
+	if action.Params != nil {
+		params = action.Params(p.session, requestId)
+	}
+	atomic.AddInt64(&g.sent, 1)
+	if err := table.PutQueue(action.Func, params...); err != nil {
+		g.errors.Observe(err.Error())
+		if requestId != "" {
+			p.untrack(requestId)
+		}
+	}
+}
+
+func (g *Generator) pick(r *rand.Rand) Action {
+	n := r.Intn(g.weight)
+	for _, action := range g.cfg.Actions {
+		if n < action.Weight {
+			return action
+		}
+		n -= action.Weight
+	}
+	return g.cfg.Actions[len(g.cfg.Actions)-1]
+}
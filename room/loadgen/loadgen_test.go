@@ -0,0 +1,88 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package loadgen
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func reply(requestId string, code int) []byte {
+	return []byte(fmt.Sprintf(`{"RequestId":%q,"Code":%d}`, requestId, code))
+}
+
+func TestReplyCorrelation(t *testing.T) {
+	g := New(Config{})
+	p := newPlayer("1", g)
+	first := p.track("Game/Ack")
+	second := p.track("Game/Ack")
+	other := p.track("Game/Other")
+
+	//乱序回复按requestId匹配
+	p.session.SendNR("Game/Ack", reply(second, 0))
+	if _, ok := p.pending[first]; !ok {
+		t.Fatalf("reply to %v matched %v", second, first)
+	}
+	//topic不一致或未知的requestId不计入
+	p.session.SendNR("Game/Ack", reply(other, 0))
+	p.session.SendNR("Game/Ack", reply("unknown", 0))
+	p.session.SendNR("Game/Ack", []byte("broadcast"))
+	if g.latency.Count() != 1 || p.outstanding() != 2 {
+		t.Fatalf("unexpected samples %v outstanding %v", g.latency.Count(), p.outstanding())
+	}
+	p.session.SendNR("Game/Ack", reply(first, 1007))
+	if g.latency.Count() != 2 || p.outstanding() != 1 {
+		t.Fatalf("unexpected samples %v outstanding %v", g.latency.Count(), p.outstanding())
+	}
+	if g.errors.Count() != 1 || g.errors.Counts()["code 1007"] != 1 {
+		t.Fatalf("unexpected errors %v", g.errors.Counts())
+	}
+	//重复回复不再计入
+	p.session.SendNR("Game/Ack", reply(first, 0))
+	if g.latency.Count() != 2 {
+		t.Fatalf("duplicate reply counted")
+	}
+}
+
+func TestErrorHistogram(t *testing.T) {
+	h := NewErrorHistogram()
+	if h.String() != "no errors" {
+		t.Fatalf("unexpected %q", h.String())
+	}
+	h.Observe("queue full")
+	h.Observe("code 1007")
+	h.Observe("queue full")
+	if h.Count() != 3 || h.Counts()["queue full"] != 2 {
+		t.Fatalf("unexpected counts %v", h.Counts())
+	}
+	expect := fmt.Sprintf("  %-24v %d\n  %-24v %d\n", "queue full", 2, "code 1007", 1)
+	if h.String() != expect {
+		t.Fatalf("unexpected %q", h.String())
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	h := NewHistogram()
+	for i := 0; i < 99; i++ {
+		h.Observe(3 * time.Millisecond)
+	}
+	h.Observe(3 * time.Second)
+	if h.Percentile(0.5) != 5*time.Millisecond {
+		t.Fatalf("unexpected p50 %v", h.Percentile(0.5))
+	}
+	if h.Percentile(0.999) != 3*time.Second {
+		t.Fatalf("unexpected p99.9 %v", h.Percentile(0.999))
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/liangdas/mqant/gate"
+	"sync"
+)
+
+//客户端在session settings中上报的语言,例如 zh-CN, en
+const SessionLocale = "locale"
+
+//本地化全服广播在队列中的函数名
+const LocalizedBroadcastQueueFunc = "Room.LocalizedBroadcast"
+
+/**
+按消息key查找的文本目录,format可以包含fmt格式化占位符
+*/
+type TextCatalog interface {
+	Text(locale string, key string) (format string, ok bool)
+}
+
+/**
+基于map的文本目录 locale->key->format
+*/
+type MapTextCatalog map[string]map[string]string
+
+func (c MapTextCatalog) Text(locale string, key string) (string, bool) {
+	if texts, ok := c[locale]; ok {
+		format, ok := texts[key]
+		return format, ok
+	}
+	return "", false
+}
+
+var (
+	textCatalog     TextCatalog
+	textCatalogLock sync.RWMutex
+)
+
+func SetTextCatalog(c TextCatalog) {
+	textCatalogLock.Lock()
+	textCatalog = c
+	textCatalogLock.Unlock()
+}
+
+func GetTextCatalog() TextCatalog {
+	textCatalogLock.RLock()
+	defer textCatalogLock.RUnlock()
+	return textCatalog
+}
+
+/**
+下发给客户端的本地化消息
+服务端目录中有该语言的文本时填充Text,否则Text为空,由客户端根据Key和Params渲染
+*/
+type LocalizedMessage struct {
+	Key    string
+	Params []interface{}
+	Text   string `json:",omitempty"`
+}
+
+/**
+按locale渲染消息
+*/
+func Localize(locale string, key string, params ...interface{}) *LocalizedMessage {
+	msg := &LocalizedMessage{
+		Key:    key,
+		Params: params,
+	}
+	if catalog := GetTextCatalog(); catalog != nil {
+		if format, ok := catalog.Text(locale, key); ok {
+			msg.Text = formatMessage(format, params)
+		}
+	}
+	return msg
+}
+
+func SessionLocaleOf(session gate.Session) string {
+	if session == nil {
+		return ""
+	}
+	if settings := session.GetSettings(); settings != nil {
+		return settings[SessionLocale]
+	}
+	return ""
+}
+
+/**
+给table内所有玩家发送本地化消息,每个玩家按自己session的语言渲染
+*/
+func (this *UnifiedSendMessageTable) NotifyLocalized(topic string, key string, params ...interface{}) error {
+	bodies := map[string][]byte{}
+	for _, role := range this.tableimp.GetSeats() {
+		if role == nil || role.Session() == nil {
+			continue
+		}
+		info := PlayerSession(role)
+		locale := info.Locale()
+		body, ok := bodies[locale]
+		if !ok {
+			var err error
+			body, err = json.Marshal(Localize(locale, key, params...))
+			if err != nil {
+				return err
+			}
+			bodies[locale] = body
+		}
+		if err := this.SendCallBackMsgNR([]string{info.SessionId()}, topic, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *UnifiedSendMessageTable) onLocalizedBroadcast(topic string, key string, params []interface{}) error {
+	return this.NotifyLocalized(topic, key, params...)
+}
+
+/**
+全服本地化广播,与Broadcast共用限流
+返回成功投递的table数量
+*/
+func (self *Room) BroadcastLocalized(topic string, key string, params ...interface{}) (int, error) {
+	if !self.broadcastLimiter.Allow() {
+		return 0, fmt.Errorf("broadcast rate limited")
+	}
+	delivered := 0
+	self.tables.Range(func(k, value interface{}) bool {
+		table := value.(BaseTable)
+		if !table.Runing() {
+			return true
+		}
+		if err := putTableQueue(table, PrioritySystem, LocalizedBroadcastQueueFunc, topic, key, params); err == nil {
+			delivered++
+		}
+		return true
+	})
+	return delivered, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLocalizeFallback(t *testing.T) {
+	//没有目录时由客户端渲染
+	msg := Localize("en", "welcome", "bob")
+	assertEqual(t, msg.Text, "")
+	assertEqual(t, msg.Key, "welcome")
+
+	SetTextCatalog(MapTextCatalog{
+		"en": {"welcome": "welcome %v"},
+		"zh": {"bye": "再见"},
+	})
+	defer SetTextCatalog(nil)
+	assertEqual(t, Localize("en", "welcome", "bob").Text, "welcome bob")
+	//目录中没有该语言或该key时Text为空,保留Key和Params
+	msg = Localize("fr", "welcome", "bob")
+	assertEqual(t, msg.Text, "")
+	assertEqual(t, msg.Params[0], "bob")
+	assertEqual(t, Localize("zh", "welcome").Text, "")
+	body, _ := json.Marshal(msg)
+	assertEqual(t, string(body), `{"Key":"welcome","Params":["bob"]}`)
+}
+
+func TestNotifyLocalized(t *testing.T) {
+	SetTextCatalog(MapTextCatalog{
+		"en": {"welcome": "welcome %v"},
+		"zh": {"welcome": "欢迎 %v"},
+	})
+	defer SetTextCatalog(nil)
+	received := map[string]*LocalizedMessage{}
+	table := &benchTable{seats: map[string]BasePlayer{}}
+	for _, locale := range []string{"en", "zh", "fr"} {
+		locale := locale
+		session := NewBotSession("u-"+locale, func(topic string, body []byte) {
+			msg := &LocalizedMessage{}
+			json.Unmarshal(body, msg)
+			received[locale] = msg
+		})
+		session.SetSettings(map[string]string{SessionLocale: locale})
+		player := &BasePlayerImp{}
+		player.Bind(session)
+		table.seats[locale] = player
+	}
+	table.OnInit(table, TableId("t1"), SetScheduler(benchScheduler, 0, 0))
+	assertEqual(t, table.NotifyLocalized("Room/Notice", "welcome", "bob"), nil)
+	table.ExecuteCallBackMsg(table.Trace())
+	assertEqual(t, received["en"].Text, "welcome bob")
+	assertEqual(t, received["zh"].Text, "欢迎 bob")
+	assertEqual(t, received["fr"].Text, "")
+	assertEqual(t, received["fr"].Key, "welcome")
+}
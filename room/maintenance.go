@@ -0,0 +1,181 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//暂停和恢复消息在队列中的函数名
+const (
+	PauseQueueFunc  = "Room.Pause"
+	ResumeQueueFunc = "Room.Resume"
+)
+
+//维护通知的状态
+const (
+	MaintenanceCountdown = "countdown" //即将暂停,Remaining为剩余秒数
+	MaintenancePaused    = "paused"
+	MaintenanceResumed   = "resumed"
+)
+
+/**
+下发给客户端的维护通知
+*/
+type MaintenanceNotice struct {
+	State     string
+	Remaining int64 //距离暂停的秒数,客户端据此自行显示倒计时
+}
+
+/**
+table暂停状态
+暂停期间只执行系统优先级消息,阶段,投票,超时和Update都停止计时
+*/
+type PauseTable struct {
+	clock    func() Clock
+	paused   bool
+	pausedAt time.Time
+}
+
+func (this *PauseTable) PauseTableInit(clock func() Clock) {
+	this.clock = clock
+	this.paused = false
+}
+
+func (this *PauseTable) Paused() bool {
+	return this.paused
+}
+
+/**
+队列检查,暂停期间拒绝玩家操作
+*/
+func (this *PauseTable) PauseGuard(msg *QueueMsg) error {
+	if this.paused && msg.Priority != PrioritySystem {
+		return NewError(ErrCodeMaintenance)
+	}
+	return nil
+}
+
+/**
+暂停table,只能在table协成中调用
+*/
+func (this *QTable) Suspend() {
+	if !this.paused {
+		this.paused = true
+		this.pausedAt = this.Clock().Now()
+	}
+}
+
+/**
+恢复table,暂停期间的时间不计入阶段,投票,回合和倒计时的计时
+只能在table协成中调用
+*/
+func (this *QTable) Resume() {
+	if this.paused {
+		d := this.Clock().Now().Sub(this.pausedAt)
+		this.paused = false
+		this.ShiftPhase(d)
+		this.ShiftVotes(d)
+		this.ShiftTurn(d)
+		this.ShiftTick(d)
+		this.ShiftCountdowns(d)
+		this.ResetTimeOut()
+	}
+}
+
+func (this *QTable) onPause(topic string, body []byte) error {
+	this.Suspend()
+	return this.NotifyCallBackMsgNR(topic, body)
+}
+
+func (this *QTable) onResume(topic string, body []byte) error {
+	this.Resume()
+	return this.NotifyCallBackMsgNR(topic, body)
+}
+
+func (self *Room) notifyMaintenance(queueFunc string, topic string, notice *MaintenanceNotice) int {
+	body, _ := json.Marshal(notice)
+	delivered := 0
+	self.tables.Range(func(key, value interface{}) bool {
+		table := value.(BaseTable)
+		if !table.Runing() {
+			return true
+		}
+		if err := putTableQueue(table, PrioritySystem, queueFunc, topic, body); err == nil {
+			delivered++
+		}
+		return true
+	})
+	return delivered
+}
+
+/**
+维护暂停,先向所有玩家发送倒计时通知,countdown之后暂停所有table
+调用后立即拒绝创建新的table
+*/
+func (self *Room) Pause(countdown time.Duration, topic string) {
+	self.maintenanceLock.Lock()
+	defer self.maintenanceLock.Unlock()
+	self.maintenance = true
+	self.maintenanceGen++
+	gen := self.maintenanceGen
+	if self.pauseTimer != nil {
+		self.pauseTimer.Stop()
+	}
+	self.notifyMaintenance(BroadcastQueueFunc, topic, &MaintenanceNotice{
+		State:     MaintenanceCountdown,
+		Remaining: int64(countdown / time.Second),
+	})
+	self.pauseTimer = time.AfterFunc(countdown, func() {
+		self.pauseTables(gen, topic)
+	})
+}
+
+/**
+倒计时结束时暂停所有table,期间调用过Resume或再次Pause时跳过
+持有锁发送,保证之后的Resume消息排在暂停消息之后
+*/
+func (self *Room) pauseTables(gen int64, topic string) {
+	self.maintenanceLock.Lock()
+	defer self.maintenanceLock.Unlock()
+	if !self.maintenance || gen != self.maintenanceGen {
+		return
+	}
+	self.notifyMaintenance(PauseQueueFunc, topic, &MaintenanceNotice{State: MaintenancePaused})
+}
+
+/**
+恢复所有table,倒计时中调用会取消暂停
+*/
+func (self *Room) Resume(topic string) {
+	self.maintenanceLock.Lock()
+	defer self.maintenanceLock.Unlock()
+	self.maintenance = false
+	self.maintenanceGen++
+	if self.pauseTimer != nil {
+		self.pauseTimer.Stop()
+		self.pauseTimer = nil
+	}
+	self.notifyMaintenance(ResumeQueueFunc, topic, &MaintenanceNotice{State: MaintenanceResumed})
+}
+
+/**
+是否处于维护状态(包括倒计时),游戏模块据此拒绝玩家加入
+*/
+func (self *Room) InMaintenance() bool {
+	self.maintenanceLock.Lock()
+	defer self.maintenanceLock.Unlock()
+	return self.maintenance
+}
@@ -0,0 +1,87 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceDrain(t *testing.T) {
+	room := NewRoom(nil)
+	table, _ := room.CreateById(nil, "t1", newBenchTable)
+	table.Run()
+	bench := table.(*benchTable)
+	room.Pause(200*time.Millisecond, "Room/Maintenance")
+	//倒计时期间已经拒绝新的table和玩家加入,已有的table继续运行
+	assertEqual(t, room.InMaintenance(), true)
+	_, err := room.CreateById(nil, "t2", newBenchTable)
+	assertEqual(t, ErrorCode(err), ErrCodeMaintenance)
+	_, err = room.JoinTable(NewNullSession("u1"), "t1", nil)
+	assertEqual(t, ErrorCode(err), ErrCodeMaintenance)
+	bench.ExecuteEvent(nil)
+	assertEqual(t, bench.Paused(), false)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !bench.Paused() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		bench.ExecuteEvent(nil)
+	}
+	assertEqual(t, bench.Paused(), true)
+	assertEqual(t, ErrorCode(bench.PauseGuard(&QueueMsg{Func: "Bet", Priority: PriorityAction})), ErrCodeMaintenance)
+	assertEqual(t, bench.PauseGuard(&QueueMsg{Func: VoteQueueFunc, Priority: PrioritySystem}), nil)
+
+	room.Resume("Room/Maintenance")
+	assertEqual(t, room.InMaintenance(), false)
+	bench.ExecuteEvent(nil)
+	assertEqual(t, bench.Paused(), false)
+	assertEqual(t, bench.PauseGuard(&QueueMsg{Func: "Bet", Priority: PriorityAction}), nil)
+}
+
+func TestMaintenanceCancel(t *testing.T) {
+	room := NewRoom(nil)
+	table, _ := room.CreateById(nil, "t1", newBenchTable)
+	table.Run()
+	bench := table.(*benchTable)
+	room.Pause(10*time.Millisecond, "Room/Maintenance")
+	//倒计时中恢复会取消暂停
+	room.Resume("Room/Maintenance")
+	time.Sleep(30 * time.Millisecond)
+	bench.ExecuteEvent(nil)
+	assertEqual(t, bench.Paused(), false)
+	_, err := room.CreateById(nil, "t2", newBenchTable)
+	assertEqual(t, err, nil)
+}
+
+func TestMaintenanceResumeRace(t *testing.T) {
+	room := NewRoom(nil)
+	table, _ := room.CreateById(nil, "t1", newBenchTable)
+	table.Run()
+	bench := table.(*benchTable)
+	room.Pause(time.Hour, "Room/Maintenance")
+	gen := room.maintenanceGen
+	room.Resume("Room/Maintenance")
+	//Resume之后才执行的定时器不能再暂停table
+	room.pauseTables(gen, "Room/Maintenance")
+	bench.ExecuteEvent(nil)
+	assertEqual(t, bench.Paused(), false)
+
+	room.Pause(time.Hour, "Room/Maintenance")
+	room.pauseTables(room.maintenanceGen, "Room/Maintenance")
+	bench.ExecuteEvent(nil)
+	assertEqual(t, bench.Paused(), true)
+	room.Resume("Room/Maintenance")
+	bench.ExecuteEvent(nil)
+	assertEqual(t, bench.Paused(), false)
+}
@@ -0,0 +1,234 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/log"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+//估算大小时最多展开的层数,更深的值按固定大小计算
+const sizeDepth = 4
+
+/**
+估算值占用的内存,只用于预算控制,不追求精确
+*/
+func approxSize(v interface{}) int64 {
+	switch value := v.(type) {
+	case nil:
+		return 0
+	case []byte:
+		return int64(len(value))
+	case string:
+		return int64(len(value))
+	}
+	return approxValueSize(reflect.ValueOf(v), sizeDepth)
+}
+
+func approxValueSize(v reflect.Value, depth int) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	if depth <= 0 {
+		return 16
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return int64(v.Len())
+		}
+		var size int64 = 24
+		for i := 0; i < v.Len(); i++ {
+			size += approxValueSize(v.Index(i), depth-1)
+		}
+		return size
+	case reflect.Map:
+		var size int64 = 48
+		for _, key := range v.MapKeys() {
+			size += approxValueSize(key, depth-1) + approxValueSize(v.MapIndex(key), depth-1)
+		}
+		return size
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 8
+		}
+		return 8 + approxValueSize(v.Elem(), depth-1)
+	case reflect.Struct:
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			size += approxValueSize(v.Field(i), depth-1)
+		}
+		return size
+	}
+	return int64(v.Type().Size())
+}
+
+func approxParamsSize(params []interface{}) int64 {
+	var size int64
+	for _, param := range params {
+		size += approxSize(param)
+	}
+	return size
+}
+
+/**
+table的估算内存占用,单位字节
+*/
+type MemoryUsage struct {
+	Queue      int64 //队列中未执行的消息
+	Attributes int64 //共享属性
+	ActionLog  int64 //事件溯源的事件和快照
+}
+
+func (u MemoryUsage) Total() int64 {
+	return u.Queue + u.Attributes + u.ActionLog
+}
+
+/**
+table内存预算
+超过Soft时打印警告并调用OnSoft,游戏可以在OnSoft中清理自己的数据
+超过Hard时先丢弃最近快照之前的事件,仍然超过则拒绝除系统消息以外的新消息,直到回落到Hard以下
+*/
+type MemoryBudget struct {
+	Soft          int64
+	Hard          int64
+	CheckInterval time.Duration //检查间隔,默认1秒
+	OnSoft        func(table BaseTable, usage MemoryUsage)
+}
+
+/**
+队列中消息的估算大小,协成安全
+*/
+func (self *QueueTable) QueueBytes() int64 {
+	return atomic.LoadInt64(&self.queueBytes)
+}
+
+/**
+是否因为超出内存预算而拒绝新消息
+*/
+func (self *QueueTable) OverBudget() bool {
+	return atomic.LoadInt32(&self.overBudget) == 1
+}
+
+func (self *QueueTable) setOverBudget(over bool) {
+	if over {
+		atomic.StoreInt32(&self.overBudget, 1)
+	} else {
+		atomic.StoreInt32(&self.overBudget, 0)
+	}
+}
+
+/**
+共享属性的估算大小,按设置时的值计算
+*/
+func (this *AttributeTable) AttributeBytes() int64 {
+	this.attrLock.RLock()
+	defer this.attrLock.RUnlock()
+	return this.attrBytes
+}
+
+/**
+内存中事件和快照的大小
+*/
+func (this *EventSourcedTable) ActionLogBytes() int64 {
+	var size int64
+	for _, event := range this.events {
+		size += int64(len(event.Type)+len(event.Data)) + 24
+	}
+	for _, snapshot := range this.snapshots {
+		size += int64(len(snapshot.Data)) + 8
+	}
+	return size
+}
+
+/**
+丢弃最近一次快照之前的事件和快照,之后只能Rewind到该快照之后
+EventStore中已持久化的数据不受影响
+*/
+func (this *EventSourcedTable) TrimEvents() {
+	if len(this.snapshots) == 0 {
+		return
+	}
+	latest := this.snapshots[len(this.snapshots)-1]
+	this.snapshots = []*TableSnapshot{latest}
+	this.events = append([]*TableEvent{}, this.events[this.indexOf(latest.Seq):]...)
+}
+
+/**
+table当前的估算内存占用
+*/
+func (this *QTable) MemoryUsage() MemoryUsage {
+	usage := MemoryUsage{
+		Queue:      this.QueueBytes(),
+		Attributes: this.AttributeBytes(),
+	}
+	if actionLog, ok := this.BaseTableImp.subtable.(interface {
+		ActionLogBytes() int64
+	}); ok {
+		usage.ActionLog = actionLog.ActionLogBytes()
+	}
+	return usage
+}
+
+/**
+【每帧调用】按CheckInterval采样内存占用(供/debug/room/tables使用)并检查内存预算
+没有设置MemoryBudget时每秒采样一次
+*/
+func (this *QTable) CheckMemory() {
+	budget := this.opts.MemoryBudget
+	now := this.Clock().Now()
+	interval := time.Second
+	if budget != nil && budget.CheckInterval > 0 {
+		interval = budget.CheckInterval
+	}
+	if now.Sub(this.lastMemoryCheck) < interval {
+		return
+	}
+	this.lastMemoryCheck = now
+	usage := this.MemoryUsage()
+	this.recordMemory(usage.Total())
+	if budget == nil {
+		return
+	}
+	if budget.Hard > 0 && usage.Total() > budget.Hard {
+		if trimmer, ok := this.BaseTableImp.subtable.(interface {
+			TrimEvents()
+		}); ok {
+			trimmer.TrimEvents()
+			usage = this.MemoryUsage()
+			this.recordMemory(usage.Total())
+		}
+	}
+	over := budget.Hard > 0 && usage.Total() > budget.Hard
+	if over != this.OverBudget() {
+		if over {
+			log.Error("table %v over hard memory budget %v: %+v", this.TableId(), budget.Hard, usage)
+		} else {
+			log.Warning("table %v back under hard memory budget %v", this.TableId(), budget.Hard)
+		}
+		this.setOverBudget(over)
+	}
+	soft := budget.Soft > 0 && usage.Total() > budget.Soft
+	if soft && !this.overSoftBudget {
+		log.Warning("table %v over soft memory budget %v: %+v", this.TableId(), budget.Soft, usage)
+		if budget.OnSoft != nil {
+			budget.OnSoft(this.BaseTableImp.subtable, usage)
+		}
+	}
+	this.overSoftBudget = soft
+}
@@ -0,0 +1,185 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//让table裁剪事件日志并进入休眠的消息在队列中的函数名
+const ShedMemoryQueueFunc = "Room.ShedMemory"
+
+//进程内存水位
+const (
+	MemoryNormal = iota
+	MemorySoft   //裁剪事件日志,空闲table进入休眠
+	MemoryHard   //在Soft的基础上拒绝创建新的table
+)
+
+/**
+进程级的内存保护,超过阈值时逐级降级,而不是在高峰期被系统OOM杀掉
+阈值单位为字节,0表示不检查该级别
+*/
+type MemoryGuard struct {
+	Soft      uint64
+	Hard      uint64
+	Interval  time.Duration //检查间隔,默认1秒
+	IdleAfter time.Duration //超过该时间没有收到消息的table视为空闲,默认1分钟
+	//水位变化时调用,用于告警
+	OnAlert func(level int, usage uint64)
+	//返回当前内存占用,默认使用runtime.MemStats.HeapAlloc,容器中可以改为读取cgroup
+	Usage func() uint64
+}
+
+func heapAlloc() uint64 {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return mem.HeapAlloc
+}
+
+type memoryGuardState struct {
+	lock  sync.Mutex
+	level int32
+	stop  chan struct{}
+}
+
+func (self *Room) startMemoryGuard(g *MemoryGuard) {
+	interval := g.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	self.memoryGuardState = &memoryGuardState{
+		stop: make(chan struct{}),
+	}
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				self.CheckMemoryGuard()
+			case <-stop:
+				return
+			}
+		}
+	}(self.memoryGuardState.stop)
+}
+
+/**
+停止后台检查
+*/
+func (self *Room) StopMemoryGuard() {
+	if self.memoryGuardState == nil {
+		return
+	}
+	self.memoryGuardState.lock.Lock()
+	defer self.memoryGuardState.lock.Unlock()
+	if self.memoryGuardState.stop != nil {
+		close(self.memoryGuardState.stop)
+		self.memoryGuardState.stop = nil
+	}
+}
+
+/**
+当前的内存水位,没有设置MemoryGuard时总是MemoryNormal
+*/
+func (self *Room) MemoryLevel() int {
+	if self.memoryGuardState == nil {
+		return MemoryNormal
+	}
+	return int(atomic.LoadInt32(&self.memoryGuardState.level))
+}
+
+/**
+检查一次内存占用,超过Soft时每次检查都会让空闲table释放内存
+*/
+func (self *Room) CheckMemoryGuard() {
+	g := self.opts.MemoryGuard
+	if g == nil || self.memoryGuardState == nil {
+		return
+	}
+	usage := g.Usage
+	if usage == nil {
+		usage = heapAlloc
+	}
+	used := usage()
+	level := MemoryNormal
+	if g.Hard > 0 && used >= g.Hard {
+		level = MemoryHard
+	} else if g.Soft > 0 && used >= g.Soft {
+		level = MemorySoft
+	}
+	old := int(atomic.SwapInt32(&self.memoryGuardState.level, int32(level)))
+	if level != old {
+		if level > old {
+			log.Error("room memory level %v -> %v, usage %v", old, level, used)
+		} else {
+			log.Warning("room memory level %v -> %v, usage %v", old, level, used)
+		}
+		if g.OnAlert != nil {
+			g.OnAlert(level, used)
+		}
+	}
+	if level >= MemorySoft {
+		self.shedMemory(g)
+	}
+}
+
+/**
+通知空闲table裁剪事件日志并进入休眠
+*/
+func (self *Room) shedMemory(g *MemoryGuard) {
+	idleAfter := g.IdleAfter
+	if idleAfter <= 0 {
+		idleAfter = time.Minute
+	}
+	self.tables.Range(func(key, value interface{}) bool {
+		table := value.(BaseTable)
+		if !table.Runing() {
+			return true
+		}
+		if idle, ok := value.(interface {
+			LastPut() time.Time
+			Clock() Clock
+		}); ok && idle.Clock().Now().Sub(idle.LastPut()) < idleAfter {
+			return true
+		}
+		putTableQueue(table, PrioritySystem, ShedMemoryQueueFunc)
+		return true
+	})
+}
+
+/**
+裁剪事件日志,使用Scheduler时进入休眠直到收到新的消息
+*/
+func (this *QTable) onShedMemory() error {
+	if trimmer, ok := this.BaseTableImp.subtable.(interface {
+		TrimEvents()
+	}); ok {
+		trimmer.TrimEvents()
+	}
+	this.hibernateSince = this.Clock().Now()
+	return nil
+}
+
+/**
+被MemoryGuard要求休眠之后是否还没有收到新的消息
+*/
+func (this *QTable) forcedHibernate() bool {
+	return !this.hibernateSince.IsZero() && this.LastPut().Before(this.hibernateSince)
+}
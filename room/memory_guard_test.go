@@ -0,0 +1,52 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/module"
+	"testing"
+	"time"
+)
+
+func TestMemoryGuard(t *testing.T) {
+	var used uint64 = 10
+	levels := []int{}
+	room := NewRoom(nil, SetMemoryGuard(&MemoryGuard{
+		Soft:     100,
+		Hard:     200,
+		Interval: time.Hour,
+		Usage:    func() uint64 { return used },
+		OnAlert:  func(level int, usage uint64) { levels = append(levels, level) },
+	}))
+	defer room.StopMemoryGuard()
+	room.CheckMemoryGuard()
+	assertEqual(t, room.MemoryLevel(), MemoryNormal)
+
+	used = 150
+	room.CheckMemoryGuard()
+	assertEqual(t, room.MemoryLevel(), MemorySoft)
+
+	used = 250
+	room.CheckMemoryGuard()
+	_, err := room.CreateById(nil, "t1", func(module module.RPCModule, tableId string) (BaseTable, error) {
+		t.Fatal("table created over hard limit")
+		return nil, nil
+	})
+	assertEqual(t, ErrorCode(err), ErrCodeOverloaded)
+
+	used = 10
+	room.CheckMemoryGuard()
+	assertEqual(t, len(levels), 3)
+	assertEqual(t, levels[2], MemoryNormal)
+}
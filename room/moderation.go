@@ -0,0 +1,203 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"github.com/liangdas/mqant/gate"
+	"sync"
+	"time"
+)
+
+//管理事件类型
+const (
+	ModerationMute   = "mute"
+	ModerationUnmute = "unmute"
+	ModerationReport = "report"
+)
+
+//每个玩家保留的举报记录数量
+const maxReportsPerPlayer = 100
+
+/**
+发送给外部审核队列的管理事件
+*/
+type ModerationEvent struct {
+	Type     string
+	UserId   string
+	Reporter string //举报人,仅举报事件
+	TableId  string
+	Reason   string
+	Until    int64 //禁言截止时间,unix秒,仅禁言事件
+	Time     int64 //单位毫秒
+}
+
+type ModerationSink func(event *ModerationEvent)
+
+/**
+通过Webhook推送管理事件
+*/
+func WebhookModerationSink(publisher *WebhookPublisher) ModerationSink {
+	return func(event *ModerationEvent) {
+		publisher.Publish(WebhookModeration, event.TableId, event)
+	}
+}
+
+/**
+禁言和举报,多个table共享,协成安全
+*/
+type Moderator struct {
+	lock    sync.RWMutex
+	mutes   map[string]time.Time
+	reports map[string][]*ModerationEvent
+	sink    ModerationSink
+	clock   Clock
+}
+
+/**
+sink为空时只在内存中记录
+*/
+func NewModerator(sink ModerationSink) *Moderator {
+	return &Moderator{
+		mutes:   map[string]time.Time{},
+		reports: map[string][]*ModerationEvent{},
+		sink:    sink,
+		clock:   RealClock,
+	}
+}
+
+/**
+禁言到期和事件时间使用的时钟,默认RealClock,只能在使用前设置
+*/
+func (self *Moderator) SetClock(clock Clock) {
+	self.clock = clock
+}
+
+func (self *Moderator) emit(event *ModerationEvent) {
+	event.Time = self.clock.Now().UnixNano() / int64(time.Millisecond)
+	if self.sink != nil {
+		self.sink(event)
+	}
+}
+
+/**
+禁言玩家duration,期间该玩家的聊天消息不会被投递
+*/
+func (self *Moderator) Mute(userId string, duration time.Duration, reason string) {
+	until := self.clock.Now().Add(duration)
+	self.lock.Lock()
+	self.mutes[userId] = until
+	self.lock.Unlock()
+	self.emit(&ModerationEvent{
+		Type:   ModerationMute,
+		UserId: userId,
+		Reason: reason,
+		Until:  until.Unix(),
+	})
+}
+
+func (self *Moderator) Unmute(userId string) {
+	self.lock.Lock()
+	_, ok := self.mutes[userId]
+	delete(self.mutes, userId)
+	self.lock.Unlock()
+	if ok {
+		self.emit(&ModerationEvent{
+			Type:   ModerationUnmute,
+			UserId: userId,
+		})
+	}
+}
+
+/**
+禁言截止时间,未禁言时ok为false
+*/
+func (self *Moderator) MutedUntil(userId string) (until time.Time, ok bool) {
+	self.lock.RLock()
+	until, ok = self.mutes[userId]
+	self.lock.RUnlock()
+	if ok && self.clock.Now().After(until) {
+		self.lock.Lock()
+		if until, ok = self.mutes[userId]; ok && self.clock.Now().After(until) {
+			delete(self.mutes, userId)
+			ok = false
+		}
+		self.lock.Unlock()
+	}
+	return until, ok
+}
+
+func (self *Moderator) IsMuted(userId string) bool {
+	_, ok := self.MutedUntil(userId)
+	return ok
+}
+
+/**
+玩家举报,记录后推送给外部审核队列
+*/
+func (self *Moderator) Report(reporter string, target string, tableId string, reason string) (*ModerationEvent, error) {
+	if reporter == "" || target == "" {
+		return nil, fmt.Errorf("reporter and target required")
+	}
+	if reporter == target {
+		return nil, NewError(ErrCodeStateInvalid)
+	}
+	event := &ModerationEvent{
+		Type:     ModerationReport,
+		UserId:   target,
+		Reporter: reporter,
+		TableId:  tableId,
+		Reason:   reason,
+	}
+	self.emit(event)
+	self.lock.Lock()
+	reports := append(self.reports[target], event)
+	if len(reports) > maxReportsPerPlayer {
+		reports = reports[len(reports)-maxReportsPerPlayer:]
+	}
+	self.reports[target] = reports
+	self.lock.Unlock()
+	return event, nil
+}
+
+/**
+玩家最近被举报的记录
+*/
+func (self *Moderator) Reports(target string) []*ModerationEvent {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return append([]*ModerationEvent{}, self.reports[target]...)
+}
+
+/**
+队列检查,丢弃被禁言玩家和观战者的聊天消息
+*/
+func (self *Moderator) MuteGuard(msg *QueueMsg) error {
+	if msg.Priority != PriorityChat || len(msg.Params) == 0 {
+		return nil
+	}
+	var userId string
+	if msg.Func == SpectatorChatQueueFunc {
+		userId, _ = msg.Params[0].(string)
+	} else if session, ok := msg.Params[0].(gate.Session); ok && session != nil && !session.IsGuest() {
+		userId = session.GetUserId()
+	}
+	if userId == "" {
+		return nil
+	}
+	if until, ok := self.MutedUntil(userId); ok {
+		return NewError(ErrCodeMuted, until.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
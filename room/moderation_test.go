@@ -0,0 +1,67 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMuteExpiry(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(100, 0))
+	events := []*ModerationEvent{}
+	moderator := NewModerator(func(event *ModerationEvent) { events = append(events, event) })
+	moderator.SetClock(clock)
+	moderator.Mute("u1", 10*time.Second, "spam")
+	assertEqual(t, len(events), 1)
+	assertEqual(t, events[0].Until, int64(110))
+	assertEqual(t, events[0].Time, int64(100000))
+
+	chat := &QueueMsg{Func: "Chat", Priority: PriorityChat, Params: []interface{}{NewNullSession("u1")}}
+	spectator := &QueueMsg{Func: SpectatorChatQueueFunc, Priority: PriorityChat, Params: []interface{}{"u1"}}
+	assertEqual(t, ErrorCode(moderator.MuteGuard(chat)), ErrCodeMuted)
+	assertEqual(t, ErrorCode(moderator.MuteGuard(spectator)), ErrCodeMuted)
+	//只拦截聊天消息
+	assertEqual(t, moderator.MuteGuard(&QueueMsg{Func: "Bet", Priority: PriorityAction, Params: []interface{}{NewNullSession("u1")}}), nil)
+
+	clock.Advance(10 * time.Second)
+	assertEqual(t, moderator.IsMuted("u1"), true)
+	clock.Advance(time.Millisecond)
+	assertEqual(t, moderator.IsMuted("u1"), false)
+	assertEqual(t, moderator.MuteGuard(chat), nil)
+	//到期后清除记录,不会再发送解除禁言事件
+	moderator.Unmute("u1")
+	assertEqual(t, len(events), 1)
+
+	moderator.Mute("u2", time.Minute, "abuse")
+	moderator.Unmute("u2")
+	assertEqual(t, len(events), 3)
+	assertEqual(t, events[2].Type, ModerationUnmute)
+	assertEqual(t, moderator.IsMuted("u2"), false)
+}
+
+func TestReport(t *testing.T) {
+	moderator := NewModerator(nil)
+	_, err := moderator.Report("u1", "u1", "t1", "cheat")
+	assertEqual(t, ErrorCode(err), ErrCodeStateInvalid)
+	_, err = moderator.Report("", "u2", "t1", "cheat")
+	assertEqual(t, err != nil, true)
+	for i := 0; i < maxReportsPerPlayer+5; i++ {
+		moderator.Report("u1", "u2", "t1", "cheat")
+	}
+	reports := moderator.Reports("u2")
+	assertEqual(t, len(reports), maxReportsPerPlayer)
+	assertEqual(t, reports[0].Reporter, "u1")
+	assertEqual(t, reports[0].TableId, "t1")
+}
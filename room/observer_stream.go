@@ -0,0 +1,366 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/liangdas/mqant/log"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//观战者聊天在table队列中的函数名
+const SpectatorChatQueueFunc = "Room.SpectatorChat"
+
+//观战聊天单条消息的最大字节数
+const maxSpectatorChat = 256
+
+/**
+可以被外部观战的table
+*/
+type Observable interface {
+	Subscribe(buffer int) (<-chan []byte, func())
+}
+
+/**
+观战者独立的聊天频道,观战者的聊天不会发送给座位上的玩家
+*/
+type SpectatorChat interface {
+	SubscribeChat(buffer int) (<-chan []byte, func())
+	PutQueueWithPriority(priority int, _func string, params ...interface{}) error
+}
+
+/**
+观战者身份,由SpectatorAuth根据请求中的登录凭证得到
+*/
+type SpectatorIdentity struct {
+	UserId string
+	Name   string //聊天中显示的名字
+}
+
+/**
+验证观战聊天请求,返回错误时拒绝发送
+*/
+type SpectatorAuth func(r *http.Request) (*SpectatorIdentity, error)
+
+/**
+观战聊天消息
+*/
+type SpectatorMessage struct {
+	Name string
+	Text string
+	Time int64 //单位毫秒
+}
+
+type delayedState struct {
+	at   time.Time
+	data []byte
+}
+
+/**
+向外部观战页面推送table的公开状态,观战者不占用座位也不进入table队列
+订阅方消费过慢时丢弃中间状态,只保证能收到最新状态
+设置了延迟时状态在delay之后才推送给观战者,防止观战者给玩家通风报信
+*/
+type ObserverTable struct {
+	observerLock  sync.Mutex
+	observers     map[chan []byte]bool
+	chatObservers map[chan []byte]bool
+	lastState     []byte
+	observerClock func() Clock
+	observerDelay time.Duration
+	delayed       []delayedState
+}
+
+/**
+delay 观战画面的延迟,0表示实时
+*/
+func (this *ObserverTable) ObserverTableInit(clock func() Clock, delay time.Duration) {
+	this.observers = map[chan []byte]bool{}
+	this.chatObservers = map[chan []byte]bool{}
+	this.observerClock = clock
+	this.observerDelay = delay
+	this.delayed = nil
+}
+
+/**
+发布公开状态(不能包含手牌等私有信息),在table协成中调用
+*/
+func (this *ObserverTable) PublishState(state interface{}) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	this.observerLock.Lock()
+	defer this.observerLock.Unlock()
+	if this.observerDelay > 0 {
+		this.delayed = append(this.delayed, delayedState{at: this.observerClock().Now(), data: data})
+		return nil
+	}
+	this.deliverState(data)
+	return nil
+}
+
+/**
+调用方需持有observerLock
+订阅方缓冲区满时丢弃最旧的一个状态再放入,发送只在持有锁时进行,所以丢弃后一定能放入
+*/
+func (this *ObserverTable) deliverState(data []byte) {
+	this.lastState = data
+	for ch := range this.observers {
+		select {
+		case ch <- data:
+			continue
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+}
+
+/**
+【每帧调用】推送已经超过延迟时间的状态
+*/
+func (this *ObserverTable) CheckObservers() {
+	this.observerLock.Lock()
+	defer this.observerLock.Unlock()
+	if len(this.delayed) == 0 {
+		return
+	}
+	deadline := this.observerClock().Now().Add(-this.observerDelay)
+	n := 0
+	for n < len(this.delayed) && !this.delayed[n].at.After(deadline) {
+		this.deliverState(this.delayed[n].data)
+		n++
+	}
+	this.delayed = this.delayed[n:]
+}
+
+/**
+订阅观战聊天
+*/
+func (this *ObserverTable) SubscribeChat(buffer int) (<-chan []byte, func()) {
+	if buffer < 1 {
+		buffer = 1
+	}
+	ch := make(chan []byte, buffer)
+	this.observerLock.Lock()
+	if this.chatObservers == nil {
+		this.chatObservers = map[chan []byte]bool{}
+	}
+	this.chatObservers[ch] = true
+	this.observerLock.Unlock()
+	return ch, func() {
+		this.observerLock.Lock()
+		defer this.observerLock.Unlock()
+		if this.chatObservers[ch] {
+			delete(this.chatObservers, ch)
+			close(ch)
+		}
+	}
+}
+
+/**
+把聊天发送给所有观战者,不会发送给座位上的玩家
+*/
+func (this *ObserverTable) PublishSpectatorChat(name string, text string) error {
+	data, err := json.Marshal(&SpectatorMessage{
+		Name: name,
+		Text: text,
+		Time: this.observerClock().Now().UnixNano() / int64(time.Millisecond),
+	})
+	if err != nil {
+		return err
+	}
+	this.observerLock.Lock()
+	defer this.observerLock.Unlock()
+	for ch := range this.chatObservers {
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+	return nil
+}
+
+/**
+userId只用于禁言检查,不发送给观战者
+*/
+func (this *QTable) onSpectatorChat(userId string, name string, text string) error {
+	return this.PublishSpectatorChat(name, text)
+}
+
+/**
+订阅状态更新,订阅时会先收到最近一次的状态
+返回的函数用于取消订阅,取消后channel会被关闭
+*/
+func (this *ObserverTable) Subscribe(buffer int) (<-chan []byte, func()) {
+	if buffer < 1 {
+		buffer = 1
+	}
+	ch := make(chan []byte, buffer)
+	this.observerLock.Lock()
+	if this.observers == nil {
+		this.observers = map[chan []byte]bool{}
+	}
+	this.observers[ch] = true
+	if this.lastState != nil {
+		ch <- this.lastState
+	}
+	this.observerLock.Unlock()
+	return ch, func() {
+		this.observerLock.Lock()
+		defer this.observerLock.Unlock()
+		if this.observers[ch] {
+			delete(this.observers, ch)
+			close(ch)
+		}
+	}
+}
+
+/**
+当前观战人数
+*/
+func (this *ObserverTable) ObserverCount() int {
+	this.observerLock.Lock()
+	defer this.observerLock.Unlock()
+	return len(this.observers)
+}
+
+/**
+关闭所有观战连接,table销毁时调用
+*/
+func (this *ObserverTable) CloseObservers() {
+	this.observerLock.Lock()
+	defer this.observerLock.Unlock()
+	for ch := range this.observers {
+		close(ch)
+	}
+	this.observers = map[chan []byte]bool{}
+	for ch := range this.chatObservers {
+		close(ch)
+	}
+	this.chatObservers = map[chan []byte]bool{}
+	this.delayed = nil
+}
+
+/**
+以Server-Sent Events推送table状态,观战聊天以chat事件推送
+GET {prefix}{tableId}
+POST {prefix}{tableId}	发送观战聊天,body为聊天内容,需要设置SpectatorAuth
+*/
+func (self *Room) ObserverHandler(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tableId := strings.TrimPrefix(r.URL.Path, prefix)
+		value, ok := self.tables.Load(tableId)
+		if !ok {
+			http.Error(w, NewError(ErrCodeTableNotFound).Error(), http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodPost {
+			self.postSpectatorChat(w, r, value)
+			return
+		}
+		observable, ok := value.(Observable)
+		if !ok {
+			http.Error(w, "table not observable", http.StatusNotFound)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		updates, cancel := observable.Subscribe(16)
+		defer cancel()
+		var chats <-chan []byte
+		if chat, ok := value.(SpectatorChat); ok {
+			var cancelChat func()
+			chats, cancelChat = chat.SubscribeChat(16)
+			defer cancelChat()
+		}
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case data, ok := <-chats:
+				if !ok {
+					chats = nil
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: chat\ndata: %s\n\n", data); err != nil {
+					return
+				}
+				flusher.Flush()
+			case data, ok := <-updates:
+				if !ok {
+					fmt.Fprint(w, "event: finished\ndata: {}\n\n")
+					flusher.Flush()
+					return
+				}
+				if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+					log.Warning("observer stream of table %v closed: %v", tableId, err)
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+func (self *Room) postSpectatorChat(w http.ResponseWriter, r *http.Request, table interface{}) {
+	chat, ok := table.(SpectatorChat)
+	if !ok || self.opts.SpectatorAuth == nil {
+		http.Error(w, "table has no spectator chat", http.StatusNotFound)
+		return
+	}
+	identity, err := self.opts.SpectatorAuth(r)
+	if err != nil || identity == nil || identity.UserId == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !self.spectatorLimiter.Allow(identity.UserId) {
+		http.Error(w, "too many messages", http.StatusTooManyRequests)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSpectatorChat))
+	if err != nil {
+		http.Error(w, "message too long", http.StatusRequestEntityTooLarge)
+		return
+	}
+	text := strings.TrimSpace(string(body))
+	if text == "" {
+		http.Error(w, "empty message", http.StatusBadRequest)
+		return
+	}
+	if err := chat.PutQueueWithPriority(PriorityChat, SpectatorChatQueueFunc, identity.UserId, identity.Name, text); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,112 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObserverDelay(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(0, 0))
+	table := &ObserverTable{}
+	table.ObserverTableInit(func() Clock { return clock }, 30*time.Second)
+	states, cancel := table.Subscribe(4)
+	defer cancel()
+	chats, cancelChat := table.SubscribeChat(4)
+	defer cancelChat()
+
+	table.PublishState(1)
+	clock.Advance(10 * time.Second)
+	table.PublishState(2)
+	table.CheckObservers()
+	assertEqual(t, len(states), 0)
+
+	clock.Advance(20 * time.Second)
+	table.CheckObservers()
+	assertEqual(t, string(<-states), "1")
+	assertEqual(t, len(states), 0)
+	clock.Advance(10 * time.Second)
+	table.CheckObservers()
+	assertEqual(t, string(<-states), "2")
+
+	//聊天不延迟
+	table.PublishSpectatorChat("guest", "hi")
+	assertEqual(t, len(chats), 1)
+}
+
+func TestObserverSlowConsumer(t *testing.T) {
+	table := &ObserverTable{}
+	table.ObserverTableInit(func() Clock { return NewSimulatedClock(time.Unix(0, 0)) }, 0)
+	states, cancel := table.Subscribe(2)
+	defer cancel()
+
+	for i := 1; i <= 5; i++ {
+		table.PublishState(i)
+	}
+	//丢弃中间状态,保留最新状态
+	assertEqual(t, len(states), 2)
+	assertEqual(t, string(<-states), "4")
+	assertEqual(t, string(<-states), "5")
+
+	table.PublishState(6)
+	assertEqual(t, string(<-states), "6")
+}
+
+func TestSpectatorChatAuth(t *testing.T) {
+	room := NewRoom(nil, SpectatorChatRate(1, time.Hour), SetSpectatorAuth(func(r *http.Request) (*SpectatorIdentity, error) {
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			return nil, fmt.Errorf("no token")
+		}
+		return &SpectatorIdentity{UserId: token, Name: "viewer-" + token}, nil
+	}))
+	_, err := room.CreateById(nil, "watch", newBenchTable)
+	assertEqual(t, err, nil)
+	handler := room.ObserverHandler("/watch/")
+	post := func(token string, name string) int {
+		r := httptest.NewRequest(http.MethodPost, "/watch/watch?name="+name, strings.NewReader("hello"))
+		if token != "" {
+			r.Header.Set("Authorization", token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	assertEqual(t, post("", "admin"), http.StatusUnauthorized)
+	assertEqual(t, post("u1", "admin"), http.StatusNoContent)
+	assertEqual(t, post("u1", "admin"), http.StatusTooManyRequests)
+	assertEqual(t, post("u2", ""), http.StatusNoContent)
+
+	//没有设置SpectatorAuth时不允许发送
+	other := NewRoom(nil)
+	other.CreateById(nil, "watch", newBenchTable)
+	r := httptest.NewRequest(http.MethodPost, "/watch/watch", strings.NewReader("hello"))
+	w := httptest.NewRecorder()
+	other.ObserverHandler("/watch/").ServeHTTP(w, r)
+	assertEqual(t, w.Code, http.StatusNotFound)
+}
+
+func TestSpectatorMute(t *testing.T) {
+	moderator := NewModerator(nil)
+	moderator.Mute("u1", time.Minute, "spam")
+	msg := &QueueMsg{Func: SpectatorChatQueueFunc, Priority: PriorityChat, Params: []interface{}{"u1", "viewer", "hi"}}
+	assertEqual(t, ErrorCode(moderator.MuteGuard(msg)), ErrCodeMuted)
+	msg.Params[0] = "u2"
+	assertEqual(t, moderator.MuteGuard(msg), nil)
+}
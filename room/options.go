@@ -19,6 +19,16 @@ type RecoverHandle func(msg *QueueMsg, err error)
 */
 type LifeCallback func(table BaseTable) error
 
+/**
+table结束时输出每个玩家的统计数据,可以写入结算记录
+*/
+type StatsFlushHandle func(table BaseTable, stats map[string]*PlayerStats)
+
+/**
+玩家相关的回调,在table协成中执行
+*/
+type PlayerCallback func(table BaseTable, player BasePlayer)
+
 /*
 获取可以路由到该房间的地址路径
 */
@@ -30,6 +40,7 @@ func newOptions(opts ...Option) Options {
 		Capaciity:        256,
 		SendMsgCapaciity: 256,
 		RunInterval:      100 * time.Millisecond,
+		Clock:            RealClock,
 	}
 
 	for _, o := range opts {
@@ -49,10 +60,40 @@ type Options struct {
 	TableId          string
 	Router           Route
 	Trace            log.TraceSpan
-	TimeOut          int64         //判断客户端超时时间单位秒
-	Capaciity        uint32        //消息队列容量,真实容量为 Capaciity*2
-	SendMsgCapaciity uint32        //每帧发送消息容量
-	RunInterval      time.Duration //运行间隔
+	TimeOut          int64             //判断客户端超时时间单位秒
+	Capaciity        uint32            //消息队列容量,真实容量为 Capaciity*2
+	SendMsgCapaciity uint32            //每帧发送消息容量
+	RunInterval      time.Duration     //运行间隔
+	ProfileLabels    []string          //pprof标签(key,value成对),设置后table每帧都会打上这些标签以及table_id
+	Webhook          *WebhookPublisher //table结束时推送TableFinished
+	Clock            Clock             //table使用的时钟,默认RealClock
+	StatsFlush       StatsFlushHandle
+	RejoinCallback   PlayerCallback //玩家重连并绑定新session后调用,可以用来下发完整状态
+	QueueObserver    QueueObserver  //每条队列消息执行或丢弃后调用,在table协成中执行(队列已满时在调用方协成中执行)
+	ResultSigner     *ResultSigner  //结算结果签名器,为空时使用Webhook的签名器
+	Flags            FlagProvider   //功能开关,为空时所有开关都关闭
+	FlagLabels       map[string]string
+	FlagsChanged     FlagCallback      //开关变化后在table协成中调用
+	Wallet           Wallet            //押注类游戏的玩家余额
+	EscrowJournal    EscrowJournal     //资金托管日志,崩溃后通过RecoverEscrow补偿
+	FlowControl      *FlowControl      //按玩家的发送流控,为空时在table协成中直接发送
+	Scheduler        *Scheduler        //帧调度器,为空时使用timewheel
+	HibernateAfter   time.Duration     //使用Scheduler时,超过该时间没有收到消息则进入休眠,0表示不休眠
+	IdleInterval     time.Duration     //休眠时的运行间隔,收到消息时立即唤醒;休眠期间超时和阶段检查的精度也会降低
+	ACL              *TableACL         //初始准入规则,大厅可以通过Room.SetTableACL修改
+	DedupWindow      time.Duration     //同一玩家在该时间内连续发送的相同消息只执行一次,0表示不去重
+	Moderator        *Moderator        //设置后被禁言玩家的聊天(PriorityChat)消息会被丢弃
+	HandlerTimeout   time.Duration     //HandlerContext的超时时间,0表示只在table销毁时取消
+	MemoryBudget     *MemoryBudget     //table内存预算,为空时不统计
+	Tick             *TickOptions      //固定频率的模拟循环,为空时只按RunInterval运行
+	InterestFunc     InterestFunc      //NotifyArea使用的空间函数
+	Chaos            *Chaos            //故障注入,只能在测试环境中设置
+	Quota            Quota             //属性和玩家Body的大小限制,零值表示不限制
+	WaitQueue        *WaitQueueOptions //满员时的等待队列,为空时使用默认权重
+	ObserverDelay    time.Duration     //观战画面的延迟,竞技类table防止观战者通风报信
+	Desync           *DesyncOptions    //状态哈希检查,为空时不检查
+	Backfill         *BackfillOptions  //中途加入,为空时不允许
+	ServerCaps       Capabilities      //服务器支持的能力,玩家能力按此协商,零值表示不限制
 }
 
 func Update(fn UpdateHandle) Option {
@@ -126,3 +167,188 @@ func RunInterval(v time.Duration) Option {
 		o.RunInterval = v
 	}
 }
+
+/**
+设置table的pprof标签,例如 ProfileLabels("game","texas")
+开启后可以在CPU profile中按table_id或游戏类型过滤
+*/
+func ProfileLabels(kv ...string) Option {
+	return func(o *Options) {
+		o.ProfileLabels = kv
+	}
+}
+
+func Webhook(v *WebhookPublisher) Option {
+	return func(o *Options) {
+		o.Webhook = v
+	}
+}
+
+/**
+替换table的时钟,用于加速测试和确定性回放
+*/
+func SetClock(v Clock) Option {
+	return func(o *Options) {
+		o.Clock = v
+	}
+}
+
+/**
+服务器支持的能力,BaseTableImp.PlayerCapabilities按此与玩家协商
+*/
+func ServerCaps(v Capabilities) Option {
+	return func(o *Options) {
+		o.ServerCaps = v
+	}
+}
+
+func StatsFlush(fn StatsFlushHandle) Option {
+	return func(o *Options) {
+		o.StatsFlush = fn
+	}
+}
+
+func RejoinCallback(fn PlayerCallback) Option {
+	return func(o *Options) {
+		o.RejoinCallback = fn
+	}
+}
+
+/**
+监听队列消息的计时事件,多个监听者可以自行组合
+*/
+func SetQueueObserver(fn QueueObserver) Option {
+	return func(o *Options) {
+		o.QueueObserver = fn
+	}
+}
+
+func SetResultSigner(v *ResultSigner) Option {
+	return func(o *Options) {
+		o.ResultSigner = v
+	}
+}
+
+/**
+labels用于匹配FlagRule.Labels,例如游戏类型,地区
+*/
+func Flags(v FlagProvider, labels map[string]string) Option {
+	return func(o *Options) {
+		o.Flags = v
+		o.FlagLabels = labels
+	}
+}
+
+/**
+开关变化后在table协成中调用,需要同时设置Flags
+*/
+func OnFlagsChanged(fn FlagCallback) Option {
+	return func(o *Options) {
+		o.FlagsChanged = fn
+	}
+}
+
+/**
+启用资金托管,journal为空时崩溃后无法补偿
+*/
+func Escrow(wallet Wallet, journal EscrowJournal) Option {
+	return func(o *Options) {
+		o.Wallet = wallet
+		o.EscrowJournal = journal
+	}
+}
+
+func SetFlowControl(v *FlowControl) Option {
+	return func(o *Options) {
+		o.FlowControl = v
+	}
+}
+
+/**
+多个table共享同一个Scheduler,长时间没有消息的table降低运行频率
+*/
+func SetScheduler(v *Scheduler, hibernateAfter time.Duration, idleInterval time.Duration) Option {
+	return func(o *Options) {
+		o.Scheduler = v
+		o.HibernateAfter = hibernateAfter
+		o.IdleInterval = idleInterval
+	}
+}
+
+func ACL(v *TableACL) Option {
+	return func(o *Options) {
+		o.ACL = v
+	}
+}
+
+func DedupWindow(v time.Duration) Option {
+	return func(o *Options) {
+		o.DedupWindow = v
+	}
+}
+
+func SetModerator(v *Moderator) Option {
+	return func(o *Options) {
+		o.Moderator = v
+	}
+}
+
+func HandlerTimeout(v time.Duration) Option {
+	return func(o *Options) {
+		o.HandlerTimeout = v
+	}
+}
+
+func SetMemoryBudget(v *MemoryBudget) Option {
+	return func(o *Options) {
+		o.MemoryBudget = v
+	}
+}
+
+func SetQuota(v Quota) Option {
+	return func(o *Options) {
+		o.Quota = v
+	}
+}
+
+func SetWaitQueue(v *WaitQueueOptions) Option {
+	return func(o *Options) {
+		o.WaitQueue = v
+	}
+}
+
+func ObserverDelay(v time.Duration) Option {
+	return func(o *Options) {
+		o.ObserverDelay = v
+	}
+}
+
+func Desync(v *DesyncOptions) Option {
+	return func(o *Options) {
+		o.Desync = v
+	}
+}
+
+func Backfill(v *BackfillOptions) Option {
+	return func(o *Options) {
+		o.Backfill = v
+	}
+}
+
+func Tick(v *TickOptions) Option {
+	return func(o *Options) {
+		o.Tick = v
+	}
+}
+
+func SetInterestFunc(v InterestFunc) Option {
+	return func(o *Options) {
+		o.InterestFunc = v
+	}
+}
+
+func SetChaos(v *Chaos) Option {
+	return func(o *Options) {
+		o.Chaos = v
+	}
+}
@@ -0,0 +1,511 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/**
+跨table的组队
+
+玩家组成队伍,队长把整个队伍放入匹配,匹配成功后整队一起入座
+队伍聊天保存在队伍中,不随table销毁
+*/
+package party
+
+import (
+	"encoding/json"
+	"github.com/liangdas/mqant-modules/room"
+	"github.com/liangdas/mqant/gate"
+	"github.com/liangdas/mqant/log"
+	"sync"
+	"time"
+)
+
+//发送给队伍成员的消息topic
+const (
+	TopicChat   = "Party/Chat"
+	TopicUpdate = "Party/Update"
+)
+
+/**
+提交给匹配服务的整队请求
+*/
+type Ticket struct {
+	PartyId string
+	Mode    string
+	Members []string
+	Time    int64 //单位毫秒
+}
+
+/**
+由匹配服务实现
+*/
+type Matchmaker interface {
+	Enqueue(ticket *Ticket) error
+	Cancel(partyId string) error
+}
+
+type ChatMessage struct {
+	UserId string
+	Text   string
+	Time   int64 //单位毫秒
+}
+
+/**
+队伍信息的副本,推送给成员时使用
+*/
+type Info struct {
+	PartyId string
+	Leader  string
+	Members []string
+	Queued  string //正在匹配的模式,为空表示没有在匹配
+}
+
+type party struct {
+	id       string
+	leader   string
+	members  []string
+	sessions map[string]gate.Session
+	chat     []*ChatMessage
+	queued   string
+	ticket   *Ticket //正在提交或已经提交给匹配服务的请求
+}
+
+func (p *party) info() *Info {
+	return &Info{
+		PartyId: p.id,
+		Leader:  p.leader,
+		Members: append([]string{}, p.members...),
+		Queued:  p.queued,
+	}
+}
+
+type Options struct {
+	MaxSize     int        //队伍人数上限,默认4
+	ChatHistory int        //保留的聊天记录条数,默认50
+	Matchmaker  Matchmaker //为空时不能Queue
+}
+
+/**
+队伍管理,协成安全
+*/
+type Manager struct {
+	opts    Options
+	lock    sync.Mutex
+	parties map[string]*party
+	byUser  map[string]string //userId->partyId
+}
+
+func NewManager(opts Options) *Manager {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 4
+	}
+	if opts.ChatHistory <= 0 {
+		opts.ChatHistory = 50
+	}
+	return &Manager{
+		opts:    opts,
+		parties: map[string]*party{},
+		byUser:  map[string]string{},
+	}
+}
+
+func now() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+/**
+需要推送的成员session,必须在持有锁时调用,发送在锁外完成
+*/
+func (self *Manager) sessionsOf(p *party, except string) []gate.Session {
+	sessions := []gate.Session{}
+	for userId, session := range p.sessions {
+		if userId != except && session != nil {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+func send(sessions []gate.Session, topic string, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Warning("marshal %v error %v", topic, err)
+		return
+	}
+	for _, session := range sessions {
+		session.SendNR(topic, body)
+	}
+}
+
+/**
+创建队伍,创建者为队长,游客不能组队
+*/
+func (self *Manager) Create(leader gate.Session) (*Info, error) {
+	if leader.IsGuest() {
+		return nil, room.NewError(room.ErrCodePermissionDenied)
+	}
+	userId := leader.GetUserId()
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if _, ok := self.byUser[userId]; ok {
+		return nil, room.NewError(room.ErrCodeAlreadyInParty)
+	}
+	p := &party{
+		id:       room.GetRandomString(16),
+		leader:   userId,
+		members:  []string{userId},
+		sessions: map[string]gate.Session{userId: leader},
+	}
+	self.parties[p.id] = p
+	self.byUser[userId] = p.id
+	return p.info(), nil
+}
+
+/**
+加入队伍,匹配中的队伍加入新成员会取消匹配,游客不能组队
+*/
+func (self *Manager) Join(partyId string, session gate.Session) (*Info, error) {
+	if session.IsGuest() {
+		return nil, room.NewError(room.ErrCodePermissionDenied)
+	}
+	userId := session.GetUserId()
+	self.lock.Lock()
+	if _, ok := self.byUser[userId]; ok {
+		self.lock.Unlock()
+		return nil, room.NewError(room.ErrCodeAlreadyInParty)
+	}
+	p, ok := self.parties[partyId]
+	if !ok {
+		self.lock.Unlock()
+		return nil, room.NewError(room.ErrCodePartyNotFound)
+	}
+	if len(p.members) >= self.opts.MaxSize {
+		self.lock.Unlock()
+		return nil, room.NewError(room.ErrCodePartyFull)
+	}
+	p.members = append(p.members, userId)
+	p.sessions[userId] = session
+	self.byUser[userId] = partyId
+	canceled := self.cancelLocked(p)
+	info := p.info()
+	sessions := self.sessionsOf(p, "")
+	self.lock.Unlock()
+	self.cancel(canceled)
+	send(sessions, TopicUpdate, info)
+	return info, nil
+}
+
+/**
+离开队伍,队长离开时由下一个成员接任,最后一个成员离开时解散
+*/
+func (self *Manager) Leave(userId string) error {
+	self.lock.Lock()
+	p, ok := self.partyOf(userId)
+	if !ok {
+		self.lock.Unlock()
+		return room.NewError(room.ErrCodePartyNotFound)
+	}
+	canceled := self.removeLocked(p, userId)
+	info := p.info()
+	sessions := self.sessionsOf(p, "")
+	self.lock.Unlock()
+	self.cancel(canceled)
+	send(sessions, TopicUpdate, info)
+	return nil
+}
+
+/**
+队长把成员移出队伍
+*/
+func (self *Manager) Kick(leaderId string, target string) error {
+	self.lock.Lock()
+	p, ok := self.partyOf(leaderId)
+	if !ok {
+		self.lock.Unlock()
+		return room.NewError(room.ErrCodePartyNotFound)
+	}
+	if p.leader != leaderId {
+		self.lock.Unlock()
+		return room.NewError(room.ErrCodeNotPartyLeader)
+	}
+	if self.byUser[target] != p.id || target == leaderId {
+		self.lock.Unlock()
+		return room.NewError(room.ErrCodeStateInvalid)
+	}
+	kicked := p.sessions[target]
+	canceled := self.removeLocked(p, target)
+	info := p.info()
+	sessions := self.sessionsOf(p, "")
+	self.lock.Unlock()
+	self.cancel(canceled)
+	if kicked != nil {
+		sessions = append(sessions, kicked)
+	}
+	send(sessions, TopicUpdate, info)
+	return nil
+}
+
+/**
+转让队长
+*/
+func (self *Manager) Promote(leaderId string, target string) error {
+	self.lock.Lock()
+	p, ok := self.partyOf(leaderId)
+	if !ok {
+		self.lock.Unlock()
+		return room.NewError(room.ErrCodePartyNotFound)
+	}
+	if p.leader != leaderId {
+		self.lock.Unlock()
+		return room.NewError(room.ErrCodeNotPartyLeader)
+	}
+	if self.byUser[target] != p.id {
+		self.lock.Unlock()
+		return room.NewError(room.ErrCodeStateInvalid)
+	}
+	p.leader = target
+	info := p.info()
+	sessions := self.sessionsOf(p, "")
+	self.lock.Unlock()
+	send(sessions, TopicUpdate, info)
+	return nil
+}
+
+/**
+玩家重连后更新session,之后的队伍消息发送到新session
+*/
+func (self *Manager) Rebind(session gate.Session) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	p, ok := self.partyOf(session.GetUserId())
+	if ok {
+		p.sessions[session.GetUserId()] = session
+	}
+	return ok
+}
+
+func (self *Manager) Get(partyId string) (*Info, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	p, ok := self.parties[partyId]
+	if !ok {
+		return nil, false
+	}
+	return p.info(), true
+}
+
+func (self *Manager) PartyOf(userId string) (*Info, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	p, ok := self.partyOf(userId)
+	if !ok {
+		return nil, false
+	}
+	return p.info(), true
+}
+
+/**
+队伍聊天,保存在队伍中并发送给其他成员
+*/
+func (self *Manager) Chat(userId string, text string) (*ChatMessage, error) {
+	self.lock.Lock()
+	p, ok := self.partyOf(userId)
+	if !ok {
+		self.lock.Unlock()
+		return nil, room.NewError(room.ErrCodePartyNotFound)
+	}
+	msg := &ChatMessage{UserId: userId, Text: text, Time: now()}
+	p.chat = append(p.chat, msg)
+	if len(p.chat) > self.opts.ChatHistory {
+		p.chat = p.chat[len(p.chat)-self.opts.ChatHistory:]
+	}
+	sessions := self.sessionsOf(p, userId)
+	self.lock.Unlock()
+	send(sessions, TopicChat, msg)
+	return msg, nil
+}
+
+/**
+队伍的聊天记录,玩家进入新table或重连后拉取
+*/
+func (self *Manager) History(userId string) []*ChatMessage {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	p, ok := self.partyOf(userId)
+	if !ok {
+		return nil
+	}
+	return append([]*ChatMessage{}, p.chat...)
+}
+
+/**
+队长把整个队伍放入匹配
+Enqueue在锁外调用,期间队伍成员变化时取消这次匹配
+*/
+func (self *Manager) Queue(leaderId string, mode string) (*Ticket, error) {
+	if self.opts.Matchmaker == nil {
+		return nil, room.NewError(room.ErrCodeStateInvalid)
+	}
+	self.lock.Lock()
+	p, ok := self.partyOf(leaderId)
+	if !ok {
+		self.lock.Unlock()
+		return nil, room.NewError(room.ErrCodePartyNotFound)
+	}
+	if p.leader != leaderId {
+		self.lock.Unlock()
+		return nil, room.NewError(room.ErrCodeNotPartyLeader)
+	}
+	if p.queued != "" {
+		self.lock.Unlock()
+		return nil, room.NewError(room.ErrCodeStateInvalid)
+	}
+	ticket := &Ticket{
+		PartyId: p.id,
+		Mode:    mode,
+		Members: append([]string{}, p.members...),
+		Time:    now(),
+	}
+	//先标记为匹配中,避免重复提交
+	p.queued = mode
+	p.ticket = ticket
+	self.lock.Unlock()
+
+	err := self.opts.Matchmaker.Enqueue(ticket)
+	self.lock.Lock()
+	if p.ticket != ticket {
+		//提交期间成员变化或已经取消
+		requeued := p.ticket != nil
+		self.lock.Unlock()
+		if err == nil && !requeued {
+			self.cancel(p.id)
+		}
+		return nil, room.NewError(room.ErrCodeStateInvalid)
+	}
+	if err != nil {
+		p.queued = ""
+		p.ticket = nil
+		self.lock.Unlock()
+		return nil, err
+	}
+	info := p.info()
+	sessions := self.sessionsOf(p, "")
+	self.lock.Unlock()
+	send(sessions, TopicUpdate, info)
+	return ticket, nil
+}
+
+/**
+任意成员都可以取消匹配
+*/
+func (self *Manager) CancelQueue(userId string) error {
+	self.lock.Lock()
+	p, ok := self.partyOf(userId)
+	if !ok {
+		self.lock.Unlock()
+		return room.NewError(room.ErrCodePartyNotFound)
+	}
+	canceled := self.cancelLocked(p)
+	info := p.info()
+	sessions := self.sessionsOf(p, "")
+	self.lock.Unlock()
+	self.cancel(canceled)
+	send(sessions, TopicUpdate, info)
+	return nil
+}
+
+/**
+匹配成功后把整个队伍加入同一个table,任意成员加入失败时已加入的成员全部离开
+*/
+func (self *Manager) Seat(r *room.Room, partyId string, tableId string, params map[string]interface{}) error {
+	self.lock.Lock()
+	p, ok := self.parties[partyId]
+	if !ok {
+		self.lock.Unlock()
+		return room.NewError(room.ErrCodePartyNotFound)
+	}
+	p.queued = ""
+	p.ticket = nil
+	sessions := []gate.Session{}
+	for _, userId := range p.members {
+		sessions = append(sessions, p.sessions[userId])
+	}
+	self.lock.Unlock()
+
+	seated := []gate.Session{}
+	for _, session := range sessions {
+		if _, err := r.JoinTable(session, tableId, params); err != nil {
+			for _, s := range seated {
+				if _, e := r.LeaveTable(s, tableId, params); e != nil {
+					log.Warning("party %v leave table %v error %v", partyId, tableId, e)
+				}
+			}
+			return err
+		}
+		seated = append(seated, session)
+	}
+	return nil
+}
+
+func (self *Manager) partyOf(userId string) (*party, bool) {
+	partyId, ok := self.byUser[userId]
+	if !ok {
+		return nil, false
+	}
+	p, ok := self.parties[partyId]
+	return p, ok
+}
+
+/**
+队伍成员变化时取消匹配,匹配服务需要用新的成员重新匹配
+返回需要取消的partyId,解锁后交给cancel,没有在匹配时返回空
+*/
+func (self *Manager) cancelLocked(p *party) string {
+	if p.queued == "" {
+		return ""
+	}
+	p.queued = ""
+	p.ticket = nil
+	return p.id
+}
+
+/**
+通知匹配服务取消,和send一样在锁外调用
+*/
+func (self *Manager) cancel(partyId string) {
+	if partyId == "" {
+		return
+	}
+	if err := self.opts.Matchmaker.Cancel(partyId); err != nil {
+		log.Warning("cancel party %v matchmaking error %v", partyId, err)
+	}
+}
+
+func (self *Manager) removeLocked(p *party, userId string) string {
+	delete(self.byUser, userId)
+	delete(p.sessions, userId)
+	for i, member := range p.members {
+		if member == userId {
+			p.members = append(p.members[:i], p.members[i+1:]...)
+			break
+		}
+	}
+	canceled := self.cancelLocked(p)
+	if len(p.members) == 0 {
+		delete(self.parties, p.id)
+		return canceled
+	}
+	if p.leader == userId {
+		p.leader = p.members[0]
+	}
+	return canceled
+}
@@ -0,0 +1,181 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package party
+
+import (
+	"github.com/liangdas/mqant-modules/room"
+	"testing"
+)
+
+type fakeMatchmaker struct {
+	queued   map[string]*Ticket
+	canceled []string
+}
+
+func (m *fakeMatchmaker) Enqueue(ticket *Ticket) error {
+	m.queued[ticket.PartyId] = ticket
+	return nil
+}
+
+func (m *fakeMatchmaker) Cancel(partyId string) error {
+	delete(m.queued, partyId)
+	m.canceled = append(m.canceled, partyId)
+	return nil
+}
+
+func TestPartyLifecycle(t *testing.T) {
+	matcher := &fakeMatchmaker{queued: map[string]*Ticket{}}
+	m := NewManager(Options{MaxSize: 2, Matchmaker: matcher})
+	received := 0
+	leader := room.NewBotSession("u1", nil)
+	member := room.NewBotSession("u2", func(topic string, body []byte) {
+		if topic == TopicChat {
+			received++
+		}
+	})
+
+	info, err := m.Create(leader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Join(info.PartyId, member); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Join(info.PartyId, room.NewNullSession("u3")); room.ErrorCode(err) != room.ErrCodePartyFull {
+		t.Fatalf("expected party full, got %v", err)
+	}
+	if _, err := m.Queue("u2", "ranked"); room.ErrorCode(err) != room.ErrCodeNotPartyLeader {
+		t.Fatalf("expected not leader, got %v", err)
+	}
+	ticket, err := m.Queue("u1", "ranked")
+	if err != nil || len(ticket.Members) != 2 {
+		t.Fatalf("queue failed %v %v", ticket, err)
+	}
+
+	m.Chat("u1", "hi")
+	if received != 1 || len(m.History("u2")) != 1 {
+		t.Fatalf("chat not delivered")
+	}
+
+	if err := m.Leave("u1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(matcher.queued) != 0 || len(matcher.canceled) != 1 {
+		t.Fatalf("leaving should cancel matchmaking")
+	}
+	info, _ = m.PartyOf("u2")
+	if info.Leader != "u2" || len(m.History("u2")) != 1 {
+		t.Fatalf("unexpected party %+v", info)
+	}
+}
+
+func TestPartyGuest(t *testing.T) {
+	m := NewManager(Options{})
+	if _, err := m.Create(room.NewNullSession("")); room.ErrorCode(err) != room.ErrCodePermissionDenied {
+		t.Fatalf("expected guest rejected, got %v", err)
+	}
+	info, err := m.Create(room.NewNullSession("u1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Join(info.PartyId, room.NewNullSession("")); room.ErrorCode(err) != room.ErrCodePermissionDenied {
+		t.Fatalf("expected guest rejected, got %v", err)
+	}
+	if info, _ := m.Get(info.PartyId); len(info.Members) != 1 {
+		t.Fatalf("unexpected members %v", info.Members)
+	}
+}
+
+/**
+Enqueue期间回调Manager,模拟匹配服务与成员变化并发
+*/
+type reentrantMatchmaker struct {
+	fakeMatchmaker
+	onEnqueue func()
+	onCancel  func()
+}
+
+func (m *reentrantMatchmaker) Enqueue(ticket *Ticket) error {
+	m.fakeMatchmaker.Enqueue(ticket)
+	if m.onEnqueue != nil {
+		m.onEnqueue()
+	}
+	return nil
+}
+
+func (m *reentrantMatchmaker) Cancel(partyId string) error {
+	m.fakeMatchmaker.Cancel(partyId)
+	if m.onCancel != nil {
+		m.onCancel()
+	}
+	return nil
+}
+
+func TestPartyQueueOutsideLock(t *testing.T) {
+	matcher := &reentrantMatchmaker{fakeMatchmaker: fakeMatchmaker{queued: map[string]*Ticket{}}}
+	m := NewManager(Options{Matchmaker: matcher})
+	info, _ := m.Create(room.NewNullSession("u1"))
+	m.Join(info.PartyId, room.NewNullSession("u2"))
+
+	matcher.onEnqueue = func() {
+		if info, _ := m.Get(info.PartyId); info.Queued != "ranked" {
+			t.Errorf("party should be queued during Enqueue, got %+v", info)
+		}
+		if _, err := m.Queue("u1", "ranked"); room.ErrorCode(err) != room.ErrCodeStateInvalid {
+			t.Errorf("expected duplicate queue rejected, got %v", err)
+		}
+	}
+	if _, err := m.Queue("u1", "ranked"); err != nil {
+		t.Fatal(err)
+	}
+
+	m.CancelQueue("u1")
+	matcher.onEnqueue = func() {
+		m.Leave("u2")
+	}
+	if _, err := m.Queue("u1", "ranked"); room.ErrorCode(err) != room.ErrCodeStateInvalid {
+		t.Fatalf("expected queue canceled by leave, got %v", err)
+	}
+	if len(matcher.queued) != 0 {
+		t.Fatalf("stale ticket should be canceled %v", matcher.queued)
+	}
+	if info, _ := m.Get(info.PartyId); info.Queued != "" {
+		t.Fatalf("party should not be queued %+v", info)
+	}
+}
+
+func TestPartyCancelOutsideLock(t *testing.T) {
+	matcher := &reentrantMatchmaker{fakeMatchmaker: fakeMatchmaker{queued: map[string]*Ticket{}}}
+	m := NewManager(Options{Matchmaker: matcher})
+	info, _ := m.Create(room.NewNullSession("u1"))
+	m.Join(info.PartyId, room.NewNullSession("u2"))
+	//Cancel期间回调Manager,在锁内调用时会死锁
+	matcher.onCancel = func() {
+		if info, ok := m.Get(info.PartyId); ok && info.Queued != "" {
+			t.Errorf("party should not be queued during Cancel, got %+v", info)
+		}
+	}
+
+	m.Queue("u1", "ranked")
+	m.CancelQueue("u2")
+	m.Queue("u1", "ranked")
+	m.Join(info.PartyId, room.NewNullSession("u3"))
+	m.Queue("u1", "ranked")
+	m.Kick("u1", "u3")
+	m.Queue("u1", "ranked")
+	m.Leave("u2")
+	if len(matcher.canceled) != 4 || len(matcher.queued) != 0 {
+		t.Fatalf("expected 4 cancels, got %v queued %v", matcher.canceled, matcher.queued)
+	}
+}
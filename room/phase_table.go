@@ -0,0 +1,191 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"time"
+)
+
+/**
+游戏阶段定义,例如 下注->发牌->比牌->结算
+*/
+type Phase struct {
+	Name     string
+	Duration time.Duration //阶段持续时间,到时自动进入下一个阶段,0表示不自动结束
+	Next     string        //下一个阶段,为空时按定义顺序,最后一个阶段结束后阶段流程停止
+	Allowed  []string      //该阶段允许的操作(队列函数名),为空表示全部允许,系统优先级消息不受限制
+	OnEnter  func()
+	OnExit   func()
+}
+
+/**
+按声明的阶段自动推进,替代手写的定时器
+只能在table协成中调用
+*/
+type PhaseTable struct {
+	clock     func() Clock
+	phases    []*Phase
+	index     map[string]int
+	current   *Phase
+	enteredAt time.Time
+}
+
+func (this *PhaseTable) PhaseTableInit(clock func() Clock) {
+	this.clock = clock
+	this.phases = nil
+	this.index = map[string]int{}
+	this.current = nil
+}
+
+/**
+声明所有阶段,会检查名字重复和Next是否存在
+*/
+func (this *PhaseTable) DefinePhases(phases ...*Phase) error {
+	index := map[string]int{}
+	for i, phase := range phases {
+		if _, ok := index[phase.Name]; ok {
+			return fmt.Errorf("phase %v already defined", phase.Name)
+		}
+		index[phase.Name] = i
+	}
+	for _, phase := range phases {
+		if phase.Next != "" {
+			if _, ok := index[phase.Next]; !ok {
+				return fmt.Errorf("phase %v: next phase %v not defined", phase.Name, phase.Next)
+			}
+		}
+	}
+	this.phases = phases
+	this.index = index
+	this.current = nil
+	return nil
+}
+
+/**
+进入指定阶段,会先执行当前阶段的OnExit
+*/
+func (this *PhaseTable) EnterPhase(name string) error {
+	i, ok := this.index[name]
+	if !ok {
+		return fmt.Errorf("phase %v not defined", name)
+	}
+	if this.current != nil && this.current.OnExit != nil {
+		this.current.OnExit()
+	}
+	this.current = this.phases[i]
+	this.enteredAt = this.clock().Now()
+	if this.current.OnEnter != nil {
+		this.current.OnEnter()
+	}
+	return nil
+}
+
+/**
+提前结束当前阶段,进入下一个阶段
+*/
+func (this *PhaseTable) NextPhase() error {
+	if this.current == nil {
+		return fmt.Errorf("no active phase")
+	}
+	next := this.current.Next
+	if next == "" {
+		i := this.index[this.current.Name] + 1
+		if i >= len(this.phases) {
+			this.StopPhases()
+			return nil
+		}
+		next = this.phases[i].Name
+	}
+	return this.EnterPhase(next)
+}
+
+/**
+停止阶段流程,会执行当前阶段的OnExit
+*/
+func (this *PhaseTable) StopPhases() {
+	if this.current != nil && this.current.OnExit != nil {
+		this.current.OnExit()
+	}
+	this.current = nil
+}
+
+/**
+当前阶段,未开始或已停止时返回nil
+*/
+func (this *PhaseTable) CurrentPhase() *Phase {
+	return this.current
+}
+
+/**
+当前阶段剩余时间,不限时的阶段返回0
+*/
+func (this *PhaseTable) PhaseRemaining() time.Duration {
+	if this.current == nil || this.current.Duration <= 0 {
+		return 0
+	}
+	remaining := this.current.Duration - this.clock().Now().Sub(this.enteredAt)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+/**
+当前阶段是否允许该操作
+*/
+func (this *PhaseTable) ActionAllowed(action string) bool {
+	if this.current == nil || len(this.current.Allowed) == 0 {
+		return true
+	}
+	for _, allowed := range this.current.Allowed {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+队列检查,拒绝当前阶段不允许的操作
+*/
+func (this *PhaseTable) PhaseGuard(msg *QueueMsg) error {
+	if msg.Priority == PrioritySystem || this.ActionAllowed(msg.Func) {
+		return nil
+	}
+	return NewError(ErrCodeStateInvalid)
+}
+
+/**
+把当前阶段的计时向后推迟d,table暂停恢复后调用
+*/
+func (this *PhaseTable) ShiftPhase(d time.Duration) {
+	if this.current != nil {
+		this.enteredAt = this.enteredAt.Add(d)
+	}
+}
+
+/**
+【每帧调用】当前阶段到时后自动进入下一个阶段
+*/
+func (this *PhaseTable) CheckPhase() {
+	if this.current == nil || this.current.Duration <= 0 {
+		return
+	}
+	if this.clock().Now().Sub(this.enteredAt) >= this.current.Duration {
+		if err := this.NextPhase(); err != nil {
+			this.StopPhases()
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPhaseTable(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(0, 0))
+	exits := 0
+	table := &PhaseTable{}
+	table.PhaseTableInit(func() Clock { return clock })
+	err := table.DefinePhases(
+		&Phase{Name: "bet", Duration: 10 * time.Second, Allowed: []string{"Bet"}, OnExit: func() { exits++ }},
+		&Phase{Name: "deal", Duration: 2 * time.Second, Next: "bet"},
+	)
+	assertEqual(t, err, nil)
+	assertEqual(t, table.EnterPhase("bet"), nil)
+	assertEqual(t, table.ActionAllowed("Bet"), true)
+	assertEqual(t, table.ActionAllowed("Chat"), false)
+	assertEqual(t, table.PhaseGuard(&QueueMsg{Func: "Chat", Priority: PrioritySystem}), nil)
+
+	clock.Advance(9 * time.Second)
+	table.CheckPhase()
+	assertEqual(t, table.CurrentPhase().Name, "bet")
+	assertEqual(t, table.PhaseRemaining(), time.Second)
+
+	clock.Advance(time.Second)
+	table.CheckPhase()
+	assertEqual(t, table.CurrentPhase().Name, "deal")
+	assertEqual(t, exits, 1)
+
+	clock.Advance(2 * time.Second)
+	table.CheckPhase()
+	assertEqual(t, table.CurrentPhase().Name, "bet")
+}
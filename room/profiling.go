@@ -0,0 +1,191 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/**
+table的运行统计,用于定位哪个table/游戏类型占用CPU,内存和协成
+*/
+type TableProfile struct {
+	TableId    string
+	Labels     map[string]string
+	Frames     int64         //已执行的帧数
+	BusyTime   time.Duration //累计执行耗时
+	MaxFrame   time.Duration //单帧最大耗时
+	Memory     int64         //最近一次采样的估算内存,单位字节,见MemoryUsage
+	Goroutines int           //带有该table_id标签的协成数,只有设置了ProfileLabels才会统计
+}
+
+/**
+实现了该接口的table会出现在/debug/room/tables中
+*/
+type Profiler interface {
+	Profile() TableProfile
+}
+
+/**
+table每帧耗时统计,协成安全
+*/
+type ProfileTable struct {
+	tableId  string
+	labels   []string
+	frames   int64
+	busyTime int64
+	maxFrame int64
+	memory   int64
+}
+
+func (this *ProfileTable) ProfileTableInit(tableId string, labels []string) {
+	this.tableId = tableId
+	this.labels = labels
+}
+
+/**
+执行一帧,如果配置了ProfileLabels则带上pprof标签执行
+*/
+func (this *ProfileTable) DoProfile(f func()) {
+	start := time.Now()
+	if len(this.labels) > 0 {
+		labels := append([]string{"table_id", this.tableId}, this.labels...)
+		rpprof.Do(context.Background(), rpprof.Labels(labels...), func(context.Context) {
+			f()
+		})
+	} else {
+		f()
+	}
+	cost := int64(time.Since(start))
+	atomic.AddInt64(&this.frames, 1)
+	atomic.AddInt64(&this.busyTime, cost)
+	for {
+		max := atomic.LoadInt64(&this.maxFrame)
+		if cost <= max || atomic.CompareAndSwapInt64(&this.maxFrame, max, cost) {
+			break
+		}
+	}
+}
+
+/**
+记录内存采样,由CheckMemory在table协成中调用
+*/
+func (this *ProfileTable) recordMemory(bytes int64) {
+	atomic.StoreInt64(&this.memory, bytes)
+}
+
+func (this *ProfileTable) Profile() TableProfile {
+	labels := map[string]string{}
+	for i := 0; i+1 < len(this.labels); i += 2 {
+		labels[this.labels[i]] = this.labels[i+1]
+	}
+	return TableProfile{
+		TableId:  this.tableId,
+		Labels:   labels,
+		Frames:   atomic.LoadInt64(&this.frames),
+		BusyTime: time.Duration(atomic.LoadInt64(&this.busyTime)),
+		MaxFrame: time.Duration(atomic.LoadInt64(&this.maxFrame)),
+		Memory:   atomic.LoadInt64(&this.memory),
+	}
+}
+
+/**
+按pprof标签table_id统计协成数
+table帧内创建的协成会继承帧的标签,所以可以找到泄漏协成的table,没有设置ProfileLabels的table不会出现
+*/
+func goroutinesByTable() map[string]int {
+	var buf bytes.Buffer
+	counts := map[string]int{}
+	if err := rpprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return counts
+	}
+	//格式为 "N @ 0x... 0x..." 下一行可能是 "# labels: {"table_id":"xxx", ...}"
+	count := 0
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, " @ "); i > 0 {
+			count, _ = strconv.Atoi(line[:i])
+			continue
+		}
+		if !strings.HasPrefix(line, "# labels: ") {
+			continue
+		}
+		labels := map[string]string{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "# labels: ")), &labels); err != nil {
+			continue
+		}
+		if tableId, ok := labels["table_id"]; ok {
+			counts[tableId] += count
+		}
+	}
+	return counts
+}
+
+/**
+返回可以挂到管理端口上的http.Handler,默认不开启,需要由持有方自行监听
+/debug/pprof/		标准pprof
+/debug/room/tables	按累计耗时排序的table统计
+/debug/room/diff	事件溯源table两个时刻的状态差异
+/debug/room/inspect	冻结和查看table的完整状态
+*/
+func (self *Room) ProfileHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/room/tables", self.serveTableProfiles)
+	mux.HandleFunc("/debug/room/diff", self.serveTableDiff)
+	mux.HandleFunc("/debug/room/inspect", self.serveTableInspect)
+	return mux
+}
+
+func (self *Room) serveTableProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles := []TableProfile{}
+	goroutines := goroutinesByTable()
+	self.tables.Range(func(key, value interface{}) bool {
+		if p, ok := value.(Profiler); ok {
+			profile := p.Profile()
+			profile.Goroutines = goroutines[profile.TableId]
+			profiles = append(profiles, profile)
+		}
+		return true
+	})
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].BusyTime > profiles[j].BusyTime
+	})
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"Goroutines": runtime.NumGoroutine(),
+		"HeapAlloc":  mem.HeapAlloc,
+		"Tables":     profiles,
+	})
+}
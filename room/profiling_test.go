@@ -0,0 +1,76 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"github.com/liangdas/mqant/module"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTableProfiles(t *testing.T) {
+	room := NewRoom(nil)
+	value, err := room.CreateById(nil, "profiled", func(_ module.RPCModule, tableId string) (BaseTable, error) {
+		table := &benchTable{seats: map[string]BasePlayer{}}
+		err := table.OnInit(table,
+			TableId(tableId),
+			Capaciity(16),
+			SendMsgCapaciity(16),
+			RunInterval(time.Hour),
+			SetScheduler(benchScheduler, 0, 0),
+			ProfileLabels("game", "bench"),
+		)
+		return table, err
+	})
+	assertEqual(t, err, nil)
+	table := value.(*benchTable)
+	table.Run()
+	defer table.Finish()
+
+	table.SetAttr("board", "0123456789")
+	stop := make(chan bool)
+	started := make(chan bool)
+	exited := make(chan bool)
+	table.DoProfile(func() {
+		table.CheckMemory()
+		//帧内创建的协成继承table_id标签
+		go func() {
+			defer close(exited)
+			started <- true
+			<-stop
+		}()
+	})
+	<-started
+	defer func() {
+		close(stop)
+		<-exited
+	}()
+
+	recorder := httptest.NewRecorder()
+	room.ProfileHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/room/tables", nil))
+	result := struct {
+		Tables []TableProfile
+	}{}
+	assertEqual(t, json.Unmarshal(recorder.Body.Bytes(), &result), nil)
+	assertEqual(t, len(result.Tables), 1)
+	profile := result.Tables[0]
+	assertEqual(t, profile.TableId, "profiled")
+	assertEqual(t, profile.Labels["game"], "bench")
+	assertEqual(t, profile.Frames, int64(1))
+	assertEqual(t, profile.Memory, table.MemoryUsage().Total())
+	assertEqual(t, profile.Memory > 0, true)
+	assertEqual(t, profile.Goroutines, 1)
+}
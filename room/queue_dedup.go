@@ -0,0 +1,100 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"github.com/liangdas/mqant/gate"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+type dedupEntry struct {
+	hash uint64
+	at   time.Time
+}
+
+/**
+丢弃同一玩家在window内连续发送的相同消息,用于吸收客户端重试风暴
+只对第一个参数为gate.Session的消息生效
+*/
+type queueDedup struct {
+	lock      sync.Mutex
+	window    time.Duration
+	last      map[string]*dedupEntry
+	lastPrune time.Time
+}
+
+func newQueueDedup(window time.Duration) *queueDedup {
+	return &queueDedup{
+		window: window,
+		last:   map[string]*dedupEntry{},
+	}
+}
+
+func dedupKey(session gate.Session) string {
+	if session.IsGuest() {
+		return "s:" + session.GetSessionId()
+	}
+	return "u:" + session.GetUserId()
+}
+
+func dedupHash(_func string, params []interface{}) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(_func))
+	for _, param := range params {
+		switch v := param.(type) {
+		case []byte:
+			h.Write(v)
+		case string:
+			h.Write([]byte(v))
+		default:
+			fmt.Fprintf(h, "%#v", v)
+		}
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+/**
+返回true表示是重复消息,应丢弃
+*/
+func (d *queueDedup) duplicate(msg *QueueMsg) bool {
+	if len(msg.Params) == 0 {
+		return false
+	}
+	session, ok := msg.Params[0].(gate.Session)
+	if !ok || session == nil {
+		return false
+	}
+	key := dedupKey(session)
+	hash := dedupHash(msg.Func, msg.Params[1:])
+	now := msg.EnqueueTime
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if now.Sub(d.lastPrune) > d.window {
+		for k, e := range d.last {
+			if now.Sub(e.at) > d.window {
+				delete(d.last, k)
+			}
+		}
+		d.lastPrune = now
+	}
+	if e, ok := d.last[key]; ok && e.hash == hash && now.Sub(e.at) <= d.window {
+		return true
+	}
+	d.last[key] = &dedupEntry{hash: hash, at: now}
+	return false
+}
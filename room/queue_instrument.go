@@ -0,0 +1,198 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/gate"
+	"github.com/liangdas/mqant/log"
+	"sync"
+	"time"
+)
+
+//消息被丢弃的原因
+const (
+	DropQueueFull = "queue_full" //队列已满,未能放入队列
+	DropGuard     = "guard"      //被执行前检查拒绝
+	DropNotFound  = "not_found"  //没有注册该函数
+	DropPanic     = "panic"      //执行时panic
+	DropVersion   = "version"    //没有匹配客户端协议版本的处理函数
+	DropDuplicate = "duplicate"  //同一玩家短时间内重复发送的相同消息
+	DropBudget    = "budget"     //table超出内存预算,未能放入队列
+)
+
+//QueueMetrics中没有注册处理函数的消息统一计入该名字,Func由客户端填写,不能直接作为key
+const UnregisteredFunc = "(unregistered)"
+
+/**
+每条队列消息的计时事件
+*/
+type QueueEvent struct {
+	TableId  string
+	Func     string
+	Priority int
+	Enqueued time.Time     //放入队列的时间
+	Wait     time.Duration //从放入队列到开始执行的等待时间
+	Handle   time.Duration //执行耗时
+	Dropped  string        //丢弃原因,正常执行时为空
+	Err      error         //执行返回的错误或丢弃原因
+	Span     log.TraceSpan //第一个参数为gate.Session时从中提取的子span
+	RTT      time.Duration //第一个参数为gate.Session时该玩家的RTT估算
+	//Func没有通过Register或RegisterVersion注册,包括由NoFound处理的消息
+	Unregistered bool
+}
+
+type QueueObserver func(event *QueueEvent)
+
+func (self *QueueTable) observe(msg *QueueMsg, dropped string, handle time.Duration, err error) {
+	if self.opts.QueueObserver == nil {
+		return
+	}
+	event := &QueueEvent{
+		TableId:  self.opts.TableId,
+		Func:     msg.Func,
+		Priority: msg.Priority,
+		Enqueued: msg.EnqueueTime,
+		Handle:   handle,
+		Dropped:  dropped,
+		Err:      err,
+		//函数只在初始化时注册,之后可以在任意协成中读取
+		Unregistered: !self.registered(msg.Func),
+	}
+	if dropped != DropQueueFull && dropped != DropBudget {
+		event.Wait = self.opts.Clock.Now().Sub(msg.EnqueueTime) - handle
+	}
+	if len(msg.Params) > 0 {
+		if session, ok := msg.Params[0].(gate.Session); ok && session != nil {
+			event.Span = session.ExtractSpan()
+			event.RTT = self.sessionRTT(session)
+		}
+	}
+	self.opts.QueueObserver(event)
+}
+
+/**
+单个函数的队列统计
+*/
+type QueueFuncMetrics struct {
+	Count     int64
+	Errors    int64
+	TotalWait time.Duration
+	MaxWait   time.Duration
+	TotalCost time.Duration
+	MaxCost   time.Duration
+	Drops     map[string]int64
+}
+
+/**
+按table和函数汇总QueueEvent,可以直接作为QueueObserver使用,协成安全
+*/
+type QueueMetrics struct {
+	lock    sync.Mutex
+	metrics map[string]map[string]*QueueFuncMetrics
+}
+
+func NewQueueMetrics() *QueueMetrics {
+	return &QueueMetrics{
+		metrics: map[string]map[string]*QueueFuncMetrics{},
+	}
+}
+
+/**
+没有注册的函数统一计入UnregisteredFunc,避免客户端用任意函数名撑大统计
+*/
+func (self *QueueMetrics) Observe(event *QueueEvent) {
+	name := event.Func
+	if event.Unregistered {
+		name = UnregisteredFunc
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	funcs, ok := self.metrics[event.TableId]
+	if !ok {
+		funcs = map[string]*QueueFuncMetrics{}
+		self.metrics[event.TableId] = funcs
+	}
+	m, ok := funcs[name]
+	if !ok {
+		m = &QueueFuncMetrics{Drops: map[string]int64{}}
+		funcs[name] = m
+	}
+	m.Count++
+	if event.Dropped != "" {
+		m.Drops[event.Dropped]++
+		return
+	}
+	if event.Err != nil {
+		m.Errors++
+	}
+	m.TotalWait += event.Wait
+	m.TotalCost += event.Handle
+	if event.Wait > m.MaxWait {
+		m.MaxWait = event.Wait
+	}
+	if event.Handle > m.MaxCost {
+		m.MaxCost = event.Handle
+	}
+}
+
+/**
+返回某个table的统计副本
+*/
+func (self *QueueMetrics) Table(tableId string) map[string]QueueFuncMetrics {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	result := map[string]QueueFuncMetrics{}
+	for name, m := range self.metrics[tableId] {
+		c := *m
+		c.Drops = map[string]int64{}
+		for k, v := range m.Drops {
+			c.Drops[k] = v
+		}
+		result[name] = c
+	}
+	return result
+}
+
+/**
+table销毁后清理统计
+*/
+func (self *QueueMetrics) Remove(tableId string) {
+	self.lock.Lock()
+	delete(self.metrics, tableId)
+	self.lock.Unlock()
+}
+
+/**
+把等待或执行超过slow的消息以及被丢弃的消息记录到消息所属的trace中
+*/
+func TraceQueueObserver(slow time.Duration) QueueObserver {
+	return func(event *QueueEvent) {
+		if event.Span == nil {
+			return
+		}
+		if event.Dropped != "" {
+			log.TWarning(event.Span, "table %v queue %v dropped: %v %v", event.TableId, event.Func, event.Dropped, event.Err)
+		} else if event.Wait > slow || event.Handle > slow {
+			log.TInfo(event.Span, "table %v queue %v wait %v handle %v", event.TableId, event.Func, event.Wait, event.Handle)
+		}
+	}
+}
+
+func (self *QueueTable) registered(id string) bool {
+	if _, ok := self.functions[id]; ok {
+		return true
+	}
+	_, ok := self.versioned[id]
+	return ok
+}
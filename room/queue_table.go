@@ -14,62 +14,157 @@
 package room
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/yireyun/go-queue"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//消息优先级,数值越大越先被处理
+const (
+	PriorityChat   = 0 //聊天等低优先级消息
+	PriorityAction = 1 //游戏操作,PutQueue的默认优先级
+	PrioritySystem = 2 //系统控制消息,如暂停,踢人,关闭
 )
 
 type QueueMsg struct {
-	Func   string
-	Params []interface{}
+	Func        string
+	Params      []interface{}
+	Priority    int
+	EnqueueTime time.Time //放入队列的时间,即table收到消息的时间,按table时钟
+	size        int64     //估算大小,只在设置了MemoryBudget时计算
 }
 type QueueReceive interface {
 	Receive(msg *QueueMsg, index int)
 }
+
+/**
+消息执行前的检查,返回错误则不执行该消息并回调ErrorHandle
+*/
+type QueueGuard func(msg *QueueMsg) error
+
 type QueueTable struct {
 	opts            Options
 	functions       map[string]reflect.Value
+	versioned       map[string][]*versionedHandler //按客户端协议版本区分的处理函数
+	rpcs            map[string]TableRPCHandler     //可以被其他模块调用的函数
+	requirements    map[string][]Requirement       //处理函数的执行条件
 	receive         QueueReceive
-	queue0          *queue.EsQueue
-	queue1          *queue.EsQueue
-	current_w_queue int //当前写的队列
+	guards          []QueueGuard
+	lanes           []*queueLane //按优先级划分的队列,下标即优先级
+	current_w_queue int          //当前写的队列
 	lock            *sync.RWMutex
+	lastPut         int64 //最后一次放入消息的时间,按table时钟,unix纳秒
+	dedup           *queueDedup
+	queueBytes      int64 //队列中消息的估算大小
+	overBudget      int32
+	ctx             context.Context //HandlerContext的父上下文
+	cancel          context.CancelFunc
+	rtt             *RTTEstimator
+	frozen          int32       //冻结期间只执行系统优先级消息
+	held            []*QueueMsg //冻结期间暂存的消息,解冻后按原顺序执行
+}
+
+/**
+同一优先级的双缓冲队列
+*/
+type queueLane struct {
+	queue0 *queue.EsQueue
+	queue1 *queue.EsQueue
 }
 
 func (self *QueueTable) QueueInit(opts ...Option) {
 	self.opts = newOptions(opts...)
 	self.functions = map[string]reflect.Value{}
-	self.queue0 = queue.NewQueue(self.opts.Capaciity)
-	self.queue1 = queue.NewQueue(self.opts.Capaciity)
+	self.lanes = make([]*queueLane, PrioritySystem+1)
+	for i := range self.lanes {
+		self.lanes[i] = &queueLane{
+			queue0: queue.NewQueue(self.opts.Capaciity),
+			queue1: queue.NewQueue(self.opts.Capaciity),
+		}
+	}
 	self.current_w_queue = 0
 	self.lock = new(sync.RWMutex)
+	self.lastPut = self.opts.Clock.Now().UnixNano()
+	if self.opts.DedupWindow > 0 {
+		self.dedup = newQueueDedup(self.opts.DedupWindow)
+	}
+	self.ctx, self.cancel = context.WithCancel(context.Background())
+	self.rtt = NewRTTEstimator()
 }
 func (self *QueueTable) SetReceive(receive QueueReceive) {
 	self.receive = receive
 }
+
+/**
+添加执行前检查,只能在table初始化时调用
+*/
+func (self *QueueTable) AddGuard(guard QueueGuard) {
+	self.guards = append(self.guards, guard)
+}
+
 func (self *QueueTable) Register(id string, f interface{}) {
 
 	if _, ok := self.functions[id]; ok {
 		panic(fmt.Sprintf("function id %v: already registered", id))
 	}
+	if _, ok := self.versioned[id]; ok {
+		panic(fmt.Sprintf("function id %v: already registered", id))
+	}
 
 	self.functions[id] = reflect.ValueOf(f)
 }
 
 /**
 协成安全,任意协成可调用
+以PriorityAction优先级放入队列
 */
 func (self *QueueTable) PutQueue(_func string, params ...interface{}) error {
-	q := self.wqueue()
+	return self.PutQueueWithPriority(PriorityAction, _func, params...)
+}
+
+/**
+协成安全,任意协成可调用
+每个优先级有独立的队列,高优先级的消息不会因为低优先级消息积压而放不进队列,并且每帧优先执行
+*/
+func (self *QueueTable) PutQueueWithPriority(priority int, _func string, params ...interface{}) error {
+	if priority < PriorityChat || priority > PrioritySystem {
+		return fmt.Errorf("Put Fail, unknown priority:%v", priority)
+	}
+	q := self.wqueue(priority)
+	msg := &QueueMsg{
+		Func:        _func,
+		Params:      params,
+		Priority:    priority,
+		EnqueueTime: self.opts.Clock.Now(),
+	}
+	if self.dedup != nil && self.dedup.duplicate(msg) {
+		self.observe(msg, DropDuplicate, 0, nil)
+		return nil
+	}
+	if priority != PrioritySystem && self.OverBudget() {
+		self.observe(msg, DropBudget, 0, nil)
+		return NewError(ErrCodeOverloaded)
+	}
+	if self.opts.MemoryBudget != nil {
+		msg.size = approxParamsSize(params)
+	}
 	self.lock.Lock()
-	ok, quantity := q.Put(&QueueMsg{
-		Func:   _func,
-		Params: params,
-	})
+	ok, quantity := q.Put(msg)
 	self.lock.Unlock()
+	if ok && msg.size > 0 {
+		atomic.AddInt64(&self.queueBytes, msg.size)
+	}
+	atomic.StoreInt64(&self.lastPut, msg.EnqueueTime.UnixNano())
+	if self.opts.Scheduler != nil {
+		self.opts.Scheduler.Wake(self.opts.TableId)
+	}
 	if !ok {
+		self.observe(msg, DropQueueFull, 0, nil)
 		return fmt.Errorf("Put Fail, quantity:%v\n", quantity)
 	} else {
 		return nil
@@ -78,111 +173,184 @@ func (self *QueueTable) PutQueue(_func string, params ...interface{}) error {
 }
 
 /**
-切换并且返回读的队列
+最后一次收到消息的时间,按table时钟
 */
-func (self *QueueTable) switchqueue() *queue.EsQueue {
+func (self *QueueTable) LastPut() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&self.lastPut))
+}
+
+/**
+切换并且返回读的队列,按优先级从高到低排列
+*/
+func (self *QueueTable) switchqueue() []*queue.EsQueue {
+	queues := make([]*queue.EsQueue, 0, len(self.lanes))
 	self.lock.Lock()
+	for i := len(self.lanes) - 1; i >= 0; i-- {
+		if self.current_w_queue == 0 {
+			queues = append(queues, self.lanes[i].queue0)
+		} else {
+			queues = append(queues, self.lanes[i].queue1)
+		}
+	}
 	if self.current_w_queue == 0 {
 		self.current_w_queue = 1
-		self.lock.Unlock()
-		return self.queue0
 	} else {
 		self.current_w_queue = 0
-		self.lock.Unlock()
-		return self.queue1
 	}
-
+	self.lock.Unlock()
+	return queues
 }
-func (self *QueueTable) wqueue() *queue.EsQueue {
+func (self *QueueTable) wqueue(priority int) *queue.EsQueue {
 	self.lock.Lock()
 	if self.current_w_queue == 0 {
 		self.lock.Unlock()
-		return self.queue0
+		return self.lanes[priority].queue0
 	} else {
 		self.lock.Unlock()
-		return self.queue1
+		return self.lanes[priority].queue1
 	}
 
 }
 
 /**
-【每帧调用】执行队列中的所有事件
+【每帧调用】执行队列中的所有事件,高优先级的先执行
 */
 func (self *QueueTable) ExecuteEvent(arge interface{}) {
-	ok := true
-	queue := self.switchqueue()
 	index := 0
-	for ok {
-		val, _ok, _ := queue.Get()
-		index++
-		if _ok {
-			if self.receive != nil {
-				self.receive.Receive(val.(*QueueMsg), index)
-			} else {
+	if len(self.held) > 0 && !self.Frozen() {
+		held := self.held
+		self.held = nil
+		for _, msg := range held {
+			index++
+			self.dispatch(msg, index)
+		}
+	}
+	for _, queue := range self.switchqueue() {
+		ok := true
+		for ok {
+			val, _ok, _ := queue.Get()
+			index++
+			if _ok {
 				msg := val.(*QueueMsg)
-				function, ok := self.functions[msg.Func]
-				if !ok {
-					//fmt.Println(fmt.Sprintf("Remote function(%s) not found", msg.Func))
-					if self.opts.NoFound != nil {
-						fc, err := self.opts.NoFound(msg)
-						if err != nil {
-							self.opts.RecoverHandle(msg, err)
-							continue
-						}
-						function = fc
-					} else {
-						if self.opts.RecoverHandle != nil {
-							self.opts.RecoverHandle(msg, errors.Errorf("Remote function(%s) not found", msg.Func))
-						}
-						continue
-					}
-				}
-				f := function
-				in := make([]reflect.Value, len(msg.Params))
-				for k, _ := range in {
-					switch v2 := msg.Params[k].(type) { //多选语句switch
-					case nil:
-						in[k] = reflect.Zero(f.Type().In(k))
-					default:
-						in[k] = reflect.ValueOf(v2)
-					}
-					//in[k] = reflect.ValueOf(msg.Params[k])
+				if msg.Priority != PrioritySystem && self.Frozen() {
+					self.held = append(self.held, msg)
+				} else {
+					self.dispatch(msg, index)
 				}
-				_runFunc := func() {
-					defer func() {
-						if r := recover(); r != nil {
-							var rn = ""
-							switch r.(type) {
-
-							case string:
-								rn = r.(string)
-							case error:
-								rn = r.(error).Error()
-							}
-							//buf := make([]byte, 1024)
-							//l := runtime.Stack(buf, false)
-							//errstr := string(buf[:l])
-							if self.opts.RecoverHandle != nil {
-								self.opts.RecoverHandle(msg, errors.New(rn))
-							}
-							//log.Error("table qeueu event(%s) exec fail error:%s \n ----Stack----\n %s", msg.Func, rn, errstr)
-						}
-					}()
-					out := f.Call(in)
-					if self.opts.ErrorHandle != nil {
-						if len(out) == 1 {
-							value, ok := out[0].Interface().(error)
-							if ok {
-								if value != nil {
-									self.opts.ErrorHandle(msg, value)
-								}
-							}
-						}
-					}
+			}
+			ok = _ok
+		}
+	}
+}
+
+func (self *QueueTable) dispatch(msg *QueueMsg, index int) {
+	start := time.Now()
+	if msg.size > 0 {
+		atomic.AddInt64(&self.queueBytes, -msg.size)
+	}
+	var (
+		dropped string
+		failure error
+	)
+	if self.opts.QueueObserver != nil {
+		defer func() {
+			self.observe(msg, dropped, time.Since(start), failure)
+		}()
+	}
+	for _, guard := range self.guards {
+		if err := guard(msg); err != nil {
+			dropped, failure = DropGuard, err
+			if self.opts.ErrorHandle != nil {
+				self.opts.ErrorHandle(msg, err)
+			}
+			return
+		}
+	}
+	if err := self.checkRequirements(msg); err != nil {
+		dropped, failure = DropGuard, err
+		if self.opts.ErrorHandle != nil {
+			self.opts.ErrorHandle(msg, err)
+		}
+		return
+	}
+	if self.receive != nil {
+		self.receive.Receive(msg, index)
+		return
+	}
+	function, ok, err := self.lookup(msg)
+	if err != nil {
+		dropped, failure = DropVersion, err
+		if self.opts.ErrorHandle != nil {
+			self.opts.ErrorHandle(msg, err)
+		}
+		return
+	}
+	if !ok {
+		//fmt.Println(fmt.Sprintf("Remote function(%s) not found", msg.Func))
+		if self.opts.NoFound != nil {
+			fc, err := self.opts.NoFound(msg)
+			if err != nil {
+				dropped, failure = DropNotFound, err
+				self.opts.RecoverHandle(msg, err)
+				return
+			}
+			function = fc
+		} else {
+			dropped, failure = DropNotFound, errors.Errorf("Remote function(%s) not found", msg.Func)
+			if self.opts.RecoverHandle != nil {
+				self.opts.RecoverHandle(msg, failure)
+			}
+			return
+		}
+	}
+	f := function
+	in, cancel := self.handlerArgs(f, msg)
+	if cancel != nil {
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			var rn = ""
+			switch r.(type) {
+
+			case string:
+				rn = r.(string)
+			case error:
+				rn = r.(error).Error()
+			}
+			//buf := make([]byte, 1024)
+			//l := runtime.Stack(buf, false)
+			//errstr := string(buf[:l])
+			dropped, failure = DropPanic, errors.New(rn)
+			if self.opts.RecoverHandle != nil {
+				self.opts.RecoverHandle(msg, failure)
+			}
+			//log.Error("table qeueu event(%s) exec fail error:%s \n ----Stack----\n %s", msg.Func, rn, errstr)
+		}
+	}()
+	if self.opts.Chaos != nil {
+		self.opts.Chaos.BeforeHandle(msg)
+	}
+	out := f.Call(in)
+	if len(out) == 1 {
+		value, ok := out[0].Interface().(error)
+		if ok {
+			if value != nil {
+				failure = value
+				if self.opts.ErrorHandle != nil {
+					self.opts.ErrorHandle(msg, value)
 				}
-				_runFunc()
 			}
 		}
-		ok = _ok
 	}
 }
+
+/**
+按优先级放入table队列,table没有实现PriorityTable时使用PutQueue
+*/
+func putTableQueue(table BaseTable, priority int, _func string, params ...interface{}) error {
+	if prioritized, ok := table.(PriorityTable); ok {
+		return prioritized.PutQueueWithPriority(priority, _func, params...)
+	}
+	return table.PutQueue(_func, params...)
+}
@@ -0,0 +1,241 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/gate"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueuePriority(t *testing.T) {
+	q := &QueueTable{}
+	q.QueueInit()
+	order := []string{}
+	q.Register("chat", func(s string) { order = append(order, s) })
+	q.Register("action", func(s string) { order = append(order, s) })
+	q.Register("kick", func(s string) { order = append(order, s) })
+
+	assertEqual(t, q.PutQueueWithPriority(PriorityChat, "chat", "c1"), nil)
+	assertEqual(t, q.PutQueue("action", "a1"), nil)
+	assertEqual(t, q.PutQueueWithPriority(PrioritySystem, "kick", "k1"), nil)
+	assertEqual(t, q.PutQueueWithPriority(PriorityChat, "chat", "c2"), nil)
+	q.ExecuteEvent(nil)
+	assertEqual(t, strings.Join(order, ","), "k1,a1,c1,c2")
+
+	if q.PutQueueWithPriority(PrioritySystem+1, "kick", "k2") == nil {
+		t.Errorf("Expected error for unknown priority")
+	}
+}
+
+func TestQueueObserver(t *testing.T) {
+	metrics := NewQueueMetrics()
+	q := &QueueTable{}
+	q.QueueInit(TableId("t1"), SetQueueObserver(metrics.Observe))
+	q.Register("ok", func() {})
+	q.Register("boom", func() { panic("boom") })
+	q.PutQueue("ok")
+	q.PutQueue("boom")
+	q.PutQueue("missing")
+	q.PutQueue("missing2")
+	q.ExecuteEvent(nil)
+
+	m := metrics.Table("t1")
+	assertEqual(t, m["ok"].Count, int64(1))
+	assertEqual(t, m["boom"].Drops[DropPanic], int64(1))
+	//没有注册的函数名不作为key
+	assertEqual(t, len(m), 3)
+	assertEqual(t, m[UnregisteredFunc].Drops[DropNotFound], int64(2))
+}
+
+func TestQueueVersionedHandler(t *testing.T) {
+	q := &QueueTable{}
+	var failure error
+	q.QueueInit(SetErrorHandle(func(msg *QueueMsg, err error) { failure = err }))
+	handled := ""
+	q.RegisterVersion("move", 1, 1, func(session gate.Session) { handled = "v1" })
+	q.RegisterVersion("move", 2, 0, func(session gate.Session) { handled = "v2" })
+
+	old := NewNullSession("u1")
+	old.SetSettings(map[string]string{CapProtocolVersion: "1"})
+	q.PutQueue("move", old)
+	q.ExecuteEvent(nil)
+	assertEqual(t, handled, "v1")
+
+	current := NewNullSession("u2")
+	current.SetSettings(map[string]string{CapProtocolVersion: "3"})
+	q.PutQueue("move", current)
+	q.ExecuteEvent(nil)
+	assertEqual(t, handled, "v2")
+
+	q.PutQueue("move", NewNullSession("u3"))
+	q.ExecuteEvent(nil)
+	assertEqual(t, ErrorCode(failure), ErrCodeUnsupportedVersion)
+}
+
+func TestQueueDedup(t *testing.T) {
+	q := &QueueTable{}
+	q.QueueInit(DedupWindow(time.Second))
+	count := 0
+	q.Register("bet", func(session gate.Session, amount int) { count++ })
+	session := NewNullSession("u1")
+	q.PutQueue("bet", session, 100)
+	q.PutQueue("bet", session, 100)
+	q.PutQueue("bet", NewNullSession("u2"), 100)
+	q.PutQueue("bet", session, 200)
+	q.PutQueue("bet", session, 100)
+	q.ExecuteEvent(nil)
+	assertEqual(t, count, 4)
+}
+
+func TestQueueHandlerContext(t *testing.T) {
+	q := &QueueTable{}
+	q.QueueInit(HandlerTimeout(time.Second))
+	var (
+		userId   string
+		amount   int
+		deadline bool
+	)
+	q.Register("bet", func(ctx *HandlerContext, n int) {
+		userId = ctx.Session.GetUserId()
+		amount = n
+		_, deadline = ctx.Deadline()
+	})
+	q.PutQueue("bet", NewNullSession("u1"), 100)
+	q.ExecuteEvent(nil)
+	assertEqual(t, userId, "u1")
+	assertEqual(t, amount, 100)
+	assertEqual(t, deadline, true)
+
+	var canceled error
+	q.Register("later", func(ctx *HandlerContext) { canceled = ctx.Err() })
+	q.CancelHandlers()
+	q.PutQueue("later")
+	q.ExecuteEvent(nil)
+	if canceled == nil {
+		t.Errorf("Expected context canceled after CancelHandlers")
+	}
+}
+
+func TestQueueMemoryBudget(t *testing.T) {
+	q := &QueueTable{}
+	q.QueueInit(SetMemoryBudget(&MemoryBudget{Hard: 1024}))
+	q.Register("say", func(s string) {})
+	assertEqual(t, q.PutQueue("say", "hello"), nil)
+	assertEqual(t, q.QueueBytes(), int64(5))
+
+	q.setOverBudget(true)
+	assertEqual(t, ErrorCode(q.PutQueue("say", "again")), ErrCodeOverloaded)
+	assertEqual(t, q.PutQueueWithPriority(PrioritySystem, "say", "kick"), nil)
+	q.ExecuteEvent(nil)
+	assertEqual(t, q.QueueBytes(), int64(0))
+}
+
+func TestQueueRequirement(t *testing.T) {
+	q := &QueueTable{}
+	var failure error
+	q.QueueInit(SetErrorHandle(func(msg *QueueMsg, err error) { failure = err }))
+	kicked := 0
+	q.RegisterWith("kick", func(session gate.Session) { kicked++ }, RequireAdmin())
+
+	q.PutQueue("kick", NewNullSession("u1"))
+	q.ExecuteEvent(nil)
+	assertEqual(t, kicked, 0)
+	assertEqual(t, ErrorCode(failure), ErrCodePermissionDenied)
+
+	admin := NewNullSession("u2")
+	admin.SetSettings(map[string]string{SessionRole: RoleAdmin})
+	q.PutQueue("kick", admin)
+	q.ExecuteEvent(nil)
+	assertEqual(t, kicked, 1)
+}
+
+func TestQueueRTT(t *testing.T) {
+	q := &QueueTable{}
+	q.QueueInit()
+	session := NewNullSession("u1")
+	now := time.Unix(100, 0)
+	q.RTTEstimator().Sample(session.GetSessionId(), 80*time.Millisecond, now)
+	q.RTTEstimator().Sample(session.GetSessionId(), 160*time.Millisecond, now)
+	rtt, jitter, ok := q.RTTEstimator().RTT(session.GetSessionId())
+	assertEqual(t, ok, true)
+	assertEqual(t, rtt, 90*time.Millisecond)
+	assertEqual(t, jitter, 50*time.Millisecond)
+
+	var (
+		got    time.Duration
+		action time.Time
+		enq    time.Time
+	)
+	q.Register("shoot", func(ctx *HandlerContext) {
+		got = ctx.RTT
+		action = ctx.ActionTime()
+		enq = ctx.EnqueueTime
+	})
+	q.PutQueue("shoot", session)
+	q.ExecuteEvent(nil)
+	assertEqual(t, got, 90*time.Millisecond)
+	assertEqual(t, enq.Sub(action), 45*time.Millisecond)
+
+	//长时间没有采样的session被清理
+	q.RTTEstimator().Sample("u2", 10*time.Millisecond, now.Add(rttStaleAfter+time.Second))
+	_, _, ok = q.RTTEstimator().RTT(session.GetSessionId())
+	assertEqual(t, ok, false)
+}
+
+func TestQueueFreeze(t *testing.T) {
+	q := &QueueTable{}
+	q.QueueInit()
+	order := []string{}
+	q.Register("act", func(s string) { order = append(order, s) })
+	q.Freeze()
+	q.PutQueue("act", "a")
+	q.PutQueueWithPriority(PrioritySystem, "act", "sys")
+	q.ExecuteEvent(nil)
+	assertEqual(t, len(order), 1)
+	assertEqual(t, order[0], "sys")
+	assertEqual(t, len(q.held), 1)
+
+	q.PutQueue("act", "b")
+	q.Thaw()
+	q.ExecuteEvent(nil)
+	assertEqual(t, len(order), 3)
+	assertEqual(t, order[1], "a")
+	assertEqual(t, order[2], "b")
+	assertEqual(t, len(q.held), 0)
+}
+
+func TestLifecycleConcurrent(t *testing.T) {
+	table, err := newBenchTable(nil, "lifecycle")
+	assertEqual(t, err, nil)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		//模拟LifecycleWatchdog在其他协成中读取
+		for i := 0; i < 100; i++ {
+			table.(interface {
+				Lifecycle() (int, time.Duration)
+			}).Lifecycle()
+			table.Runing()
+		}
+	}()
+	table.Run()
+	table.Finish()
+	<-done
+	state, _ := table.(interface {
+		Lifecycle() (int, time.Duration)
+	}).Lifecycle()
+	assertEqual(t, state, Finished)
+}
@@ -0,0 +1,65 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+/**
+table状态的大小限制,防止游戏bug在长期运行的table中不断累积数据
+大小按approxSize估算,0表示不限制
+*/
+type Quota struct {
+	AttrValue  int64 //单个属性值
+	AttrTotal  int64 //所有属性合计
+	PlayerBody int64 //单个玩家的Body
+}
+
+func quotaError(what string, limit int64) error {
+	return NewError(ErrCodeQuotaExceeded, what, limit)
+}
+
+/**
+检查把key设置为size大小的值是否超过限制,调用方需持有attrLock
+*/
+func (this *AttributeTable) checkAttrQuota(key string, size int64) error {
+	quota := this.quota
+	if quota == nil {
+		return nil
+	}
+	if quota.AttrValue > 0 && size > quota.AttrValue {
+		return quotaError(key, quota.AttrValue)
+	}
+	if quota.AttrTotal > 0 {
+		total := this.attrBytes + size + int64(len(key)) + 16
+		if attr, ok := this.attrs[key]; ok {
+			total -= attr.size + int64(len(key)) + 16
+		}
+		if total > quota.AttrTotal {
+			return quotaError(key, quota.AttrTotal)
+		}
+	}
+	return nil
+}
+
+/**
+设置玩家的Body,超过Quota.PlayerBody时返回ErrCodeQuotaExceeded并保留原值
+Body在设置后被原地修改时无法检查,游戏应通过该方法替换Body
+*/
+func (this *QTable) SetPlayerBody(player BasePlayer, body interface{}) error {
+	if limit := this.opts.Quota.PlayerBody; limit > 0 {
+		if approxSize(body) > limit {
+			return quotaError("body", limit)
+		}
+	}
+	player.SetBody(body)
+	return nil
+}
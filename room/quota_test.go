@@ -0,0 +1,43 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+)
+
+func TestAttributeQuota(t *testing.T) {
+	table := &AttributeTable{}
+	table.AttributeTableInit(&Quota{AttrValue: 8, AttrTotal: 45})
+	_, err := table.SetAttr("a", "0123456789")
+	assertEqual(t, ErrorCode(err), ErrCodeQuotaExceeded)
+	_, _, ok := table.GetAttr("a")
+	assertEqual(t, ok, false)
+
+	_, err = table.SetAttr("a", "01234567")
+	assertEqual(t, err, nil)
+	assertEqual(t, table.AttributeBytes(), int64(25))
+	//总量超限
+	_, err = table.SetAttr("b", "01234567")
+	assertEqual(t, ErrorCode(err), ErrCodeQuotaExceeded)
+	//替换已有的值按差值计算
+	version, err := table.SetAttr("a", "0123")
+	assertEqual(t, err, nil)
+	_, err = table.CompareAndSetAttr("b", 0, "0123")
+	assertEqual(t, err, nil)
+	table.DeleteAttr("b")
+	assertEqual(t, table.AttributeBytes(), int64(21))
+	_, err = table.CompareAndSetAttr("a", version, "012345678")
+	assertEqual(t, ErrorCode(err), ErrCodeQuotaExceeded)
+}
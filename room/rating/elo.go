@@ -0,0 +1,77 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rating
+
+import (
+	"math"
+)
+
+/**
+Elo,多人对局按两两比较计算,K值按对手数量平均
+*/
+type Elo struct {
+	K      float64 //默认32
+	Rating float64 //初始分,默认1500
+}
+
+func (e *Elo) k() float64 {
+	if e.K <= 0 {
+		return 32
+	}
+	return e.K
+}
+
+func (e *Elo) Name() string {
+	return "elo"
+}
+
+func (e *Elo) Initial(id string) *Player {
+	rating := e.Rating
+	if rating == 0 {
+		rating = 1500
+	}
+	return &Player{Id: id, Rating: rating}
+}
+
+func (e *Elo) Expected(a float64, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+func (e *Elo) Rate(players []*Player, ranks []int) []*Player {
+	rated := make([]*Player, len(players))
+	if len(players) < 2 {
+		//没有对手时分数不变
+		for i, player := range players {
+			rated[i] = player.clone()
+		}
+		return rated
+	}
+	k := e.k() / float64(len(players)-1)
+	for i, player := range players {
+		delta := 0.0
+		for j, opponent := range players {
+			if i == j {
+				continue
+			}
+			delta += score(ranks[i], ranks[j]) - e.Expected(player.Rating, opponent.Rating)
+		}
+		rated[i] = player.clone()
+		rated[i].Rating += k * delta
+	}
+	return rated
+}
+
+func (e *Elo) Display(player *Player) float64 {
+	return player.Rating
+}
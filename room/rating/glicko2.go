@@ -0,0 +1,137 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rating
+
+import (
+	"math"
+)
+
+//Glicko-2内部刻度与Glicko刻度的换算系数
+const glickoScale = 173.7178
+
+/**
+Glicko-2,每局作为一个评分周期,其他所有玩家都是对手
+*/
+type Glicko2 struct {
+	Tau        float64 //限制波动率的变化,默认0.5
+	Rating     float64 //初始分,默认1500
+	Deviation  float64 //初始偏差,默认350
+	Volatility float64 //初始波动率,默认0.06
+}
+
+func (g *Glicko2) Name() string {
+	return "glicko2"
+}
+
+func (g *Glicko2) Initial(id string) *Player {
+	player := &Player{Id: id, Rating: g.Rating, Deviation: g.Deviation, Volatility: g.Volatility}
+	if player.Rating == 0 {
+		player.Rating = 1500
+	}
+	if player.Deviation == 0 {
+		player.Deviation = 350
+	}
+	if player.Volatility == 0 {
+		player.Volatility = 0.06
+	}
+	return player
+}
+
+func (g *Glicko2) tau() float64 {
+	if g.Tau <= 0 {
+		return 0.5
+	}
+	return g.Tau
+}
+
+func glickoG(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func glickoE(mu float64, muj float64, phij float64) float64 {
+	return 1 / (1 + math.Exp(-glickoG(phij)*(mu-muj)))
+}
+
+func (g *Glicko2) Rate(players []*Player, ranks []int) []*Player {
+	rated := make([]*Player, len(players))
+	for i, player := range players {
+		mu := (player.Rating - 1500) / glickoScale
+		phi := player.Deviation / glickoScale
+		sigma := player.Volatility
+		v := 0.0
+		sum := 0.0
+		for j, opponent := range players {
+			if i == j {
+				continue
+			}
+			muj := (opponent.Rating - 1500) / glickoScale
+			phij := opponent.Deviation / glickoScale
+			e := glickoE(mu, muj, phij)
+			gj := glickoG(phij)
+			v += gj * gj * e * (1 - e)
+			sum += gj * (score(ranks[i], ranks[j]) - e)
+		}
+		v = 1 / v
+		delta := v * sum
+		sigma = g.volatility(phi, sigma, v, delta)
+		phiStar := math.Sqrt(phi*phi + sigma*sigma)
+		phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+		mu += phi * phi * sum
+		rated[i] = player.clone()
+		rated[i].Rating = glickoScale*mu + 1500
+		rated[i].Deviation = glickoScale * phi
+		rated[i].Volatility = sigma
+	}
+	return rated
+}
+
+/**
+Illinois算法求新的波动率
+*/
+func (g *Glicko2) volatility(phi float64, sigma float64, v float64, delta float64) float64 {
+	tau := g.tau()
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(tau*tau)
+	}
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > 1e-6 {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA = fA / 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
+
+func (g *Glicko2) Display(player *Player) float64 {
+	return player.Rating
+}
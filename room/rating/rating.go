@@ -0,0 +1,197 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/**
+排位分计算
+
+内置Elo,Glicko-2和TrueSkill三种算法,在结算时调用Settler.Settle
+名次从1开始,数值越小越靠前,名次相同表示平局
+*/
+package rating
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/**
+玩家的排位分,不同算法使用的字段不同
+Elo只使用Rating;Glicko-2使用Rating,Deviation和Volatility;TrueSkill中Rating为mu,Deviation为sigma
+*/
+type Player struct {
+	Id         string
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+	Games      int
+}
+
+func (p *Player) clone() *Player {
+	c := *p
+	return &c
+}
+
+/**
+排位分算法
+Rate不修改传入的players,返回与players顺序一致的新分数
+*/
+type Rater interface {
+	Name() string
+	Initial(id string) *Player
+	Rate(players []*Player, ranks []int) []*Player
+	//用于排行榜展示的分数,例如TrueSkill使用mu-3*sigma
+	Display(player *Player) float64
+}
+
+/**
+排位分持久化,由游戏实现
+*/
+type Store interface {
+	//不存在的玩家不需要返回
+	Load(rater string, ids []string) (map[string]*Player, error)
+	Save(rater string, players []*Player) error
+}
+
+/**
+结算后的分数变化
+*/
+type Change struct {
+	Before *Player
+	After  *Player
+}
+
+func (c *Change) Delta() float64 {
+	return c.After.Rating - c.Before.Rating
+}
+
+/**
+结算流程:读取分数,计算,保存,通知
+*/
+type Settler struct {
+	Rater   Rater
+	Store   Store
+	OnRated func(changes map[string]*Change) //保存成功后调用,例如推送给客户端
+}
+
+/**
+ranks为userId->名次
+*/
+func (self *Settler) Settle(ranks map[string]int) (map[string]*Change, error) {
+	if len(ranks) < 2 {
+		return nil, fmt.Errorf("rating needs at least 2 players, got %d", len(ranks))
+	}
+	ids := make([]string, 0, len(ranks))
+	for id := range ranks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	loaded, err := self.Store.Load(self.Rater.Name(), ids)
+	if err != nil {
+		return nil, err
+	}
+	players := make([]*Player, len(ids))
+	order := make([]int, len(ids))
+	for i, id := range ids {
+		if player, ok := loaded[id]; ok {
+			players[i] = player
+		} else {
+			players[i] = self.Rater.Initial(id)
+		}
+		order[i] = ranks[id]
+	}
+	rated := self.Rater.Rate(players, order)
+	for _, player := range rated {
+		player.Games++
+	}
+	if err := self.Store.Save(self.Rater.Name(), rated); err != nil {
+		return nil, err
+	}
+	changes := make(map[string]*Change, len(ids))
+	for i, id := range ids {
+		changes[id] = &Change{Before: players[i], After: rated[i]}
+	}
+	if self.OnRated != nil {
+		self.OnRated(changes)
+	}
+	return changes, nil
+}
+
+/**
+a相对b的比赛结果,1胜0.5平0负
+*/
+func score(a int, b int) float64 {
+	if a < b {
+		return 1
+	}
+	if a == b {
+		return 0.5
+	}
+	return 0
+}
+
+/**
+基于内存的Store,主要用于测试
+*/
+type MemoryStore struct {
+	lock    sync.Mutex
+	players map[string]map[string]*Player
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		players: map[string]map[string]*Player{},
+	}
+}
+
+func (self *MemoryStore) Load(rater string, ids []string) (map[string]*Player, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	result := map[string]*Player{}
+	for _, id := range ids {
+		if player, ok := self.players[rater][id]; ok {
+			result[id] = player.clone()
+		}
+	}
+	return result, nil
+}
+
+func (self *MemoryStore) Save(rater string, players []*Player) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.players[rater] == nil {
+		self.players[rater] = map[string]*Player{}
+	}
+	for _, player := range players {
+		self.players[rater][player.Id] = player.clone()
+	}
+	return nil
+}
+
+/**
+赛季软重置,分数向初始分回归,keep为保留的比例(0~1)
+不确定度向初始值回升,新赛季初期分数变化更快
+*/
+func SoftReset(player *Player, initial *Player, keep float64) *Player {
+	reset := player.clone()
+	reset.Rating = initial.Rating + (player.Rating-initial.Rating)*keep
+	if initial.Deviation > 0 {
+		reset.Deviation = initial.Deviation + (player.Deviation-initial.Deviation)*keep
+	}
+	if initial.Volatility > 0 {
+		reset.Volatility = initial.Volatility
+	}
+	reset.Games = 0
+	return reset
+}
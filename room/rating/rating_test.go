@@ -0,0 +1,102 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rating
+
+import (
+	"github.com/liangdas/mqant-modules/room"
+	"math"
+	"testing"
+	"time"
+)
+
+func near(t *testing.T, name string, got float64, want float64, tolerance float64) {
+	if math.Abs(got-want) > tolerance {
+		t.Errorf("%v: got %v want %v", name, got, want)
+	}
+}
+
+func TestGlicko2(t *testing.T) {
+	//Glickman论文中的示例
+	g := &Glicko2{}
+	players := []*Player{
+		{Id: "p", Rating: 1500, Deviation: 200, Volatility: 0.06},
+		{Id: "a", Rating: 1400, Deviation: 30, Volatility: 0.06},
+		{Id: "b", Rating: 1550, Deviation: 100, Volatility: 0.06},
+		{Id: "c", Rating: 1700, Deviation: 300, Volatility: 0.06},
+	}
+	rated := g.Rate(players, []int{2, 3, 1, 1})
+	near(t, "rating", rated[0].Rating, 1464.06, 0.01)
+	near(t, "deviation", rated[0].Deviation, 151.52, 0.01)
+	near(t, "volatility", rated[0].Volatility, 0.05999, 0.00001)
+}
+
+func TestTrueSkill(t *testing.T) {
+	ts := &TrueSkill{}
+	rated := ts.Rate([]*Player{ts.Initial("w"), ts.Initial("l")}, []int{1, 2})
+	near(t, "winner mu", rated[0].Rating, 29.396, 0.001)
+	near(t, "winner sigma", rated[0].Deviation, 7.171, 0.001)
+	near(t, "loser mu", rated[1].Rating, 20.604, 0.001)
+}
+
+func TestSettle(t *testing.T) {
+	store := NewMemoryStore()
+	settler := &Settler{Rater: &Elo{}, Store: store}
+	changes, err := settler.Settle(map[string]int{"u1": 1, "u2": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	near(t, "winner", changes["u1"].Delta(), 16, 0.0001)
+	near(t, "loser", changes["u2"].Delta(), -16, 0.0001)
+
+	changes, _ = settler.Settle(map[string]int{"u1": 1, "u2": 2})
+	if changes["u1"].Before.Rating != 1516 || changes["u1"].After.Games != 2 {
+		t.Errorf("stored rating not reused: %+v", changes["u1"].Before)
+	}
+}
+
+func TestSubscriber(t *testing.T) {
+	bus := room.NewEventBus()
+	store := NewMemoryStore()
+	subscriber := NewSubscriber(bus, &Settler{Rater: &Elo{}, Store: store}, "poker", 16)
+	defer subscriber.Close()
+	bus.Publish(&room.RoomEvent{Type: room.EventTableSettled, TableId: "t0", GameType: "mahjong", Data: []*room.PlayerResult{
+		{UserId: "u1", Rank: 2},
+		{UserId: "u2", Rank: 1},
+	}})
+	bus.Publish(&room.RoomEvent{Type: room.EventTableSettled, TableId: "t1", GameType: "poker", Data: []*room.PlayerResult{
+		{UserId: "u1", Rank: 1},
+		{UserId: "u2", Rank: 2},
+		{UserId: "u3", Rank: 0},
+	}})
+
+	deadline := time.Now().Add(time.Second)
+	var players map[string]*Player
+	for time.Now().Before(deadline) {
+		players, _ = store.Load("elo", []string{"u1", "u2", "u3"})
+		if len(players) > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(players) != 2 || players["u1"].Games != 1 {
+		t.Fatalf("unexpected ratings %+v", players)
+	}
+	near(t, "winner", players["u1"].Rating, 1516, 0.0001)
+}
+
+func TestEloSinglePlayer(t *testing.T) {
+	e := &Elo{}
+	rated := e.Rate([]*Player{e.Initial("u1")}, []int{1})
+	near(t, "single", rated[0].Rating, e.Initial("u1").Rating, 0)
+}
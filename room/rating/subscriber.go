@@ -0,0 +1,110 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rating
+
+import (
+	"encoding/json"
+	"github.com/liangdas/mqant-modules/room"
+	"github.com/liangdas/mqant/log"
+)
+
+/**
+订阅Room的结算事件,按名次结算排位分
+结算在独立的协成中完成,不会阻塞table
+*/
+type Subscriber struct {
+	settler  *Settler
+	gameType string
+	pending  chan *room.RoomEvent
+	closed   chan bool
+	cancel   func()
+}
+
+/**
+gameType为空时结算所有游戏类型,否则只结算该游戏类型
+capacity为待结算的事件数量,满了之后丢弃
+*/
+func NewSubscriber(bus *room.EventBus, settler *Settler, gameType string, capacity int) *Subscriber {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+	subscriber := &Subscriber{
+		settler:  settler,
+		gameType: gameType,
+		pending:  make(chan *room.RoomEvent, capacity),
+		closed:   make(chan bool),
+	}
+	subscriber.cancel = bus.Subscribe(subscriber.onEvent)
+	go subscriber.run()
+	return subscriber
+}
+
+func (self *Subscriber) onEvent(event *room.RoomEvent) {
+	//其他节点的结算由其他节点结算
+	if event.Type != room.EventTableSettled || event.Node != "" {
+		return
+	}
+	if self.gameType != "" && event.GameType != self.gameType {
+		return
+	}
+	select {
+	case self.pending <- event:
+	default:
+		log.Warning("rating queue full, drop settlement of table %v", event.TableId)
+	}
+}
+
+func (self *Subscriber) run() {
+	for {
+		select {
+		case <-self.closed:
+			return
+		case event := <-self.pending:
+			self.settle(event)
+		}
+	}
+}
+
+func (self *Subscriber) settle(event *room.RoomEvent) {
+	results, ok := event.Data.([]*room.PlayerResult)
+	if !ok {
+		data, err := json.Marshal(event.Data)
+		if err != nil || json.Unmarshal(data, &results) != nil {
+			log.Warning("rating unknown settlement data of table %v", event.TableId)
+			return
+		}
+	}
+	ranks := map[string]int{}
+	for _, result := range results {
+		//不排名的玩家(例如中途离开的观战者)不参与结算
+		if result == nil || result.UserId == "" || result.Rank <= 0 {
+			continue
+		}
+		ranks[result.UserId] = result.Rank
+	}
+	if len(ranks) < 2 {
+		return
+	}
+	if _, err := self.settler.Settle(ranks); err != nil {
+		log.Error("rating settle table %v error %v", event.TableId, err)
+	}
+}
+
+/**
+取消订阅,未结算的事件会被丢弃
+*/
+func (self *Subscriber) Close() {
+	self.cancel()
+	close(self.closed)
+}
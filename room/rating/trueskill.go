@@ -0,0 +1,149 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rating
+
+import (
+	"math"
+	"sort"
+)
+
+/**
+TrueSkill,单人自由混战
+多人对局按名次相邻的两两对局近似计算,不包含组队的因子图
+*/
+type TrueSkill struct {
+	Mu              float64 //初始mu,默认25
+	Sigma           float64 //初始sigma,默认Mu/3
+	Beta            float64 //表现波动,默认Sigma/2
+	Tau             float64 //每局增加的不确定度,默认Sigma/100
+	DrawProbability float64 //平局概率,默认0.1
+}
+
+func (t *TrueSkill) params() (mu, sigma, beta, tau, draw float64) {
+	mu, sigma, beta, tau, draw = t.Mu, t.Sigma, t.Beta, t.Tau, t.DrawProbability
+	if mu == 0 {
+		mu = 25
+	}
+	if sigma == 0 {
+		sigma = mu / 3
+	}
+	if beta == 0 {
+		beta = sigma / 2
+	}
+	if tau == 0 {
+		tau = sigma / 100
+	}
+	if draw == 0 {
+		draw = 0.1
+	}
+	return
+}
+
+func (t *TrueSkill) Name() string {
+	return "trueskill"
+}
+
+func (t *TrueSkill) Initial(id string) *Player {
+	mu, sigma, _, _, _ := t.params()
+	return &Player{Id: id, Rating: mu, Deviation: sigma}
+}
+
+func normPdf(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+func normCdf(x float64) float64 {
+	return math.Erfc(-x/math.Sqrt2) / 2
+}
+
+func normPpf(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
+
+/**
+胜负时的均值和方差修正系数
+*/
+func vwWin(t float64, e float64) (float64, float64) {
+	denom := normCdf(t - e)
+	if denom < 1e-300 {
+		return -t + e, 1
+	}
+	v := normPdf(t-e) / denom
+	return v, v * (v + t - e)
+}
+
+/**
+平局时的修正系数
+*/
+func vwDraw(t float64, e float64) (float64, float64) {
+	denom := normCdf(e-t) - normCdf(-e-t)
+	if denom < 1e-300 {
+		if t < 0 {
+			return -t - e, 1
+		}
+		return -t + e, 1
+	}
+	v := (normPdf(-e-t) - normPdf(e-t)) / denom
+	w := v*v + ((e-t)*normPdf(e-t)+(e+t)*normPdf(e+t))/denom
+	return v, w
+}
+
+func (t *TrueSkill) Rate(players []*Player, ranks []int) []*Player {
+	_, _, beta, tau, draw := t.params()
+	n := len(players)
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return ranks[order[a]] < ranks[order[b]]
+	})
+	margin := normPpf((draw+1)/2) * math.Sqrt2 * beta
+	sigma2 := make([]float64, n)
+	for i, player := range players {
+		sigma2[i] = player.Deviation*player.Deviation + tau*tau
+	}
+	deltaMu := make([]float64, n)
+	factor := make([]float64, n)
+	for i := range factor {
+		factor[i] = 1
+	}
+	for k := 0; k+1 < n; k++ {
+		w, l := order[k], order[k+1]
+		c2 := 2*beta*beta + sigma2[w] + sigma2[l]
+		c := math.Sqrt(c2)
+		diff := (players[w].Rating - players[l].Rating) / c
+		var v, ww float64
+		if ranks[w] == ranks[l] {
+			v, ww = vwDraw(diff, margin/c)
+		} else {
+			v, ww = vwWin(diff, margin/c)
+		}
+		deltaMu[w] += sigma2[w] / c * v
+		deltaMu[l] -= sigma2[l] / c * v
+		factor[w] *= 1 - sigma2[w]/c2*ww
+		factor[l] *= 1 - sigma2[l]/c2*ww
+	}
+	rated := make([]*Player, n)
+	for i, player := range players {
+		rated[i] = player.clone()
+		rated[i].Rating += deltaMu[i]
+		rated[i].Deviation = math.Sqrt(sigma2[i] * math.Max(factor[i], 1e-4))
+	}
+	return rated
+}
+
+func (t *TrueSkill) Display(player *Player) float64 {
+	return player.Rating - 3*player.Deviation
+}
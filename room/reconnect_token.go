@@ -0,0 +1,152 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/liangdas/mqant/gate"
+	"strings"
+	"time"
+)
+
+//JoinTable返回数据中重连凭证的key
+const ReconnectTokenKey = "ReconnectToken"
+
+/**
+重连凭证中携带的信息
+*/
+type ReconnectClaims struct {
+	UserId  string
+	TableId string
+	Expire  int64 //过期时间,unix秒
+}
+
+/**
+签发和校验短期有效的重连凭证(HMAC-SHA256)
+凭证格式: base64(claims).base64(signature)
+*/
+type ReconnectTokenIssuer struct {
+	secret []byte
+	ttl    time.Duration
+	clock  Clock
+}
+
+func NewReconnectTokenIssuer(secret []byte, ttl time.Duration) *ReconnectTokenIssuer {
+	return &ReconnectTokenIssuer{
+		secret: secret,
+		ttl:    ttl,
+		clock:  RealClock,
+	}
+}
+
+/**
+计算有效期使用的时钟,默认RealClock,只能在使用前设置
+*/
+func (self *ReconnectTokenIssuer) SetClock(clock Clock) {
+	self.clock = clock
+}
+
+func (self *ReconnectTokenIssuer) Issue(userId string, tableId string) (string, error) {
+	if userId == "" {
+		return "", NewError(ErrCodeTokenInvalid)
+	}
+	claims, err := json.Marshal(&ReconnectClaims{
+		UserId:  userId,
+		TableId: tableId,
+		Expire:  self.clock.Now().Add(self.ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(self.sign(payload)), nil
+}
+
+/**
+校验签名和有效期,失败返回ErrCodeTokenInvalid
+*/
+func (self *ReconnectTokenIssuer) Verify(token string) (*ReconnectClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, NewError(ErrCodeTokenInvalid)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, self.sign(parts[0])) {
+		return nil, NewError(ErrCodeTokenInvalid)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, NewError(ErrCodeTokenInvalid)
+	}
+	claims := &ReconnectClaims{}
+	if err := json.Unmarshal(data, claims); err != nil || claims.UserId == "" {
+		return nil, NewError(ErrCodeTokenInvalid)
+	}
+	if self.clock.Now().Unix() > claims.Expire {
+		return nil, NewError(ErrCodeTokenInvalid)
+	}
+	return claims, nil
+}
+
+func (self *ReconnectTokenIssuer) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, self.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+/**
+玩家入座(Bind)后调用,签发重连凭证并记录玩家所在的table
+凭证应随入座结果一起下发给客户端,JoinTable成功后会自动签发
+游客没有固定的userId,不能签发
+*/
+func (self *Room) IssueReconnectToken(tableId string, session gate.Session) (string, error) {
+	if self.opts.ReconnectTokens == nil || session.IsGuest() {
+		return "", NewError(ErrCodeTokenInvalid)
+	}
+	if err := self.opts.Locator.Bind(session.GetUserId(), tableId); err != nil {
+		return "", err
+	}
+	return self.opts.ReconnectTokens.Issue(session.GetUserId(), tableId)
+}
+
+/**
+网关用客户端保存的凭证重连,校验通过后直接在table协成中把新session绑定到原来的座位
+不经过Locator查询,也不再执行入座检查
+玩家已经离开或座位已被占用时返回ErrCodeNotSeated
+*/
+func (self *Room) RejoinWithToken(session gate.Session, token string) (*RejoinInfo, error) {
+	if self.opts.ReconnectTokens == nil || session.IsGuest() {
+		return nil, NewError(ErrCodeTokenInvalid)
+	}
+	claims, err := self.opts.ReconnectTokens.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserId != session.GetUserId() {
+		return nil, NewError(ErrCodeTokenInvalid)
+	}
+	value, ok := self.tables.Load(claims.TableId)
+	if !ok || !value.(BaseTable).Runing() {
+		return nil, NewError(ErrCodeTableNotFound)
+	}
+	info, err := self.rejoinTable(value.(BaseTable), claims.TableId, session)
+	if err != nil {
+		return nil, err
+	}
+	self.opts.Locator.Bind(session.GetUserId(), claims.TableId)
+	return info, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/gate"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReconnectToken(t *testing.T) {
+	issuer := NewReconnectTokenIssuer([]byte("secret"), time.Minute)
+	token, err := issuer.Issue("u1", "t1")
+	assertEqual(t, err, nil)
+	claims, err := issuer.Verify(token)
+	assertEqual(t, err, nil)
+	assertEqual(t, claims.UserId, "u1")
+	assertEqual(t, claims.TableId, "t1")
+
+	//篡改内容或签名
+	parts := strings.Split(token, ".")
+	forged, _ := NewReconnectTokenIssuer([]byte("other"), time.Minute).Issue("u2", "t1")
+	_, err = issuer.Verify(strings.Split(forged, ".")[0] + "." + parts[1])
+	assertEqual(t, ErrorCode(err), ErrCodeTokenInvalid)
+	_, err = issuer.Verify(forged)
+	assertEqual(t, ErrorCode(err), ErrCodeTokenInvalid)
+	_, err = issuer.Verify(parts[0])
+	assertEqual(t, ErrorCode(err), ErrCodeTokenInvalid)
+
+	expired, _ := NewReconnectTokenIssuer([]byte("secret"), -2*time.Second).Issue("u1", "t1")
+	_, err = issuer.Verify(expired)
+	assertEqual(t, ErrorCode(err), ErrCodeTokenInvalid)
+
+	//有效期按注入的时钟计算
+	clock := NewSimulatedClock(time.Now())
+	issuer.SetClock(clock)
+	token, _ = issuer.Issue("u1", "t1")
+	clock.Advance(59 * time.Second)
+	_, err = issuer.Verify(token)
+	assertEqual(t, err, nil)
+	clock.Advance(2 * time.Second)
+	_, err = issuer.Verify(token)
+	assertEqual(t, ErrorCode(err), ErrCodeTokenInvalid)
+
+	//游客不能签发
+	_, err = issuer.Issue("", "t1")
+	assertEqual(t, ErrorCode(err), ErrCodeTokenInvalid)
+}
+
+func TestRejoinWithToken(t *testing.T) {
+	room := NewRoom(nil, ReconnectTokens(NewReconnectTokenIssuer([]byte("secret"), time.Minute)))
+	table, err := room.CreateById(nil, "t1", newBenchTable)
+	assertEqual(t, err, nil)
+	bench := table.(*benchTable)
+	bench.RegisterRPC(JoinRPCFunc, func(session gate.Session, params map[string]interface{}) (map[string]interface{}, error) {
+		player := &BasePlayerImp{}
+		player.Bind(session)
+		bench.seats["joined"] = player
+		return nil, nil
+	})
+	table.Run()
+
+	//加入成功后自动签发凭证
+	var data map[string]interface{}
+	pumpTable(table, func() { data, err = room.JoinTable(NewNullSession("u1"), "t1", nil) })
+	assertEqual(t, err, nil)
+	token := data[ReconnectTokenKey].(string)
+
+	var info *RejoinInfo
+	pumpTable(table, func() { info, err = room.RejoinWithToken(NewNullSession("u1"), token) })
+	assertEqual(t, err, nil)
+	assertEqual(t, info.TableId, "t1")
+
+	_, err = room.RejoinWithToken(NewNullSession("u2"), token)
+	assertEqual(t, ErrorCode(err), ErrCodeTokenInvalid)
+	_, err = room.RejoinWithToken(NewNullSession(""), token)
+	assertEqual(t, ErrorCode(err), ErrCodeTokenInvalid)
+	_, err = room.IssueReconnectToken("t1", NewNullSession(""))
+	assertEqual(t, ErrorCode(err), ErrCodeTokenInvalid)
+
+	//离开后座位被其他玩家占用
+	bench.seats["joined"] = &BasePlayerImp{}
+	bench.seats["joined"].Bind(NewNullSession("u3"))
+	pumpTable(table, func() { info, err = room.RejoinWithToken(NewNullSession("u1"), token) })
+	assertEqual(t, ErrorCode(err), ErrCodeNotSeated)
+}
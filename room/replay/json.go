@@ -0,0 +1,90 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+/**
+JSON中的单条记录,Kind为event或snapshot
+Data是合法JSON时原样嵌入,否则为base64字符串
+*/
+type JSONRecord struct {
+	Kind string          `json:"kind"`
+	Seq  int64           `json:"seq"`
+	Time int64           `json:"time,omitempty"`
+	Type string          `json:"type,omitempty"`
+	Data json.RawMessage `json:"data"`
+}
+
+func jsonData(data []byte) json.RawMessage {
+	if len(data) > 0 && json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	encoded, _ := json.Marshal(data)
+	return json.RawMessage(encoded)
+}
+
+/**
+把回放文件转换为JSON
+	{"header":{...},"records":[{...},...]}
+逐条转换,不会把整个文件读入内存
+*/
+func ToJSON(r io.Reader, w io.Writer) error {
+	reader, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(w)
+	header, err := json.Marshal(reader.Header())
+	if err != nil {
+		return err
+	}
+	out.WriteString(`{"header":`)
+	out.Write(header)
+	out.WriteString(`,"records":[`)
+	for i := 0; ; i++ {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		j := &JSONRecord{Seq: record.Seq()}
+		if record.Event != nil {
+			j.Kind = "event"
+			j.Time = record.Event.Time
+			j.Type = record.Event.Type
+			j.Data = jsonData(record.Event.Data)
+		} else {
+			j.Kind = "snapshot"
+			j.Data = jsonData(record.Snapshot.Data)
+		}
+		data, err := json.Marshal(j)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n")
+		out.Write(data)
+	}
+	out.WriteString("\n]}\n")
+	return out.Flush()
+}
@@ -0,0 +1,285 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/**
+回放文件格式
+
+	magic    8字节 "MQREPLAY"
+	version  2字节 大端
+	record*  [类型 1字节][长度 uvarint][内容]
+
+第一条记录必须是头部('H',JSON),之后按Seq顺序排列事件('E')和快照('S')
+事件内容为 seq(uvarint) time(varint) type长度(uvarint) type data
+快照内容为 seq(uvarint) data
+新版本只能增加记录类型,读取时跳过不认识的记录
+*/
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/liangdas/mqant-modules/room"
+	"io"
+	"sort"
+)
+
+const (
+	Magic   = "MQREPLAY"
+	Version = 1
+)
+
+//记录类型
+const (
+	RecordHeader   = 'H'
+	RecordEvent    = 'E'
+	RecordSnapshot = 'S'
+)
+
+//单条记录的最大长度,防止读取损坏的文件时分配过多内存
+const maxRecordSize = 64 << 20
+
+type Header struct {
+	Version  int
+	TableId  string
+	GameType string
+	Seed     int64 //游戏随机数种子,回放时用相同的种子得到相同的结果
+	Created  int64 //单位毫秒
+	Meta     map[string]string
+}
+
+/**
+Event和Snapshot只有一个不为nil
+*/
+type Record struct {
+	Event    *room.TableEvent
+	Snapshot *room.TableSnapshot
+}
+
+func (r *Record) Seq() int64 {
+	if r.Event != nil {
+		return r.Event.Seq
+	}
+	return r.Snapshot.Seq
+}
+
+type Writer struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+/**
+写入文件头,返回的Writer使用完后必须调用Flush
+*/
+func NewWriter(w io.Writer, header *Header) (*Writer, error) {
+	writer := &Writer{w: bufio.NewWriter(w)}
+	writer.w.WriteString(Magic)
+	version := make([]byte, 2)
+	binary.BigEndian.PutUint16(version, Version)
+	writer.w.Write(version)
+	h := *header
+	h.Version = Version
+	data, err := json.Marshal(&h)
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.writeRecord(RecordHeader, data); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (self *Writer) writeRecord(kind byte, payload []byte) error {
+	self.buf = self.buf[:0]
+	self.buf = append(self.buf, kind)
+	self.buf = appendUvarint(self.buf, uint64(len(payload)))
+	if _, err := self.w.Write(self.buf); err != nil {
+		return err
+	}
+	_, err := self.w.Write(payload)
+	return err
+}
+
+func (self *Writer) WriteEvent(event *room.TableEvent) error {
+	payload := appendUvarint(nil, uint64(event.Seq))
+	payload = appendVarint(payload, event.Time)
+	payload = appendUvarint(payload, uint64(len(event.Type)))
+	payload = append(payload, event.Type...)
+	payload = append(payload, event.Data...)
+	return self.writeRecord(RecordEvent, payload)
+}
+
+func (self *Writer) WriteSnapshot(snapshot *room.TableSnapshot) error {
+	payload := appendUvarint(nil, uint64(snapshot.Seq))
+	payload = append(payload, snapshot.Data...)
+	return self.writeRecord(RecordSnapshot, payload)
+}
+
+func (self *Writer) Flush() error {
+	return self.w.Flush()
+}
+
+/**
+导出事件溯源table内存中的事件和快照,快照排在同一Seq的事件之后
+只能在table协成中调用
+*/
+func WriteTable(w io.Writer, header *Header, table *room.EventSourcedTable) error {
+	writer, err := NewWriter(w, header)
+	if err != nil {
+		return err
+	}
+	records := []*Record{}
+	for _, snapshot := range table.Snapshots() {
+		records = append(records, &Record{Snapshot: snapshot})
+	}
+	for _, event := range table.Events(0) {
+		records = append(records, &Record{Event: event})
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Seq() != records[j].Seq() {
+			return records[i].Seq() < records[j].Seq()
+		}
+		return records[i].Event != nil && records[j].Snapshot != nil
+	})
+	for _, record := range records {
+		if record.Event != nil {
+			err = writer.WriteEvent(record.Event)
+		} else {
+			err = writer.WriteSnapshot(record.Snapshot)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+type Reader struct {
+	r      *bufio.Reader
+	header *Header
+}
+
+/**
+读取并检查文件头
+*/
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{r: bufio.NewReader(r)}
+	prefix := make([]byte, len(Magic)+2)
+	if _, err := io.ReadFull(reader.r, prefix); err != nil {
+		return nil, fmt.Errorf("read replay header: %v", err)
+	}
+	if string(prefix[:len(Magic)]) != Magic {
+		return nil, fmt.Errorf("not a replay file")
+	}
+	if version := binary.BigEndian.Uint16(prefix[len(Magic):]); version > Version {
+		return nil, fmt.Errorf("unsupported replay version %v", version)
+	}
+	kind, payload, err := reader.readRecord()
+	if err != nil {
+		return nil, err
+	}
+	if kind != RecordHeader {
+		return nil, fmt.Errorf("replay header record missing")
+	}
+	reader.header = &Header{}
+	if err := json.Unmarshal(payload, reader.header); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (self *Reader) Header() *Header {
+	return self.header
+}
+
+func (self *Reader) readRecord() (byte, []byte, error) {
+	kind, err := self.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	size, err := binary.ReadUvarint(self.r)
+	if err != nil {
+		return 0, nil, unexpected(err)
+	}
+	if size > maxRecordSize {
+		return 0, nil, fmt.Errorf("replay record too large: %v", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(self.r, payload); err != nil {
+		return 0, nil, unexpected(err)
+	}
+	return kind, payload, nil
+}
+
+/**
+读取下一条事件或快照,文件结束时返回io.EOF
+*/
+func (self *Reader) Next() (*Record, error) {
+	for {
+		kind, payload, err := self.readRecord()
+		if err != nil {
+			return nil, err
+		}
+		r := bytes.NewReader(payload)
+		switch kind {
+		case RecordEvent:
+			event := &room.TableEvent{}
+			seq, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, unexpected(err)
+			}
+			event.Seq = int64(seq)
+			if event.Time, err = binary.ReadVarint(r); err != nil {
+				return nil, unexpected(err)
+			}
+			size, err := binary.ReadUvarint(r)
+			if err != nil || size > uint64(r.Len()) {
+				return nil, fmt.Errorf("replay event %v corrupted", event.Seq)
+			}
+			rest := payload[len(payload)-r.Len():]
+			event.Type = string(rest[:size])
+			event.Data = rest[size:]
+			return &Record{Event: event}, nil
+		case RecordSnapshot:
+			seq, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, unexpected(err)
+			}
+			return &Record{Snapshot: &room.TableSnapshot{
+				Seq:  int64(seq),
+				Data: payload[len(payload)-r.Len():],
+			}}, nil
+		}
+		//更新版本增加的记录类型
+	}
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	return append(buf, tmp[:binary.PutUvarint(tmp, v)]...)
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	return append(buf, tmp[:binary.PutVarint(tmp, v)]...)
+}
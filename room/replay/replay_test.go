@@ -0,0 +1,84 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/liangdas/mqant-modules/room"
+	"io"
+	"testing"
+)
+
+func TestReplayRoundTrip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &Header{TableId: "t1", GameType: "poker", Seed: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteSnapshot(&room.TableSnapshot{Seq: 0, Data: []byte(`{"pot":0}`)})
+	w.WriteEvent(&room.TableEvent{Seq: 1, Type: "bet", Time: 1000, Data: []byte(`{"amount":10}`)})
+	w.WriteEvent(&room.TableEvent{Seq: 2, Type: "fold", Time: 1001, Data: []byte{0xff}})
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Header().Seed != 42 || r.Header().Version != Version {
+		t.Fatalf("unexpected header %+v", r.Header())
+	}
+	records := []*Record{}
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 || records[1].Event.Type != "bet" || string(records[1].Event.Data) != `{"amount":10}` {
+		t.Fatalf("unexpected records %+v", records)
+	}
+
+	out := &bytes.Buffer{}
+	if err := ToJSON(bytes.NewReader(data), out); err != nil {
+		t.Fatal(err)
+	}
+	doc := struct {
+		Header  Header
+		Records []JSONRecord
+	}{}
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Header.TableId != "t1" || len(doc.Records) != 3 || string(doc.Records[2].Data) != `"/w=="` {
+		t.Fatalf("unexpected json %v", out.String())
+	}
+
+	truncated, err := NewReader(bytes.NewReader(data[:len(data)-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated.Next()
+	truncated.Next()
+	if _, err := truncated.Next(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected ErrUnexpectedEOF, got %v", err)
+	}
+}
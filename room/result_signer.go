@@ -0,0 +1,116 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/crypto/ed25519"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+带签名的结算记录,下游计费系统用节点公钥校验结果未被篡改
+*/
+type SignedResult struct {
+	TableId   string
+	Time      int64 //签名时间,单位毫秒
+	Result    json.RawMessage
+	KeyId     string //签名节点的密钥标识
+	Signature string //base64编码的ed25519签名
+}
+
+/**
+签名内容: TableId \n Time \n Result
+*/
+func (r *SignedResult) signingBytes() []byte {
+	return []byte(r.TableId + "\n" + strconv.FormatInt(r.Time, 10) + "\n" + string(r.Result))
+}
+
+/**
+节点的结算签名器
+*/
+type ResultSigner struct {
+	keyId      string
+	privateKey ed25519.PrivateKey
+}
+
+/**
+seed为32字节的ed25519私钥种子
+*/
+func NewResultSigner(keyId string, seed []byte) (*ResultSigner, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("ed25519 seed must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	return &ResultSigner{
+		keyId:      keyId,
+		privateKey: ed25519.NewKeyFromSeed(seed),
+	}, nil
+}
+
+/**
+从文件加载base64编码的私钥种子
+*/
+func LoadResultSigner(keyId string, path string) (*ResultSigner, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	return NewResultSigner(keyId, seed)
+}
+
+func (self *ResultSigner) KeyId() string {
+	return self.keyId
+}
+
+func (self *ResultSigner) PublicKey() ed25519.PublicKey {
+	return self.privateKey.Public().(ed25519.PublicKey)
+}
+
+/**
+把结算结果序列化为JSON并签名
+*/
+func (self *ResultSigner) Sign(tableId string, result interface{}) (*SignedResult, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	signed := &SignedResult{
+		TableId: tableId,
+		Time:    time.Now().UnixNano() / int64(time.Millisecond),
+		Result:  data,
+		KeyId:   self.keyId,
+	}
+	signed.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(self.privateKey, signed.signingBytes()))
+	return signed, nil
+}
+
+/**
+用节点公钥校验签名
+*/
+func VerifyResult(publicKey ed25519.PublicKey, result *SignedResult) bool {
+	signature, err := base64.StdEncoding.DecodeString(result.Signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(publicKey, result.signingBytes(), signature)
+}
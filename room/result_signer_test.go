@@ -0,0 +1,40 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestResultSigner(t *testing.T) {
+	signer, err := NewResultSigner("node-1", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := signer.Sign("table-1", map[string]int{"u1": 100, "u2": -100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, signed.KeyId, "node-1")
+	assertEqual(t, VerifyResult(signer.PublicKey(), signed), true)
+
+	tampered := *signed
+	tampered.Result = []byte(`{"u1":200,"u2":-100}`)
+	assertEqual(t, VerifyResult(signer.PublicKey(), &tampered), false)
+
+	if _, err := NewResultSigner("node-1", []byte("short")); err == nil {
+		t.Fatal("expected error for short seed")
+	}
+}
@@ -0,0 +1,130 @@
+package room
+
+import (
+	"time"
+)
+
+func newRoomOptions(opts ...RoomOption) RoomOptions {
+	opt := RoomOptions{
+		BroadcastBurst:    5,
+		BroadcastInterval: time.Second,
+		Locator:           NewMemoryTableLocator(),
+		Registry:          DefaultRegistry(),
+		RPCTimeout:        5 * time.Second,
+		SpectatorBurst:    3,
+		SpectatorInterval: 5 * time.Second,
+		Clock:             RealClock,
+	}
+	opt.TableIds, _ = NewTableIdGenerator(0)
+
+	for _, o := range opts {
+		o(&opt)
+	}
+	return opt
+}
+
+type RoomOption func(*RoomOptions)
+
+type RoomOptions struct {
+	BroadcastBurst    int                   //全服广播允许的突发数量
+	BroadcastInterval time.Duration         //全服广播令牌恢复间隔
+	Locator           TableLocator          //玩家所在table的索引,默认只在本进程内有效
+	Router            Route                 //不在本节点的table的路由,多节点共享Locator时设置
+	Registry          *TableRegistry        //游戏类型注册表,默认DefaultRegistry()
+	ReconnectTokens   *ReconnectTokenIssuer //重连凭证签发器,为空时不支持凭证重连
+	Watchdog          *LifecycleWatchdog    //table生命周期检查,为空时不检查
+	RPCTimeout        time.Duration         //RPC接口等待table处理的最长时间
+	MemoryGuard       *MemoryGuard          //进程内存保护,为空时不检查
+	TableIds          *TableIdGenerator     //NewTableId使用的生成器,默认节点号为0
+	LoadShedding      *LoadShedding         //过载时按游戏优先级削减负载,为空时不检查
+	SpectatorAuth     SpectatorAuth         //观战聊天的身份认证,为空时不允许观战聊天
+	SpectatorBurst    int                   //每个观战者允许连续发送的聊天数量
+	SpectatorInterval time.Duration         //观战聊天令牌恢复间隔
+	Clock             Clock                 //RPC等待超时和事件时间使用的时钟,默认RealClock
+}
+
+/**
+全服广播限流,最多连续发送burst条,之后每interval恢复一条
+*/
+func BroadcastRate(burst int, interval time.Duration) RoomOption {
+	return func(o *RoomOptions) {
+		o.BroadcastBurst = burst
+		o.BroadcastInterval = interval
+	}
+}
+
+func Locator(v TableLocator) RoomOption {
+	return func(o *RoomOptions) {
+		o.Locator = v
+	}
+}
+
+func RoomRouter(v Route) RoomOption {
+	return func(o *RoomOptions) {
+		o.Router = v
+	}
+}
+
+func Registry(v *TableRegistry) RoomOption {
+	return func(o *RoomOptions) {
+		o.Registry = v
+	}
+}
+
+func ReconnectTokens(v *ReconnectTokenIssuer) RoomOption {
+	return func(o *RoomOptions) {
+		o.ReconnectTokens = v
+	}
+}
+
+func Watchdog(v *LifecycleWatchdog) RoomOption {
+	return func(o *RoomOptions) {
+		o.Watchdog = v
+	}
+}
+
+func RPCTimeout(v time.Duration) RoomOption {
+	return func(o *RoomOptions) {
+		o.RPCTimeout = v
+	}
+}
+
+func SetMemoryGuard(v *MemoryGuard) RoomOption {
+	return func(o *RoomOptions) {
+		o.MemoryGuard = v
+	}
+}
+
+func TableIds(v *TableIdGenerator) RoomOption {
+	return func(o *RoomOptions) {
+		o.TableIds = v
+	}
+}
+
+func SetSpectatorAuth(v SpectatorAuth) RoomOption {
+	return func(o *RoomOptions) {
+		o.SpectatorAuth = v
+	}
+}
+
+/**
+观战聊天按观战者限流,最多连续发送burst条,之后每interval恢复一条
+*/
+func SpectatorChatRate(burst int, interval time.Duration) RoomOption {
+	return func(o *RoomOptions) {
+		o.SpectatorBurst = burst
+		o.SpectatorInterval = interval
+	}
+}
+
+func SetLoadShedding(v *LoadShedding) RoomOption {
+	return func(o *RoomOptions) {
+		o.LoadShedding = v
+	}
+}
+
+func RoomClock(v Clock) RoomOption {
+	return func(o *RoomOptions) {
+		o.Clock = v
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"container/heap"
+	"github.com/liangdas/mqant/log"
+	"sync"
+	"time"
+)
+
+type schedEntry struct {
+	key      string
+	due      time.Time
+	job      func()
+	wakeable bool
+	index    int
+}
+
+type schedHeap []*schedEntry
+
+func (h schedHeap) Len() int           { return len(h) }
+func (h schedHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+func (h schedHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *schedHeap) Push(x interface{}) {
+	e := x.(*schedEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *schedHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	e.index = -1
+	return e
+}
+
+/**
+把大量table的帧复用到固定数量的工作协成上(M:N)
+每个key同一时间最多只有一个待执行的帧,重复Schedule会替换之前的帧
+*/
+type Scheduler struct {
+	lock    sync.Mutex
+	heap    schedHeap
+	entries map[string]*schedEntry
+	wakeup  chan bool
+	jobs    chan func()
+	closed  chan bool
+}
+
+func NewScheduler(workers int) *Scheduler {
+	s := &Scheduler{
+		entries: map[string]*schedEntry{},
+		wakeup:  make(chan bool, 1),
+		jobs:    make(chan func()),
+		closed:  make(chan bool),
+	}
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	go s.loop()
+	return s
+}
+
+/**
+delay之后在工作协成中执行job
+*/
+func (self *Scheduler) Schedule(key string, delay time.Duration, job func()) {
+	self.schedule(key, delay, job, false)
+}
+
+/**
+与Schedule相同,但可以被Wake提前唤醒,用于休眠中的table
+*/
+func (self *Scheduler) ScheduleIdle(key string, delay time.Duration, job func()) {
+	self.schedule(key, delay, job, true)
+}
+
+func (self *Scheduler) schedule(key string, delay time.Duration, job func(), wakeable bool) {
+	due := time.Now().Add(delay)
+	self.lock.Lock()
+	if e, ok := self.entries[key]; ok {
+		e.due, e.job, e.wakeable = due, job, wakeable
+		heap.Fix(&self.heap, e.index)
+	} else {
+		e := &schedEntry{key: key, due: due, job: job, wakeable: wakeable}
+		self.entries[key] = e
+		heap.Push(&self.heap, e)
+	}
+	self.lock.Unlock()
+	self.notify()
+}
+
+/**
+休眠中的key立即执行,协成安全
+*/
+func (self *Scheduler) Wake(key string) {
+	self.lock.Lock()
+	e, ok := self.entries[key]
+	if !ok || !e.wakeable {
+		self.lock.Unlock()
+		return
+	}
+	e.due, e.wakeable = time.Now(), false
+	heap.Fix(&self.heap, e.index)
+	self.lock.Unlock()
+	self.notify()
+}
+
+/**
+取消key待执行的帧
+*/
+func (self *Scheduler) Cancel(key string) {
+	self.lock.Lock()
+	if e, ok := self.entries[key]; ok {
+		heap.Remove(&self.heap, e.index)
+		delete(self.entries, key)
+	}
+	self.lock.Unlock()
+}
+
+/**
+待执行的帧数量
+*/
+func (self *Scheduler) Pending() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return len(self.heap)
+}
+
+func (self *Scheduler) Close() {
+	close(self.closed)
+}
+
+func (self *Scheduler) notify() {
+	select {
+	case self.wakeup <- true:
+	default:
+	}
+}
+
+func (self *Scheduler) loop() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		self.lock.Lock()
+		var wait time.Duration = time.Hour
+		var due *schedEntry
+		if len(self.heap) > 0 {
+			wait = time.Until(self.heap[0].due)
+			if wait <= 0 {
+				due = heap.Pop(&self.heap).(*schedEntry)
+				delete(self.entries, due.key)
+			}
+		}
+		self.lock.Unlock()
+		if due != nil {
+			//工作协成都在忙时在这里等待,不会无限创建协成
+			select {
+			case self.jobs <- due.job:
+			case <-self.closed:
+				return
+			}
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-self.closed:
+			return
+		case <-self.wakeup:
+		case <-timer.C:
+		}
+	}
+}
+
+func (self *Scheduler) work() {
+	for {
+		select {
+		case <-self.closed:
+			return
+		case job := <-self.jobs:
+			self.run(job)
+		}
+	}
+}
+
+func (self *Scheduler) run(job func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("scheduler job panic %v", r)
+		}
+	}()
+	job()
+}
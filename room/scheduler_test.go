@@ -0,0 +1,48 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerWake(t *testing.T) {
+	s := NewScheduler(2)
+	defer s.Close()
+	done := make(chan string, 4)
+	s.Schedule("a", 10*time.Millisecond, func() { done <- "a" })
+	s.ScheduleIdle("b", time.Hour, func() { done <- "b" })
+	assertEqual(t, s.Pending(), 2)
+
+	select {
+	case v := <-done:
+		assertEqual(t, v, "a")
+	case <-time.After(time.Second):
+		t.Fatal("scheduled job not run")
+	}
+
+	s.Wake("b")
+	select {
+	case v := <-done:
+		assertEqual(t, v, "b")
+	case <-time.After(time.Second):
+		t.Fatal("idle job not woken")
+	}
+
+	s.Schedule("c", time.Hour, func() { done <- "c" })
+	s.Wake("c")
+	s.Cancel("c")
+	assertEqual(t, s.Pending(), 0)
+}
@@ -0,0 +1,300 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/**
+赛季管理
+
+每个游戏类型独立配置赛季周期,赛季结束时依次
+保存排行榜快照,按名次发放奖励邮件,调用排位分软重置,清空排行榜,开始下一个赛季
+中途失败时下次检查重新结算,快照和已发放的奖励从Store读取,不会重复发放
+*/
+package season
+
+import (
+	"fmt"
+	"github.com/liangdas/mqant/log"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Season struct {
+	GameType string
+	Number   int //从1开始
+	Start    time.Time
+	End      time.Time
+}
+
+func (s *Season) Id() string {
+	return fmt.Sprintf("%v-%d", s.GameType, s.Number)
+}
+
+type Entry struct {
+	UserId string
+	Score  float64
+	Rank   int //从1开始
+}
+
+/**
+名次区间[FromRank,ToRank]内的玩家获得的奖励
+*/
+type RewardTier struct {
+	FromRank int
+	ToRank   int
+	Title    string
+	Body     string //可以包含%d,替换为名次
+	Items    map[string]int
+}
+
+type Config struct {
+	GameType     string
+	Duration     time.Duration
+	Rewards      []RewardTier
+	SnapshotSize int //快照保存的名次数,默认取奖励覆盖的最大名次
+}
+
+func (c *Config) snapshotSize() int {
+	if c.SnapshotSize > 0 {
+		return c.SnapshotSize
+	}
+	size := 0
+	for _, tier := range c.Rewards {
+		if tier.ToRank > size {
+			size = tier.ToRank
+		}
+	}
+	return size
+}
+
+/**
+由排行榜模块实现
+*/
+type Leaderboard interface {
+	Top(gameType string, n int) ([]Entry, error)
+	Reset(gameType string) error
+}
+
+/**
+由邮件模块实现
+*/
+type Mailer interface {
+	SendMail(userId string, title string, body string, items map[string]int) error
+}
+
+/**
+赛季状态,快照和奖励发放记录的持久化,重启后从LoadSeason恢复
+*/
+type Store interface {
+	LoadSeason(gameType string) (*Season, error) //没有记录时返回nil
+	SaveSeason(season *Season) error
+	SaveSnapshot(season *Season, entries []Entry) error
+	LoadSnapshot(season *Season) (entries []Entry, ok bool, err error)
+	//记录玩家已经领取了该赛季的奖励
+	MarkRewarded(season *Season, userId string) error
+	Rewarded(season *Season) (map[string]bool, error)
+}
+
+type Options struct {
+	Leaderboard Leaderboard
+	Mailer      Mailer
+	Store       Store
+	//排位分软重置,例如对所有玩家调用rating.SoftReset
+	SoftReset func(season *Season) error
+	//新赛季开始后调用
+	OnStart func(season *Season)
+}
+
+type Manager struct {
+	opts      Options
+	lock      sync.Mutex
+	checkLock sync.Mutex //同一时间只有一个Check,避免重复结算
+	configs   map[string]*Config
+	current   map[string]*Season
+	closed    chan bool
+}
+
+func NewManager(opts Options) *Manager {
+	return &Manager{
+		opts:    opts,
+		configs: map[string]*Config{},
+		current: map[string]*Season{},
+		closed:  make(chan bool),
+	}
+}
+
+/**
+配置游戏类型的赛季,Store中有记录时从记录恢复,否则从start开始第一个赛季
+*/
+func (self *Manager) Configure(cfg Config, start time.Time) error {
+	if cfg.Duration <= 0 {
+		return fmt.Errorf("season duration of %v must be positive", cfg.GameType)
+	}
+	season, err := self.opts.Store.LoadSeason(cfg.GameType)
+	if err != nil {
+		return err
+	}
+	if season == nil {
+		season = &Season{
+			GameType: cfg.GameType,
+			Number:   1,
+			Start:    start,
+			End:      start.Add(cfg.Duration),
+		}
+		if err := self.opts.Store.SaveSeason(season); err != nil {
+			return err
+		}
+	}
+	self.lock.Lock()
+	self.configs[cfg.GameType] = &cfg
+	self.current[cfg.GameType] = season
+	self.lock.Unlock()
+	return nil
+}
+
+func (self *Manager) Current(gameType string) (*Season, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	season, ok := self.current[gameType]
+	if !ok {
+		return nil, false
+	}
+	s := *season
+	return &s, true
+}
+
+/**
+检查所有游戏类型,结束已到期的赛季
+停服期间错过多个赛季时每次只结束一个,下次检查继续
+*/
+func (self *Manager) Check(now time.Time) {
+	self.checkLock.Lock()
+	defer self.checkLock.Unlock()
+	self.lock.Lock()
+	due := []*Config{}
+	for gameType, season := range self.current {
+		if !now.Before(season.End) {
+			due = append(due, self.configs[gameType])
+		}
+	}
+	self.lock.Unlock()
+	for _, cfg := range due {
+		if err := self.rollover(cfg); err != nil {
+			log.Error("season rollover of %v error %v", cfg.GameType, err)
+		}
+	}
+}
+
+func (self *Manager) rollover(cfg *Config) error {
+	self.lock.Lock()
+	season := self.current[cfg.GameType]
+	self.lock.Unlock()
+
+	//重试时排行榜可能已经清空,使用第一次保存的快照
+	entries, ok, err := self.opts.Store.LoadSnapshot(season)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		entries, err = self.opts.Leaderboard.Top(cfg.GameType, cfg.snapshotSize())
+		if err != nil {
+			return err
+		}
+		if err := self.opts.Store.SaveSnapshot(season, entries); err != nil {
+			return err
+		}
+	}
+	if err := self.reward(cfg, season, entries); err != nil {
+		return err
+	}
+	if self.opts.SoftReset != nil {
+		if err := self.opts.SoftReset(season); err != nil {
+			log.Error("season %v soft reset error %v", season.Id(), err)
+		}
+	}
+	if err := self.opts.Leaderboard.Reset(cfg.GameType); err != nil {
+		return err
+	}
+	next := &Season{
+		GameType: cfg.GameType,
+		Number:   season.Number + 1,
+		Start:    season.End,
+		End:      season.End.Add(cfg.Duration),
+	}
+	if err := self.opts.Store.SaveSeason(next); err != nil {
+		return err
+	}
+	self.lock.Lock()
+	self.current[cfg.GameType] = next
+	self.lock.Unlock()
+	if self.opts.OnStart != nil {
+		self.opts.OnStart(next)
+	}
+	return nil
+}
+
+/**
+发放奖励,跳过已经发放过的玩家,单个玩家发送失败只记录日志
+*/
+func (self *Manager) reward(cfg *Config, season *Season, entries []Entry) error {
+	if self.opts.Mailer == nil {
+		return nil
+	}
+	rewarded, err := self.opts.Store.Rewarded(season)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if rewarded[entry.UserId] {
+			continue
+		}
+		for _, tier := range cfg.Rewards {
+			if entry.Rank < tier.FromRank || entry.Rank > tier.ToRank {
+				continue
+			}
+			body := tier.Body
+			if strings.Contains(body, "%") {
+				body = fmt.Sprintf(body, entry.Rank)
+			}
+			if err := self.opts.Mailer.SendMail(entry.UserId, tier.Title, body, tier.Items); err != nil {
+				log.Error("season %v reward %v rank %v error %v", season.Id(), entry.UserId, entry.Rank, err)
+			} else if err := self.opts.Store.MarkRewarded(season, entry.UserId); err != nil {
+				log.Error("season %v mark %v rewarded error %v", season.Id(), entry.UserId, err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+/**
+后台定时检查
+*/
+func (self *Manager) Run(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-self.closed:
+				return
+			case now := <-ticker.C:
+				self.Check(now)
+			}
+		}
+	}()
+}
+
+func (self *Manager) Close() {
+	close(self.closed)
+}
@@ -0,0 +1,165 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package season
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type fakeBackend struct {
+	entries   []Entry
+	resets    int
+	resetErr  error
+	mails     map[string]string
+	sent      int
+	seasons   map[string]*Season
+	snapshots map[string][]Entry
+	rewarded  map[string]map[string]bool
+}
+
+func (f *fakeBackend) Top(gameType string, n int) ([]Entry, error) {
+	if n < len(f.entries) {
+		return f.entries[:n], nil
+	}
+	return f.entries, nil
+}
+
+func (f *fakeBackend) Reset(gameType string) error {
+	if f.resetErr != nil {
+		return f.resetErr
+	}
+	f.resets++
+	f.entries = nil
+	return nil
+}
+
+func (f *fakeBackend) SendMail(userId string, title string, body string, items map[string]int) error {
+	f.mails[userId] = body
+	f.sent++
+	return nil
+}
+
+func (f *fakeBackend) LoadSeason(gameType string) (*Season, error) {
+	return f.seasons[gameType], nil
+}
+
+func (f *fakeBackend) SaveSeason(season *Season) error {
+	f.seasons[season.GameType] = season
+	return nil
+}
+
+func (f *fakeBackend) SaveSnapshot(season *Season, entries []Entry) error {
+	f.snapshots[season.Id()] = entries
+	return nil
+}
+
+func (f *fakeBackend) LoadSnapshot(season *Season) ([]Entry, bool, error) {
+	entries, ok := f.snapshots[season.Id()]
+	return entries, ok, nil
+}
+
+func (f *fakeBackend) MarkRewarded(season *Season, userId string) error {
+	if f.rewarded[season.Id()] == nil {
+		f.rewarded[season.Id()] = map[string]bool{}
+	}
+	f.rewarded[season.Id()][userId] = true
+	return nil
+}
+
+func (f *fakeBackend) Rewarded(season *Season) (map[string]bool, error) {
+	return f.rewarded[season.Id()], nil
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		entries:   []Entry{{"u1", 100, 1}, {"u2", 90, 2}, {"u3", 80, 3}},
+		mails:     map[string]string{},
+		seasons:   map[string]*Season{},
+		snapshots: map[string][]Entry{},
+		rewarded:  map[string]map[string]bool{},
+	}
+}
+
+func TestSeasonRollover(t *testing.T) {
+	backend := newFakeBackend()
+	softReset := 0
+	m := NewManager(Options{
+		Leaderboard: backend,
+		Mailer:      backend,
+		Store:       backend,
+		SoftReset:   func(season *Season) error { softReset++; return nil },
+	})
+	start := time.Unix(0, 0)
+	err := m.Configure(Config{
+		GameType: "poker",
+		Duration: 24 * time.Hour,
+		Rewards: []RewardTier{
+			{FromRank: 1, ToRank: 1, Body: "rank %d"},
+			{FromRank: 2, ToRank: 2, Body: "thanks"},
+		},
+	}, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Check(start.Add(time.Hour))
+	if backend.resets != 0 {
+		t.Fatal("season ended too early")
+	}
+
+	m.Check(start.Add(25 * time.Hour))
+	current, _ := m.Current("poker")
+	if current.Number != 2 || !current.Start.Equal(start.Add(24*time.Hour)) {
+		t.Fatalf("unexpected season %+v", current)
+	}
+	if len(backend.snapshots["poker-1"]) != 2 || backend.mails["u1"] != "rank 1" || backend.mails["u2"] != "thanks" {
+		t.Fatalf("unexpected rewards %v %v", backend.snapshots, backend.mails)
+	}
+	if _, ok := backend.mails["u3"]; ok || softReset != 1 || backend.resets != 1 {
+		t.Fatalf("unexpected rollover side effects")
+	}
+}
+
+func TestSeasonRolloverRetry(t *testing.T) {
+	backend := newFakeBackend()
+	backend.resetErr = fmt.Errorf("leaderboard unavailable")
+	m := NewManager(Options{
+		Leaderboard: backend,
+		Mailer:      backend,
+		Store:       backend,
+	})
+	start := time.Unix(0, 0)
+	m.Configure(Config{
+		GameType: "poker",
+		Duration: 24 * time.Hour,
+		Rewards:  []RewardTier{{FromRank: 1, ToRank: 3, Body: "rank %d"}},
+	}, start)
+
+	//清空排行榜失败,赛季没有结束,奖励已经发放
+	m.Check(start.Add(25 * time.Hour))
+	current, _ := m.Current("poker")
+	if current.Number != 1 || backend.sent != 3 {
+		t.Fatalf("unexpected season %+v sent %v", current, backend.sent)
+	}
+
+	//重试时不重复发放奖励
+	backend.resetErr = nil
+	m.Check(start.Add(26 * time.Hour))
+	current, _ = m.Current("poker")
+	if current.Number != 2 || backend.sent != 3 || len(backend.snapshots["poker-1"]) != 3 {
+		t.Fatalf("unexpected retry season %+v sent %v", current, backend.sent)
+	}
+}
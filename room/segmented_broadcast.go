@@ -0,0 +1,174 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//客户端在session settings中上报的平台,例如 ios, android, web
+const SessionPlatform = "platform"
+
+//按平台和版本区分内容的全服广播在队列中的函数名
+const SegmentedBroadcastQueueFunc = "Room.SegmentedBroadcast"
+
+/**
+按客户端平台和版本划分的玩家群体
+版本区间为[MinVersion,MaxVersion),为空表示不限制
+*/
+type Segment struct {
+	Platforms  []string //为空表示所有平台
+	MinVersion string
+	MaxVersion string
+}
+
+func (s *Segment) Match(platform string, version string) bool {
+	if len(s.Platforms) > 0 {
+		found := false
+		for _, p := range s.Platforms {
+			if strings.EqualFold(p, platform) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if s.MinVersion != "" && CompareVersion(version, s.MinVersion) < 0 {
+		return false
+	}
+	if s.MaxVersion != "" && CompareVersion(version, s.MaxVersion) >= 0 {
+		return false
+	}
+	return true
+}
+
+type SegmentedVariant struct {
+	Segment Segment
+	Body    []byte
+}
+
+/**
+按玩家所属群体发送不同内容的消息,使用第一个匹配的Variant
+都不匹配时发送Default,Default为nil时不发送
+*/
+type SegmentedMessage struct {
+	Variants []SegmentedVariant
+	Default  []byte
+}
+
+/**
+返回匹配的Variant下标,都不匹配时返回-1表示Default
+*/
+func (m *SegmentedMessage) pick(platform string, version string) int {
+	for i := range m.Variants {
+		if m.Variants[i].Segment.Match(platform, version) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *SegmentedMessage) body(index int) []byte {
+	if index < 0 {
+		return m.Default
+	}
+	return m.Variants[index].Body
+}
+
+/**
+比较点分隔的版本号,例如1.2.10大于1.2.9,缺少的段按0处理
+非数字的段按字符串比较
+*/
+func CompareVersion(a string, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) && as[i] != "" {
+			x = as[i]
+		}
+		if i < len(bs) && bs[i] != "" {
+			y = bs[i]
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		if xerr == nil && yerr == nil {
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+/**
+给table内的玩家按平台和版本发送不同的内容,相同内容的玩家合并发送
+*/
+func (this *UnifiedSendMessageTable) NotifySegmented(topic string, msg *SegmentedMessage) error {
+	groups := map[int][]string{}
+	for _, role := range this.tableimp.GetSeats() {
+		if role == nil || role.Session() == nil {
+			continue
+		}
+		info := PlayerSession(role)
+		index := msg.pick(info.Platform(), info.ClientVersion())
+		if msg.body(index) == nil {
+			continue
+		}
+		groups[index] = append(groups[index], info.SessionId())
+	}
+	for index, players := range groups {
+		if err := this.SendCallBackMsgNR(players, topic, msg.body(index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *UnifiedSendMessageTable) onSegmentedBroadcast(topic string, msg *SegmentedMessage) error {
+	return this.NotifySegmented(topic, msg)
+}
+
+/**
+全服广播,不同平台和版本的客户端收到不同的内容
+例如给低于2.0版本的iOS客户端发送旧格式的公告
+*/
+func (self *Room) BroadcastSegmented(topic string, msg *SegmentedMessage) (int, error) {
+	if !self.broadcastLimiter.Allow() {
+		return 0, fmt.Errorf("broadcast rate limited")
+	}
+	delivered := 0
+	self.tables.Range(func(key, value interface{}) bool {
+		table := value.(BaseTable)
+		if !table.Runing() {
+			return true
+		}
+		if err := putTableQueue(table, PrioritySystem, SegmentedBroadcastQueueFunc, topic, msg); err == nil {
+			delivered++
+		}
+		return true
+	})
+	return delivered, nil
+}
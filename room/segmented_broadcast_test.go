@@ -0,0 +1,39 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+)
+
+func TestCompareVersion(t *testing.T) {
+	assertEqual(t, CompareVersion("1.2.10", "1.2.9"), 1)
+	assertEqual(t, CompareVersion("1.2", "1.2.0"), 0)
+	assertEqual(t, CompareVersion("", "0.1"), -1)
+	assertEqual(t, CompareVersion("2.0.beta", "2.0.alpha"), 1)
+}
+
+func TestSegmentedMessage(t *testing.T) {
+	msg := &SegmentedMessage{
+		Variants: []SegmentedVariant{
+			{Segment: Segment{Platforms: []string{"ios"}, MaxVersion: "2.0"}, Body: []byte("old")},
+			{Segment: Segment{Platforms: []string{"web"}}, Body: nil},
+		},
+		Default: []byte("new"),
+	}
+	assertEqual(t, string(msg.body(msg.pick("iOS", "1.9.3"))), "old")
+	assertEqual(t, string(msg.body(msg.pick("ios", "2.0"))), "new")
+	assertEqual(t, string(msg.body(msg.pick("android", "1.0"))), "new")
+	assertEqual(t, msg.body(msg.pick("web", "1.0")) == nil, true)
+}
@@ -0,0 +1,180 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/gate"
+	"github.com/liangdas/mqant/log"
+	"sync"
+)
+
+//同步到网关session settings中的玩家状态,网关和大厅可以直接读取
+const (
+	SessionTableId = "room.table"
+	SessionSeat    = "room.seat"
+	SessionStatus  = "room.status"
+)
+
+/**
+把玩家状态推送到网关session,只推送发生变化的字段
+每个session由一个独立协成按顺序推送,不会阻塞table
+只能在table协成中调用
+*/
+type SessionSyncTable struct {
+	synced map[string]*sessionSync //sessionId->推送状态
+}
+
+/**
+单个session的推送状态,synced只记录网关已经确认的值
+*/
+type sessionSync struct {
+	lock    sync.Mutex
+	session gate.Session
+	synced  map[string]string
+	pending map[string]string //等待推送的值,合并了多次SyncSession
+	sending bool
+	cleared bool //玩家已经离开table,推送完成后可以删除
+}
+
+func (this *SessionSyncTable) SessionSyncTableInit() {
+	this.synced = map[string]*sessionSync{}
+}
+
+/**
+推送任意settings,值为空字符串表示清除
+*/
+func (this *SessionSyncTable) SyncSession(session gate.Session, settings map[string]string) {
+	if session == nil {
+		return
+	}
+	s, ok := this.synced[session.GetSessionId()]
+	if !ok {
+		s = &sessionSync{
+			synced:  map[string]string{},
+			pending: map[string]string{},
+		}
+		this.synced[session.GetSessionId()] = s
+	}
+	s.lock.Lock()
+	s.cleared = false
+	for k, v := range settings {
+		_, queued := s.pending[k]
+		if old, ok := s.synced[k]; queued || !ok || old != v {
+			s.pending[k] = v
+		}
+	}
+	if len(s.pending) == 0 {
+		s.lock.Unlock()
+		return
+	}
+	bot, isBot := session.(*BotSession)
+	if isBot {
+		s.session = bot
+	} else {
+		s.session = session.Clone()
+	}
+	if s.sending {
+		//由正在推送的协成继续推送
+		s.lock.Unlock()
+		return
+	}
+	s.sending = true
+	s.lock.Unlock()
+	if isBot {
+		s.run()
+	} else {
+		go s.run()
+	}
+}
+
+/**
+按顺序推送,直到没有新的变化
+推送失败时保留未推送的值,下次SyncSession时重试
+*/
+func (s *sessionSync) run() {
+	for {
+		s.lock.Lock()
+		if len(s.pending) == 0 {
+			s.sending = false
+			s.lock.Unlock()
+			return
+		}
+		batch := s.pending
+		session := s.session
+		s.pending = map[string]string{}
+		s.lock.Unlock()
+
+		err := session.SetBatch(batch)
+
+		s.lock.Lock()
+		if err != "" {
+			for k, v := range batch {
+				if _, ok := s.pending[k]; !ok {
+					s.pending[k] = v
+				}
+			}
+			s.sending = false
+			s.lock.Unlock()
+			log.Warning("sync session %v settings error %v", session.GetSessionId(), err)
+			return
+		}
+		for k, v := range batch {
+			s.synced[k] = v
+		}
+		s.lock.Unlock()
+	}
+}
+
+func (s *sessionSync) idle() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return !s.sending && len(s.pending) == 0
+}
+
+/**
+推送玩家当前所在的table,座位和状态
+*/
+func (this *SessionSyncTable) SyncPlayerState(tableId string, player BasePlayer, seat string, status string) {
+	this.SyncSession(player.Session(), map[string]string{
+		SessionTableId: tableId,
+		SessionSeat:    seat,
+		SessionStatus:  status,
+	})
+}
+
+/**
+玩家离开table时清除推送的状态
+*/
+func (this *SessionSyncTable) ClearPlayerState(player BasePlayer) {
+	session := player.Session()
+	if session == nil {
+		return
+	}
+	this.SyncSession(session, map[string]string{
+		SessionTableId: "",
+		SessionSeat:    "",
+		SessionStatus:  "",
+	})
+	if s, ok := this.synced[session.GetSessionId()]; ok {
+		s.lock.Lock()
+		s.cleared = true
+		s.lock.Unlock()
+	}
+	//推送中的session保留到下次清理,保证之后重新加入时的推送排在清除之后
+	for sessionId, s := range this.synced {
+		if s.cleared && s.idle() {
+			delete(this.synced, sessionId)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/gate"
+	"sync"
+	"testing"
+	"time"
+)
+
+type flakySession struct {
+	*BotSession
+	lock    sync.Mutex
+	fail    bool
+	batches int
+}
+
+func (s *flakySession) Clone() gate.Session {
+	return s
+}
+
+func (s *flakySession) SetBatch(settings map[string]string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.batches++
+	if s.fail {
+		return "gateway unavailable"
+	}
+	return s.BotSession.SetBatch(settings)
+}
+
+func waitSessionSync(table *SessionSyncTable, session gate.Session) *sessionSync {
+	s := table.synced[session.GetSessionId()]
+	for {
+		s.lock.Lock()
+		sending := s.sending
+		s.lock.Unlock()
+		if !sending {
+			return s
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSessionSync(t *testing.T) {
+	table := &SessionSyncTable{}
+	table.SessionSyncTableInit()
+	session := &flakySession{BotSession: NewNullSession("u1"), fail: true}
+
+	//推送失败时不更新已推送的值,下次推送时重试
+	table.SyncSession(session, map[string]string{SessionSeat: "1"})
+	s := waitSessionSync(table, session)
+	s.lock.Lock()
+	assertEqual(t, len(s.synced), 0)
+	assertEqual(t, s.pending[SessionSeat], "1")
+	s.lock.Unlock()
+
+	session.lock.Lock()
+	session.fail = false
+	session.lock.Unlock()
+	table.SyncSession(session, map[string]string{SessionSeat: "1"})
+	waitSessionSync(table, session)
+	assertEqual(t, session.Get(SessionSeat), "1")
+	assertEqual(t, s.synced[SessionSeat], "1")
+
+	//多次推送按顺序生效
+	for _, seat := range []string{"2", "3", "4"} {
+		table.SyncSession(session, map[string]string{SessionSeat: seat})
+	}
+	waitSessionSync(table, session)
+	assertEqual(t, session.Get(SessionSeat), "4")
+
+	//没有变化时不推送
+	session.lock.Lock()
+	batches := session.batches
+	session.lock.Unlock()
+	table.SyncSession(session, map[string]string{SessionSeat: "4"})
+	waitSessionSync(table, session)
+	session.lock.Lock()
+	assertEqual(t, session.batches, batches)
+	session.lock.Unlock()
+}
@@ -0,0 +1,267 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+//调试接口取table状态差异的消息在队列中的函数名
+const DiffQueueFunc = "Room.Diff"
+
+/**
+状态中一个字段的变化,Path为JSON路径,例如 seats.2.score
+新增字段Before为nil,删除字段After为nil
+*/
+type StateChange struct {
+	Path   string
+	Before interface{}
+	After  interface{}
+}
+
+/**
+两个Seq时刻的状态以及之间的事件
+快照不是JSON时Changes为空,只能对比Before和After
+*/
+type StateDiff struct {
+	TableId string
+	From    int64
+	To      int64
+	Before  json.RawMessage
+	After   json.RawMessage
+	Events  []*TableEvent
+	Changes []StateChange
+}
+
+/**
+计算seq时刻的状态快照,不影响当前状态
+只能在table协成中调用
+*/
+func (this *EventSourcedTable) StateAt(seq int64) ([]byte, error) {
+	if seq > this.seq || seq < 0 {
+		return nil, fmt.Errorf("state seq %v out of range [0,%v]", seq, this.seq)
+	}
+	current, err := this.applier.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if seq == this.seq {
+		return current, nil
+	}
+	var base *TableSnapshot
+	for _, snapshot := range this.snapshots {
+		if snapshot.Seq <= seq {
+			base = snapshot
+		}
+	}
+	if base == nil {
+		return nil, fmt.Errorf("no snapshot before seq %v", seq)
+	}
+	defer func() {
+		//回到当前状态,失败说明applier的Snapshot/Restore不对称
+		if err := this.applier.Restore(current); err != nil {
+			panic(fmt.Sprintf("table %v restore current state error %v", this.tableId, err))
+		}
+	}()
+	if err := this.applier.Restore(base.Data); err != nil {
+		return nil, err
+	}
+	for _, event := range this.events {
+		if event.Seq > base.Seq && event.Seq <= seq {
+			if err := this.applier.Apply(event); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return this.applier.Snapshot()
+}
+
+/**
+对比from和to两个时刻的状态,用于排查玩家反馈的状态错乱
+只能在table协成中调用
+*/
+func (this *EventSourcedTable) DiffState(from int64, to int64) (*StateDiff, error) {
+	if from > to {
+		return nil, fmt.Errorf("diff from %v after to %v", from, to)
+	}
+	before, err := this.StateAt(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := this.StateAt(to)
+	if err != nil {
+		return nil, err
+	}
+	diff := &StateDiff{
+		TableId: this.tableId,
+		From:    from,
+		To:      to,
+		Before:  rawState(before),
+		After:   rawState(after),
+	}
+	for _, event := range this.events {
+		if event.Seq > from && event.Seq <= to {
+			diff.Events = append(diff.Events, event)
+		}
+	}
+	if changes, err := DiffJSON(before, after); err == nil {
+		diff.Changes = changes
+	}
+	return diff, nil
+}
+
+/**
+非JSON的快照转成JSON字符串,保证StateDiff可以序列化
+*/
+func rawState(data []byte) json.RawMessage {
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	quoted, _ := json.Marshal(string(data))
+	return json.RawMessage(quoted)
+}
+
+/**
+逐字段对比两个JSON文档,结果按Path排序
+*/
+func DiffJSON(before []byte, after []byte) ([]StateChange, error) {
+	var a, b interface{}
+	if err := json.Unmarshal(before, &a); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(after, &b); err != nil {
+		return nil, err
+	}
+	changes := []StateChange{}
+	diffValue("", a, b, &changes)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+func diffValue(path string, a interface{}, b interface{}, changes *[]StateChange) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			for k, v := range av {
+				diffValue(joinPath(path, k), v, bv[k], changes)
+			}
+			for k, v := range bv {
+				if _, ok := av[k]; !ok {
+					diffValue(joinPath(path, k), nil, v, changes)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			for i := 0; i < len(av) || i < len(bv); i++ {
+				var x, y interface{}
+				if i < len(av) {
+					x = av[i]
+				}
+				if i < len(bv) {
+					y = bv[i]
+				}
+				diffValue(joinPath(path, strconv.Itoa(i)), x, y, changes)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, StateChange{Path: path, Before: a, After: b})
+	}
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (this *QTable) onDiff(from int64, to int64, call *tableCall) error {
+	if !call.start() {
+		return nil
+	}
+	defer call.recoverPanic()
+	differ, ok := this.BaseTableImp.subtable.(interface {
+		Seq() int64
+		DiffState(from int64, to int64) (*StateDiff, error)
+	})
+	if !ok {
+		call.finish(nil, fmt.Errorf("table %v is not event sourced", this.TableId()))
+		return nil
+	}
+	if to < 0 {
+		to = differ.Seq()
+	}
+	diff, err := differ.DiffState(from, to)
+	call.finish(diff, err)
+	return nil
+}
+
+/**
+在table协成中计算from和to时刻的状态差异,to小于0表示当前状态
+table需要嵌入EventSourcedTable,没有运行的table返回ErrCodeTableNotFound
+*/
+func (self *Room) DiffTable(tableId string, from int64, to int64) (*StateDiff, error) {
+	table := self.runningTable(tableId)
+	if table == nil {
+		return nil, NewError(ErrCodeTableNotFound)
+	}
+	result, err := self.callTable(table, PrioritySystem, self.opts.RPCTimeout, DiffQueueFunc, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*StateDiff), nil
+}
+
+/**
+/debug/room/diff?table=xxx&from=10&to=20	to省略时对比到当前状态
+*/
+func (self *Room) serveTableDiff(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, err := strconv.ParseInt(query.Get("from"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	to := int64(-1)
+	if v := query.Get("to"); v != "" {
+		if to, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+	}
+	diff, err := self.DiffTable(query.Get("table"), from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(diff); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(buf.Bytes())
+}
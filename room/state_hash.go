@@ -0,0 +1,178 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/liangdas/mqant/gate"
+	"github.com/liangdas/mqant/log"
+	"hash/fnv"
+	"time"
+)
+
+//客户端上报状态哈希的消息在队列中的函数名
+const ReportHashQueueFunc = "Room.ReportHash"
+
+//默认推送状态哈希的topic
+const StateHashTopic = "Room/StateHash"
+
+/**
+状态哈希检查,客户端做预测时用于发现与服务器状态不一致
+*/
+type DesyncOptions struct {
+	Interval time.Duration //计算哈希的间隔
+	//返回权威状态的规范序列化(字段顺序固定),客户端必须对相同的内容计算FNV-1a 64
+	State   func() ([]byte, error)
+	Topic   string //推送哈希的topic,默认StateHashTopic
+	History int    //保留最近多少个哈希用于比对客户端上报,默认16
+	//哈希不一致时调用,应给该玩家下发完整状态
+	Resync   func(player BasePlayer) error
+	OnDesync func(player BasePlayer, seq int64, server string, client string)
+}
+
+/**
+推送给客户端的状态哈希
+*/
+type StateHash struct {
+	Seq  int64
+	Hash string
+	Time int64 //单位毫秒
+}
+
+/**
+定期计算状态哈希并推送,接收客户端上报的哈希进行比对
+只能在table协成中调用
+*/
+type DesyncTable struct {
+	desyncOpts  *DesyncOptions
+	desyncClock func() Clock
+	desyncSend  func(topic string, body []byte) error
+	hashSeq     int64
+	hashes      map[int64]string
+	lastHashAt  time.Time
+	desyncs     int64
+}
+
+func (this *DesyncTable) DesyncTableInit(opts *DesyncOptions, clock func() Clock, send func(topic string, body []byte) error) {
+	this.desyncOpts = opts
+	this.desyncClock = clock
+	this.desyncSend = send
+	this.hashSeq = 0
+	this.hashes = map[int64]string{}
+	this.lastHashAt = time.Time{}
+	this.desyncs = 0
+}
+
+func HashState(state []byte) string {
+	h := fnv.New64a()
+	h.Write(state)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+/**
+最近一次计算的哈希,游戏可以把它附加在自己的广播中,还没有计算过时seq为0
+*/
+func (this *DesyncTable) StateHash() (int64, string) {
+	return this.hashSeq, this.hashes[this.hashSeq]
+}
+
+/**
+已发现的不一致次数
+*/
+func (this *DesyncTable) Desyncs() int64 {
+	return this.desyncs
+}
+
+/**
+立即计算并推送一次哈希
+*/
+func (this *DesyncTable) PublishStateHash() (*StateHash, error) {
+	if this.desyncOpts == nil || this.desyncOpts.State == nil {
+		return nil, fmt.Errorf("desync detection not configured")
+	}
+	state, err := this.desyncOpts.State()
+	if err != nil {
+		return nil, err
+	}
+	now := this.desyncClock().Now()
+	this.lastHashAt = now
+	this.hashSeq++
+	hash := &StateHash{
+		Seq:  this.hashSeq,
+		Hash: HashState(state),
+		Time: now.UnixNano() / int64(time.Millisecond),
+	}
+	this.hashes[hash.Seq] = hash.Hash
+	history := this.desyncOpts.History
+	if history <= 0 {
+		history = 16
+	}
+	delete(this.hashes, hash.Seq-int64(history))
+	topic := this.desyncOpts.Topic
+	if topic == "" {
+		topic = StateHashTopic
+	}
+	body, err := json.Marshal(hash)
+	if err != nil {
+		return hash, err
+	}
+	return hash, this.desyncSend(topic, body)
+}
+
+/**
+【每帧调用】按Interval计算哈希
+*/
+func (this *DesyncTable) CheckStateHash() {
+	if this.desyncOpts == nil || this.desyncOpts.Interval <= 0 || this.desyncOpts.State == nil {
+		return
+	}
+	if this.desyncClock().Now().Sub(this.lastHashAt) < this.desyncOpts.Interval {
+		return
+	}
+	if _, err := this.PublishStateHash(); err != nil {
+		log.Warning("publish state hash error %v", err)
+	}
+}
+
+/**
+比对客户端上报的哈希,seq太旧已经不在历史中时忽略
+返回false表示不一致
+*/
+func (this *DesyncTable) VerifyStateHash(player BasePlayer, seq int64, hash string) bool {
+	server, ok := this.hashes[seq]
+	if !ok || server == hash {
+		return true
+	}
+	this.desyncs++
+	log.Warning("desync player %v seq %v server %v client %v", PlayerSession(player).UserId(), seq, server, hash)
+	if this.desyncOpts.OnDesync != nil {
+		this.desyncOpts.OnDesync(player, seq, server, hash)
+	}
+	if this.desyncOpts.Resync != nil {
+		if err := this.desyncOpts.Resync(player); err != nil {
+			log.Error("resync player %v error %v", PlayerSession(player).UserId(), err)
+		}
+	}
+	return false
+}
+
+func (this *QTable) onReportHash(session gate.Session, seq int64, hash string) error {
+	player := this.FindPlayer(session)
+	if player == nil {
+		return NewError(ErrCodeNotSeated)
+	}
+	this.VerifyStateHash(player, seq, hash)
+	return nil
+}
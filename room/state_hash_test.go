@@ -0,0 +1,71 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestStateHash(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(100, 0))
+	state := "a"
+	sent := []*StateHash{}
+	resynced := []string{}
+	table := &DesyncTable{}
+	table.DesyncTableInit(&DesyncOptions{
+		Interval: time.Second,
+		History:  2,
+		State: func() ([]byte, error) {
+			return []byte(state), nil
+		},
+		Resync: func(player BasePlayer) error {
+			resynced = append(resynced, PlayerSession(player).UserId())
+			return nil
+		},
+	}, func() Clock { return clock }, func(topic string, body []byte) error {
+		assertEqual(t, topic, StateHashTopic)
+		hash := &StateHash{}
+		json.Unmarshal(body, hash)
+		sent = append(sent, hash)
+		return nil
+	})
+	table.CheckStateHash()
+	assertEqual(t, len(sent), 1)
+	assertEqual(t, sent[0].Seq, int64(1))
+	assertEqual(t, sent[0].Hash, HashState([]byte("a")))
+	table.CheckStateHash()
+	assertEqual(t, len(sent), 1)
+
+	state = "b"
+	clock.Advance(time.Second)
+	table.CheckStateHash()
+	assertEqual(t, len(sent), 2)
+	seq, hash := table.StateHash()
+	assertEqual(t, seq, int64(2))
+	assertEqual(t, hash, HashState([]byte("b")))
+
+	player := &BasePlayerImp{}
+	player.Bind(NewNullSession("p1"))
+	assertEqual(t, table.VerifyStateHash(player, 1, HashState([]byte("a"))), true)
+	assertEqual(t, table.VerifyStateHash(player, 2, HashState([]byte("a"))), false)
+	assertEqual(t, len(resynced), 1)
+	assertEqual(t, table.Desyncs(), int64(1))
+
+	//超出History的seq不再比对
+	clock.Advance(time.Second)
+	table.CheckStateHash()
+	assertEqual(t, table.VerifyStateHash(player, 1, "stale"), true)
+}
@@ -0,0 +1,127 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"time"
+)
+
+/**
+单个玩家在本局游戏中的统计数据
+*/
+type PlayerStats struct {
+	Counters map[string]int64
+	Gauges   map[string]float64
+	Timers   map[string]time.Duration
+}
+
+func newPlayerStats() *PlayerStats {
+	return &PlayerStats{
+		Counters: map[string]int64{},
+		Gauges:   map[string]float64{},
+		Timers:   map[string]time.Duration{},
+	}
+}
+
+/**
+按玩家累计统计数据,table结束时通过Options.StatsFlush输出
+只能在table协成中调用
+*/
+type StatsTable struct {
+	clock   func() Clock
+	stats   map[string]*PlayerStats
+	running map[string]map[string]time.Time
+	flushed bool
+}
+
+func (this *StatsTable) StatsTableInit(clock func() Clock) {
+	this.clock = clock
+	this.stats = map[string]*PlayerStats{}
+	this.running = map[string]map[string]time.Time{}
+	this.flushed = false
+}
+
+func (this *StatsTable) playerStats(playerId string) *PlayerStats {
+	stats, ok := this.stats[playerId]
+	if !ok {
+		stats = newPlayerStats()
+		this.stats[playerId] = stats
+	}
+	return stats
+}
+
+/**
+计数器累加
+*/
+func (this *StatsTable) StatIncr(playerId string, name string, delta int64) {
+	this.playerStats(playerId).Counters[name] += delta
+}
+
+/**
+设置瞬时值,例如当前筹码
+*/
+func (this *StatsTable) StatGauge(playerId string, name string, value float64) {
+	this.playerStats(playerId).Gauges[name] = value
+}
+
+/**
+直接累加一段耗时
+*/
+func (this *StatsTable) StatTiming(playerId string, name string, d time.Duration) {
+	this.playerStats(playerId).Timers[name] += d
+}
+
+/**
+开始计时,例如玩家思考时间
+*/
+func (this *StatsTable) StatStartTimer(playerId string, name string) {
+	timers, ok := this.running[playerId]
+	if !ok {
+		timers = map[string]time.Time{}
+		this.running[playerId] = timers
+	}
+	timers[name] = this.clock().Now()
+}
+
+/**
+结束计时并累加到Timers,未开始计时则忽略
+*/
+func (this *StatsTable) StatStopTimer(playerId string, name string) {
+	if timers, ok := this.running[playerId]; ok {
+		if start, ok := timers[name]; ok {
+			this.StatTiming(playerId, name, this.clock().Now().Sub(start))
+			delete(timers, name)
+		}
+	}
+}
+
+func (this *StatsTable) Stats() map[string]*PlayerStats {
+	return this.stats
+}
+
+/**
+结束所有未停止的计时并返回统计数据,只会生效一次
+*/
+func (this *StatsTable) FlushStats() map[string]*PlayerStats {
+	if this.flushed {
+		return nil
+	}
+	for playerId, timers := range this.running {
+		for name := range timers {
+			this.StatStopTimer(playerId, name)
+		}
+	}
+	this.flushed = true
+	return this.stats
+}
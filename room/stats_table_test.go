@@ -0,0 +1,70 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsTable(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(100, 0))
+	table := &StatsTable{}
+	table.StatsTableInit(func() Clock { return clock })
+	table.StatIncr("p1", "hands", 1)
+	table.StatIncr("p1", "hands", 2)
+	table.StatGauge("p1", "chips", 10)
+	table.StatGauge("p1", "chips", 25)
+	table.StatStartTimer("p1", "think")
+	clock.Advance(3 * time.Second)
+	table.StatStopTimer("p1", "think")
+	//未开始的计时忽略
+	table.StatStopTimer("p2", "think")
+	assertEqual(t, table.Stats()["p1"].Counters["hands"], int64(3))
+	assertEqual(t, table.Stats()["p1"].Gauges["chips"], float64(25))
+	assertEqual(t, table.Stats()["p1"].Timers["think"], 3*time.Second)
+	_, ok := table.Stats()["p2"]
+	assertEqual(t, ok, false)
+
+	//结束时停止所有未停止的计时,只输出一次
+	table.StatStartTimer("p1", "think")
+	table.StatStartTimer("p2", "think")
+	clock.Advance(time.Second)
+	stats := table.FlushStats()
+	assertEqual(t, stats["p1"].Timers["think"], 4*time.Second)
+	assertEqual(t, stats["p2"].Timers["think"], time.Second)
+	assertEqual(t, table.FlushStats() == nil, true)
+}
+
+func TestStatsFlushOnFinish(t *testing.T) {
+	flushed := 0
+	var got map[string]*PlayerStats
+	table := &benchTable{seats: map[string]BasePlayer{}}
+	table.OnInit(table,
+		TableId("stats"),
+		Capaciity(16),
+		SendMsgCapaciity(16),
+		RunInterval(time.Hour),
+		SetScheduler(benchScheduler, 0, 0),
+		StatsFlush(func(table BaseTable, stats map[string]*PlayerStats) {
+			flushed++
+			got = stats
+		}),
+	)
+	table.StatIncr("p1", "wins", 1)
+	table.Finish()
+	table.Finish()
+	assertEqual(t, flushed, 1)
+	assertEqual(t, got["p1"].Counters["wins"], int64(1))
+}
@@ -0,0 +1,92 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	callPending   = iota
+	callStarted   //table协成已经开始执行
+	callAbandoned //调用方已经超时放弃
+	callFinished  //已经返回结果
+)
+
+/**
+其他协成向table发起的同步调用,作为消息的最后一个参数放入队列
+处理函数先调用start,返回false表示调用方已经放弃,不能再执行
+start成功后必须 defer call.recoverPanic(),处理函数panic时调用方也能得到结果
+执行中的调用不会被放弃,调用方最多再等待一个超时时间
+*/
+type tableCall struct {
+	state  int32
+	done   chan struct{}
+	result interface{}
+	err    error
+}
+
+func (c *tableCall) start() bool {
+	return atomic.CompareAndSwapInt32(&c.state, callPending, callStarted)
+}
+
+/**
+只有第一次调用生效
+*/
+func (c *tableCall) finish(result interface{}, err error) {
+	if !atomic.CompareAndSwapInt32(&c.state, callStarted, callFinished) {
+		return
+	}
+	c.result = result
+	c.err = err
+	close(c.done)
+}
+
+/**
+处理函数panic时把panic作为错误返回给调用方,然后继续panic由队列处理
+*/
+func (c *tableCall) recoverPanic() {
+	if r := recover(); r != nil {
+		c.finish(nil, fmt.Errorf("%v", r))
+		panic(r)
+	}
+}
+
+/**
+把消息放入table队列并等待处理结果
+超时前table还没有开始执行时放弃该调用,table之后也不会再执行
+已经开始执行的调用再等待一个timeout,仍未完成时返回超时错误,结果被丢弃
+*/
+func (self *Room) callTable(table BaseTable, priority int, timeout time.Duration, queueFunc string, params ...interface{}) (interface{}, error) {
+	call := &tableCall{done: make(chan struct{})}
+	if err := putTableQueue(table, priority, queueFunc, append(params, call)...); err != nil {
+		return nil, err
+	}
+	select {
+	case <-call.done:
+		return call.result, call.err
+	case <-self.opts.Clock.After(timeout):
+		if atomic.CompareAndSwapInt32(&call.state, callPending, callAbandoned) {
+			return nil, fmt.Errorf("%v on table %v timeout", queueFunc, table.TableId())
+		}
+		select {
+		case <-call.done:
+			return call.result, call.err
+		case <-self.opts.Clock.After(timeout):
+			return nil, fmt.Errorf("%v on table %v still running after timeout", queueFunc, table.TableId())
+		}
+	}
+}
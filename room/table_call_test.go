@@ -0,0 +1,118 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/gate"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCallTable(room *Room, called *int) *benchTable {
+	table, _ := room.CreateById(nil, "call", newBenchTable)
+	bench := table.(*benchTable)
+	bench.RegisterRPC("ping", func(session gate.Session, params map[string]interface{}) (map[string]interface{}, error) {
+		*called++
+		return map[string]interface{}{"pong": true}, nil
+	})
+	table.Run()
+	return bench
+}
+
+func TestInvokeTableFunc(t *testing.T) {
+	room := NewRoom(nil, RPCTimeout(10*time.Millisecond))
+	called := 0
+	bench := newCallTable(room, &called)
+	session := NewNullSession("p1")
+
+	//Join和Leave必须经过JoinTable和LeaveTable
+	_, err := room.InvokeTableFunc(session, "call", JoinRPCFunc, nil)
+	assertEqual(t, ErrorCode(err), ErrCodePermissionDenied)
+	_, err = room.InvokeTableFunc(session, "call", LeaveRPCFunc, nil)
+	assertEqual(t, ErrorCode(err), ErrCodePermissionDenied)
+
+	//table没有处理,调用超时后放弃,之后也不再执行
+	_, err = room.InvokeTableFunc(session, "call", "ping", nil)
+	assertEqual(t, err != nil, true)
+	bench.ExecuteEvent(nil)
+	assertEqual(t, called, 0)
+
+	room = NewRoom(nil, RPCTimeout(10*time.Second))
+	bench = newCallTable(room, &called)
+	var data map[string]interface{}
+	pumpTable(bench, func() { data, err = room.InvokeTableFunc(session, "call", "ping", nil) })
+	assertEqual(t, err, nil)
+	assertEqual(t, called, 1)
+	assertEqual(t, data["pong"], true)
+}
+
+func TestInvokeTableFuncPanic(t *testing.T) {
+	room := NewRoom(nil, RPCTimeout(10*time.Second))
+	called := 0
+	bench := newCallTable(room, &called)
+	bench.RegisterRPC("boom", func(session gate.Session, params map[string]interface{}) (map[string]interface{}, error) {
+		panic("boom")
+	})
+	//处理函数panic时调用方得到错误,不会一直等待
+	var err error
+	pumpTable(bench, func() { _, err = room.InvokeTableFunc(NewNullSession("p1"), "call", "boom", nil) })
+	assertEqual(t, err != nil, true)
+	assertEqual(t, err.Error(), "boom")
+	assertEqual(t, bench.Runing(), true)
+}
+
+func TestCallTableBound(t *testing.T) {
+	room := NewRoom(nil, RPCTimeout(200*time.Millisecond))
+	called := 0
+	bench := newCallTable(room, &called)
+	started := make(chan bool)
+	release := make(chan bool)
+	defer close(release)
+	bench.RegisterRPC("slow", func(session gate.Session, params map[string]interface{}) (map[string]interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	done := make(chan error, 1)
+	go func() {
+		_, err := room.InvokeTableFunc(NewNullSession("p1"), "call", "slow", nil)
+		done <- err
+	}()
+	go func() {
+		for {
+			select {
+			case <-started:
+				return
+			case <-release:
+				return
+			default:
+				bench.ExecuteEvent(nil)
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	//已经开始执行的调用最多再等待一个超时时间
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("call did not start")
+	}
+	select {
+	case err := <-done:
+		assertEqual(t, strings.Contains(err.Error(), "still running"), true)
+	case <-time.After(5 * time.Second):
+		t.Fatal("call did not return")
+	}
+}
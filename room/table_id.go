@@ -0,0 +1,133 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//snowflake各部分的位数
+const (
+	tableIdNodeBits = 10
+	tableIdSeqBits  = 12
+	MaxTableIdNode  = 1<<tableIdNodeBits - 1
+	tableIdSeqMask  = 1<<tableIdSeqBits - 1
+)
+
+//TableId中时间部分的起点
+var TableIdEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+/**
+从TableId中解析出的信息
+*/
+type TableIdInfo struct {
+	GameType string
+	Node     int
+	Time     time.Time //精确到毫秒
+	Seq      int
+}
+
+/**
+生成带有节点,游戏类型和创建时间的TableId,格式为 {gameType}-{snowflake的36进制}
+同一个节点上生成的id按时间递增,节点号在集群内必须唯一
+*/
+type TableIdGenerator struct {
+	lock   sync.Mutex
+	node   int64
+	lastMs int64
+	seq    int64
+}
+
+func NewTableIdGenerator(node int) (*TableIdGenerator, error) {
+	if node < 0 || node > MaxTableIdNode {
+		return nil, fmt.Errorf("table id node %v out of range [0,%v]", node, MaxTableIdNode)
+	}
+	return &TableIdGenerator{node: int64(node)}, nil
+}
+
+func (self *TableIdGenerator) Node() int {
+	return int(self.node)
+}
+
+/**
+协成安全,同一毫秒内超过4096个时等待下一毫秒
+*/
+func (self *TableIdGenerator) Next(gameType string) string {
+	self.lock.Lock()
+	ms := time.Since(TableIdEpoch).Nanoseconds() / int64(time.Millisecond)
+	if ms < self.lastMs {
+		//时钟回拨时沿用上一次的时间,保证不重复
+		ms = self.lastMs
+	}
+	if ms == self.lastMs {
+		self.seq = (self.seq + 1) & tableIdSeqMask
+		if self.seq == 0 {
+			for ms <= self.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				ms = time.Since(TableIdEpoch).Nanoseconds() / int64(time.Millisecond)
+			}
+		}
+	} else {
+		self.seq = 0
+	}
+	self.lastMs = ms
+	id := ms<<(tableIdNodeBits+tableIdSeqBits) | self.node<<tableIdSeqBits | self.seq
+	self.lock.Unlock()
+	return gameType + "-" + strconv.FormatInt(id, 36)
+}
+
+/**
+解析由TableIdGenerator生成的TableId
+*/
+func ParseTableId(tableId string) (*TableIdInfo, error) {
+	i := strings.LastIndex(tableId, "-")
+	if i <= 0 {
+		return nil, fmt.Errorf("table id %q has no game type", tableId)
+	}
+	id, err := strconv.ParseInt(tableId[i+1:], 36, 64)
+	if err != nil || id < 0 {
+		return nil, fmt.Errorf("table id %q is not generated", tableId)
+	}
+	ms := id >> (tableIdNodeBits + tableIdSeqBits)
+	return &TableIdInfo{
+		GameType: tableId[:i],
+		Node:     int(id >> tableIdSeqBits & MaxTableIdNode),
+		Time:     TableIdEpoch.Add(time.Duration(ms) * time.Millisecond),
+		Seq:      int(id & tableIdSeqMask),
+	}, nil
+}
+
+/**
+按TableId中的节点号路由,node返回节点的地址
+*/
+func RouteByNode(node func(node int) string) Route {
+	return func(tableId string) string {
+		info, err := ParseTableId(tableId)
+		if err != nil {
+			return ""
+		}
+		return node(info.Node)
+	}
+}
+
+/**
+使用Room的TableIdGenerator生成新的TableId
+*/
+func (self *Room) NewTableId(gameType string) string {
+	return self.opts.TableIds.Next(gameType)
+}
@@ -0,0 +1,55 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTableId(t *testing.T) {
+	gen, err := NewTableIdGenerator(37)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewTableIdGenerator(MaxTableIdNode + 1)
+	assertEqual(t, err != nil, true)
+
+	seen := map[string]bool{}
+	last := ""
+	for i := 0; i < 10000; i++ {
+		id := gen.Next("dou-dizhu")
+		if seen[id] {
+			t.Fatalf("duplicate table id %v", id)
+		}
+		seen[id] = true
+		last = id
+	}
+	info, err := ParseTableId(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, info.GameType, "dou-dizhu")
+	assertEqual(t, info.Node, 37)
+	assertEqual(t, time.Since(info.Time) < time.Minute, true)
+
+	route := RouteByNode(func(node int) string {
+		if node == 37 {
+			return "room@node37"
+		}
+		return ""
+	})
+	assertEqual(t, route(last), "room@node37")
+	assertEqual(t, route("manual"), "")
+}
@@ -0,0 +1,260 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"github.com/liangdas/mqant/gate"
+	"sync"
+)
+
+//重连消息在队列中的函数名
+const RejoinQueueFunc = "Room.Rejoin"
+
+/**
+记录玩家当前所在的table,用于断线或重启后找回
+*/
+type TableLocator interface {
+	Locate(userId string) (tableId string, ok bool)
+	Bind(userId string, tableId string) error
+	Unbind(userId string, tableId string) error
+	//table销毁时解除所有玩家的绑定
+	UnbindTable(tableId string) error
+}
+
+/**
+基于内存的TableLocator,只在单个进程内有效
+*/
+type MemoryTableLocator struct {
+	lock    sync.RWMutex
+	players map[string]string
+	tables  map[string]map[string]bool
+}
+
+func NewMemoryTableLocator() *MemoryTableLocator {
+	return &MemoryTableLocator{
+		players: map[string]string{},
+		tables:  map[string]map[string]bool{},
+	}
+}
+
+func (self *MemoryTableLocator) Locate(userId string) (string, bool) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	tableId, ok := self.players[userId]
+	return tableId, ok
+}
+
+func (self *MemoryTableLocator) Bind(userId string, tableId string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if old, ok := self.players[userId]; ok {
+		delete(self.tables[old], userId)
+	}
+	self.players[userId] = tableId
+	if _, ok := self.tables[tableId]; !ok {
+		self.tables[tableId] = map[string]bool{}
+	}
+	self.tables[tableId][userId] = true
+	return nil
+}
+
+func (self *MemoryTableLocator) Unbind(userId string, tableId string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.players[userId] == tableId {
+		delete(self.players, userId)
+	}
+	delete(self.tables[tableId], userId)
+	return nil
+}
+
+func (self *MemoryTableLocator) UnbindTable(tableId string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for userId := range self.tables[tableId] {
+		if self.players[userId] == tableId {
+			delete(self.players, userId)
+		}
+	}
+	delete(self.tables, tableId)
+	return nil
+}
+
+//ARGV[3]为table key的前缀
+var locatorBindScript = redis.NewScript(2, `
+local old = redis.call('GET', KEYS[1])
+if old and old ~= ARGV[2] then
+	redis.call('SREM', ARGV[3]..old, ARGV[1])
+end
+redis.call('SET', KEYS[1], ARGV[2])
+redis.call('SADD', KEYS[2], ARGV[1])
+return 1
+`)
+
+var locatorUnbindScript = redis.NewScript(2, `
+if redis.call('GET', KEYS[1]) == ARGV[2] then
+	redis.call('DEL', KEYS[1])
+end
+redis.call('SREM', KEYS[2], ARGV[1])
+return 1
+`)
+
+//ARGV[2]为player key的前缀
+var locatorUnbindTableScript = redis.NewScript(1, `
+for _, user in ipairs(redis.call('SMEMBERS', KEYS[1])) do
+	if redis.call('GET', ARGV[2]..user) == ARGV[1] then
+		redis.call('DEL', ARGV[2]..user)
+	end
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+/**
+基于redis的TableLocator,多个节点共享,进程重启后仍然有效
+{prefix}player:{userId} 玩家所在的tableId
+{prefix}table:{tableId} table中绑定的玩家集合
+*/
+type RedisTableLocator struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+func NewRedisTableLocator(pool *redis.Pool, prefix string) *RedisTableLocator {
+	return &RedisTableLocator{
+		pool:   pool,
+		prefix: prefix,
+	}
+}
+
+func (self *RedisTableLocator) playerKey(userId string) string {
+	return self.prefix + "player:" + userId
+}
+
+func (self *RedisTableLocator) tableKey(tableId string) string {
+	return self.prefix + "table:" + tableId
+}
+
+func (self *RedisTableLocator) Locate(userId string) (string, bool) {
+	conn := self.pool.Get()
+	defer conn.Close()
+	tableId, err := redis.String(conn.Do("GET", self.playerKey(userId)))
+	if err != nil {
+		return "", false
+	}
+	return tableId, true
+}
+
+func (self *RedisTableLocator) Bind(userId string, tableId string) error {
+	conn := self.pool.Get()
+	defer conn.Close()
+	_, err := locatorBindScript.Do(conn, self.playerKey(userId), self.tableKey(tableId), userId, tableId, self.tableKey(""))
+	return err
+}
+
+func (self *RedisTableLocator) Unbind(userId string, tableId string) error {
+	conn := self.pool.Get()
+	defer conn.Close()
+	_, err := locatorUnbindScript.Do(conn, self.playerKey(userId), self.tableKey(tableId), userId, tableId)
+	return err
+}
+
+func (self *RedisTableLocator) UnbindTable(tableId string) error {
+	conn := self.pool.Get()
+	defer conn.Close()
+	_, err := locatorUnbindTableScript.Do(conn, self.tableKey(tableId), tableId, self.playerKey(""))
+	return err
+}
+
+/**
+玩家登录时查询的重连信息
+*/
+type RejoinInfo struct {
+	TableId string
+	Route   string //可以路由到该table的地址,未设置Router时为空
+}
+
+/**
+玩家登录(网关连接)时调用,如果玩家有未结束的table则返回table信息,并自动把新session绑定到原来的座位上
+table在其他节点时只返回路由信息,由客户端到该节点重连,需要设置RoomRouter
+没有可重连的table时返回nil
+*/
+func (self *Room) Rejoin(session gate.Session) (*RejoinInfo, error) {
+	if session.IsGuest() {
+		return nil, nil
+	}
+	tableId, ok := self.opts.Locator.Locate(session.GetUserId())
+	if !ok {
+		return nil, nil
+	}
+	value, ok := self.tables.Load(tableId)
+	if !ok && self.opts.Router != nil {
+		//不能确定table已经结束,保留绑定
+		return &RejoinInfo{TableId: tableId, Route: self.opts.Router(tableId)}, nil
+	}
+	if !ok || !value.(BaseTable).Runing() {
+		self.opts.Locator.Unbind(session.GetUserId(), tableId)
+		return nil, nil
+	}
+	info, err := self.rejoinTable(value.(BaseTable), tableId, session)
+	if ErrorCode(err) == ErrCodeNotSeated {
+		//玩家已经离开,座位可能已经被其他玩家占用
+		self.opts.Locator.Unbind(session.GetUserId(), tableId)
+		return nil, nil
+	}
+	return info, err
+}
+
+/**
+在table协成中把session绑定到原来的座位,玩家已经不在座位上时返回ErrCodeNotSeated
+*/
+func (self *Room) rejoinTable(table BaseTable, tableId string, session gate.Session) (*RejoinInfo, error) {
+	if _, err := self.callTable(table, PrioritySystem, self.opts.RPCTimeout, RejoinQueueFunc, session); err != nil {
+		return nil, err
+	}
+	info := &RejoinInfo{TableId: tableId}
+	if router := table.Options().Router; router != nil {
+		info.Route = router(tableId)
+	}
+	return info, nil
+}
+
+func (self *Room) Locator() TableLocator {
+	return self.opts.Locator
+}
+
+/**
+table内处理重连,把新session绑定到同一个userId的座位上
+*/
+func (this *QTable) onRejoin(session gate.Session, call *tableCall) error {
+	if !call.start() {
+		return nil
+	}
+	defer call.recoverPanic()
+	player := this.FindPlayer(session)
+	if player == nil {
+		err := NewError(ErrCodeNotSeated)
+		call.finish(nil, err)
+		return err
+	}
+	player.Bind(session)
+	//新session还没有table信息
+	this.SyncSession(session, map[string]string{SessionTableId: this.TableId()})
+	if this.opts.RejoinCallback != nil {
+		this.opts.RejoinCallback(this, player)
+	}
+	call.finish(player, nil)
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryTableLocator(t *testing.T) {
+	locator := NewMemoryTableLocator()
+	locator.Bind("u1", "t1")
+	locator.Bind("u2", "t1")
+	locator.Bind("u1", "t2")
+	tableId, _ := locator.Locate("u1")
+	assertEqual(t, tableId, "t2")
+
+	//解除t1不影响已经换到t2的玩家
+	locator.UnbindTable("t1")
+	_, ok := locator.Locate("u2")
+	assertEqual(t, ok, false)
+	tableId, _ = locator.Locate("u1")
+	assertEqual(t, tableId, "t2")
+
+	locator.Unbind("u1", "t1")
+	_, ok = locator.Locate("u1")
+	assertEqual(t, ok, true)
+	locator.Unbind("u1", "t2")
+	_, ok = locator.Locate("u1")
+	assertEqual(t, ok, false)
+}
+
+/**
+在当前协成中执行table消息,直到f返回
+*/
+func pumpTable(table BaseTable, f func()) {
+	done := make(chan bool)
+	go func() {
+		f()
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			table.(*benchTable).ExecuteEvent(nil)
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestRejoin(t *testing.T) {
+	locator := NewMemoryTableLocator()
+	room := NewRoom(nil, Locator(locator))
+	table, err := room.CreateById(nil, "t1", newBenchTable)
+	assertEqual(t, err, nil)
+	table.Run()
+
+	locator.Bind("t1-p0", "t1")
+	var info *RejoinInfo
+	pumpTable(table, func() { info, err = room.Rejoin(NewNullSession("t1-p0")) })
+	assertEqual(t, err, nil)
+	assertEqual(t, info.TableId, "t1")
+
+	//已经不在座位上
+	locator.Bind("u1", "t1")
+	pumpTable(table, func() { info, err = room.Rejoin(NewNullSession("u1")) })
+	assertEqual(t, err, nil)
+	assertEqual(t, info == nil, true)
+	_, ok := locator.Locate("u1")
+	assertEqual(t, ok, false)
+
+	//本节点没有该table,单节点时说明已经结束
+	locator.Bind("u2", "gone")
+	info, err = room.Rejoin(NewNullSession("u2"))
+	assertEqual(t, err, nil)
+	assertEqual(t, info == nil, true)
+	_, ok = locator.Locate("u2")
+	assertEqual(t, ok, false)
+
+	//多节点共享Locator时返回其他节点的路由并保留绑定
+	other := NewRoom(nil, Locator(locator), RoomRouter(func(tableId string) string {
+		return "node-1/" + tableId
+	}))
+	info, err = other.Rejoin(NewNullSession("t1-p0"))
+	assertEqual(t, err, nil)
+	assertEqual(t, info.Route, "node-1/t1")
+	tableId, _ := locator.Locate("t1-p0")
+	assertEqual(t, tableId, "t1")
+}
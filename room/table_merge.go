@@ -0,0 +1,118 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"time"
+)
+
+//合并table的消息在队列中的函数名
+const (
+	MergeOutQueueFunc  = "Room.MergeOut"
+	MergeInQueueFunc   = "Room.MergeIn"
+	MergeDoneQueueFunc = "Room.MergeDone"
+)
+
+/**
+从被合并table导出的玩家和游戏状态
+*/
+type MergeState struct {
+	Players []BasePlayer
+	Data    interface{}
+}
+
+/**
+由游戏实现的合并逻辑
+Export在被合并table的协成中执行,Import在目标table的协成中执行
+*/
+type TableMerger interface {
+	Export(from BaseTable) (*MergeState, error)
+	Import(into BaseTable, state *MergeState) error
+}
+
+/**
+导出成功后暂停table,等待合并结果
+*/
+func (this *QTable) onMergeOut(merger TableMerger, call *tableCall) error {
+	if !call.start() {
+		return nil
+	}
+	defer call.recoverPanic()
+	state, err := merger.Export(this.BaseTableImp.subtable)
+	if err == nil {
+		this.Suspend()
+	}
+	call.finish(state, err)
+	return err
+}
+
+func (this *QTable) onMergeIn(merger TableMerger, state *MergeState, call *tableCall) error {
+	if !call.start() {
+		return nil
+	}
+	defer call.recoverPanic()
+	err := merger.Import(this.BaseTableImp.subtable, state)
+	call.finish(nil, err)
+	return err
+}
+
+/**
+合并成功后结束table,失败时恢复运行
+*/
+func (this *QTable) onMergeDone(merged bool) error {
+	if merged {
+		this.Finish()
+	} else {
+		this.Resume()
+	}
+	return nil
+}
+
+/**
+把fromId的玩家合并到intoId,两个table必须是同一游戏类型
+用于后台把人数不足的table合并,timeout为等待每个table处理的最长时间
+*/
+func (self *Room) MergeTables(fromId string, intoId string, merger TableMerger, timeout time.Duration) error {
+	if fromId == intoId {
+		return fmt.Errorf("cannot merge table %v into itself", fromId)
+	}
+	from := self.GetTable(fromId)
+	into := self.GetTable(intoId)
+	if from == nil || into == nil {
+		return NewError(ErrCodeTableNotFound)
+	}
+	if self.GameType(fromId) != self.GameType(intoId) {
+		return fmt.Errorf("cannot merge %v table %v into %v table %v", self.GameType(fromId), fromId, self.GameType(intoId), intoId)
+	}
+
+	//超时放弃的导出和导入不会再执行
+	result, err := self.callTable(from, PrioritySystem, timeout, MergeOutQueueFunc, merger)
+	if err != nil {
+		return err
+	}
+	state := result.(*MergeState)
+	if _, err := self.callTable(into, PrioritySystem, timeout, MergeInQueueFunc, merger, state); err != nil {
+		putTableQueue(from, PrioritySystem, MergeDoneQueueFunc, false)
+		return err
+	}
+
+	for _, player := range state.Players {
+		if player != nil && player.Session() != nil && !player.Session().IsGuest() {
+			self.opts.Locator.Bind(player.Session().GetUserId(), intoId)
+		}
+	}
+	putTableQueue(from, PrioritySystem, MergeDoneQueueFunc, true)
+	return self.DestroyTable(fromId)
+}
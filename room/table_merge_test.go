@@ -0,0 +1,96 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type testMerger struct {
+	importErr error
+	imported  *MergeState
+}
+
+func (m *testMerger) Export(from BaseTable) (*MergeState, error) {
+	state := &MergeState{Data: from.TableId()}
+	for _, player := range from.(*benchTable).seats {
+		state.Players = append(state.Players, player)
+	}
+	return state, nil
+}
+
+func (m *testMerger) Import(into BaseTable, state *MergeState) error {
+	if m.importErr != nil {
+		return m.importErr
+	}
+	m.imported = state
+	return nil
+}
+
+func mergeTables(room *Room, from BaseTable, into BaseTable, merger TableMerger) (err error) {
+	done := make(chan bool)
+	go func() {
+		err = room.MergeTables(from.TableId(), into.TableId(), merger, time.Second)
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			from.ExecuteEvent(nil)
+			return err
+		default:
+			from.ExecuteEvent(nil)
+			into.ExecuteEvent(nil)
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestMergeRollback(t *testing.T) {
+	room := NewRoom(nil)
+	from, _ := room.CreateById(nil, "t1", newBenchTable)
+	into, _ := room.CreateById(nil, "t2", newBenchTable)
+	from.Run()
+	into.Run()
+	room.Locator().Bind("t1-p0", "t1")
+	merger := &testMerger{importErr: fmt.Errorf("seats full")}
+	assertEqual(t, mergeTables(room, from, into, merger), merger.importErr)
+	//导入失败时被合并的table恢复运行,玩家仍在原来的table
+	assertEqual(t, from.(*benchTable).Paused(), false)
+	assertEqual(t, from.Runing(), true)
+	assertEqual(t, room.GetTable("t1"), from)
+	tableId, _ := room.Locator().Locate("t1-p0")
+	assertEqual(t, tableId, "t1")
+}
+
+func TestMergeTables(t *testing.T) {
+	room := NewRoom(nil)
+	from, _ := room.CreateById(nil, "t1", newBenchTable)
+	into, _ := room.CreateById(nil, "t2", newBenchTable)
+	from.Run()
+	into.Run()
+	assertEqual(t, room.MergeTables("t1", "t1", &testMerger{}, time.Second) != nil, true)
+	assertEqual(t, ErrorCode(room.MergeTables("t1", "t3", &testMerger{}, time.Second)), ErrCodeTableNotFound)
+
+	merger := &testMerger{}
+	assertEqual(t, mergeTables(room, from, into, merger), nil)
+	assertEqual(t, merger.imported.Data, "t1")
+	assertEqual(t, len(merger.imported.Players), 4)
+	assertEqual(t, from.Runing(), false)
+	assertEqual(t, room.GetTable("t1") == nil, true)
+	tableId, _ := room.Locator().Locate("t1-p0")
+	assertEqual(t, tableId, "t2")
+}
@@ -0,0 +1,147 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/**
+按游戏类型注册的table工厂,一个room模块可以同时承载多个游戏
+*/
+type TableRegistry struct {
+	lock      sync.RWMutex
+	factories map[string]NewTableFunc
+}
+
+func NewTableRegistry() *TableRegistry {
+	return &TableRegistry{
+		factories: map[string]NewTableFunc{},
+	}
+}
+
+var defaultRegistry = NewTableRegistry()
+
+/**
+默认的注册表,游戏模块可以在init中注册
+*/
+func DefaultRegistry() *TableRegistry {
+	return defaultRegistry
+}
+
+/**
+注册到默认注册表
+*/
+func RegisterGame(gameType string, newTablefunc NewTableFunc) error {
+	return defaultRegistry.Register(gameType, newTablefunc)
+}
+
+func (self *TableRegistry) Register(gameType string, newTablefunc NewTableFunc) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if _, ok := self.factories[gameType]; ok {
+		return fmt.Errorf("game type %v already registered", gameType)
+	}
+	self.factories[gameType] = newTablefunc
+	return nil
+}
+
+func (self *TableRegistry) Factory(gameType string) (NewTableFunc, bool) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	fn, ok := self.factories[gameType]
+	return fn, ok
+}
+
+/**
+已注册的游戏类型,按名字排序,供大厅展示
+*/
+func (self *TableRegistry) GameTypes() []string {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	types := make([]string, 0, len(self.factories))
+	for gameType := range self.factories {
+		types = append(types, gameType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+/**
+通过注册表创建指定游戏类型的table,已存在时直接返回
+已存在的table不是该游戏类型时返回错误
+*/
+func (self *Room) CreateByType(gameType string, tableId string) (BaseTable, error) {
+	newTablefunc, ok := self.opts.Registry.Factory(gameType)
+	if !ok {
+		return nil, NewError(ErrCodeUnknownGame, gameType)
+	}
+	stored := false
+	if _, exists := self.tables.Load(tableId); exists {
+		if current := self.GameType(tableId); current != gameType {
+			return nil, fmt.Errorf("table %v already exists with game type %q, not %v", tableId, current, gameType)
+		}
+	} else {
+		if err := self.Admit(gameType); err != nil {
+			return nil, err
+		}
+		//先记录类型,EventTableCreated事件中需要
+		current, loaded := self.gameTypes.LoadOrStore(tableId, gameType)
+		if loaded && current.(string) != gameType {
+			return nil, fmt.Errorf("table %v is being created with game type %q, not %v", tableId, current, gameType)
+		}
+		stored = !loaded
+	}
+	table, err := self.CreateById(self.module, tableId, newTablefunc)
+	if err != nil {
+		if stored {
+			self.gameTypes.Delete(tableId)
+		}
+		return nil, err
+	}
+	self.gameTypes.Store(table.TableId(), gameType)
+	return table, nil
+}
+
+/**
+table的游戏类型,不是通过CreateByType创建的返回空
+*/
+func (self *Room) GameType(tableId string) string {
+	if gameType, ok := self.gameTypes.Load(tableId); ok {
+		return gameType.(string)
+	}
+	return ""
+}
+
+/**
+某个游戏类型当前所有的table
+*/
+func (self *Room) TablesByType(gameType string) []BaseTable {
+	tables := []BaseTable{}
+	self.gameTypes.Range(func(key, value interface{}) bool {
+		if value.(string) == gameType {
+			if table, ok := self.tables.Load(key); ok {
+				tables = append(tables, table.(BaseTable))
+			}
+		}
+		return true
+	})
+	return tables
+}
+
+func (self *Room) GameTypes() []string {
+	return self.opts.Registry.GameTypes()
+}
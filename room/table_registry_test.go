@@ -0,0 +1,49 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+)
+
+func TestCreateByType(t *testing.T) {
+	registry := NewTableRegistry()
+	assertEqual(t, registry.Register("texas", newBenchTable), nil)
+	assertEqual(t, registry.Register("omaha", newBenchTable), nil)
+	assertEqual(t, registry.Register("texas", newBenchTable) != nil, true)
+	room := NewRoom(nil, Registry(registry))
+
+	_, err := room.CreateByType("bridge", "t1")
+	assertEqual(t, ErrorCode(err), ErrCodeUnknownGame)
+	assertEqual(t, room.GameType("t1"), "")
+
+	table, err := room.CreateByType("texas", "t1")
+	assertEqual(t, err, nil)
+	again, err := room.CreateByType("texas", "t1")
+	assertEqual(t, err, nil)
+	assertEqual(t, again, table)
+
+	//已存在的table不能换成其他游戏类型
+	_, err = room.CreateByType("omaha", "t1")
+	assertEqual(t, err != nil, true)
+	assertEqual(t, room.GameType("t1"), "texas")
+	assertEqual(t, len(room.TablesByType("omaha")), 0)
+	assertEqual(t, len(room.TablesByType("texas")), 1)
+
+	_, err = room.CreateById(nil, "plain", newBenchTable)
+	assertEqual(t, err, nil)
+	_, err = room.CreateByType("texas", "plain")
+	assertEqual(t, err != nil, true)
+	assertEqual(t, room.GameType("plain"), "")
+}
@@ -0,0 +1,230 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"github.com/liangdas/mqant/gate"
+	"github.com/liangdas/mqant/server"
+)
+
+//通过RPC调用table的消息在队列中的函数名
+const InvokeQueueFunc = "Room.Invoke"
+
+//游戏通过RegisterRPC实现的标准处理函数
+const (
+	JoinRPCFunc  = "Join"
+	LeaveRPCFunc = "Leave"
+	InfoRPCFunc  = "Info"
+)
+
+//Room.RegisterRPC注册的RPC方法
+const (
+	RPCJoinTable       = "JoinTable"
+	RPCLeaveTable      = "LeaveTable"
+	RPCTableInfo       = "TableInfo"
+	RPCInvokeTableFunc = "InvokeTableFunc"
+)
+
+/**
+可以被其他模块通过RPC调用的table函数,在table协成中执行
+*/
+type TableRPCHandler func(session gate.Session, params map[string]interface{}) (map[string]interface{}, error)
+
+/**
+注册可以通过InvokeTableFunc调用的函数,只能在table初始化时调用
+没有注册的函数不能从外部调用
+*/
+func (self *QueueTable) RegisterRPC(id string, f TableRPCHandler) {
+	if self.rpcs == nil {
+		self.rpcs = map[string]TableRPCHandler{}
+	}
+	if _, ok := self.rpcs[id]; ok {
+		panic(fmt.Sprintf("rpc id %v: already registered", id))
+	}
+	self.rpcs[id] = f
+}
+
+func (this *QTable) onInvoke(id string, session gate.Session, params map[string]interface{}, call *tableCall) error {
+	if !call.start() {
+		return nil
+	}
+	defer call.recoverPanic()
+	f, ok := this.rpcs[id]
+	if !ok {
+		call.finish(nil, NewError(ErrCodeStateInvalid))
+		return nil
+	}
+	data, err := f(session, params)
+	call.finish(data, err)
+	return err
+}
+
+/**
+统一的RPC返回结构,成功时Code为0,失败时err为错误描述
+*/
+func rpcResponse(data map[string]interface{}, err error) (map[string]interface{}, string) {
+	if err != nil {
+		code := ErrorCode(err)
+		message := err.Error()
+		if e, ok := err.(*RoomError); ok {
+			message = e.Localize("")
+		}
+		return map[string]interface{}{
+			"Code":    code,
+			"Message": message,
+		}, err.Error()
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"Code": 0,
+		"Data": data,
+	}, ""
+}
+
+/**
+把其他模块的调用放入table队列并等待结果
+*/
+func (self *Room) invoke(tableId string, id string, session gate.Session, params map[string]interface{}) (map[string]interface{}, error) {
+	table := self.GetTable(tableId)
+	if table == nil {
+		return nil, NewError(ErrCodeTableNotFound)
+	}
+	result, err := self.callTable(table, PriorityAction, self.opts.RPCTimeout, InvokeQueueFunc, id, session, params)
+	data, _ := result.(map[string]interface{})
+	return data, err
+}
+
+/**
+玩家进入table前的维护状态,负载和准入规则检查,JoinTable和Backfill共用
+*/
+func (self *Room) checkJoin(tableId string, table interface{}, session gate.Session) error {
+	if self.InMaintenance() {
+		return NewError(ErrCodeMaintenance)
+	}
+	if err := self.Admit(self.GameType(tableId)); err != nil {
+		return err
+	}
+	if acl, ok := table.(interface {
+		CheckJoin(session gate.Session) error
+	}); ok {
+		return acl.CheckJoin(session)
+	}
+	return nil
+}
+
+/**
+加入table,先检查维护状态和准入规则,成功后记录玩家所在的table
+设置了ReconnectTokens时返回数据中附带重连凭证ReconnectTokenKey
+*/
+func (self *Room) JoinTable(session gate.Session, tableId string, params map[string]interface{}) (map[string]interface{}, error) {
+	if self.InMaintenance() {
+		return nil, NewError(ErrCodeMaintenance)
+	}
+	value, ok := self.tables.Load(tableId)
+	if !ok {
+		return nil, NewError(ErrCodeTableNotFound)
+	}
+	if err := self.checkJoin(tableId, value, session); err != nil {
+		return nil, err
+	}
+	data, err := self.invoke(tableId, JoinRPCFunc, session, params)
+	if err != nil {
+		return nil, err
+	}
+	if !session.IsGuest() {
+		self.opts.Locator.Bind(session.GetUserId(), tableId)
+		if self.opts.ReconnectTokens != nil {
+			token, err := self.opts.ReconnectTokens.Issue(session.GetUserId(), tableId)
+			if err != nil {
+				return nil, err
+			}
+			if data == nil {
+				data = map[string]interface{}{}
+			}
+			data[ReconnectTokenKey] = token
+		}
+	}
+	return data, nil
+}
+
+func (self *Room) LeaveTable(session gate.Session, tableId string, params map[string]interface{}) (map[string]interface{}, error) {
+	data, err := self.invoke(tableId, LeaveRPCFunc, session, params)
+	if err != nil {
+		return nil, err
+	}
+	if !session.IsGuest() {
+		self.opts.Locator.Unbind(session.GetUserId(), tableId)
+	}
+	return data, nil
+}
+
+/**
+table的基本信息,游戏注册了InfoRPCFunc时附加在Game中
+*/
+func (self *Room) TableInfo(session gate.Session, tableId string) (map[string]interface{}, error) {
+	value, ok := self.tables.Load(tableId)
+	if !ok {
+		return nil, NewError(ErrCodeTableNotFound)
+	}
+	info := map[string]interface{}{
+		"TableId":  tableId,
+		"GameType": self.GameType(tableId),
+		"Running":  value.(BaseTable).Runing(),
+	}
+	if router := value.(BaseTable).Options().Router; router != nil {
+		info["Route"] = router(tableId)
+	}
+	if value.(BaseTable).Runing() {
+		data, err := self.invoke(tableId, InfoRPCFunc, session, nil)
+		if err == nil {
+			info["Game"] = data
+		} else if ErrorCode(err) != ErrCodeStateInvalid {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+/**
+调用游戏注册的其他函数,Join和Leave只能通过JoinTable和LeaveTable调用,
+否则会跳过维护,准入检查和TableLocator
+*/
+func (self *Room) InvokeTableFunc(session gate.Session, tableId string, id string, params map[string]interface{}) (map[string]interface{}, error) {
+	if id == JoinRPCFunc || id == LeaveRPCFunc {
+		return nil, NewError(ErrCodePermissionDenied)
+	}
+	return self.invoke(tableId, id, session, params)
+}
+
+/**
+在模块的RPC服务上注册标准的table接口,在模块OnInit中调用
+	room.RegisterRPC(self.GetServer())
+*/
+func (self *Room) RegisterRPC(s server.Server) {
+	s.RegisterGO(RPCJoinTable, func(session gate.Session, tableId string, params map[string]interface{}) (map[string]interface{}, string) {
+		return rpcResponse(self.JoinTable(session, tableId, params))
+	})
+	s.RegisterGO(RPCLeaveTable, func(session gate.Session, tableId string, params map[string]interface{}) (map[string]interface{}, string) {
+		return rpcResponse(self.LeaveTable(session, tableId, params))
+	})
+	s.RegisterGO(RPCTableInfo, func(session gate.Session, tableId string) (map[string]interface{}, string) {
+		return rpcResponse(self.TableInfo(session, tableId))
+	})
+	s.RegisterGO(RPCInvokeTableFunc, func(session gate.Session, tableId string, id string, params map[string]interface{}) (map[string]interface{}, string) {
+		return rpcResponse(self.InvokeTableFunc(session, tableId, id, params))
+	})
+}
@@ -0,0 +1,147 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"github.com/liangdas/mqant/log"
+	"time"
+)
+
+/**
+固定频率的模拟循环,用于实时类游戏
+*/
+type TickOptions struct {
+	Rate       int                                     //每秒tick数,例如20
+	MaxCatchUp int                                     //落后时一帧内最多补执行的tick数,超过后丢弃落后的tick,默认5
+	Budget     time.Duration                           //单个tick的耗时预算,0表示不检查
+	OnTick     func(tick int64, dt time.Duration)      //在table协成中执行
+	OnOverrun  func(tick int64, elapsed time.Duration) //单个tick超出Budget时调用
+}
+
+/**
+tick运行统计
+*/
+type TickStats struct {
+	Ticks    int64         //已执行的tick数
+	Skipped  int64         //因为落后太多被丢弃的tick数
+	Overruns int64         //超出预算的tick数
+	Max      time.Duration //单个tick的最大耗时
+	Total    time.Duration //所有tick的总耗时
+}
+
+func (s TickStats) Avg() time.Duration {
+	if s.Ticks == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Ticks)
+}
+
+/**
+按绝对时间安排tick,不会因为帧调度误差累积漂移
+只能在table协成中调用
+*/
+type TickTable struct {
+	tickOpts *TickOptions
+	clock    func() Clock
+	interval time.Duration
+	nextTick time.Time
+	tick     int64
+	stats    TickStats
+}
+
+func (this *TickTable) TickTableInit(clock func() Clock, opts *TickOptions) {
+	this.clock = clock
+	this.tickOpts = opts
+	if opts == nil || opts.Rate <= 0 || opts.OnTick == nil {
+		this.tickOpts = nil
+		return
+	}
+	this.interval = time.Second / time.Duration(opts.Rate)
+	this.nextTick = clock().Now().Add(this.interval)
+}
+
+func (this *TickTable) Ticking() bool {
+	return this.tickOpts != nil
+}
+
+/**
+距离下一个tick的时间,没有设置tick时返回-1
+*/
+func (this *TickTable) NextTickIn() time.Duration {
+	if this.tickOpts == nil {
+		return -1
+	}
+	d := this.nextTick.Sub(this.clock().Now())
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func (this *TickTable) TickStats() TickStats {
+	return this.stats
+}
+
+/**
+【每帧调用】执行所有到期的tick
+*/
+func (this *TickTable) RunTicks() {
+	opts := this.tickOpts
+	if opts == nil {
+		return
+	}
+	now := this.clock().Now()
+	maxCatchUp := opts.MaxCatchUp
+	if maxCatchUp <= 0 {
+		maxCatchUp = 5
+	}
+	behind := int64(now.Sub(this.nextTick)/this.interval) + 1
+	if behind > int64(maxCatchUp) {
+		//落后太多,丢弃多余的tick,从当前时间重新对齐
+		skipped := behind - int64(maxCatchUp)
+		this.stats.Skipped += skipped
+		this.tick += skipped
+		this.nextTick = this.nextTick.Add(time.Duration(skipped) * this.interval)
+	}
+	for !now.Before(this.nextTick) {
+		this.tick++
+		start := time.Now()
+		opts.OnTick(this.tick, this.interval)
+		elapsed := time.Since(start)
+		this.stats.Ticks++
+		this.stats.Total += elapsed
+		if elapsed > this.stats.Max {
+			this.stats.Max = elapsed
+		}
+		if opts.Budget > 0 && elapsed > opts.Budget {
+			this.stats.Overruns++
+			if opts.OnOverrun != nil {
+				opts.OnOverrun(this.tick, elapsed)
+			} else {
+				log.Warning("tick %v took %v, budget %v", this.tick, elapsed, opts.Budget)
+			}
+		}
+		this.nextTick = this.nextTick.Add(this.interval)
+	}
+}
+
+/**
+暂停恢复时把下一个tick顺延d,不补执行暂停期间的tick
+*/
+func (this *TickTable) ShiftTick(d time.Duration) {
+	if this.tickOpts == nil {
+		return
+	}
+	this.nextTick = this.nextTick.Add(d)
+}
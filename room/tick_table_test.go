@@ -0,0 +1,41 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTickTableCatchUp(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(1000, 0))
+	ticks := []int64{}
+	table := &TickTable{}
+	table.TickTableInit(func() Clock { return clock }, &TickOptions{
+		Rate:   10,
+		OnTick: func(tick int64, dt time.Duration) { ticks = append(ticks, tick) },
+	})
+
+	clock.Advance(250 * time.Millisecond)
+	table.RunTicks()
+	assertEqual(t, len(ticks), 2)
+	assertEqual(t, table.NextTickIn(), 50*time.Millisecond)
+
+	clock.Advance(2 * time.Second)
+	table.RunTicks()
+	stats := table.TickStats()
+	assertEqual(t, stats.Ticks, int64(7))
+	assertEqual(t, stats.Skipped, int64(15))
+	assertEqual(t, ticks[len(ticks)-1], int64(22))
+}
@@ -27,10 +27,16 @@ type TimeOutTable struct {
 func (this *TimeOutTable) TimeOutTableInit(subtable SubTable, timeout int64) {
 	this.subtable = subtable
 	this.timeout = timeout
-	this.lastCommunicationDate = time.Now().Unix()
+	this.lastCommunicationDate = this.now().Unix()
+}
+func (this *TimeOutTable) now() time.Time {
+	if clock := this.subtable.Options().Clock; clock != nil {
+		return clock.Now()
+	}
+	return time.Now()
 }
 func (this *TimeOutTable) ResetTimeOut() {
-	this.lastCommunicationDate = time.Now().Unix()
+	this.lastCommunicationDate = this.now().Unix()
 }
 
 /**
@@ -49,7 +55,7 @@ func (this *TimeOutTable) CheckTimeOut() {
 		}
 	}
 	if this.timeout == 0 {
-		if time.Now().Unix() > (this.lastCommunicationDate + this.timeout) {
+		if this.now().Unix() > (this.lastCommunicationDate + this.timeout) {
 			this.subtable.OnTimeOut()
 		}
 	}
@@ -0,0 +1,179 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"time"
+)
+
+/**
+每个游戏自己配置的回合规则
+*/
+type TurnOptions struct {
+	Timeout     time.Duration         //每个回合的操作时间
+	AutoAction  func(playerId string) //超时后替玩家执行的操作,例如过牌,弃牌
+	SitOutAfter int                   //连续自动操作N次后进入暂离,0表示不暂离
+	OnSitOut    func(playerId string) //进入暂离时调用
+	OnTurn      func(playerId string) //轮到某个玩家时调用
+}
+
+/**
+按座位顺序轮流操作,超时自动操作,连续超时的玩家进入暂离并在之后的回合中被跳过
+只能在table协成中调用
+*/
+type TurnTable struct {
+	clock      func() Clock
+	turnOpts   TurnOptions
+	order      []string
+	current    int
+	startedAt  time.Time
+	seq        int64 //每次切换回合加一,用于判断AutoAction中是否已经结束回合
+	autos      map[string]int
+	sittingOut map[string]bool
+	active     bool
+	inAuto     bool //正在执行AutoAction
+}
+
+func (this *TurnTable) TurnTableInit(clock func() Clock) {
+	this.clock = clock
+	this.autos = map[string]int{}
+	this.sittingOut = map[string]bool{}
+	this.active = false
+}
+
+/**
+按order的顺序开始回合,从第一个未暂离的玩家开始
+*/
+func (this *TurnTable) StartTurns(order []string, opts TurnOptions) error {
+	if len(order) == 0 {
+		return fmt.Errorf("no players to take turns")
+	}
+	this.turnOpts = opts
+	this.order = order
+	this.current = -1
+	this.active = true
+	this.advance()
+	return nil
+}
+
+func (this *TurnTable) StopTurns() {
+	this.active = false
+}
+
+/**
+当前回合的玩家,没有进行中的回合时返回空
+*/
+func (this *TurnTable) CurrentTurn() string {
+	if !this.active {
+		return ""
+	}
+	return this.order[this.current]
+}
+
+func (this *TurnTable) TurnRemaining() time.Duration {
+	if !this.active || this.turnOpts.Timeout <= 0 {
+		return 0
+	}
+	remaining := this.turnOpts.Timeout - this.clock().Now().Sub(this.startedAt)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+/**
+玩家操作后调用,进入下一个回合
+玩家主动操作时清零连续自动操作次数,AutoAction中调用时不清零
+*/
+func (this *TurnTable) EndTurn(playerId string) error {
+	if !this.active || this.order[this.current] != playerId {
+		return NewError(ErrCodeStateInvalid)
+	}
+	if !this.inAuto {
+		this.autos[playerId] = 0
+	}
+	this.advance()
+	return nil
+}
+
+/**
+暂离的玩家回来
+*/
+func (this *TurnTable) SitIn(playerId string) {
+	delete(this.sittingOut, playerId)
+	this.autos[playerId] = 0
+}
+
+func (this *TurnTable) IsSittingOut(playerId string) bool {
+	return this.sittingOut[playerId]
+}
+
+/**
+把当前回合的计时向后推迟d,table暂停恢复后调用
+*/
+func (this *TurnTable) ShiftTurn(d time.Duration) {
+	if this.active {
+		this.startedAt = this.startedAt.Add(d)
+	}
+}
+
+/**
+切换到下一个未暂离的玩家,所有玩家都暂离时停止回合
+*/
+func (this *TurnTable) advance() {
+	for i := 1; i <= len(this.order); i++ {
+		next := (this.current + i) % len(this.order)
+		if !this.sittingOut[this.order[next]] {
+			this.current = next
+			this.startedAt = this.clock().Now()
+			this.seq++
+			if this.turnOpts.OnTurn != nil {
+				this.turnOpts.OnTurn(this.order[next])
+			}
+			return
+		}
+	}
+	this.active = false
+}
+
+/**
+【每帧调用】回合超时后替玩家自动操作
+*/
+func (this *TurnTable) CheckTurn() {
+	if !this.active || this.turnOpts.Timeout <= 0 {
+		return
+	}
+	if this.clock().Now().Sub(this.startedAt) < this.turnOpts.Timeout {
+		return
+	}
+	playerId := this.order[this.current]
+	seq := this.seq
+	this.autos[playerId]++
+	if this.turnOpts.AutoAction != nil {
+		this.inAuto = true
+		this.turnOpts.AutoAction(playerId)
+		this.inAuto = false
+	}
+	if this.turnOpts.SitOutAfter > 0 && this.autos[playerId] >= this.turnOpts.SitOutAfter && !this.sittingOut[playerId] {
+		this.sittingOut[playerId] = true
+		if this.turnOpts.OnSitOut != nil {
+			this.turnOpts.OnSitOut(playerId)
+		}
+	}
+	//AutoAction中没有调用EndTurn时由这里结束回合
+	if this.active && this.seq == seq {
+		this.advance()
+	}
+}
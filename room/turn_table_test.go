@@ -0,0 +1,55 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTurnAutoActionSitOut(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(0, 0))
+	turns := &TurnTable{}
+	turns.TurnTableInit(func() Clock { return clock })
+	autos := []string{}
+	sitOut := ""
+	turns.StartTurns([]string{"a", "b"}, TurnOptions{
+		Timeout:     10 * time.Second,
+		SitOutAfter: 2,
+		AutoAction: func(playerId string) {
+			autos = append(autos, playerId)
+			turns.EndTurn(playerId)
+		},
+		OnSitOut: func(playerId string) { sitOut = playerId },
+	})
+
+	assertEqual(t, turns.CurrentTurn(), "a")
+	clock.Advance(10 * time.Second)
+	turns.CheckTurn()
+	assertEqual(t, turns.CurrentTurn(), "b")
+	assertEqual(t, turns.EndTurn("b"), nil)
+
+	clock.Advance(10 * time.Second)
+	turns.CheckTurn()
+	assertEqual(t, sitOut, "a")
+	assertEqual(t, len(autos), 2)
+
+	//a暂离后只剩b
+	assertEqual(t, turns.CurrentTurn(), "b")
+	assertEqual(t, turns.EndTurn("b"), nil)
+	assertEqual(t, turns.CurrentTurn(), "b")
+	turns.SitIn("a")
+	assertEqual(t, turns.EndTurn("b"), nil)
+	assertEqual(t, turns.CurrentTurn(), "a")
+}
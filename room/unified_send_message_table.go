@@ -40,6 +40,9 @@ type TableImp interface {
 type UnifiedSendMessageTable struct {
 	queue_message *queue.EsQueue
 	tableimp      TableImp
+	flow          *FlowControl
+	outboxes      map[string]*playerOutbox //sessionId->发送队列,开启流控时使用
+	chaos         *Chaos
 }
 
 func (this *UnifiedSendMessageTable) UnifiedSendMessageTableInit(tableimp TableImp, Capaciity uint32) {
@@ -49,12 +52,13 @@ func (this *UnifiedSendMessageTable) UnifiedSendMessageTableInit(tableimp TableI
 func (this *UnifiedSendMessageTable) FindPlayer(session gate.Session) BasePlayer {
 	for _, player := range this.tableimp.GetSeats() {
 		if (player != nil) && (player.Session() != nil) {
-			if player.Session().IsGuest() {
-				if player.Session().GetSessionId() == session.GetSessionId() {
+			info := PlayerSession(player)
+			if info.IsGuest() {
+				if info.SessionId() == session.GetSessionId() {
 					return player
 				}
 			} else {
-				if player.Session().GetUserId() == session.GetUserId() {
+				if info.UserId() == session.GetUserId() {
 					return player
 				}
 			}
@@ -125,17 +129,18 @@ func (this *UnifiedSendMessageTable) NotifyCallBackMsgNR(topic string, body []by
 
 /**
 合并玩家所在网关
+机器人session不在任何网关上,不参与合并
 */
 func (this *UnifiedSendMessageTable) mergeGate() map[string][]string {
 	merge := map[string][]string{}
 	for _, role := range this.tableimp.GetSeats() {
 		if role != nil && role.Session() != nil {
-			//未断网
-			if _, ok := merge[role.Session().GetServerId()]; ok {
-				merge[role.Session().GetServerId()] = append(merge[role.Session().GetServerId()], role.Session().GetSessionId())
-			} else {
-				merge[role.Session().GetServerId()] = []string{role.Session().GetSessionId()}
+			if _, ok := role.Session().(*BotSession); ok {
+				continue
 			}
+			//未断网
+			info := PlayerSession(role)
+			merge[info.ServerId()] = append(merge[info.ServerId()], info.SessionId())
 		}
 	}
 	return merge
@@ -154,7 +159,13 @@ func (this *UnifiedSendMessageTable) ExecuteCallBackMsg(span log.TraceSpan) {
 		index++
 		if _ok {
 			msg := val.(*CallBackMsg)
-			if msg.notify {
+			if this.chaos != nil && this.chaos.DropBroadcast() {
+				//故障注入,模拟消息丢失
+				continue
+			}
+			if this.flow != nil {
+				this.flowDispatch(msg)
+			} else if msg.notify {
 				if merge == nil {
 					merge = this.mergeGate()
 				}
@@ -163,6 +174,7 @@ func (this *UnifiedSendMessageTable) ExecuteCallBackMsg(span log.TraceSpan) {
 					server, e := this.tableimp.GetModule().GetApp().GetServerById(serverid)
 					if e != nil {
 						log.Warning("SendBatch error %v", e)
+						continue
 					}
 					if msg.needReply {
 						ctx, _ := context.WithTimeout(context.TODO(), time.Second*3)
@@ -182,6 +194,13 @@ func (this *UnifiedSendMessageTable) ExecuteCallBackMsg(span log.TraceSpan) {
 					}
 
 				}
+				for _, role := range this.tableimp.GetSeats() {
+					if role != nil {
+						if bot, ok := role.Session().(*BotSession); ok {
+							bot.Send(*msg.topic, *msg.body)
+						}
+					}
+				}
 			} else {
 				for _, sessionId := range msg.players {
 					for _, role := range this.tableimp.GetSeats() {
@@ -204,4 +223,7 @@ func (this *UnifiedSendMessageTable) ExecuteCallBackMsg(span log.TraceSpan) {
 		}
 		ok = _ok
 	}
+	if this.flow != nil {
+		this.flushOutboxes()
+	}
 }
@@ -0,0 +1,97 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"github.com/liangdas/mqant/gate"
+	"reflect"
+)
+
+/**
+只处理协议版本在[minVersion,maxVersion]之间的客户端消息,maxVersion为0表示不限上限
+*/
+type versionedHandler struct {
+	minVersion int
+	maxVersion int
+	function   reflect.Value
+}
+
+func (h *versionedHandler) match(version int) bool {
+	return version >= h.minVersion && (h.maxVersion == 0 || version <= h.maxVersion)
+}
+
+func (h *versionedHandler) overlaps(o *versionedHandler) bool {
+	if h.maxVersion != 0 && h.maxVersion < o.minVersion {
+		return false
+	}
+	if o.maxVersion != 0 && o.maxVersion < h.minVersion {
+		return false
+	}
+	return true
+}
+
+/**
+按客户端协议版本注册处理函数,同一个id可以注册多个不重叠的版本区间
+消息的第一个参数为gate.Session时,按session中的CapProtocolVersion选择处理函数
+只能在table初始化时调用
+*/
+func (self *QueueTable) RegisterVersion(id string, minVersion int, maxVersion int, f interface{}) {
+	if _, ok := self.functions[id]; ok {
+		panic(fmt.Sprintf("function id %v: already registered", id))
+	}
+	if maxVersion != 0 && maxVersion < minVersion {
+		panic(fmt.Sprintf("function id %v: invalid version range [%v,%v]", id, minVersion, maxVersion))
+	}
+	if self.versioned == nil {
+		self.versioned = map[string][]*versionedHandler{}
+	}
+	handler := &versionedHandler{
+		minVersion: minVersion,
+		maxVersion: maxVersion,
+		function:   reflect.ValueOf(f),
+	}
+	for _, h := range self.versioned[id] {
+		if h.overlaps(handler) {
+			panic(fmt.Sprintf("function id %v: version range [%v,%v] overlaps [%v,%v]", id, minVersion, maxVersion, h.minVersion, h.maxVersion))
+		}
+	}
+	self.versioned[id] = append(self.versioned[id], handler)
+}
+
+/**
+查找msg对应的处理函数,ok为false表示没有注册
+注册了版本处理函数但客户端版本不匹配时返回ErrCodeUnsupportedVersion
+*/
+func (self *QueueTable) lookup(msg *QueueMsg) (reflect.Value, bool, error) {
+	if function, ok := self.functions[msg.Func]; ok {
+		return function, true, nil
+	}
+	handlers, ok := self.versioned[msg.Func]
+	if !ok {
+		return reflect.Value{}, false, nil
+	}
+	version := 0
+	if len(msg.Params) > 0 {
+		if session, ok := msg.Params[0].(gate.Session); ok {
+			version = ParseCapabilities(session.GetSettings()).ProtocolVersion
+		}
+	}
+	for _, h := range handlers {
+		if h.match(version) {
+			return h.function, true, nil
+		}
+	}
+	return reflect.Value{}, true, NewError(ErrCodeUnsupportedVersion, version)
+}
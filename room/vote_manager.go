@@ -0,0 +1,180 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"fmt"
+	"time"
+)
+
+//投票类型
+const (
+	VoteReady   = "ready"   //准备确认
+	VoteKick    = "kick"    //踢人投票
+	VoteRematch = "rematch" //再来一局
+)
+
+//投票消息在队列中的函数名
+const VoteQueueFunc = "Room.Vote"
+
+type VoteResult struct {
+	VoteId   string
+	Kind     string
+	Options  []string
+	Votes    map[string]string //playerId->option
+	Counts   map[string]int    //option->票数
+	Winner   string            //得票最多的选项,平票或无人投票时为空
+	TimedOut bool              //是否因超时结束
+}
+
+type VoteCallback func(result *VoteResult)
+
+type vote struct {
+	id       string
+	kind     string
+	options  []string
+	voters   map[string]bool
+	votes    map[string]string
+	deadline time.Time
+	callback VoteCallback
+}
+
+/**
+table内的投票管理,所有回调都在table协成中执行
+*/
+type VoteManager struct {
+	table BaseTable
+	clock func() Clock
+	votes map[string]*vote
+	seq   int
+}
+
+func (this *VoteManager) VoteManagerInit(table BaseTable, clock func() Clock) {
+	this.table = table
+	this.clock = clock
+	this.votes = map[string]*vote{}
+	table.Register(VoteQueueFunc, this.onVote)
+}
+
+/**
+发起投票,只能在table协成中调用
+voters 有投票权的玩家,全部投票后立即结束,否则到timeout结束
+*/
+func (this *VoteManager) StartVote(kind string, options []string, voters []string, timeout time.Duration, callback VoteCallback) (string, error) {
+	if len(options) == 0 || len(voters) == 0 {
+		return "", fmt.Errorf("vote %v needs options and voters", kind)
+	}
+	this.seq++
+	v := &vote{
+		id:       fmt.Sprintf("%s-%d", kind, this.seq),
+		kind:     kind,
+		options:  options,
+		voters:   map[string]bool{},
+		votes:    map[string]string{},
+		deadline: this.clock().Now().Add(timeout),
+		callback: callback,
+	}
+	for _, voter := range voters {
+		v.voters[voter] = true
+	}
+	this.votes[v.id] = v
+	return v.id, nil
+}
+
+/**
+协成安全,玩家投票通过队列进入table协成处理
+*/
+func (this *VoteManager) SubmitVote(playerId string, voteId string, option string) error {
+	return putTableQueue(this.table, PrioritySystem, VoteQueueFunc, playerId, voteId, option)
+}
+
+/**
+取消投票,不会触发回调
+*/
+func (this *VoteManager) CancelVote(voteId string) {
+	delete(this.votes, voteId)
+}
+
+func (this *VoteManager) onVote(playerId string, voteId string, option string) error {
+	v, ok := this.votes[voteId]
+	if !ok {
+		return NewError(ErrCodeStateInvalid)
+	}
+	if !v.voters[playerId] {
+		return fmt.Errorf("player %v can not vote in %v", playerId, voteId)
+	}
+	valid := false
+	for _, o := range v.options {
+		if o == option {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return fmt.Errorf("unknown vote option %v", option)
+	}
+	v.votes[playerId] = option
+	if len(v.votes) == len(v.voters) {
+		this.finish(v, false)
+	}
+	return nil
+}
+
+/**
+把所有进行中投票的截止时间推迟d,table暂停恢复后调用
+*/
+func (this *VoteManager) ShiftVotes(d time.Duration) {
+	for _, v := range this.votes {
+		v.deadline = v.deadline.Add(d)
+	}
+}
+
+/**
+【每帧调用】结束已超时的投票
+*/
+func (this *VoteManager) CheckVotes() {
+	now := this.clock().Now()
+	for _, v := range this.votes {
+		if now.After(v.deadline) {
+			this.finish(v, true)
+		}
+	}
+}
+
+func (this *VoteManager) finish(v *vote, timedOut bool) {
+	delete(this.votes, v.id)
+	result := &VoteResult{
+		VoteId:   v.id,
+		Kind:     v.kind,
+		Options:  v.options,
+		Votes:    v.votes,
+		Counts:   map[string]int{},
+		TimedOut: timedOut,
+	}
+	best := 0
+	for _, option := range v.votes {
+		result.Counts[option]++
+	}
+	for option, count := range result.Counts {
+		if count > best {
+			best = count
+			result.Winner = option
+		} else if count == best {
+			result.Winner = ""
+		}
+	}
+	if v.callback != nil {
+		v.callback(result)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func newClockTable(clock Clock) *benchTable {
+	table := &benchTable{seats: map[string]BasePlayer{}}
+	table.OnInit(table,
+		TableId("t1"),
+		Capaciity(64),
+		SendMsgCapaciity(64),
+		RunInterval(time.Hour),
+		SetClock(clock),
+		SetScheduler(benchScheduler, 0, 0),
+	)
+	return table
+}
+
+func TestVoteQuorum(t *testing.T) {
+	table := newClockTable(NewSimulatedClock(time.Unix(100, 0)))
+	results := []*VoteResult{}
+	voteId, err := table.StartVote(VoteRematch, []string{"yes", "no"}, []string{"p1", "p2", "p3"}, 10*time.Second, func(result *VoteResult) {
+		results = append(results, result)
+	})
+	assertEqual(t, err, nil)
+
+	table.SubmitVote("p1", voteId, "yes")
+	table.SubmitVote("p2", voteId, "yes")
+	table.ExecuteEvent(nil)
+	assertEqual(t, len(results), 0)
+	//没有投票权的玩家和未知选项不计票
+	assertEqual(t, table.onVote("p4", voteId, "yes") != nil, true)
+	assertEqual(t, table.onVote("p3", voteId, "maybe") != nil, true)
+	assertEqual(t, len(results), 0)
+
+	table.SubmitVote("p3", voteId, "no")
+	table.ExecuteEvent(nil)
+	assertEqual(t, len(results), 1)
+	assertEqual(t, results[0].TimedOut, false)
+	assertEqual(t, results[0].Winner, "yes")
+	assertEqual(t, results[0].Counts["yes"], 2)
+	assertEqual(t, results[0].Counts["no"], 1)
+	assertEqual(t, ErrorCode(table.onVote("p1", voteId, "yes")), ErrCodeStateInvalid)
+}
+
+func TestVoteExpiry(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(100, 0))
+	table := newClockTable(clock)
+	results := []*VoteResult{}
+	callback := func(result *VoteResult) { results = append(results, result) }
+	voteId, _ := table.StartVote(VoteKick, []string{"kick", "keep"}, []string{"p1", "p2", "p3"}, 10*time.Second, callback)
+	table.onVote("p1", voteId, "kick")
+	table.onVote("p2", voteId, "keep")
+
+	clock.Advance(10 * time.Second)
+	table.CheckVotes()
+	assertEqual(t, len(results), 0)
+
+	clock.Advance(time.Millisecond)
+	table.CheckVotes()
+	assertEqual(t, len(results), 1)
+	assertEqual(t, results[0].TimedOut, true)
+	assertEqual(t, len(results[0].Votes), 2)
+	//平票时没有胜出的选项
+	assertEqual(t, results[0].Winner, "")
+
+	//暂停期间推迟截止时间
+	voteId, _ = table.StartVote(VoteReady, []string{"ready"}, []string{"p1"}, time.Second, callback)
+	table.ShiftVotes(5 * time.Second)
+	clock.Advance(2 * time.Second)
+	table.CheckVotes()
+	assertEqual(t, len(results), 1)
+	table.CancelVote(voteId)
+	clock.Advance(10 * time.Second)
+	table.CheckVotes()
+	assertEqual(t, len(results), 1)
+}
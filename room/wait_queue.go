@@ -0,0 +1,280 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"github.com/liangdas/mqant/gate"
+	"time"
+)
+
+//等待队列的优先级,数值越小越优先
+const (
+	WaitTierVIP       = 0 //VIP玩家
+	WaitTierReturning = 1 //断线后回来的玩家
+	WaitTierNormal    = 2
+	waitTiers         = 3
+)
+
+//默认推送排队位置的topic
+const WaitingTopic = "Room/Waiting"
+
+type WaitQueueOptions struct {
+	//各优先级的出队权重,默认VIP:断线重连:普通为4:2:1
+	//低优先级的玩家也会按权重轮到,不会一直等待
+	Weights [waitTiers]int
+	MaxSize int    //最多等待人数,0表示不限制
+	Topic   string //推送排队位置的topic,默认WaitingTopic
+}
+
+type WaitingPlayer struct {
+	Session gate.Session
+	Tier    int
+	Since   time.Time
+}
+
+/**
+推送给排队玩家的位置信息
+*/
+type WaitNotice struct {
+	Position int //从1开始
+	Tier     int
+	Eta      int64 //预计等待秒数,-1表示还无法估算
+}
+
+/**
+table满员时的等待队列,按优先级加权公平出队
+只能在table协成中调用
+*/
+type WaitQueue struct {
+	waitOpts     WaitQueueOptions
+	waitClock    func() Clock
+	waitSend     func(players []string, topic string, body []byte) error
+	waiting      [waitTiers][]*WaitingPlayer
+	waitCurrent  [waitTiers]int //平滑加权轮询的当前权重
+	waitIndex    map[string]*WaitingPlayer
+	waitInterval time.Duration //出队间隔的滑动平均,用于估算等待时间
+	lastDequeue  time.Time
+	waitDirty    bool
+}
+
+func (this *WaitQueue) WaitQueueInit(opts *WaitQueueOptions, clock func() Clock, send func(players []string, topic string, body []byte) error) {
+	this.waitOpts = WaitQueueOptions{}
+	if opts != nil {
+		this.waitOpts = *opts
+	}
+	if this.waitOpts.Weights == [waitTiers]int{} {
+		this.waitOpts.Weights = [waitTiers]int{4, 2, 1}
+	}
+	if this.waitOpts.Topic == "" {
+		this.waitOpts.Topic = WaitingTopic
+	}
+	this.waitClock = clock
+	this.waitSend = send
+	this.waiting = [waitTiers][]*WaitingPlayer{}
+	this.waitCurrent = [waitTiers]int{}
+	this.waitIndex = map[string]*WaitingPlayer{}
+	this.waitInterval = 0
+	this.lastDequeue = time.Time{}
+}
+
+/**
+加入等待队列,返回当前的排队位置
+已经在队列中时只调整优先级,同一优先级内保持原来的顺序
+*/
+func (this *WaitQueue) JoinWaiting(session gate.Session, tier int) (int, error) {
+	if tier < 0 || tier >= waitTiers {
+		tier = WaitTierNormal
+	}
+	key := dedupKey(session)
+	if player, ok := this.waitIndex[key]; ok {
+		player.Session = session
+		if player.Tier != tier {
+			this.removeWaiting(player)
+			player.Tier = tier
+			this.waiting[tier] = append(this.waiting[tier], player)
+			this.waitIndex[key] = player
+			this.waitDirty = true
+		}
+		return this.WaitingPosition(session), nil
+	}
+	if this.waitOpts.MaxSize > 0 && len(this.waitIndex) >= this.waitOpts.MaxSize {
+		return 0, NewError(ErrCodeTableFull)
+	}
+	player := &WaitingPlayer{
+		Session: session,
+		Tier:    tier,
+		Since:   this.waitClock().Now(),
+	}
+	this.waiting[tier] = append(this.waiting[tier], player)
+	this.waitIndex[key] = player
+	this.waitDirty = true
+	return this.WaitingPosition(session), nil
+}
+
+/**
+玩家放弃排队或断线
+*/
+func (this *WaitQueue) LeaveWaiting(session gate.Session) bool {
+	player, ok := this.waitIndex[dedupKey(session)]
+	if !ok {
+		return false
+	}
+	this.removeWaiting(player)
+	this.waitDirty = true
+	return true
+}
+
+func (this *WaitQueue) removeWaiting(player *WaitingPlayer) {
+	delete(this.waitIndex, dedupKey(player.Session))
+	tier := this.waiting[player.Tier]
+	for i, p := range tier {
+		if p == player {
+			this.waiting[player.Tier] = append(tier[:i], tier[i+1:]...)
+			return
+		}
+	}
+}
+
+/**
+平滑加权轮询,从非空的优先级中选出下一个出队的优先级
+*/
+func (this *WaitQueue) pickTier(current *[waitTiers]int, sizes [waitTiers]int) int {
+	total := 0
+	best := -1
+	for tier := 0; tier < waitTiers; tier++ {
+		if sizes[tier] == 0 {
+			continue
+		}
+		weight := this.waitOpts.Weights[tier]
+		if weight <= 0 {
+			weight = 1
+		}
+		current[tier] += weight
+		total += weight
+		if best < 0 || current[tier] > current[best] {
+			best = tier
+		}
+	}
+	if best >= 0 {
+		current[best] -= total
+	}
+	return best
+}
+
+/**
+有空座位时取出下一个玩家,队列为空时返回nil
+*/
+func (this *WaitQueue) NextWaiting() *WaitingPlayer {
+	sizes := [waitTiers]int{}
+	for tier := range this.waiting {
+		sizes[tier] = len(this.waiting[tier])
+	}
+	tier := this.pickTier(&this.waitCurrent, sizes)
+	if tier < 0 {
+		return nil
+	}
+	player := this.waiting[tier][0]
+	this.waiting[tier] = this.waiting[tier][1:]
+	delete(this.waitIndex, dedupKey(player.Session))
+	now := this.waitClock().Now()
+	if !this.lastDequeue.IsZero() {
+		interval := now.Sub(this.lastDequeue)
+		if this.waitInterval == 0 {
+			this.waitInterval = interval
+		} else {
+			this.waitInterval = (this.waitInterval*3 + interval) / 4
+		}
+	}
+	this.lastDequeue = now
+	this.waitDirty = true
+	return player
+}
+
+/**
+按出队顺序排列的等待玩家
+*/
+func (this *WaitQueue) Waiting() []*WaitingPlayer {
+	current := this.waitCurrent
+	sizes := [waitTiers]int{}
+	heads := [waitTiers]int{}
+	for tier := range this.waiting {
+		sizes[tier] = len(this.waiting[tier])
+	}
+	order := make([]*WaitingPlayer, 0, len(this.waitIndex))
+	for {
+		tier := this.pickTier(&current, sizes)
+		if tier < 0 {
+			return order
+		}
+		order = append(order, this.waiting[tier][heads[tier]])
+		heads[tier]++
+		sizes[tier]--
+	}
+}
+
+/**
+排队位置,从1开始,不在队列中返回0
+*/
+func (this *WaitQueue) WaitingPosition(session gate.Session) int {
+	player, ok := this.waitIndex[dedupKey(session)]
+	if !ok {
+		return 0
+	}
+	for i, p := range this.Waiting() {
+		if p == player {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (this *WaitQueue) WaitingCount() int {
+	return len(this.waitIndex)
+}
+
+/**
+预计等待时间,还没有出队记录时返回-1
+*/
+func (this *WaitQueue) WaitingEta(position int) time.Duration {
+	if this.waitInterval <= 0 {
+		return -1
+	}
+	return time.Duration(position) * this.waitInterval
+}
+
+/**
+【每帧调用】队列有变化时给所有排队玩家推送位置和预计等待时间
+*/
+func (this *WaitQueue) CheckWaiting() {
+	if !this.waitDirty || this.waitSend == nil {
+		return
+	}
+	this.waitDirty = false
+	for i, player := range this.Waiting() {
+		notice := &WaitNotice{
+			Position: i + 1,
+			Tier:     player.Tier,
+			Eta:      -1,
+		}
+		if eta := this.WaitingEta(i + 1); eta >= 0 {
+			notice.Eta = int64(eta / time.Second)
+		}
+		body, err := json.Marshal(notice)
+		if err != nil {
+			continue
+		}
+		this.waitSend([]string{player.Session.GetSessionId()}, this.waitOpts.Topic, body)
+	}
+}
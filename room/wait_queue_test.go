@@ -0,0 +1,67 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWaitQueue(t *testing.T) {
+	clock := NewSimulatedClock(time.Unix(0, 0))
+	notices := map[string]*WaitNotice{}
+	queue := &WaitQueue{}
+	queue.WaitQueueInit(nil, func() Clock { return clock }, func(players []string, topic string, body []byte) error {
+		notice := &WaitNotice{}
+		json.Unmarshal(body, notice)
+		notices[players[0]] = notice
+		return nil
+	})
+	sessions := map[string]*BotSession{}
+	join := func(id string, tier int) {
+		sessions[id] = NewBotSession(id, nil)
+		if _, err := queue.JoinWaiting(sessions[id], tier); err != nil {
+			t.Fatal(err)
+		}
+	}
+	join("v1", WaitTierVIP)
+	join("v2", WaitTierVIP)
+	join("n1", WaitTierNormal)
+	join("v3", WaitTierVIP)
+	join("r1", WaitTierReturning)
+	join("v4", WaitTierVIP)
+	join("r2", WaitTierReturning)
+
+	//权重4:2:1
+	order := ""
+	for _, player := range queue.Waiting() {
+		order += player.Session.GetUserId() + ","
+	}
+	assertEqual(t, order, "v1,r1,v2,n1,v3,r2,v4,")
+	assertEqual(t, queue.WaitingPosition(sessions["n1"]), 4)
+
+	queue.CheckWaiting()
+	assertEqual(t, notices[sessions["n1"].GetSessionId()].Position, 4)
+	assertEqual(t, notices[sessions["n1"].GetSessionId()].Eta, int64(-1))
+
+	assertEqual(t, queue.NextWaiting().Session.GetUserId(), "v1")
+	clock.Advance(10 * time.Second)
+	assertEqual(t, queue.NextWaiting().Session.GetUserId(), "r1")
+	assertEqual(t, queue.LeaveWaiting(sessions["v2"]), true)
+	queue.CheckWaiting()
+	assertEqual(t, notices[sessions["n1"].GetSessionId()].Position, 2)
+	assertEqual(t, notices[sessions["n1"].GetSessionId()].Eta, int64(20))
+	assertEqual(t, queue.WaitingCount(), 4)
+}
@@ -0,0 +1,252 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package room
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/liangdas/mqant/log"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	WebhookTableFinished = "TableFinished" //table结束
+	WebhookSettlement    = "Settlement"    //结算结果
+	WebhookModeration    = "Moderation"    //禁言和举报
+)
+
+/**
+推送给外部系统(BI/CRM)的消息体
+*/
+type WebhookPayload struct {
+	Event   string
+	TableId string
+	Time    int64 //单位毫秒
+	Data    interface{}
+}
+
+type WebhookOption func(*WebhookOptions)
+
+type WebhookOptions struct {
+	URLs     []string
+	Secret   string        //HMAC-SHA256签名密钥,为空则不签名
+	Retries  int           //失败重试次数
+	Backoff  time.Duration //第一次重试间隔,之后每次翻倍
+	Timeout  time.Duration //单次请求超时
+	Capacity int           //待发送队列容量,满了之后丢弃
+	Signer   *ResultSigner //结算结果的ed25519签名器,为空则不签名
+	Clock    Clock         //事件时间和重试间隔使用的时钟,默认RealClock
+}
+
+func WebhookURLs(urls ...string) WebhookOption {
+	return func(o *WebhookOptions) {
+		o.URLs = urls
+	}
+}
+
+func WebhookSecret(v string) WebhookOption {
+	return func(o *WebhookOptions) {
+		o.Secret = v
+	}
+}
+
+func WebhookRetries(v int) WebhookOption {
+	return func(o *WebhookOptions) {
+		o.Retries = v
+	}
+}
+
+func WebhookBackoff(v time.Duration) WebhookOption {
+	return func(o *WebhookOptions) {
+		o.Backoff = v
+	}
+}
+
+func WebhookTimeout(v time.Duration) WebhookOption {
+	return func(o *WebhookOptions) {
+		o.Timeout = v
+	}
+}
+
+func WebhookCapacity(v int) WebhookOption {
+	return func(o *WebhookOptions) {
+		o.Capacity = v
+	}
+}
+
+func WebhookResultSigner(v *ResultSigner) WebhookOption {
+	return func(o *WebhookOptions) {
+		o.Signer = v
+	}
+}
+
+func WebhookClock(v Clock) WebhookOption {
+	return func(o *WebhookOptions) {
+		o.Clock = v
+	}
+}
+
+/**
+把table结束和结算结果以签名后的JSON POST给配置的地址
+发送在独立的协成中完成,不会阻塞table
+*/
+type WebhookPublisher struct {
+	opts    WebhookOptions
+	client  *http.Client
+	pending chan *WebhookPayload
+	closed  chan bool
+}
+
+func NewWebhookPublisher(opts ...WebhookOption) *WebhookPublisher {
+	opt := WebhookOptions{
+		Retries:  3,
+		Backoff:  time.Second,
+		Timeout:  5 * time.Second,
+		Capacity: 1024,
+		Clock:    RealClock,
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	publisher := &WebhookPublisher{
+		opts:    opt,
+		client:  &http.Client{Timeout: opt.Timeout},
+		pending: make(chan *WebhookPayload, opt.Capacity),
+		closed:  make(chan bool),
+	}
+	go publisher.run()
+	return publisher
+}
+
+/**
+协成安全,队列满时返回错误
+*/
+func (self *WebhookPublisher) Publish(event string, tableId string, data interface{}) error {
+	payload := &WebhookPayload{
+		Event:   event,
+		TableId: tableId,
+		Time:    self.opts.Clock.Now().UnixNano() / int64(time.Millisecond),
+		Data:    data,
+	}
+	select {
+	case self.pending <- payload:
+		return nil
+	default:
+		return fmt.Errorf("webhook queue full, drop event %v of table %v", event, tableId)
+	}
+}
+
+/**
+配置了Signer时Data为*SignedResult
+*/
+func (self *WebhookPublisher) PublishSettlement(tableId string, result interface{}) error {
+	if self.opts.Signer != nil {
+		signed, err := self.opts.Signer.Sign(tableId, result)
+		if err != nil {
+			return err
+		}
+		return self.Publish(WebhookSettlement, tableId, signed)
+	}
+	return self.Publish(WebhookSettlement, tableId, result)
+}
+
+/**
+结算签名器,持久化结算结果时应使用同一个签名器
+*/
+func (self *WebhookPublisher) Signer() *ResultSigner {
+	return self.opts.Signer
+}
+
+/**
+停止发送,未发送的消息会被丢弃
+*/
+func (self *WebhookPublisher) Close() {
+	close(self.closed)
+}
+
+/**
+计算body的签名,接收方用同样的密钥校验X-Webhook-Signature
+*/
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (self *WebhookPublisher) run() {
+	for {
+		select {
+		case <-self.closed:
+			return
+		case payload := <-self.pending:
+			body, err := json.Marshal(payload)
+			if err != nil {
+				log.Error("webhook marshal %v error %v", payload.Event, err)
+				continue
+			}
+			for _, url := range self.opts.URLs {
+				self.deliver(url, payload.Event, body)
+			}
+		}
+	}
+}
+
+func (self *WebhookPublisher) deliver(url string, event string, body []byte) {
+	backoff := self.opts.Backoff
+	for i := 0; i <= self.opts.Retries; i++ {
+		err := self.post(url, event, body)
+		if err == nil {
+			return
+		}
+		if i == self.opts.Retries {
+			log.Warning("webhook %v to %v failed after %v retries: %v", event, url, self.opts.Retries, err)
+			return
+		}
+		select {
+		case <-self.closed:
+			return
+		case <-self.opts.Clock.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (self *WebhookPublisher) post(url string, event string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event)
+	if self.opts.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", WebhookSignature(self.opts.Secret, body))
+	}
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %v", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package wallet
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryHold struct {
+	userId string
+	amount int64
+	state  string
+	time   time.Time
+}
+
+/**
+基于内存的钱包,语义与RedisWallet相同,主要用于测试
+*/
+type MemoryWallet struct {
+	lock     sync.Mutex
+	ledger   Ledger
+	now      func() time.Time
+	balances map[string]int64
+	holds    map[string]*memoryHold
+	credits  map[string]bool
+	outbox   []*Entry
+}
+
+/**
+now为nil时使用time.Now
+*/
+func NewMemoryWallet(ledger Ledger, now func() time.Time) *MemoryWallet {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryWallet{
+		ledger:   ledger,
+		now:      now,
+		balances: map[string]int64{},
+		holds:    map[string]*memoryHold{},
+		credits:  map[string]bool{},
+	}
+}
+
+func (self *MemoryWallet) entry(id string, userId string, kind string, amount int64) {
+	self.outbox = append(self.outbox, &Entry{
+		Id:      id + ":" + kind,
+		HoldId:  id,
+		UserId:  userId,
+		Type:    kind,
+		Amount:  amount,
+		Balance: self.balances[userId],
+		Time:    millis(self.now()),
+	})
+}
+
+func (self *MemoryWallet) Reserve(holdId string, userId string, amount int64) error {
+	if amount <= 0 {
+		return fmt.Errorf("invalid reserve amount %v", amount)
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if hold, ok := self.holds[holdId]; ok {
+		if hold.userId != userId || hold.amount != amount {
+			return ErrHoldConflict
+		}
+		if hold.state != EntryReserve {
+			return ErrHoldSettled
+		}
+		return nil
+	}
+	if self.balances[userId] < amount {
+		return ErrInsufficient
+	}
+	self.balances[userId] -= amount
+	self.holds[holdId] = &memoryHold{userId: userId, amount: amount, state: EntryReserve, time: self.now()}
+	self.entry(holdId, userId, EntryReserve, -amount)
+	return nil
+}
+
+func (self *MemoryWallet) finish(holdId string, kind string, payout int64) {
+	hold, ok := self.holds[holdId]
+	if !ok || hold.state != EntryReserve {
+		return
+	}
+	if kind == EntryRollback {
+		payout = hold.amount
+	}
+	hold.state = kind
+	self.balances[hold.userId] += payout
+	self.entry(holdId, hold.userId, kind, payout)
+}
+
+func (self *MemoryWallet) Commit(holdId string, payout int64) error {
+	if payout < 0 {
+		return fmt.Errorf("invalid payout %v", payout)
+	}
+	self.lock.Lock()
+	self.finish(holdId, EntryCommit, payout)
+	self.lock.Unlock()
+	return nil
+}
+
+func (self *MemoryWallet) Rollback(holdId string) error {
+	self.lock.Lock()
+	self.finish(holdId, EntryRollback, 0)
+	self.lock.Unlock()
+	return nil
+}
+
+func (self *MemoryWallet) Credit(txId string, userId string, amount int64) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.credits[txId] {
+		return nil
+	}
+	if self.balances[userId]+amount < 0 {
+		return ErrInsufficient
+	}
+	self.credits[txId] = true
+	self.balances[userId] += amount
+	self.entry(txId, userId, EntryCredit, amount)
+	return nil
+}
+
+func (self *MemoryWallet) Balance(userId string) (int64, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.balances[userId], nil
+}
+
+func (self *MemoryWallet) StaleHolds(before time.Time) ([]string, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	holds := []string{}
+	for holdId, hold := range self.holds {
+		if hold.state == EntryReserve && hold.time.Before(before) {
+			holds = append(holds, holdId)
+		}
+	}
+	sort.Strings(holds)
+	return holds, nil
+}
+
+func (self *MemoryWallet) Flush() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if len(self.outbox) == 0 {
+		return nil
+	}
+	if err := self.ledger.Append(self.outbox); err != nil {
+		return err
+	}
+	self.outbox = nil
+	return nil
+}
+
+/**
+基于内存的Ledger,主要用于测试
+*/
+type MemoryLedger struct {
+	lock    sync.Mutex
+	ids     map[string]bool
+	Entries []*Entry
+}
+
+func NewMemoryLedger() *MemoryLedger {
+	return &MemoryLedger{
+		ids: map[string]bool{},
+	}
+}
+
+func (self *MemoryLedger) Append(entries []*Entry) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, entry := range entries {
+		if self.ids[entry.Id] {
+			continue
+		}
+		self.ids[entry.Id] = true
+		self.Entries = append(self.Entries, entry)
+	}
+	return nil
+}
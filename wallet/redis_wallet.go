@@ -0,0 +1,281 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"github.com/liangdas/mqant/log"
+	"strconv"
+	"time"
+)
+
+//每次从发件箱取出的流水数
+const flushBatch = 100
+
+var reserveScript = redis.NewScript(4, `
+local user = redis.call('HGET', KEYS[2], 'user')
+if user then
+	if user ~= ARGV[2] or redis.call('HGET', KEYS[2], 'amount') ~= ARGV[3] then
+		return -2
+	end
+	if redis.call('HGET', KEYS[2], 'state') ~= 'reserved' then
+		return -3
+	end
+	return 0
+end
+local amount = tonumber(ARGV[3])
+if tonumber(redis.call('GET', KEYS[1]) or '0') < amount then
+	return -1
+end
+local balance = redis.call('DECRBY', KEYS[1], amount)
+redis.call('HMSET', KEYS[2], 'user', ARGV[2], 'amount', ARGV[3], 'state', 'reserved', 'time', ARGV[4])
+redis.call('ZADD', KEYS[3], ARGV[4], ARGV[1])
+redis.call('RPUSH', KEYS[4], cjson.encode({Id=ARGV[1]..':reserve', HoldId=ARGV[1], UserId=ARGV[2], Type='reserve', Amount=-amount, Balance=balance, Time=tonumber(ARGV[4])}))
+return 1
+`)
+
+//ARGV[2]为返还金额,为空时退回冻结金额(Rollback)
+var finishScript = redis.NewScript(4, `
+if redis.call('HGET', KEYS[2], 'state') ~= 'reserved' then
+	return 0
+end
+local kind = 'commit'
+local amount = tonumber(ARGV[2])
+if ARGV[2] == '' then
+	kind = 'rollback'
+	amount = tonumber(redis.call('HGET', KEYS[2], 'amount'))
+end
+local user = redis.call('HGET', KEYS[2], 'user')
+local balance = redis.call('INCRBY', KEYS[1], amount)
+redis.call('HMSET', KEYS[2], 'state', kind, 'payout', amount)
+redis.call('EXPIRE', KEYS[2], ARGV[4])
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('RPUSH', KEYS[4], cjson.encode({Id=ARGV[1]..':'..kind, HoldId=ARGV[1], UserId=user, Type=kind, Amount=amount, Balance=balance, Time=tonumber(ARGV[3])}))
+return 1
+`)
+
+var creditScript = redis.NewScript(3, `
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+local amount = tonumber(ARGV[3])
+if amount < 0 and tonumber(redis.call('GET', KEYS[1]) or '0') + amount < 0 then
+	return -1
+end
+local balance = redis.call('INCRBY', KEYS[1], amount)
+redis.call('SET', KEYS[2], ARGV[3], 'EX', ARGV[5])
+redis.call('RPUSH', KEYS[3], cjson.encode({Id=ARGV[1]..':credit', HoldId=ARGV[1], UserId=ARGV[2], Type='credit', Amount=amount, Balance=balance, Time=tonumber(ARGV[4])}))
+return 1
+`)
+
+var unlockScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+/**
+基于redis的钱包,流水异步写入Ledger
+*/
+type RedisWallet struct {
+	pool   *redis.Pool
+	ledger Ledger
+	ttl    int64 //完成的冻结记录和充值记录保留的时间,单位秒,在此期间重复调用是幂等的
+	kick   chan bool
+	closed chan bool
+}
+
+func NewRedisWallet(pool *redis.Pool, ledger Ledger, ttl int64) *RedisWallet {
+	if ttl <= 0 {
+		ttl = 7 * 24 * 3600
+	}
+	return &RedisWallet{
+		pool:   pool,
+		ledger: ledger,
+		ttl:    ttl,
+		kick:   make(chan bool, 1),
+		closed: make(chan bool),
+	}
+}
+
+func (self *RedisWallet) notify() {
+	select {
+	case self.kick <- true:
+	default:
+	}
+}
+
+func (self *RedisWallet) Reserve(holdId string, userId string, amount int64) error {
+	if amount <= 0 {
+		return fmt.Errorf("invalid reserve amount %v", amount)
+	}
+	conn := self.pool.Get()
+	defer conn.Close()
+	result, err := redis.Int(reserveScript.Do(conn,
+		fmt.Sprintf(BalanceFormat, userId), fmt.Sprintf(HoldFormat, holdId), PendingKey, OutboxKey,
+		holdId, userId, amount, millis(time.Now())))
+	if err != nil {
+		return err
+	}
+	switch result {
+	case -1:
+		return ErrInsufficient
+	case -2:
+		return ErrHoldConflict
+	case -3:
+		return ErrHoldSettled
+	}
+	self.notify()
+	return nil
+}
+
+func (self *RedisWallet) finish(holdId string, payout string) error {
+	conn := self.pool.Get()
+	defer conn.Close()
+	userId, err := redis.String(conn.Do("HGET", fmt.Sprintf(HoldFormat, holdId), "user"))
+	if err == redis.ErrNil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	result, err := redis.Int(finishScript.Do(conn,
+		fmt.Sprintf(BalanceFormat, userId), fmt.Sprintf(HoldFormat, holdId), PendingKey, OutboxKey,
+		holdId, payout, millis(time.Now()), self.ttl))
+	if err != nil {
+		return err
+	}
+	if result == 1 {
+		self.notify()
+	}
+	return nil
+}
+
+func (self *RedisWallet) Commit(holdId string, payout int64) error {
+	if payout < 0 {
+		return fmt.Errorf("invalid payout %v", payout)
+	}
+	return self.finish(holdId, strconv.FormatInt(payout, 10))
+}
+
+func (self *RedisWallet) Rollback(holdId string) error {
+	return self.finish(holdId, "")
+}
+
+/**
+充值(amount为正)或扣除(amount为负),按txId幂等
+*/
+func (self *RedisWallet) Credit(txId string, userId string, amount int64) error {
+	conn := self.pool.Get()
+	defer conn.Close()
+	result, err := redis.Int(creditScript.Do(conn,
+		fmt.Sprintf(BalanceFormat, userId), fmt.Sprintf(CreditFormat, txId), OutboxKey,
+		txId, userId, amount, millis(time.Now()), self.ttl))
+	if err != nil {
+		return err
+	}
+	if result == -1 {
+		return ErrInsufficient
+	}
+	self.notify()
+	return nil
+}
+
+/**
+可用余额,不包括冻结部分
+*/
+func (self *RedisWallet) Balance(userId string) (int64, error) {
+	conn := self.pool.Get()
+	defer conn.Close()
+	balance, err := redis.Int64(conn.Do("GET", fmt.Sprintf(BalanceFormat, userId)))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	return balance, err
+}
+
+func (self *RedisWallet) StaleHolds(before time.Time) ([]string, error) {
+	conn := self.pool.Get()
+	defer conn.Close()
+	return redis.Strings(conn.Do("ZRANGEBYSCORE", PendingKey, "-inf", millis(before)))
+}
+
+/**
+把发件箱中的流水写入Ledger,多个进程同时调用时只有一个会执行
+*/
+func (self *RedisWallet) Flush() error {
+	conn := self.pool.Get()
+	defer conn.Close()
+	token := strconv.FormatInt(time.Now().UnixNano(), 36)
+	ok, err := redis.String(conn.Do("SET", OutboxLockKey, token, "NX", "PX", 30000))
+	if err == redis.ErrNil {
+		return nil
+	}
+	if err != nil || ok != "OK" {
+		return err
+	}
+	defer unlockScript.Do(conn, OutboxLockKey, token)
+	for {
+		values, err := redis.ByteSlices(conn.Do("LRANGE", OutboxKey, 0, flushBatch-1))
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		entries := make([]*Entry, 0, len(values))
+		for _, value := range values {
+			entry := &Entry{}
+			if err := json.Unmarshal(value, entry); err != nil {
+				log.Error("wallet outbox entry %s error %v", value, err)
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		if err := self.ledger.Append(entries); err != nil {
+			return err
+		}
+		if _, err := conn.Do("LTRIM", OutboxKey, len(values), -1); err != nil {
+			return err
+		}
+	}
+}
+
+/**
+后台写入流水,interval为没有新流水时的重试间隔
+*/
+func (self *RedisWallet) Run(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-self.closed:
+				return
+			case <-ticker.C:
+			case <-self.kick:
+			}
+			if err := self.Flush(); err != nil {
+				log.Warning("wallet flush ledger error %v", err)
+			}
+		}
+	}()
+}
+
+func (self *RedisWallet) Close() {
+	close(self.closed)
+}
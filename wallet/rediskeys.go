@@ -0,0 +1,23 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package wallet
+
+var (
+	BalanceFormat = "wallet:balance:%s" //玩家余额 %s=userId
+	HoldFormat    = "wallet:hold:%s"    //冻结记录 %s=holdId
+	CreditFormat  = "wallet:credit:%s"  //已执行的充值/扣除,用于幂等 %s=txId
+	PendingKey    = "wallet:pending"    //未完成的冻结,score为冻结时间(毫秒)
+	OutboxKey     = "wallet:outbox"     //还没有写入Ledger的流水
+	OutboxLockKey = "wallet:outbox:lock"
+)
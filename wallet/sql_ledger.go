@@ -0,0 +1,106 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package wallet
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+/**
+SQLLedger使用的表结构,表名可以修改
+*/
+const LedgerSchema = `CREATE TABLE IF NOT EXISTS %s (
+	id         VARCHAR(160) NOT NULL PRIMARY KEY,
+	hold_id    VARCHAR(128) NOT NULL,
+	user_id    VARCHAR(64)  NOT NULL,
+	type       VARCHAR(16)  NOT NULL,
+	amount     BIGINT       NOT NULL,
+	balance    BIGINT       NOT NULL,
+	created_at BIGINT       NOT NULL
+)`
+
+/**
+基于database/sql的Ledger,语句使用?占位符(MySQL/SQLite)
+驱动由使用方引入
+*/
+type SQLLedger struct {
+	db    *sql.DB
+	table string
+}
+
+func NewSQLLedger(db *sql.DB, table string) *SQLLedger {
+	if table == "" {
+		table = "wallet_ledger"
+	}
+	return &SQLLedger{
+		db:    db,
+		table: table,
+	}
+}
+
+/**
+创建流水表
+*/
+func (self *SQLLedger) Init() error {
+	_, err := self.db.Exec(fmt.Sprintf(LedgerSchema, self.table))
+	return err
+}
+
+/**
+在一个事务中写入,已经存在的流水跳过
+*/
+func (self *SQLLedger) Append(entries []*Entry) error {
+	tx, err := self.db.Begin()
+	if err != nil {
+		return err
+	}
+	exists := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE id = ?", self.table)
+	insert := fmt.Sprintf("INSERT INTO %s (id, hold_id, user_id, type, amount, balance, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)", self.table)
+	for _, entry := range entries {
+		var count int
+		if err := tx.QueryRow(exists, entry.Id).Scan(&count); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if _, err := tx.Exec(insert, entry.Id, entry.HoldId, entry.UserId, entry.Type, entry.Amount, entry.Balance, entry.Time); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+/**
+玩家最近的n条流水,按时间从新到旧
+*/
+func (self *SQLLedger) Recent(userId string, n int) ([]*Entry, error) {
+	rows, err := self.db.Query(fmt.Sprintf("SELECT id, hold_id, user_id, type, amount, balance, created_at FROM %s WHERE user_id = ? ORDER BY created_at DESC LIMIT ?", self.table), userId, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []*Entry{}
+	for rows.Next() {
+		entry := &Entry{}
+		if err := rows.Scan(&entry.Id, &entry.HoldId, &entry.UserId, &entry.Type, &entry.Amount, &entry.Balance, &entry.Time); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
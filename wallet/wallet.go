@@ -0,0 +1,107 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+/**
+钱包的参考实现,满足room.Wallet的两阶段语义
+
+余额和冻结记录保存在redis中,每次变化在同一个lua脚本中写入流水发件箱,
+再由后台协成把流水写入SQL(Ledger),redis不可用时可以用流水恢复余额
+*/
+package wallet
+
+import (
+	"errors"
+	"time"
+)
+
+//流水类型
+const (
+	EntryReserve  = "reserve"
+	EntryCommit   = "commit"
+	EntryRollback = "rollback"
+	EntryCredit   = "credit"
+)
+
+var (
+	ErrInsufficient = errors.New("wallet: insufficient balance")
+	ErrHoldConflict = errors.New("wallet: hold id reused with different user or amount")
+	ErrHoldSettled  = errors.New("wallet: hold already settled")
+)
+
+/**
+一条余额变化流水
+*/
+type Entry struct {
+	Id      string //流水号,Ledger按它去重
+	HoldId  string //充值/扣除时为txId
+	UserId  string
+	Type    string
+	Amount  int64 //余额变化,冻结时为负
+	Balance int64 //变化后的余额
+	Time    int64 //单位毫秒
+}
+
+/**
+流水的持久化,Append必须按Entry.Id幂等
+*/
+type Ledger interface {
+	Append(entries []*Entry) error
+}
+
+/**
+可以对账的钱包
+*/
+type Reconcilable interface {
+	//把还没有写入Ledger的流水写入
+	Flush() error
+	//冻结时间早于before并且还没有Commit/Rollback的holdId
+	StaleHolds(before time.Time) ([]string, error)
+	Rollback(holdId string) error
+}
+
+/**
+对账结果
+*/
+type Report struct {
+	RolledBack []string
+}
+
+/**
+进程启动或定时调用,处理崩溃留下的状态
+1. 把发件箱中的流水写入Ledger
+2. 退回早于before的冻结,这些冻结所属的table已经不存在
+
+必须在room.RecoverEscrow之后调用,已经开始结算的冻结要先按记录结算,
+before应早于最长一局游戏的开始时间
+*/
+func Reconcile(w Reconcilable, before time.Time) (*Report, error) {
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	holds, err := w.StaleHolds(before)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{RolledBack: []string{}}
+	for _, holdId := range holds {
+		if err := w.Rollback(holdId); err != nil {
+			return report, err
+		}
+		report.RolledBack = append(report.RolledBack, holdId)
+	}
+	return report, w.Flush()
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
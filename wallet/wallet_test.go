@@ -0,0 +1,106 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package wallet
+
+import (
+	"github.com/liangdas/mqant-modules/room"
+	"testing"
+	"time"
+)
+
+var _ room.Wallet = &RedisWallet{}
+var _ room.Wallet = &MemoryWallet{}
+
+func TestMemoryWallet(t *testing.T) {
+	now := time.Unix(100, 0)
+	ledger := NewMemoryLedger()
+	w := NewMemoryWallet(ledger, func() time.Time { return now })
+	if err := w.Credit("tx1", "u1", 500); err != nil {
+		t.Fatal(err)
+	}
+	w.Credit("tx1", "u1", 500)
+	if err := w.Reserve("t1:u1", "u1", 1000); err != ErrInsufficient {
+		t.Errorf("Expected ErrInsufficient, got %v", err)
+	}
+	if err := w.Reserve("t1:u1", "u1", 300); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reserve("t1:u1", "u1", 200); err != ErrHoldConflict {
+		t.Errorf("Expected ErrHoldConflict, got %v", err)
+	}
+	if err := w.Reserve("t1:u1", "u1", 300); err != nil {
+		t.Errorf("Expected retried reserve to succeed, got %v", err)
+	}
+	w.Commit("t1:u1", 450)
+	w.Commit("t1:u1", 450)
+	w.Rollback("t1:u1")
+	if err := w.Reserve("t1:u1", "u1", 300); err != ErrHoldSettled {
+		t.Errorf("Expected ErrHoldSettled, got %v", err)
+	}
+	if balance, _ := w.Balance("u1"); balance != 650 {
+		t.Errorf("Expected balance 650, got %v", balance)
+	}
+	w.Flush()
+	if len(ledger.Entries) != 3 {
+		t.Fatalf("Expected 3 ledger entries, got %v", len(ledger.Entries))
+	}
+	last := ledger.Entries[2]
+	if last.Type != EntryCommit || last.Amount != 450 || last.Balance != 650 {
+		t.Errorf("Unexpected commit entry %+v", last)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	now := time.Unix(100, 0)
+	ledger := NewMemoryLedger()
+	w := NewMemoryWallet(ledger, func() time.Time { return now })
+	w.Credit("tx1", "u1", 100)
+	w.Credit("tx2", "u2", 100)
+
+	//崩溃前t1已经开始结算,t2还在进行中
+	journal := room.NewMemoryEscrowJournal()
+	journal.Save(&room.EscrowRecord{
+		TableId: "t1",
+		Holds:   map[string]int64{"u1": 100},
+		Payouts: map[string]int64{"u1": 80},
+	})
+	w.Reserve("t1:u1", "u1", 100)
+	now = now.Add(time.Hour)
+	w.Reserve("t2:u2", "u2", 100)
+
+	if err := room.RecoverEscrow(w, journal); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Reconcile(w, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.RolledBack) != 0 {
+		t.Errorf("Expected no stale holds, got %v", report.RolledBack)
+	}
+	//t2所在的进程崩溃并且没有托管记录
+	report, _ = Reconcile(w, now.Add(time.Minute))
+	if len(report.RolledBack) != 1 || report.RolledBack[0] != "t2:u2" {
+		t.Errorf("Expected t2:u2 rolled back, got %v", report.RolledBack)
+	}
+	if balance, _ := w.Balance("u1"); balance != 80 {
+		t.Errorf("Expected u1 balance 80, got %v", balance)
+	}
+	if balance, _ := w.Balance("u2"); balance != 100 {
+		t.Errorf("Expected u2 balance 100, got %v", balance)
+	}
+	if len(ledger.Entries) != 6 {
+		t.Errorf("Expected 6 ledger entries, got %v", len(ledger.Entries))
+	}
+}